@@ -380,6 +380,25 @@ def execute_create_table(dynamodb_client, input):
         print("Unknown error while creating table: " + error.response['Error']['Message'])
 
 
+# Items with a numeric "ttl" attribute (unix seconds) are removed by DynamoDB
+# once it has passed: trench entries 30 days after their molt, and each
+# crab's sea ranking a day after it was made. TTL can only be turned on once
+# the table is active.
+def execute_enable_ttl(dynamodb_client, table_name):
+    try:
+        dynamodb_client.get_waiter("table_exists").wait(TableName=table_name)
+        dynamodb_client.update_time_to_live(
+            TableName=table_name,
+            TimeToLiveSpecification={
+                "Enabled": True,
+                "AttributeName": "ttl"
+            }
+        )
+        print("Successfully enabled TTL on ttl.")
+    except ClientError as error:
+        handle_error(error)
+
+
 def handle_error(error):
     error_code = error.response['Error']['Code']
     error_message = error.response['Error']['Message']
@@ -402,6 +421,9 @@ def main():
     # Call DynamoDB's create_table API
     execute_create_table(dynamodb_client, create_table_request)
 
+    # Expire items through their ttl attribute
+    execute_enable_ttl(dynamodb_client, create_table_request["TableName"])
+
 
 if __name__ == "__main__":
     main()
@@ -14,6 +14,9 @@ import (
 	w "krabber.net/cmd/web"
 	"krabber.net/internal/models"
 	"krabber.net/internal/models/mailer"
+	"krabber.net/internal/models/memdb"
+	"krabber.net/internal/models/sqldb"
+	"krabber.net/internal/models/storage"
 	_ "krabber.net/internal/models/validator"
 	"log"
 	"net/http"
@@ -23,10 +26,13 @@ import (
 )
 
 type conf struct {
-	port    int
-	env     string
-	crabmin string
-	db      struct {
+	port       int
+	env        string
+	crabmin    string
+	editWindow time.Duration
+	db         struct {
+		driver    string
+		dsn       string
 		tableName string
 		region    string
 		url       string
@@ -43,6 +49,26 @@ type conf struct {
 		burst   int
 		enabled bool
 	}
+	// celebrityFollowers is how many followers stop a crab's molts being
+	// written into trenches, see models.TrenchModel.
+	celebrityFollowers int
+	// seaRefresh is how often the app rebuilds the sea, 0 when cmd/sea
+	// does it instead.
+	seaRefresh time.Duration
+	// ranking weighs each crab's sea, see models.ParseRanking.
+	ranking models.Ranking
+	// suggestRefresh is how often crabs' who to follow suggestions are
+	// worked out again, 0 to never.
+	suggestRefresh time.Duration
+	// storage says where uploads go: driver "disk" keeps them in dir,
+	// anything else in the S3 bucket, handed out with presigned URLs that
+	// last expiry if it is set.
+	storage struct {
+		driver string
+		dir    string
+		bucket string
+		expiry time.Duration
+	}
 	smtp struct {
 		host     string
 		port     int
@@ -58,6 +84,8 @@ func main() {
 	prod := false
 	if !prod {
 		// Environment variables are simpler than SSM..
+		cfg.db.driver = goDotEnvVariable("DB_DRIVER")
+		cfg.db.dsn = goDotEnvVariable("DB_DSN")
 		cfg.db.tableName = goDotEnvVariable("TABLE_NAME")
 		cfg.db.region = goDotEnvVariable("REGION")
 		cfg.db.sac = goDotEnvVariable("DB_SAC")
@@ -72,10 +100,24 @@ func main() {
 		cfg.smtp.password = goDotEnvVariable("SMTP_PASS")
 		cfg.smtp.sender = goDotEnvVariable("SMTP_SEND")
 		cfg.crabmin = goDotEnvVariable("CRABMIN")
+		cfg.editWindow = editWindow(goDotEnvVariable("EDIT_WINDOW"))
+		cfg.celebrityFollowers = celebrityFollowers(goDotEnvVariable("CELEBRITY_FOLLOWERS"))
+		cfg.seaRefresh = interval(goDotEnvVariable("SEA_REFRESH"), 10*time.Minute)
+		cfg.suggestRefresh = interval(goDotEnvVariable("SUGGEST_REFRESH"), time.Hour)
+		cfg.ranking, err = models.ParseRanking(goDotEnvVariable("SEA_RANKING"))
+		if err != nil {
+			log.Fatalf("ERROR reading SEA_RANKING: %v", err)
+		}
+		cfg.storage.driver = goDotEnvVariable("STORAGE")
+		cfg.storage.dir = goDotEnvVariable("MEDIA_DIR")
+		cfg.storage.bucket = goDotEnvVariable("S3")
+		cfg.storage.expiry, _ = time.ParseDuration(goDotEnvVariable("S3_URL_EXPIRY"))
 	}
 
 	if prod {
 
+		cfg.db.driver = os.Getenv("DB_DRIVER")
+		cfg.db.dsn = os.Getenv("DB_DSN")
 		cfg.db.tableName = os.Getenv("TABLE_NAME")
 		cfg.db.region = os.Getenv("REGION")
 		cfg.db.sac = os.Getenv("DB_SAC")
@@ -90,14 +132,27 @@ func main() {
 		cfg.smtp.password = os.Getenv("SMTP_PASS")
 		cfg.smtp.sender = os.Getenv("SMTP_SEND")
 		cfg.crabmin = os.Getenv("CRABMIN")
+		cfg.editWindow = editWindow(os.Getenv("EDIT_WINDOW"))
+		cfg.celebrityFollowers = celebrityFollowers(os.Getenv("CELEBRITY_FOLLOWERS"))
+		cfg.seaRefresh = interval(os.Getenv("SEA_REFRESH"), 10*time.Minute)
+		cfg.suggestRefresh = interval(os.Getenv("SUGGEST_REFRESH"), time.Hour)
+		cfg.ranking, err = models.ParseRanking(os.Getenv("SEA_RANKING"))
+		if err != nil {
+			log.Fatalf("ERROR reading SEA_RANKING: %v", err)
+		}
+		cfg.storage.driver = os.Getenv("STORAGE")
+		cfg.storage.dir = os.Getenv("MEDIA_DIR")
+		cfg.storage.bucket = os.Getenv("S3")
+		cfg.storage.expiry, _ = time.ParseDuration(os.Getenv("S3_URL_EXPIRY"))
 	}
 
 	addr := flag.String("addr", ":5000", "HTTP network address") // default:5000
 	//logger := slog.New(slog.NewTextHandler(os.Stdout, nil))
 
 	svc := newItemService(cfg)
+	store := newStore(cfg)
 	// Initialize a new template cache...
-	templateCache, err := w.NewTemplateCache()
+	templateCache, err := w.NewTemplateCache(store)
 	if err != nil {
 		fmt.Println("ERROR with template cache: ", err)
 		os.Exit(1)
@@ -117,15 +172,22 @@ func main() {
 	// and add it to the application dependencies.
 	app := &w.Application{
 		//Logger:         logger,
-		Molts:          &models.MoltModel{SVC: svc},
-		Comments:       &models.CommentModel{SVC: svc},
-		Crabs:          &models.CrabModel{SVC: svc},
+		Molts:          &models.MoltModel{SVC: svc, Blobs: store, Ranking: cfg.ranking},
+		Crabs:          &models.CrabModel{SVC: svc, Blobs: store},
 		Follows:        &models.FollowModel{SVC: svc},
 		Tokens:         &models.TokenModel{SVC: svc},
-		Trench:         &models.TrenchModel{SVC: svc},
+		Trench:         &models.TrenchModel{SVC: svc, CelebrityFollowers: cfg.celebrityFollowers},
+		FanOuts:        make(chan struct{}, 1),
 		Likes:          &models.LikesModel{SVC: svc},
 		Mailer:         mailer.New(cfg.smtp.host, cfg.smtp.port, cfg.smtp.username, cfg.smtp.password, cfg.smtp.sender),
 		Notifications:  &models.NotificationModel{SVC: svc},
+		Search:         &models.SearchModel{SVC: svc},
+		Tags:           &models.TagModel{SVC: svc},
+		Blocks:         &models.BlockModel{SVC: svc},
+		Mutes:          &models.MuteModel{SVC: svc},
+		Suggestions:    &models.SuggestionModel{SVC: svc},
+		EditWindow:     cfg.editWindow,
+		Storage:        store,
 		TemplateCache:  templateCache,
 		FormDecoder:    formDecoder,
 		SessionManager: sessionManager,
@@ -139,17 +201,70 @@ func main() {
 		WriteTimeout: 10 * time.Second,
 	}
 
+	// molts reach the followers' trenches in the background, see RunFanOut
+	go app.RunFanOut(context.Background(), 5*time.Second)
+	if cfg.seaRefresh > 0 {
+		go app.RunSea(context.Background(), cfg.seaRefresh)
+	}
+	if cfg.suggestRefresh > 0 {
+		go app.RunSuggestions(context.Background(), cfg.suggestRefresh)
+	}
+	// the memory and SQLite stores have no TTL of their own to expire items
+	go app.RunSweep(context.Background(), 10*time.Minute)
+
 	err = srv.ListenAndServe()
 	os.Exit(1)
 }
 
+// newItemService picks the storage backend from DB_DRIVER. "memory" keeps
+// everything in process, which is handy for hacking on the app without an AWS
+// account; "sqlite" stores the table in the SQLite database at DB_DSN for
+// small self-hosted installs; anything else talks to DynamoDB.
 func newItemService(cfg conf) models.ItemService {
+	switch cfg.db.driver {
+	case "memory":
+		return models.ItemService{ItemTable: memdb.New()}
+	case "sqlite":
+		dsn := cfg.db.dsn
+		if dsn == "" {
+			dsn = "file:krabber.db"
+		}
+		db, err := sqldb.Open(dsn)
+		if err != nil {
+			log.Fatalf("ERROR opening sqlite database: %v", err)
+		}
+		return models.ItemService{ItemTable: db}
+	}
 	dt := createLocalClient(cfg)
 	return models.ItemService{
 		ItemTable: dt,
 	}
 }
 
+// newStore picks where uploads are kept from STORAGE. "disk" keeps them in
+// MEDIA_DIR, "media" if that is unset, and serves them at /media; anything
+// else puts them in the S3 bucket. A private bucket needs S3_URL_EXPIRY, a
+// Go duration like "1h", so pages get presigned URLs.
+func newStore(cfg conf) storage.Store {
+	if cfg.storage.driver == "disk" {
+		dir := cfg.storage.dir
+		if dir == "" {
+			dir = "media"
+		}
+		d, err := storage.NewDisk(dir, "/media")
+		if err != nil {
+			log.Fatalf("ERROR opening media directory: %v", err)
+		}
+		return d
+	}
+	s, err := storage.NewS3(cfg.db.region, cfg.db.akid, cfg.db.sac, cfg.storage.bucket)
+	if err != nil {
+		log.Fatalf("ERROR opening S3 bucket: %v", err)
+	}
+	s.Expiry = cfg.storage.expiry
+	return s
+}
+
 func createLocalClient(c conf) *dynamodb.Client {
 	cfg, err := config.LoadDefaultConfig(context.TODO(),
 		config.WithRegion(c.db.region),
@@ -167,6 +282,37 @@ func createLocalClient(c conf) *dynamodb.Client {
 	return dynamodb.NewFromConfig(cfg)
 }
 
+// editWindow reads how long a molt can be edited for, e.g. "15m". Unset or
+// unreadable values fall back to 15 minutes.
+func editWindow(s string) time.Duration {
+	d, err := time.ParseDuration(s)
+	if err != nil || d <= 0 {
+		return 15 * time.Minute
+	}
+	return d
+}
+
+// celebrityFollowers reads how many followers make a crab a celebrity.
+// Unset or unreadable values fall back to 10000; 0 turns it off.
+func celebrityFollowers(s string) int {
+	n, err := strconv.Atoi(s)
+	if err != nil || n < 0 {
+		return 10000
+	}
+	return n
+}
+
+// interval reads how often a background job runs, e.g. "10m". Unset or
+// unreadable values fall back to fallback; 0 turns the job off, as for the
+// sea when cmd/sea runs on a schedule instead.
+func interval(s string, fallback time.Duration) time.Duration {
+	d, err := time.ParseDuration(s)
+	if err != nil || d < 0 {
+		return fallback
+	}
+	return d
+}
+
 // use godot package to load/read the .env file and
 // return the value of the key
 func goDotEnvVariable(key string) string {
@@ -0,0 +1,83 @@
+// Command sea rebuilds the sea's shards and the trending crabtags once and
+// exits. Run it on a schedule (cron, a scheduled ECS task, or wrapped in a
+// Lambda handler around refresh) with SEA_REFRESH=0 set for the web app, so
+// only one of them keeps the sea fresh.
+//
+// It reads the same DB_DRIVER, DB_DSN, REGION, DB_AKID and DB_SAC as the
+// app, from the environment or a .env file.
+package main
+
+import (
+	"context"
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/config"
+	"github.com/aws/aws-sdk-go-v2/credentials"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+	"github.com/joho/godotenv"
+	"krabber.net/internal/models"
+	"krabber.net/internal/models/sqldb"
+	"log"
+	"os"
+	"time"
+)
+
+func main() {
+	// a .env file is optional here, the scheduler may set the environment
+	_ = godotenv.Load(".env")
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Minute)
+	defer cancel()
+	err := refresh(ctx)
+	if err != nil {
+		log.Fatalf("ERROR filling the sea: %v", err)
+	}
+}
+
+// refresh fills the sea and trending in the table the environment points
+// at.
+func refresh(ctx context.Context) error {
+	svc, err := itemService(ctx)
+	if err != nil {
+		return err
+	}
+	err = models.MoltModel{SVC: svc}.FillSea(ctx)
+	if err != nil {
+		return err
+	}
+	_, err = models.TagModel{SVC: svc}.FillTrending(ctx)
+	return err
+}
+
+// itemService opens the table like the app does. The in-memory store is
+// the app's own, so there is nothing here to fill.
+func itemService(ctx context.Context) (models.ItemService, error) {
+	switch os.Getenv("DB_DRIVER") {
+	case "memory":
+		log.Fatal("ERROR DB_DRIVER=memory lives inside the app, set SEA_REFRESH there instead")
+	case "sqlite":
+		dsn := os.Getenv("DB_DSN")
+		if dsn == "" {
+			dsn = "file:krabber.db"
+		}
+		db, err := sqldb.Open(dsn)
+		if err != nil {
+			return models.ItemService{}, err
+		}
+		return models.ItemService{ItemTable: db}, nil
+	}
+	opts := []func(*config.LoadOptions) error{config.WithRegion(os.Getenv("REGION"))}
+	// without keys it takes the role it runs as, as a Lambda would
+	if akid := os.Getenv("DB_AKID"); akid != "" {
+		opts = append(opts, config.WithCredentialsProvider(credentials.StaticCredentialsProvider{
+			Value: aws.Credentials{
+				AccessKeyID:     akid,
+				SecretAccessKey: os.Getenv("DB_SAC"),
+			},
+		}))
+	}
+	cfg, err := config.LoadDefaultConfig(ctx, opts...)
+	if err != nil {
+		return models.ItemService{}, err
+	}
+	return models.ItemService{ItemTable: dynamodb.NewFromConfig(cfg)}, nil
+}
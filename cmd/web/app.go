@@ -6,13 +6,14 @@ import (
 	"html/template"
 	"krabber.net/internal/models"
 	"krabber.net/internal/models/mailer"
+	"krabber.net/internal/models/storage"
 	"sync"
+	"time"
 )
 
 // Define an application struct to hold the application-wide dependencies for the
 // web application.
 type Application struct {
-	Comments       *models.CommentModel
 	Crabs          *models.CrabModel
 	Follows        *models.FollowModel
 	FormDecoder    *form.Decoder
@@ -25,4 +26,15 @@ type Application struct {
 	Trench         *models.TrenchModel
 	Wg             sync.WaitGroup
 	Notifications  *models.NotificationModel
+	Search         *models.SearchModel
+	Tags           *models.TagModel
+	Blocks         *models.BlockModel
+	Mutes          *models.MuteModel
+	Suggestions    *models.SuggestionModel
+	// Storage is where uploaded files are kept.
+	Storage storage.Store
+	// EditWindow is how long after posting a molt can still be edited.
+	EditWindow time.Duration
+	// FanOuts wakes RunFanOut when a molt is queued for the trenches.
+	FanOuts chan struct{}
 }
@@ -0,0 +1,115 @@
+package web
+
+import (
+	"context"
+	"github.com/julienschmidt/httprouter"
+	"krabber.net/internal/models"
+	"net/http"
+)
+
+func (app *Application) blockCreatePost(w http.ResponseWriter, r *http.Request) {
+	id := httprouter.ParamsFromContext(r.Context()).ByName("id")
+	crabID := app.SessionManager.GetString(r.Context(), "authenticatedCrabID")
+	if id == "" || id == crabID {
+		app.NotFound(w)
+		return
+	}
+
+	blocker, err := app.Crabs.ByID(r.Context(), crabID)
+	if err != nil {
+		app.modelError(w, r, err)
+		return
+	}
+	blocked, err := app.Crabs.ByID(r.Context(), id)
+	if err != nil {
+		app.modelError(w, r, err)
+		return
+	}
+
+	err = app.Blocks.Insert(r.Context(), blocker.ID, blocked.ID)
+	if err != nil {
+		app.modelError(w, r, err)
+		return
+	}
+	// a block ends any following in either direction
+	for _, pair := range [][2]*models.Crab{{blocker, blocked}, {blocked, blocker}} {
+		err = app.unfollowIfFollowing(r.Context(), pair[0], pair[1])
+		if err != nil {
+			app.serverError(w, r, err)
+			return
+		}
+	}
+	app.SessionManager.Put(r.Context(), "flash", "Crab blocked.")
+	app.refresh(w, r)
+}
+
+func (app *Application) blockDeletePost(w http.ResponseWriter, r *http.Request) {
+	id := httprouter.ParamsFromContext(r.Context()).ByName("id")
+	if id == "" {
+		app.NotFound(w)
+		return
+	}
+
+	crabID := app.SessionManager.GetString(r.Context(), "authenticatedCrabID")
+	err := app.Blocks.Delete(r.Context(), crabID, id)
+	if err != nil {
+		app.modelError(w, r, err)
+		return
+	}
+	app.SessionManager.Put(r.Context(), "flash", "Crab unblocked.")
+	app.refresh(w, r)
+}
+
+func (app *Application) unfollowIfFollowing(ctx context.Context, follower, followee *models.Crab) error {
+	following, err := app.Follows.Exists(ctx, follower.ID, followee.ID)
+	if err != nil || !following {
+		return err
+	}
+	err = app.Follows.Delete(ctx, follower, followee)
+	if err != nil {
+		return err
+	}
+	app.purge(follower.ID, followee.ID)
+	return nil
+}
+
+// muteCreatePost mutes a crab for the logged in crab. Muting only sinks
+// their molts in the sea, so unlike a block it leaves follows alone.
+func (app *Application) muteCreatePost(w http.ResponseWriter, r *http.Request) {
+	id := httprouter.ParamsFromContext(r.Context()).ByName("id")
+	crabID := app.SessionManager.GetString(r.Context(), "authenticatedCrabID")
+	if id == "" || id == crabID {
+		app.NotFound(w)
+		return
+	}
+
+	muted, err := app.Crabs.ByID(r.Context(), id)
+	if err != nil {
+		app.modelError(w, r, err)
+		return
+	}
+	err = app.Mutes.Insert(r.Context(), crabID, muted.ID)
+	if err != nil {
+		app.modelError(w, r, err)
+		return
+	}
+	app.SessionManager.Put(r.Context(), "flash", "Crab muted.")
+	app.refresh(w, r)
+}
+
+func (app *Application) muteDeletePost(w http.ResponseWriter, r *http.Request) {
+	id := httprouter.ParamsFromContext(r.Context()).ByName("id")
+	if id == "" {
+		app.NotFound(w)
+		return
+	}
+
+	crabID := app.SessionManager.GetString(r.Context(), "authenticatedCrabID")
+	err := app.Mutes.Delete(r.Context(), crabID, id)
+	if err != nil {
+		app.modelError(w, r, err)
+		return
+	}
+	app.SessionManager.Put(r.Context(), "flash", "Crab unmuted.")
+	app.refresh(w, r)
+}
@@ -3,3 +3,5 @@ package web
 type contextKey string
 
 const isAuthenticatedContextKey = contextKey("isAuthenticated")
+
+const hydratorContextKey = contextKey("hydrator")
@@ -3,14 +3,10 @@ package web
 import (
 	"errors"
 	"fmt"
-	"github.com/aws/aws-sdk-go/aws"
-	"github.com/aws/aws-sdk-go/aws/credentials"
-	"github.com/aws/aws-sdk-go/aws/session"
 	"krabber.net/internal/models"
 	"krabber.net/internal/models/validator"
 	"log"
 	"net/http"
-	"os"
 )
 
 type crabActivateForm struct {
@@ -51,6 +47,7 @@ func (app *Application) crabSignupPost(w http.ResponseWriter, r *http.Request) {
 
 	// Validate the form contents using our helper functions.
 	form.CheckField(validator.NotBlank(form.Name), "name", "This field cannot be blank")
+	form.CheckField(models.ValidUserName(form.Name), "name", "This name is not available")
 	form.CheckField(validator.NotBlank(form.Email), "email", "This field cannot be blank")
 	form.CheckField(validator.Matches(form.Email, validator.EmailRX), "email", "This field must be a valid email address")
 	form.CheckField(validator.NotBlank(form.Password), "password", "This field cannot be blank")
@@ -74,20 +71,23 @@ func (app *Application) crabSignupPost(w http.ResponseWriter, r *http.Request) {
 		app.serverError(w, r, err)
 		return
 	}
-	crab, err := app.Crabs.Insert(c)
+	crab, err := app.Crabs.Insert(r.Context(), c)
 	if err != nil {
-		if errors.Is(err, models.ErrDuplicateEmail) {
+		switch {
+		case errors.Is(err, models.ErrDuplicateEmail):
 			form.AddFieldError("email", "Email address is already in use")
-			data := app.NewTemplateData(r)
-			data.Form = form
-			app.Render(w, r, http.StatusUnprocessableEntity, "signup.html", data)
-		} else {
+		case errors.Is(err, models.ErrDuplicateUserName):
+			form.AddFieldError("name", "This name is already taken")
+		default:
 			app.serverError(w, r, err)
+			return
 		}
-
+		data := app.NewTemplateData(r)
+		data.Form = form
+		app.Render(w, r, http.StatusUnprocessableEntity, "signup.html", data)
 		return
 	}
-	token, err := app.Tokens.New(crab, models.ScopeActivation)
+	token, err := app.Tokens.New(r.Context(), crab, models.ScopeActivation)
 	if err != nil {
 		app.serverError(w, r, err)
 		return
@@ -133,24 +133,28 @@ func (app *Application) crabActivatePost(w http.ResponseWriter, r *http.Request)
 		app.Render(w, r, http.StatusUnprocessableEntity, "activate.html", data)
 		return
 	}
-	t, err := app.Tokens.Get(models.ScopeActivation, form.Token)
+	t, err := app.Tokens.Get(r.Context(), models.ScopeActivation, form.Token)
 	if err != nil {
 		switch {
 		case errors.Is(err, models.ErrRecordNotFound):
-			app.serverError(w, r, err)
+			form.AddFieldError("token", "Invalid or expired activation token")
+			data := app.NewTemplateData(r)
+			data.Form = form
+			app.Render(w, r, http.StatusUnprocessableEntity, "activate.html", data)
 		default:
 			app.serverError(w, r, err)
 		}
 		return
 	}
-	crab, err := app.Crabs.ByToken(t)
+	crab, err := app.Crabs.ByToken(r.Context(), t)
 	if err != nil {
-		fmt.Printf("ERROR fetching crab by token %v", err)
+		app.modelError(w, r, err)
+		return
 	}
 	crab.Activated = true
-	err = app.Crabs.Activate(crab)
+	err = app.Crabs.Activate(r.Context(), crab)
 	if err != nil {
-		app.serverError(w, r, err)
+		app.modelError(w, r, err)
 		return
 	}
 	// Otherwise add a confirmation flash message to the session confirming that
@@ -164,38 +168,38 @@ func (app *Application) crabActivatePost(w http.ResponseWriter, r *http.Request)
 
 func (app *Application) crabUpdateAvatar(w http.ResponseWriter, r *http.Request) {
 	crabID := app.SessionManager.GetString(r.Context(), "authenticatedCrabID")
-	c, err := app.Crabs.ByID(crabID)
-	maxSize := int64(1024000) // allow only 1MB of file size
+	c, err := app.Crabs.ByID(r.Context(), crabID)
+	if err != nil {
+		app.modelError(w, r, err)
+		return
+	}
 
-	err = r.ParseMultipartForm(maxSize)
+	r.Body = http.MaxBytesReader(w, r.Body, models.MaxImageSize+1<<20)
+	err = r.ParseMultipartForm(1 << 20)
 	if err != nil {
-		log.Println(err)
-		fmt.Fprintf(w, "Image too large. Max Size: %v", maxSize)
+		app.uploadError(w, err)
 		return
 	}
 
-	file, fileHeader, err := r.FormFile("photofile")
+	file, _, err := r.FormFile("photofile")
 	if err != nil {
 		log.Println(err)
 		fmt.Fprintf(w, "Could not get uploaded file")
 		return
 	}
 	defer file.Close()
-
-	s, err := session.NewSession(&aws.Config{
-		Region: aws.String(os.Getenv("REGION")),
-		Credentials: credentials.NewStaticCredentials(
-			os.Getenv("DB_AKID"),
-			os.Getenv("DB_SAC"),
-			""),
-	})
+	data, err := readUpload(file)
 	if err != nil {
-		fmt.Fprintf(w, "Could not session: %v", err)
+		app.serverError(w, r, err)
+		return
 	}
-	bucketName := os.Getenv("S3")
-	_, err = app.Crabs.UpdateAvatar(c, s, file, fileHeader, bucketName)
-	if err != nil {
-		fmt.Fprintf(w, "Could not update file and crab url: %v", err)
+
+	err = app.Crabs.UpdateAvatar(r.Context(), c, data)
+	if problem := imageProblem(err); problem != "" {
+		app.SessionManager.Put(r.Context(), "flash", problem)
+	} else if err != nil {
+		app.modelError(w, r, err)
+		return
 	}
 
 	// And redirect the crab to the login page.
@@ -235,9 +239,9 @@ func (app *Application) crabLoginPost(w http.ResponseWriter, r *http.Request) {
 
 	// Check whether the credentials are valid. If they're not, add a generic
 	// non-field error message and re-display the login page.
-	crab, err := app.Crabs.ByEmail(form.Email)
+	crab, err := app.Crabs.ByEmail(r.Context(), form.Email)
 	if err != nil {
-		if errors.Is(err, models.ErrInvalidCredentials) {
+		if errors.Is(err, models.ErrNoRecord) {
 			form.AddNonFieldError("Email or password is incorrect")
 			data := app.NewTemplateData(r)
 			data.Form = form
@@ -249,20 +253,20 @@ func (app *Application) crabLoginPost(w http.ResponseWriter, r *http.Request) {
 	}
 	// Check if the provided password matches the actual password for the crab.
 	match, err := models.Equal(form.Password, crab.PasswordHash)
+	if err != nil {
+		app.serverError(w, r, err)
+		return
+	}
 	if !match {
-		if errors.Is(err, models.ErrInvalidCredentials) {
-			form.AddNonFieldError("Email or password is incorrect")
+		form.AddNonFieldError("Email or password is incorrect")
 
-			data := app.NewTemplateData(r)
-			data.Form = form
-			app.Render(w, r, http.StatusUnprocessableEntity, "login.html", data)
-		} else {
-			app.serverError(w, r, err)
-		}
+		data := app.NewTemplateData(r)
+		data.Form = form
+		app.Render(w, r, http.StatusUnprocessableEntity, "login.html", data)
 		return
 	}
 	// add new token to db with 24 hr sessions
-	_, err = app.Tokens.New(crab, models.ScopeAuthentication)
+	_, err = app.Tokens.New(r.Context(), crab, models.ScopeAuthentication)
 	if err != nil {
 		app.serverError(w, r, err)
 		return
@@ -3,6 +3,7 @@ package web
 import (
 	"fmt"
 	"github.com/julienschmidt/httprouter"
+	"krabber.net/internal/models"
 	"net/http"
 )
 
@@ -18,25 +19,36 @@ func (app *Application) followCreatePost(w http.ResponseWriter, r *http.Request)
 	}
 
 	crabID := app.SessionManager.GetString(r.Context(), "authenticatedCrabID")
-	follower, err := app.Crabs.ByID(crabID)
-	//fmt.Println("FOLLOWER: ", follower)
+	follower, err := app.Crabs.ByID(r.Context(), crabID)
 	if err != nil {
-		fmt.Print("Error finding crab by ID for Follower %s", err)
+		app.modelError(w, r, err)
+		return
 	}
 
-	followee, err := app.Crabs.ByID(id)
-	fmt.Println("FOLLOWEE: ", followee)
+	followee, err := app.Crabs.ByID(r.Context(), id)
 	if err != nil {
-		fmt.Print("Error finding crab by ID for Followee %s", err)
+		app.modelError(w, r, err)
+		return
 	}
 
-	res := app.Follows.Insert(follower, followee)
-	if res != nil {
-		fmt.Println("error creating follower relationship ")
+	blocked, err := app.Blocks.Between(r.Context(), follower.ID, followee.ID)
+	if err != nil {
 		app.serverError(w, r, err)
 		return
 	}
+	if blocked {
+		app.clientError(w, http.StatusForbidden)
+		return
+	}
+
+	err = app.Follows.Insert(r.Context(), follower, followee)
+	if err != nil {
+		app.modelError(w, r, err)
+		return
+	}
+	app.backfill(follower, followee)
 	app.SessionManager.Put(r.Context(), "flash", "Follow successfully created!")
+	app.refresh(w, r)
 
 }
 
@@ -50,19 +62,65 @@ func (app *Application) followDeletePost(w http.ResponseWriter, r *http.Request)
 	}
 
 	crabID := app.SessionManager.GetString(r.Context(), "authenticatedCrabID")
-	follower, err := app.Crabs.ByID(crabID)
+	follower, err := app.Crabs.ByID(r.Context(), crabID)
 	if err != nil {
-		fmt.Print("ERR %s", err)
+		app.modelError(w, r, err)
+		return
 	}
-	followee, err := app.Crabs.ByID(id)
+	followee, err := app.Crabs.ByID(r.Context(), id)
 	if err != nil {
-		fmt.Print("ERR %s", err)
+		app.modelError(w, r, err)
+		return
 	}
-	res := app.Follows.Delete(follower, followee)
-	if res != nil {
-		fmt.Println("error deleting follower relationship ")
-		app.serverError(w, r, err)
+	err = app.Follows.Delete(r.Context(), follower, followee)
+	if err != nil {
+		app.modelError(w, r, err)
 		return
 	}
+	app.purge(follower.ID, followee.ID)
 	app.SessionManager.Put(r.Context(), "flash", "Unfollow successfully created!")
+	app.refresh(w, r)
+}
+
+// crabFollows lists the crabs following c, or the crabs c follows, as list
+// says, a page at a time.
+func (app *Application) crabFollows(w http.ResponseWriter, r *http.Request, c *models.Crab, list string) {
+	var (
+		follows []models.Follow
+		next    string
+		err     error
+	)
+	cursor := r.URL.Query().Get("cursor")
+	ids := make([]string, 0, models.PageSize)
+	if list == "followers" {
+		follows, next, err = app.Follows.Followers(r.Context(), c.ID, cursor)
+		for _, f := range follows {
+			ids = append(ids, f.FollowerID())
+		}
+	} else {
+		follows, next, err = app.Follows.Show(r.Context(), c.ID, cursor)
+		for _, f := range follows {
+			ids = append(ids, f.FolloweeID())
+		}
+	}
+	if err != nil {
+		app.modelError(w, r, err)
+		return
+	}
+
+	data := app.NewTemplateData(r)
+	data.Crab = c
+	data.Tab = list
+	data.NextPage = nextPage(r, next)
+	data.Crabs, err = app.hydrator(r).Crabs(r.Context(), ids)
+	if err != nil {
+		app.serverError(w, r, err)
+		return
+	}
+	err = app.hydrator(r).Follows(r.Context(), data.Crabs)
+	if err != nil {
+		app.serverError(w, r, err)
+		return
+	}
+	app.Render(w, r, http.StatusOK, "follows.html", data)
 }
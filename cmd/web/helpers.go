@@ -2,10 +2,14 @@ package web
 
 import (
 	"bytes"
+	"context"
 	"errors"
 	"fmt"
 	"github.com/go-playground/form/v4"
 	"github.com/justinas/nosurf"
+	"io"
+	"krabber.net/internal/models"
+	"mime/multipart"
 	"net/http"
 )
 
@@ -51,6 +55,79 @@ func (app *Application) background(fn func()) {
 	}()
 }
 
+// destroySessions logs a crab out everywhere by destroying every session that
+// belongs to them. The current request's session is renewed and logged out too,
+// since the session middleware would otherwise save it back after the handler.
+func (app *Application) destroySessions(r *http.Request, crabID string) error {
+	err := app.SessionManager.Iterate(r.Context(), func(ctx context.Context) error {
+		if app.SessionManager.GetString(ctx, "authenticatedCrabID") != crabID {
+			return nil
+		}
+		return app.SessionManager.Destroy(ctx)
+	})
+	if err != nil {
+		return err
+	}
+	if app.SessionManager.GetString(r.Context(), "authenticatedCrabID") == crabID {
+		err = app.SessionManager.RenewToken(r.Context())
+		if err != nil {
+			return err
+		}
+		app.SessionManager.Remove(r.Context(), "authenticatedCrabID")
+	}
+	return nil
+}
+
+// nextPage returns the URL of the page after the current one, or "" when
+// there isn't one. Any other query parameters of the request are kept.
+func nextPage(r *http.Request, cursor string) string {
+	if cursor == "" {
+		return ""
+	}
+	u := *r.URL
+	q := u.Query()
+	q.Set("cursor", cursor)
+	u.RawQuery = q.Encode()
+	return u.RequestURI()
+}
+
+// refresh asks htmx to reload the page once a request it sent has finished,
+// so buttons that changed state and the flash message are shown.
+func (app *Application) refresh(w http.ResponseWriter, r *http.Request) {
+	if r.Header.Get("HX-Request") == "true" {
+		w.Header().Set("HX-Refresh", "true")
+	}
+}
+
+// redirect sends the crab to url, by telling htmx to go there when the
+// request came from htmx.
+func (app *Application) redirect(w http.ResponseWriter, r *http.Request, url string) {
+	if r.Header.Get("HX-Request") == "true" {
+		w.Header().Set("HX-Redirect", url)
+		return
+	}
+	http.Redirect(w, r, url, http.StatusSeeOther)
+}
+
+// modelError sends the response that matches an error returned by the models:
+// 404 for a record that doesn't exist, 409 for a write that lost a condition
+// check, 422 for bad credentials, 400 for a cursor that came from a tampered
+// or stale URL, and a 500 for anything else.
+func (app *Application) modelError(w http.ResponseWriter, r *http.Request, err error) {
+	switch {
+	case errors.Is(err, models.ErrNoRecord), errors.Is(err, models.ErrRecordNotFound):
+		app.NotFound(w)
+	case errors.Is(err, models.ErrConflict), errors.Is(err, models.ErrDuplicateEmail), errors.Is(err, models.ErrDuplicateUserName):
+		app.clientError(w, http.StatusConflict)
+	case errors.Is(err, models.ErrInvalidCredentials), errors.Is(err, models.ErrThreadTooDeep):
+		app.clientError(w, http.StatusUnprocessableEntity)
+	case errors.Is(err, models.ErrInvalidCursor):
+		app.clientError(w, http.StatusBadRequest)
+	default:
+		app.serverError(w, r, err)
+	}
+}
+
 // The serverError helper writes a log entry at Error level (including the request
 // method and URI as attributes), then sends a generic 500 Internal Server Error
 // response to the crab.
@@ -85,6 +162,24 @@ func (app *Application) Render(w http.ResponseWriter, r *http.Request, status in
 		return
 	}
 
+	// The trending panel sits beside most pages but nothing else needs it, so
+	// if the cache can't be read the panel is just left empty.
+	if data.Trending == nil {
+		trending, err := app.Tags.Trending(r.Context())
+		if err != nil {
+			fmt.Println("Error: ", err)
+		}
+		data.Trending = trending
+	}
+	// so is who to follow, which is only for crabs who are logged in
+	if data.IsAuthenticated && data.Suggestions == nil {
+		suggestions, err := app.Suggestions.For(r.Context(), data.CrabID, 3)
+		if err != nil {
+			fmt.Println("Error: ", err)
+		}
+		data.Suggestions = suggestions
+	}
+
 	// Initialize a new buffer.
 	buf := new(bytes.Buffer)
 
@@ -137,3 +232,31 @@ func (app *Application) DecodePostForm(r *http.Request, dst any) error {
 
 	return nil
 }
+
+// readUpload reads an uploaded file. It stops one byte past the biggest
+// image models take, which is enough for them to tell it is too big.
+func readUpload(file multipart.File) ([]byte, error) {
+	return io.ReadAll(io.LimitReader(file, models.MaxImageSize+1))
+}
+
+// imageProblem says what was wrong with an uploaded image, in words for the
+// crab, if err is models turning it down. It is empty for other errors.
+func imageProblem(err error) string {
+	switch {
+	case errors.Is(err, models.ErrUnsupportedImage):
+		return "Pictures have to be JPEG, PNG, GIF or WebP images"
+	case errors.Is(err, models.ErrImageTooLarge):
+		return fmt.Sprintf("Pictures cannot be bigger than %dMB or %d megapixels", models.MaxImageSize>>20, models.MaxImagePixels/1_000_000)
+	}
+	return ""
+}
+
+// hydrator is the request's models.Hydrator. Requests that didn't come
+// through the hydration middleware get one of their own.
+func (app *Application) hydrator(r *http.Request) *models.Hydrator {
+	h, ok := r.Context().Value(hydratorContextKey).(*models.Hydrator)
+	if !ok {
+		return models.NewHydrator(app.Molts.SVC, app.SessionManager.GetString(r.Context(), "authenticatedCrabID"))
+	}
+	return h
+}
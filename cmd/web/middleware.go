@@ -4,6 +4,7 @@ import (
 	"context"
 	"fmt"
 	"github.com/justinas/nosurf"
+	"krabber.net/internal/models"
 	"net/http"
 )
 
@@ -106,7 +107,7 @@ func (app *Application) authenticate(next http.Handler) http.Handler {
 
 		// Otherwise, we check to see if a user with that ID exists in our
 		// database.
-		exists, err := app.Crabs.Exists(string(id))
+		exists, err := app.Crabs.Exists(r.Context(), id)
 		if err != nil {
 			app.serverError(w, r, err)
 			return
@@ -125,3 +126,13 @@ func (app *Application) authenticate(next http.Handler) http.Handler {
 		next.ServeHTTP(w, r)
 	})
 }
+
+// hydration gives each request its own models.Hydrator, so all the molts a
+// handler shows share one cache of what has been read.
+func (app *Application) hydration(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		h := models.NewHydrator(app.Molts.SVC, app.SessionManager.GetString(r.Context(), "authenticatedCrabID"))
+		ctx := context.WithValue(r.Context(), hydratorContextKey, h)
+		next.ServeHTTP(w, r.WithContext(ctx))
+	})
+}
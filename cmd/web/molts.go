@@ -5,11 +5,11 @@ import (
 	"fmt"
 	"github.com/google/uuid"
 	"github.com/julienschmidt/httprouter"
-	"html/template"
 	"krabber.net/internal/models"
 	"krabber.net/internal/models/ksuid"
 	"krabber.net/internal/models/validator"
 	"net/http"
+	"strings"
 	"time"
 )
 
@@ -28,11 +28,10 @@ func (app *Application) moltCommonActionsPost(w http.ResponseWriter, r *http.Req
 	}
 
 	form.CheckField(validator.NotBlank(form.Content), "content", "This field cannot be blank")
+	form.CheckField(validator.MaxChars(form.Content, 200), "content", "This field cannot be more than 200 characters long")
 
 	if !form.Valid() {
-		data := app.NewTemplateData(r)
-		data.Form = form
-		app.Render(w, r, http.StatusUnprocessableEntity, "create.html", data)
+		app.createError(w, r, form)
 		return
 	}
 	crabID := app.SessionManager.GetString(r.Context(), "authenticatedCrabID")
@@ -55,94 +54,235 @@ func (app *Application) moltCommonActionsPost(w http.ResponseWriter, r *http.Req
 		Content: form.Content,
 	}
 
-	res := app.Molts.Insert(molt)
-	if res != nil {
-		fmt.Println("error after inserting molt..?")
-		app.serverError(w, r, err)
+	err = app.Molts.Insert(r.Context(), molt)
+	if err != nil {
+		app.modelError(w, r, err)
 		return
 	}
-	// if err == nil then get Followers
-	// then for each follower do writing to their trench
-	Followers := app.Follows.Followers(crabID)
-	if Followers != nil {
-		err := app.Trench.Insert(Followers, molt)
-		fmt.Println("Alerting followers of my molt...")
-		if err != nil {
-			app.serverError(w, r, err)
-		}
-	}
+	// Insert queued it for the followers' trenches
+	app.wakeFanOut()
 	app.SessionManager.Put(r.Context(), "flash", "Molt successfully created!")
-	tmpl := template.Must(template.ParseFiles("public/html/pages/profile.html")) // TODO remove this long af thing
-	tmpl.ExecuteTemplate(w, "molt-list-element", molt)
+	err = app.TemplateCache["profile.html"].ExecuteTemplate(w, "molt-list-element", molt)
+	if err != nil {
+		fmt.Printf("ERROR molt-list-element %v", err)
+	}
 }
 
+// moltLikePost likes the molt, or unlikes it if the crab already has, and
+// sends back the like button as it now stands.
 func (app *Application) moltLikePost(w http.ResponseWriter, r *http.Request) {
 	params := httprouter.ParamsFromContext(r.Context())
 	id := params.ByName("id")
-	fmt.Println("liking", id)
 	if id == "" {
 		app.NotFound(w)
 		return
 	}
-	molt, err := app.Molts.ByID(id)
+	molt, err := app.Molts.ByID(r.Context(), id)
 	if err != nil {
-		app.NotFound(w)
+		app.modelError(w, r, err)
 		return
 	}
-
 	crabID := app.SessionManager.GetString(r.Context(), "authenticatedCrabID")
+	crab, err := app.Crabs.ByID(r.Context(), crabID)
+	if err != nil {
+		app.modelError(w, r, err)
+		return
+	}
 
-	res := app.Likes.Insert(crabID, molt)
-	if res != nil {
-		fmt.Println("error creating a like on the molt")
+	liked, err := app.Likes.Exists(r.Context(), crab.ID, molt.ID)
+	if err != nil {
 		app.serverError(w, r, err)
 		return
 	}
-	app.SessionManager.Put(r.Context(), "flash", "Like successfully created!")
-
+	if liked {
+		err = app.Likes.Delete(r.Context(), crab, molt)
+	} else {
+		err = app.Likes.Insert(r.Context(), crab.ID, molt)
+	}
+	// a double click races itself; the loser just shows how the race ended
+	if err != nil && !errors.Is(err, models.ErrConflict) {
+		app.modelError(w, r, err)
+		return
+	}
+	app.moltButton(w, r, "like-button", molt.ID)
 }
 
+// moltRemoltPost remolts the molt, or undoes the crab's remolt of it if
+// there is one, and sends back the remolt button as it now stands.
 func (app *Application) moltRemoltPost(w http.ResponseWriter, r *http.Request) {
 	params := httprouter.ParamsFromContext(r.Context())
 	id := params.ByName("id")
-	fmt.Println("remolting", id)
 	if id == "" {
 		app.NotFound(w)
 		return
 	}
 	crabID := app.SessionManager.GetString(r.Context(), "authenticatedCrabID")
-	crab, err := app.Crabs.ByID(crabID)
+	crab, err := app.Crabs.ByID(r.Context(), crabID)
 	if err != nil {
-		app.NotFound(w)
+		app.modelError(w, r, err)
+		return
+	}
+	oldMolt, err := app.Molts.ByID(r.Context(), id)
+	if err != nil {
+		app.modelError(w, r, err)
+		return
+	}
+
+	remolted, err := app.Molts.ReMolted(r.Context(), crab.ID, oldMolt.ID)
+	if err != nil {
+		app.serverError(w, r, err)
+		return
+	}
+	if remolted {
+		err = app.Molts.DeleteReMolt(r.Context(), crab, oldMolt)
+	} else {
+		KSUID := ksuid.GenerateKSUID()
+		mid := uuid.New().String()
+		newMolt := &models.Molt{
+			ID:          mid,
+			PK:          fmt.Sprintf("M#%s", crabID), // it is a new molt for the crab doing it
+			SK:          fmt.Sprintf("M#%s#%s", crabID, KSUID),
+			GSI3PK:      fmt.Sprintf("M#%s", time.Now().Format(time.RFC3339)),
+			GSI3SK:      fmt.Sprintf("M#%s", mid),
+			GSI5PK:      fmt.Sprintf("M#%s", mid),
+			GSI5SK:      fmt.Sprintf("M#%s", mid),
+			Author:      oldMolt.Author,  // original author
+			Content:     oldMolt.Content, // original content
+			Mentions:    oldMolt.Mentions,
+			QuoteOf:     oldMolt.QuoteOf,
+			Attachments: oldMolt.Attachments,
+		}
+		err = app.Molts.ReMolt(r.Context(), crab, oldMolt, newMolt)
+	}
+	if err != nil && !errors.Is(err, models.ErrConflict) && !errors.Is(err, models.ErrNoRecord) {
+		app.modelError(w, r, err)
 		return
 	}
-	oldMolt, err := app.Molts.ByID(id)
+	app.moltButton(w, r, "remolt-button", oldMolt.ID)
+}
+
+// moltQuotePost posts a quote of the molt with the crab's own text above
+// it, then sends them to it.
+func (app *Application) moltQuotePost(w http.ResponseWriter, r *http.Request) {
+	var form moltCreateForm
+
+	err := app.DecodePostForm(r, &form)
 	if err != nil {
+		app.clientError(w, http.StatusBadRequest)
+		return
+	}
+	form.CheckField(validator.NotBlank(form.Content), "content", "This field cannot be blank")
+	form.CheckField(validator.MaxChars(form.Content, 200), "content", "This field cannot be more than 200 characters long")
+	if !form.Valid() {
+		app.clientError(w, http.StatusUnprocessableEntity)
+		return
+	}
+
+	id := httprouter.ParamsFromContext(r.Context()).ByName("id")
+	if id == "" {
 		app.NotFound(w)
 		return
 	}
+	original, err := app.Molts.ByID(r.Context(), id)
+	if err != nil {
+		app.modelError(w, r, err)
+		return
+	}
+	// quoting a remolt quotes the molt it copies
+	if original.ReMoltOf != "" {
+		original, err = app.Molts.ByID(r.Context(), original.ReMoltOf)
+		if err != nil {
+			app.modelError(w, r, err)
+			return
+		}
+	}
+
+	crabID := app.SessionManager.GetString(r.Context(), "authenticatedCrabID")
+	c, err := app.Crabs.ByID(r.Context(), crabID)
+	if err != nil {
+		app.modelError(w, r, err)
+		return
+	}
+	blocked, err := app.Blocks.Between(r.Context(), c.ID, original.PK[2:])
+	if err != nil {
+		app.serverError(w, r, err)
+		return
+	}
+	if blocked {
+		app.clientError(w, http.StatusForbidden)
+		return
+	}
+
 	KSUID := ksuid.GenerateKSUID()
 	mid := uuid.New().String()
-	newMolt := &models.Molt{
-		ID:      mid,
-		PK:      fmt.Sprintf("M#%s", crabID), // it is a new molt for the crab doing it
-		SK:      fmt.Sprintf("M#%s#%s", crabID, KSUID),
-		GSI3PK:  fmt.Sprintf("M#%s", time.Now().Format(time.RFC3339)),
-		GSI3SK:  fmt.Sprintf("M#%s", mid),
-		GSI5PK:  fmt.Sprintf("M#%s", mid),
-		GSI5SK:  fmt.Sprintf("M#%s", mid),
-		Author:  oldMolt.Author,  // original author
-		Content: oldMolt.Content, // original content
+	y, mnth, d := time.Now().Date()
+	quote := &models.Molt{
+		ID:            mid,
+		PK:            fmt.Sprintf("M#%s", c.ID),
+		SK:            fmt.Sprintf("M#%s#%s", c.ID, KSUID),
+		GSI3PK:        "M#" + fmt.Sprintf("%d-%d-%d", y, int(mnth), d),
+		GSI3SK:        fmt.Sprintf("M#%s", mid),
+		GSI5PK:        fmt.Sprintf("M#%s", mid),
+		GSI5SK:        fmt.Sprintf("M#%s", mid),
+		Author:        c.UserName,
+		CreatorAvatar: c.AvatarAt(models.ListAvatar),
+		Content:       form.Content,
+	}
+	err = app.Molts.Quote(r.Context(), original, quote)
+	if err != nil {
+		app.modelError(w, r, err)
+		return
 	}
+	app.wakeFanOut()
+	app.SessionManager.Put(r.Context(), "flash", "Quote successfully created!")
+	app.redirect(w, r, fmt.Sprintf("/molt/view/%s", quote.ID))
+}
 
-	res := app.Molts.ReMolt(crab, oldMolt, newMolt)
-	if res != nil {
-		fmt.Println("error creating a remolt on the molt")
+// moltButton renders one of a molt's action buttons from fresh counts, for
+// htmx to swap in over the one that was clicked.
+func (app *Application) moltButton(w http.ResponseWriter, r *http.Request, name, id string) {
+	molt, err := app.Molts.ByID(r.Context(), id)
+	if err != nil {
+		app.modelError(w, r, err)
+		return
+	}
+	molts := []models.Molt{*molt}
+	err = app.pressed(r, molts)
+	if err != nil {
 		app.serverError(w, r, err)
 		return
 	}
-	app.SessionManager.Put(r.Context(), "flash", "Remolt successfully created!")
+	err = app.TemplateCache["profile.html"].ExecuteTemplate(w, name, molts[0])
+	if err != nil {
+		fmt.Printf("ERROR %s %v", name, err)
+	}
+}
 
+// pressedThread marks replies the way pressed does, all the way down.
+func (app *Application) pressedThread(r *http.Request, replies []models.Molt) error {
+	err := app.pressed(r, replies)
+	if err != nil {
+		return err
+	}
+	for i := range replies {
+		err = app.pressedThread(r, replies[i].Replies)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// hydrate fills in what showing molts needs beyond what is stored: the
+// molts quotes embed, their authors as they are now and the state of the
+// logged in crab's buttons.
+func (app *Application) hydrate(r *http.Request, molts []models.Molt) error {
+	return app.hydrator(r).Hydrate(r.Context(), molts)
+}
+
+// pressed marks which of molts the logged in crab has liked or remolted.
+func (app *Application) pressed(r *http.Request, molts []models.Molt) error {
+	return app.hydrator(r).Pressed(r.Context(), molts)
 }
 
 func (app *Application) moltView(w http.ResponseWriter, r *http.Request) {
@@ -152,25 +292,47 @@ func (app *Application) moltView(w http.ResponseWriter, r *http.Request) {
 		app.NotFound(w)
 		return
 	}
-	molt, err := app.Molts.ByID(id)
+	molt, err := app.Molts.ByID(r.Context(), id)
 	if err != nil {
-		if errors.Is(err, models.ErrNoRecord) {
-			app.NotFound(w)
-		} else {
-			app.serverError(w, r, err)
-		}
+		app.modelError(w, r, err)
+		return
+	}
+
+	molts := []models.Molt{*molt}
+	err = app.hydrate(r, molts)
+	if err != nil {
+		app.serverError(w, r, err)
 		return
 	}
 
 	data := app.NewTemplateData(r)
-	data.Molt = *molt
-	comments, err := app.Comments.On(data.Molt.ID)
+	data.Molt = molts[0]
+	if molt.Edited != "" {
+		data.History, _, err = app.Molts.History(r.Context(), molt.ID, "")
+		if err != nil {
+			app.serverError(w, r, err)
+			return
+		}
+	}
+	data.Ancestors, err = app.Molts.Ancestors(r.Context(), molt)
 	if err != nil {
 		app.serverError(w, r, err)
 		return
 	}
-	for _, c := range comments {
-		data.Molt.Comments = append(data.Molt.Comments, c)
+	data.Molt.Replies, err = app.Molts.Replies(r.Context(), molt)
+	if err != nil {
+		app.serverError(w, r, err)
+		return
+	}
+	err = app.hydrate(r, data.Ancestors)
+	if err != nil {
+		app.serverError(w, r, err)
+		return
+	}
+	err = app.pressedThread(r, data.Molt.Replies)
+	if err != nil {
+		app.serverError(w, r, err)
+		return
 	}
 	// if notification then update it here...?
 	// or as fetching notifications mark them all as read
@@ -185,11 +347,12 @@ func (app *Application) moltLikesView(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 	data := app.NewTemplateData(r)
-	likes, err := app.Likes.On(id) // add get string here
+	likes, cursor, err := app.Likes.On(r.Context(), id, r.URL.Query().Get("cursor"))
 	if err != nil {
-		app.serverError(w, r, err)
+		app.modelError(w, r, err)
 		return
 	}
+	data.NextPage = nextPage(r, cursor)
 	for _, l := range likes {
 		data.Likes = append(data.Likes, l)
 	}
@@ -201,28 +364,32 @@ func (app *Application) moltLikesView(w http.ResponseWriter, r *http.Request) {
 func (app *Application) moltCreatePost(w http.ResponseWriter, r *http.Request) {
 	var form moltCreateForm
 
-	err := app.DecodePostForm(r, &form)
+	uploads, err := app.decodeMoltForm(w, r, &form)
 	if err != nil {
-		app.clientError(w, http.StatusBadRequest)
+		app.uploadError(w, err)
 		return
 	}
 
-	form.CheckField(validator.NotBlank(form.Content), "content", "This field cannot be blank")
+	// a molt can be just pictures
+	form.CheckField(validator.NotBlank(form.Content) || len(uploads) > 0, "content", "This field cannot be blank")
+	form.CheckField(validator.MaxChars(form.Content, 200), "content", "This field cannot be more than 200 characters long")
 
 	if !form.Valid() {
-		data := app.NewTemplateData(r)
-		data.Form = form
-		app.Render(w, r, http.StatusUnprocessableEntity, "create.html", data) // redirect oops page?
+		app.createError(w, r, form)
 		return
 	}
 	crabID := app.SessionManager.GetString(r.Context(), "authenticatedCrabID")
 	author := app.SessionManager.GetString(r.Context(), "authenticatedCrabUserName")
 	KSUID := ksuid.GenerateKSUID()
 	id := uuid.New().String()
-	c, err := app.Crabs.ByID(crabID)
-	fmt.Printf("HERE's CRAB BY ID : %v", c)
+	c, err := app.Crabs.ByID(r.Context(), crabID)
 	if err != nil {
-		fmt.Printf("ERROR retrieving crab for molt %v", err)
+		app.modelError(w, r, err)
+		return
+	}
+	attachments, ok := app.attach(w, r, &form, crabID, uploads)
+	if !ok {
+		return
 	}
 	now := time.Now()
 	y, mnth, d := now.Date()
@@ -236,25 +403,19 @@ func (app *Application) moltCreatePost(w http.ResponseWriter, r *http.Request) {
 		GSI5PK:        fmt.Sprintf("M#%s", id),
 		GSI5SK:        fmt.Sprintf("M#%s", id),
 		Author:        author,
-		CreatorAvatar: c.Avatar,
+		CreatorAvatar: c.AvatarAt(models.ListAvatar),
 		Deleted:       false,
 		Content:       form.Content,
+		Attachments:   attachments,
 	}
 
-	res := app.Molts.Insert(molt)
-	if res != nil {
-		fmt.Println("error after inserting molt..?")
-		app.serverError(w, r, err)
+	err = app.Molts.Insert(r.Context(), molt)
+	if err != nil {
+		app.Molts.Detach(r.Context(), attachments)
+		app.modelError(w, r, err)
 		return
 	}
-	Followers := app.Follows.Followers(crabID)
-	if Followers != nil {
-		err := app.Trench.Insert(Followers, molt)
-		fmt.Println("Alerting followers of my molt...")
-		if err != nil {
-			app.serverError(w, r, err)
-		}
-	}
+	app.wakeFanOut()
 	app.SessionManager.Put(r.Context(), "flash", "Molt successfully created!")
 	const p = "profile.html"
 	file := app.TemplateCache[p]
@@ -270,28 +431,32 @@ func (app *Application) moltCreatePost(w http.ResponseWriter, r *http.Request) {
 func (app *Application) moltModalCreatePost(w http.ResponseWriter, r *http.Request) {
 	var form moltCreateForm
 
-	err := app.DecodePostForm(r, &form)
+	uploads, err := app.decodeMoltForm(w, r, &form)
 	if err != nil {
-		app.clientError(w, http.StatusBadRequest)
+		app.uploadError(w, err)
 		return
 	}
 
-	form.CheckField(validator.NotBlank(form.Content), "content", "This field cannot be blank")
+	// a molt can be just pictures
+	form.CheckField(validator.NotBlank(form.Content) || len(uploads) > 0, "content", "This field cannot be blank")
+	form.CheckField(validator.MaxChars(form.Content, 200), "content", "This field cannot be more than 200 characters long")
 
 	if !form.Valid() {
-		data := app.NewTemplateData(r)
-		data.Form = form
-		app.Render(w, r, http.StatusUnprocessableEntity, "create.html", data) // redirect oops page?
+		app.createError(w, r, form)
 		return
 	}
 	crabID := app.SessionManager.GetString(r.Context(), "authenticatedCrabID")
 	author := app.SessionManager.GetString(r.Context(), "authenticatedCrabUserName")
 	KSUID := ksuid.GenerateKSUID()
 	id := uuid.New().String()
-	c, err := app.Crabs.ByID(crabID)
-	fmt.Printf("HERE's CRAB BY ID : %v", c)
+	c, err := app.Crabs.ByID(r.Context(), crabID)
 	if err != nil {
-		fmt.Printf("ERROR retrieving crab for molt %v", err)
+		app.modelError(w, r, err)
+		return
+	}
+	attachments, ok := app.attach(w, r, &form, crabID, uploads)
+	if !ok {
+		return
 	}
 
 	now := time.Now()
@@ -306,25 +471,19 @@ func (app *Application) moltModalCreatePost(w http.ResponseWriter, r *http.Reque
 		GSI5PK:        fmt.Sprintf("M#%s", id),
 		GSI5SK:        fmt.Sprintf("M#%s", id),
 		Author:        author,
-		CreatorAvatar: c.Avatar,
+		CreatorAvatar: c.AvatarAt(models.ListAvatar),
 		Deleted:       false,
 		Content:       form.Content,
+		Attachments:   attachments,
 	}
 
-	res := app.Molts.Insert(molt)
-	if res != nil {
-		fmt.Println("error after inserting molt..?")
-		app.serverError(w, r, err)
+	err = app.Molts.Insert(r.Context(), molt)
+	if err != nil {
+		app.Molts.Detach(r.Context(), attachments)
+		app.modelError(w, r, err)
 		return
 	}
-	Followers := app.Follows.Followers(crabID)
-	if Followers != nil {
-		err := app.Trench.Insert(Followers, molt)
-		fmt.Println("Alerting followers of my molt...")
-		if err != nil {
-			app.serverError(w, r, err)
-		}
-	}
+	app.wakeFanOut()
 	app.SessionManager.Put(r.Context(), "flash", "Molt successfully created!")
 	const moltinTime = "nav.html"
 	file := app.TemplateCache[moltinTime]
@@ -336,3 +495,166 @@ func (app *Application) moltModalCreatePost(w http.ResponseWriter, r *http.Reque
 		fmt.Printf("ERROR exampleModal %v", err)
 	}
 }
+
+// maxMoltBody is the most a posted molt can be: its pictures and a bit for
+// everything else.
+const maxMoltBody = models.MaxAttachments*models.MaxImageSize + 1<<20
+
+// decodeMoltForm decodes a molt being posted, plain or with pictures. The
+// pictures come in as attachment0 to attachment3, each described by the
+// matching alt0 to alt3.
+func (app *Application) decodeMoltForm(w http.ResponseWriter, r *http.Request, form *moltCreateForm) ([]models.Upload, error) {
+	r.Body = http.MaxBytesReader(w, r.Body, maxMoltBody)
+	err := r.ParseMultipartForm(1 << 20)
+	if err != nil && !errors.Is(err, http.ErrNotMultipart) {
+		return nil, err
+	}
+	err = app.DecodePostForm(r, form)
+	if err != nil {
+		return nil, err
+	}
+	uploads := make([]models.Upload, 0)
+	if r.MultipartForm == nil {
+		return uploads, nil
+	}
+	for i := 0; i < models.MaxAttachments; i++ {
+		files := r.MultipartForm.File[fmt.Sprintf("attachment%d", i)]
+		if len(files) == 0 {
+			continue
+		}
+		file, err := files[0].Open()
+		if err != nil {
+			return nil, err
+		}
+		data, err := readUpload(file)
+		file.Close()
+		if err != nil {
+			return nil, err
+		}
+		alt := strings.TrimSpace(r.PostForm.Get(fmt.Sprintf("alt%d", i)))
+		form.CheckField(validator.MaxChars(alt, models.MaxAltText), "alt", fmt.Sprintf("Image descriptions cannot be more than %d characters long", models.MaxAltText))
+		uploads = append(uploads, models.Upload{Data: data, Alt: alt})
+	}
+	return uploads, nil
+}
+
+// uploadError answers a molt post decodeMoltForm couldn't read.
+func (app *Application) uploadError(w http.ResponseWriter, err error) {
+	var tooBig *http.MaxBytesError
+	if errors.As(err, &tooBig) {
+		app.clientError(w, http.StatusRequestEntityTooLarge)
+		return
+	}
+	app.clientError(w, http.StatusBadRequest)
+}
+
+// attach stores the pictures posted with a molt. It returns false once it
+// has answered the request: pictures we don't take go back to the crab as an
+// error on the form, like a bad avatar or banner does.
+func (app *Application) attach(w http.ResponseWriter, r *http.Request, form *moltCreateForm, crabID string, uploads []models.Upload) ([]models.Attachment, bool) {
+	if len(uploads) == 0 {
+		return nil, true
+	}
+	attachments, err := app.Molts.Attach(r.Context(), crabID, uploads)
+	if problem := imageProblem(err); problem != "" {
+		form.AddFieldError("attachments", problem)
+		app.createError(w, r, *form)
+		return nil, false
+	} else if err != nil {
+		app.serverError(w, r, err)
+		return nil, false
+	}
+	return attachments, true
+}
+
+// createError shows a molt form that didn't pass back on the create page.
+// The compose boxes post with htmx, so it is told to swap the page in whole.
+func (app *Application) createError(w http.ResponseWriter, r *http.Request, form moltCreateForm) {
+	if r.Header.Get("HX-Request") == "true" {
+		w.Header().Set("HX-Retarget", "body")
+		w.Header().Set("HX-Reswap", "innerHTML")
+	}
+	data := app.NewTemplateData(r)
+	data.Form = form
+	app.Render(w, r, http.StatusUnprocessableEntity, "create.html", data)
+}
+
+type moltEditForm struct {
+	Content             string `form:"content"`
+	validator.Validator `form:"-"`
+}
+
+// ownMolt loads the molt named in the URL for the logged in crab to change.
+// It answers the request itself and returns nil if there is no such molt or
+// it is someone else's.
+func (app *Application) ownMolt(w http.ResponseWriter, r *http.Request) *models.Molt {
+	id := httprouter.ParamsFromContext(r.Context()).ByName("id")
+	if id == "" {
+		app.NotFound(w)
+		return nil
+	}
+	molt, err := app.Molts.ByID(r.Context(), id)
+	if err != nil {
+		app.modelError(w, r, err)
+		return nil
+	}
+	if molt.PK[2:] != app.SessionManager.GetString(r.Context(), "authenticatedCrabID") {
+		app.clientError(w, http.StatusForbidden)
+		return nil
+	}
+	return molt
+}
+
+func (app *Application) moltEditPost(w http.ResponseWriter, r *http.Request) {
+	molt := app.ownMolt(w, r)
+	if molt == nil {
+		return
+	}
+	// a remolt's words are someone else's, and a molt can only be edited for
+	// a while after it is posted
+	created, err := molt.Created()
+	if molt.Remolt || err != nil || time.Since(created) > app.EditWindow {
+		app.clientError(w, http.StatusForbidden)
+		return
+	}
+
+	var form moltEditForm
+	err = app.DecodePostForm(r, &form)
+	if err != nil {
+		app.clientError(w, http.StatusBadRequest)
+		return
+	}
+	form.CheckField(validator.NotBlank(form.Content), "content", "This field cannot be blank")
+	form.CheckField(validator.MaxChars(form.Content, 200), "content", "This field cannot be more than 200 characters long")
+	if !form.Valid() {
+		app.clientError(w, http.StatusUnprocessableEntity)
+		return
+	}
+
+	err = app.Molts.Update(r.Context(), molt, form.Content)
+	if err != nil {
+		app.modelError(w, r, err)
+		return
+	}
+	err = app.TemplateCache["profile.html"].ExecuteTemplate(w, "owned-molt", molt)
+	if err != nil {
+		fmt.Printf("ERROR owned-molt %v", err)
+	}
+}
+
+func (app *Application) moltDeletePost(w http.ResponseWriter, r *http.Request) {
+	molt := app.ownMolt(w, r)
+	if molt == nil {
+		return
+	}
+
+	err := app.Molts.Delete(r.Context(), molt)
+	if err != nil {
+		app.modelError(w, r, err)
+		return
+	}
+	app.wakeFanOut()
+	// nothing is sent back so htmx swaps the molt out of the page
+	app.SessionManager.Put(r.Context(), "flash", "Molt deleted.")
+	w.WriteHeader(http.StatusOK)
+}
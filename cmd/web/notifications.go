@@ -9,22 +9,27 @@ func (app *Application) notifications(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 	// get crab by ID
-	c, err := app.Crabs.ByID(id)
+	c, err := app.Crabs.ByID(r.Context(), id)
 	if err != nil {
-		app.serverError(w, r, err)
+		app.modelError(w, r, err)
 		return
 	}
-	notifications, err := app.Notifications.Show(id) // get the crabs notifications
+	notifications, cursor, err := app.Notifications.Show(r.Context(), id, r.URL.Query().Get("cursor")) // get the crabs notifications
 	if err != nil {
-		app.serverError(w, r, err)
+		app.modelError(w, r, err)
 		return
 	}
 
 	data := app.NewTemplateData(r)
 	data.Notifications = notifications
 	data.Crab = c
+	data.NextPage = nextPage(r, cursor)
 	// render the view
 	// but before that update each notification to 'viewed' == true
-	app.Notifications.MarkAsViewed(notifications) // permanent update so only show once... otherwise deleted in 7 days
+	err = app.Notifications.MarkAsViewed(r.Context(), notifications) // permanent update so only show once... otherwise deleted in 7 days
+	if err != nil {
+		app.serverError(w, r, err)
+		return
+	}
 	app.Render(w, r, http.StatusOK, "notifications.html", data)
 }
@@ -0,0 +1,147 @@
+package web
+
+import (
+	"errors"
+	"fmt"
+	"krabber.net/internal/models"
+	"krabber.net/internal/models/validator"
+	"net/http"
+)
+
+type passwordForgotForm struct {
+	Email               string `form:"email"`
+	validator.Validator `form:"-"`
+}
+
+type passwordResetForm struct {
+	Token               string `form:"token"`
+	Password            string `form:"password"`
+	validator.Validator `form:"-"`
+}
+
+func (app *Application) passwordForgot(w http.ResponseWriter, r *http.Request) {
+	data := app.NewTemplateData(r)
+	data.Form = passwordForgotForm{}
+	app.Render(w, r, http.StatusOK, "password_forgot.html", data)
+}
+
+func (app *Application) passwordForgotPost(w http.ResponseWriter, r *http.Request) {
+	var form passwordForgotForm
+
+	err := app.DecodePostForm(r, &form)
+	if err != nil {
+		app.clientError(w, http.StatusBadRequest)
+		return
+	}
+
+	form.CheckField(validator.NotBlank(form.Email), "email", "This field cannot be blank")
+	form.CheckField(validator.Matches(form.Email, validator.EmailRX), "email", "This field must be a valid email address")
+
+	if !form.Valid() {
+		data := app.NewTemplateData(r)
+		data.Form = form
+		app.Render(w, r, http.StatusUnprocessableEntity, "password_forgot.html", data)
+		return
+	}
+
+	// Whether or not the email belongs to a crab the response is the same, so
+	// the form can't be used to find out who has an account.
+	crab, err := app.Crabs.ByEmail(r.Context(), form.Email)
+	switch {
+	case errors.Is(err, models.ErrNoRecord):
+	case err != nil:
+		app.serverError(w, r, err)
+		return
+	default:
+		token, err := app.Tokens.New(r.Context(), crab, models.ScopePasswordReset)
+		if err != nil {
+			app.serverError(w, r, err)
+			return
+		}
+		app.background(func() {
+			data := map[string]any{
+				"passwordResetToken": token.Plaintext,
+			}
+			err := app.Mailer.Send(crab.Email, "token_password_reset.html", data)
+			if err != nil {
+				fmt.Println("Error: ", err)
+			}
+		})
+	}
+
+	app.SessionManager.Put(r.Context(), "flash", "If that e-mail belongs to a crab, a password reset token is on its way.")
+	http.Redirect(w, r, "/crab/password/reset", http.StatusSeeOther)
+}
+
+func (app *Application) passwordReset(w http.ResponseWriter, r *http.Request) {
+	data := app.NewTemplateData(r)
+	// the emailed link carries the token so the crab only has to pick a password
+	data.Form = passwordResetForm{Token: r.URL.Query().Get("token")}
+	app.Render(w, r, http.StatusOK, "password_reset.html", data)
+}
+
+func (app *Application) passwordResetPost(w http.ResponseWriter, r *http.Request) {
+	var form passwordResetForm
+
+	err := app.DecodePostForm(r, &form)
+	if err != nil {
+		app.clientError(w, http.StatusBadRequest)
+		return
+	}
+
+	models.ValidateTokenPlaintext(&form.Validator, form.Token)
+	models.ValidatePasswordPlaintext(&form.Validator, form.Password)
+
+	if !form.Valid() {
+		data := app.NewTemplateData(r)
+		data.Form = form
+		app.Render(w, r, http.StatusUnprocessableEntity, "password_reset.html", data)
+		return
+	}
+
+	t, err := app.Tokens.Get(r.Context(), models.ScopePasswordReset, form.Token)
+	if err != nil {
+		switch {
+		case errors.Is(err, models.ErrRecordNotFound):
+			form.AddFieldError("token", "Invalid or expired password reset token")
+			data := app.NewTemplateData(r)
+			data.Form = form
+			app.Render(w, r, http.StatusUnprocessableEntity, "password_reset.html", data)
+		default:
+			app.serverError(w, r, err)
+		}
+		return
+	}
+
+	crab, err := app.Crabs.ByID(r.Context(), t.CrabID)
+	if err != nil {
+		app.modelError(w, r, err)
+		return
+	}
+	err = crab.Password.Set(form.Password)
+	if err != nil {
+		app.serverError(w, r, err)
+		return
+	}
+	err = app.Crabs.ResetPassword(r.Context(), crab)
+	if err != nil {
+		app.modelError(w, r, err)
+		return
+	}
+
+	// The token is single use, and anyone already logged in as this crab may be
+	// whoever the password was reset to keep out.
+	err = app.Tokens.DeleteAllForCrab(r.Context(), models.ScopePasswordReset, crab.ID)
+	if err != nil {
+		app.serverError(w, r, err)
+		return
+	}
+	err = app.destroySessions(r, crab.ID)
+	if err != nil {
+		app.serverError(w, r, err)
+		return
+	}
+
+	app.SessionManager.Put(r.Context(), "flash", "Your password has been reset. Please login with your new password.")
+	http.Redirect(w, r, "/crab/login", http.StatusSeeOther)
+}
@@ -1,6 +1,60 @@
 package web
 
-import "net/http"
+import (
+	"github.com/julienschmidt/httprouter"
+	"krabber.net/internal/models"
+	"net/http"
+	"strings"
+)
+
+// crabPages serves every GET under /crab/. httprouter won't let a
+// /crab/:username route share its segment with the static /crab pages, so
+// those are looked up here first and anything else is taken as a profile.
+func (app *Application) crabPages() http.HandlerFunc {
+	pages := map[string]http.HandlerFunc{
+		"signup":          app.crabSignup,
+		"login":           app.crabLogin,
+		"activate":        app.crabActivate,
+		"password/forgot": app.passwordForgot,
+		"password/reset":  app.passwordReset,
+	}
+	return func(w http.ResponseWriter, r *http.Request) {
+		path := strings.TrimPrefix(httprouter.ParamsFromContext(r.Context()).ByName("path"), "/")
+		if page, ok := pages[path]; ok {
+			page(w, r)
+			return
+		}
+		// a profile's follow lists hang off it, e.g. /crab/sandy/followers
+		list := ""
+		if i := strings.LastIndex(path, "/"); i >= 0 {
+			if tail := path[i+1:]; tail == "followers" || tail == "following" {
+				path, list = path[:i], tail
+			}
+		}
+		var (
+			c   *models.Crab
+			err error
+		)
+		switch {
+		case strings.HasPrefix(path, "id/") && !strings.Contains(path[3:], "/"):
+			c, err = app.Crabs.ByID(r.Context(), path[3:])
+		case path != "" && !strings.Contains(path, "/"):
+			c, err = app.Crabs.ByUserName(r.Context(), path)
+		default:
+			app.NotFound(w)
+			return
+		}
+		if err != nil {
+			app.modelError(w, r, err)
+			return
+		}
+		if list != "" {
+			app.crabFollows(w, r, c, list)
+			return
+		}
+		app.crabProfile(w, r, c)
+	}
+}
 
 func (app *Application) profile(w http.ResponseWriter, r *http.Request) {
 	// for now show this logged in crabs molts
@@ -10,19 +64,72 @@ func (app *Application) profile(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 	// get crab by ID
-	c, err := app.Crabs.ByID(id)
+	c, err := app.Crabs.ByID(r.Context(), id)
 	if err != nil {
-		app.serverError(w, r, err)
+		app.modelError(w, r, err)
+		return
+	}
+	app.crabProfile(w, r, c)
+}
+
+// crabProfile renders c's profile with the tab picked by the tab query
+// parameter: molts (the default), remolts, likes or replies.
+func (app *Application) crabProfile(w http.ResponseWriter, r *http.Request, c *models.Crab) {
+	data := app.NewTemplateData(r)
+	data.Crab = c
+	data.Tab = r.URL.Query().Get("tab")
+
+	cursor := r.URL.Query().Get("cursor")
+	var (
+		next string
+		err  error
+	)
+	switch data.Tab {
+	case "", "molts":
+		data.Tab = "molts"
+		data.Molts, next, err = app.Molts.Show(r.Context(), c.ID, cursor)
+	case "remolts":
+		data.Molts, next, err = app.Molts.ShowReMolts(r.Context(), c.ID, cursor)
+	case "likes":
+		var likes []models.Like
+		likes, next, err = app.Likes.Show(r.Context(), c.ID, cursor)
+		if err == nil {
+			data.Molts, err = app.hydrator(r).LikedMolts(r.Context(), likes)
+		}
+	case "replies":
+		data.Molts, next, err = app.Molts.ShowReplies(r.Context(), c.ID, cursor)
+	default:
+		app.NotFound(w)
+		return
+	}
+	if err != nil {
+		app.modelError(w, r, err)
 		return
 	}
-	molts, err := app.Molts.Show(id) // add get string here
+	err = app.hydrate(r, data.Molts)
 	if err != nil {
 		app.serverError(w, r, err)
 		return
 	}
 
-	data := app.NewTemplateData(r)
-	data.Molts = molts
-	data.Crab = c
+	if data.IsAuthenticated && data.CrabID != c.ID {
+		data.Following, err = app.Follows.Exists(r.Context(), data.CrabID, c.ID)
+		if err != nil {
+			app.serverError(w, r, err)
+			return
+		}
+		data.Blocking, err = app.Blocks.Exists(r.Context(), data.CrabID, c.ID)
+		if err != nil {
+			app.serverError(w, r, err)
+			return
+		}
+		data.Muting, err = app.Mutes.Exists(r.Context(), data.CrabID, c.ID)
+		if err != nil {
+			app.serverError(w, r, err)
+			return
+		}
+	}
+
+	data.NextPage = nextPage(r, next)
 	app.Render(w, r, http.StatusOK, "profile.html", data)
 }
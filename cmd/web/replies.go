@@ -0,0 +1,86 @@
+package web
+
+import (
+	"fmt"
+	"github.com/google/uuid"
+	"github.com/julienschmidt/httprouter"
+	"krabber.net/internal/models"
+	"krabber.net/internal/models/ksuid"
+	"krabber.net/internal/models/validator"
+	"net/http"
+)
+
+// moltReplyPost posts a reply to the molt and sends it back as a branch of
+// the thread, for htmx to add under the molt it answers.
+func (app *Application) moltReplyPost(w http.ResponseWriter, r *http.Request) {
+	var form moltCreateForm
+
+	err := app.DecodePostForm(r, &form)
+	if err != nil {
+		app.clientError(w, http.StatusBadRequest)
+		return
+	}
+	form.CheckField(validator.NotBlank(form.Content), "content", "This field cannot be blank")
+	form.CheckField(validator.MaxChars(form.Content, 200), "content", "This field cannot be more than 200 characters long")
+	if !form.Valid() {
+		app.clientError(w, http.StatusUnprocessableEntity)
+		return
+	}
+
+	id := httprouter.ParamsFromContext(r.Context()).ByName("id")
+	if id == "" {
+		app.NotFound(w)
+		return
+	}
+	parent, err := app.Molts.ByID(r.Context(), id)
+	if err != nil {
+		app.modelError(w, r, err)
+		return
+	}
+	// replying to a remolt joins the thread of the molt it copies
+	if parent.ReMoltOf != "" {
+		parent, err = app.Molts.ByID(r.Context(), parent.ReMoltOf)
+		if err != nil {
+			app.modelError(w, r, err)
+			return
+		}
+	}
+
+	crabID := app.SessionManager.GetString(r.Context(), "authenticatedCrabID")
+	c, err := app.Crabs.ByID(r.Context(), crabID)
+	if err != nil {
+		app.modelError(w, r, err)
+		return
+	}
+	blocked, err := app.Blocks.Between(r.Context(), c.ID, parent.PK[2:])
+	if err != nil {
+		app.serverError(w, r, err)
+		return
+	}
+	if blocked {
+		app.clientError(w, http.StatusForbidden)
+		return
+	}
+
+	KSUID := ksuid.GenerateKSUID()
+	mid := uuid.New().String()
+	reply := &models.Molt{
+		ID:            mid,
+		PK:            fmt.Sprintf("M#%s", c.ID),
+		SK:            fmt.Sprintf("M#%s#%s", c.ID, KSUID),
+		GSI5PK:        fmt.Sprintf("M#%s", mid),
+		GSI5SK:        fmt.Sprintf("M#%s", mid),
+		Author:        c.UserName,
+		CreatorAvatar: c.AvatarAt(models.ListAvatar),
+		Content:       form.Content,
+	}
+	err = app.Molts.Reply(r.Context(), parent, reply)
+	if err != nil {
+		app.modelError(w, r, err)
+		return
+	}
+	err = app.TemplateCache["view.html"].ExecuteTemplate(w, "reply-tree", []models.Molt{*reply})
+	if err != nil {
+		fmt.Printf("ERROR reply-tree %v", err)
+	}
+}
@@ -20,7 +20,12 @@ func (app *Application) Routes() http.Handler {
 	fileServer := http.FileServer(http.FS(public.Files))
 	router.Handler(http.MethodGet, "/static/*filepath", fileServer)
 
-	dynamic := alice.New(app.SessionManager.LoadAndSave, noSurf, app.authenticate)
+	// uploads kept on disk are served from here; S3 serves its own
+	if media, ok := app.Storage.(http.Handler); ok {
+		router.Handler(http.MethodGet, "/media/*filepath", http.StripPrefix("/media", media))
+	}
+
+	dynamic := alice.New(app.SessionManager.LoadAndSave, noSurf, app.authenticate, app.hydration)
 
 	// SEA
 	router.Handler(http.MethodGet, "/sea", dynamic.ThenFunc(app.sea))
@@ -32,6 +37,12 @@ func (app *Application) Routes() http.Handler {
 	router.Handler(http.MethodGet, "/", dynamic.ThenFunc(app.root))
 	router.Handler(http.MethodPost, "/", dynamic.ThenFunc(app.moltCommonActionsPost))
 
+	// SEARCH
+	router.Handler(http.MethodGet, "/search/", dynamic.ThenFunc(app.search))
+
+	// CRABTAGS
+	router.Handler(http.MethodGet, "/tag/:name", dynamic.ThenFunc(app.tagTimeline))
+
 	// FOLLOW
 	router.Handler(http.MethodPost, "/follow/:id", dynamic.ThenFunc(app.followCreatePost))
 	router.Handler(http.MethodPost, "/unfollow/:id", dynamic.ThenFunc(app.followDeletePost))
@@ -40,14 +51,11 @@ func (app *Application) Routes() http.Handler {
 	router.Handler(http.MethodGet, "/profile", dynamic.ThenFunc(app.profile))
 	router.Handler(http.MethodGet, "/notifications", dynamic.ThenFunc(app.notifications))
 	router.Handler(http.MethodGet, "/settings", dynamic.ThenFunc(app.settings))
-
-	// COMMENT
-	router.Handler(http.MethodPost, "/comment/:id", dynamic.ThenFunc(app.commentCreatePost))
+	router.Handler(http.MethodGet, "/settings/email", dynamic.ThenFunc(app.settingsEmail))
+	router.Handler(http.MethodPost, "/settings/email", dynamic.ThenFunc(app.settingsEmailPost))
 
 	// MOLTS
 	router.Handler(http.MethodGet, "/molt/view/:id", dynamic.ThenFunc(app.moltView))
-	router.Handler(http.MethodPost, "/molt/like/:id", dynamic.ThenFunc(app.moltLikePost))
-	router.Handler(http.MethodPost, "/remolt/:id", dynamic.ThenFunc(app.moltRemoltPost))
 
 	// LIKES
 	router.Handler(http.MethodGet, "/molt/likes/view/:id", dynamic.ThenFunc(app.moltLikesView))
@@ -55,21 +63,37 @@ func (app *Application) Routes() http.Handler {
 	// CRABMIN
 	router.Handler(http.MethodGet, "/crabmin", dynamic.ThenFunc(app.crabmin))
 	router.Handler(http.MethodPost, "/crabmin/sea", dynamic.ThenFunc(app.crabminCreateSea))
+	router.Handler(http.MethodPost, "/crabmin/usernames", dynamic.ThenFunc(app.crabminIndexUserNames))
+	router.Handler(http.MethodPost, "/crabmin/search", dynamic.ThenFunc(app.crabminRebuildSearch))
+	router.Handler(http.MethodPost, "/crabmin/trending", dynamic.ThenFunc(app.crabminFillTrending))
+	router.Handler(http.MethodPost, "/crabmin/comments", dynamic.ThenFunc(app.crabminMigrateComments))
 
 	// CRAB
-	router.Handler(http.MethodGet, "/crab/signup", dynamic.ThenFunc(app.crabSignup))
+	// signup, login, activate, the password pages and /crab/:username profiles
+	router.Handler(http.MethodGet, "/crab/*path", dynamic.ThenFunc(app.crabPages()))
 	router.Handler(http.MethodPost, "/crab/avatar", dynamic.ThenFunc(app.crabUpdateAvatar))
 	router.Handler(http.MethodGet, "/crabs", dynamic.ThenFunc(app.allCrabs))
 	router.Handler(http.MethodPost, "/crab/signup", dynamic.ThenFunc(app.crabSignupPost))
-	router.Handler(http.MethodGet, "/crab/login", dynamic.ThenFunc(app.crabLogin))
 	router.Handler(http.MethodPost, "/crab/login", dynamic.ThenFunc(app.crabLoginPost))
-	router.Handler(http.MethodGet, "/crab/activate", dynamic.ThenFunc(app.crabActivate))
 	router.Handler(http.MethodPost, "/crab/activate", dynamic.ThenFunc(app.crabActivatePost))
+	router.Handler(http.MethodPost, "/crab/password/forgot", dynamic.ThenFunc(app.passwordForgotPost))
+	router.Handler(http.MethodPost, "/crab/password/reset", dynamic.ThenFunc(app.passwordResetPost))
 
 	protected := dynamic.Append(app.requireAuthentication)
 	router.Handler(http.MethodPost, "/molt/create", protected.ThenFunc(app.moltCreatePost))
 	router.Handler(http.MethodPost, "/molt/modal/create", protected.ThenFunc(app.moltModalCreatePost))
+	router.Handler(http.MethodPost, "/molt/edit/:id", protected.ThenFunc(app.moltEditPost))
+	router.Handler(http.MethodPost, "/molt/delete/:id", protected.ThenFunc(app.moltDeletePost))
+	router.Handler(http.MethodPost, "/molt/like/:id", protected.ThenFunc(app.moltLikePost))
+	router.Handler(http.MethodPost, "/remolt/:id", protected.ThenFunc(app.moltRemoltPost))
+	router.Handler(http.MethodPost, "/molt/reply/:id", protected.ThenFunc(app.moltReplyPost))
+	router.Handler(http.MethodPost, "/molt/quote/:id", protected.ThenFunc(app.moltQuotePost))
 	router.Handler(http.MethodPost, "/crab/logout", protected.ThenFunc(app.crabLogoutPost))
+	router.Handler(http.MethodPost, "/settings", protected.ThenFunc(app.settingsPost))
+	router.Handler(http.MethodPost, "/block/:id", protected.ThenFunc(app.blockCreatePost))
+	router.Handler(http.MethodPost, "/unblock/:id", protected.ThenFunc(app.blockDeletePost))
+	router.Handler(http.MethodPost, "/mute/:id", protected.ThenFunc(app.muteCreatePost))
+	router.Handler(http.MethodPost, "/unmute/:id", protected.ThenFunc(app.muteDeletePost))
 	standard := alice.New(app.recoverPanic, app.logRequest, secureHeaders)
 	return standard.Then(router)
 }
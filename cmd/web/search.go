@@ -0,0 +1,49 @@
+package web
+
+import (
+	"net/http"
+	"strings"
+)
+
+func (app *Application) search(w http.ResponseWriter, r *http.Request) {
+	id := app.SessionManager.GetString(r.Context(), "authenticatedCrabID")
+	if id == "" {
+		app.NotFound(w)
+		return
+	}
+	c, err := app.Crabs.ByID(r.Context(), id)
+	if err != nil {
+		app.modelError(w, r, err)
+		return
+	}
+
+	data := app.NewTemplateData(r)
+	data.Crab = c
+	data.Query = strings.TrimSpace(r.URL.Query().Get("q"))
+	data.Tab = r.URL.Query().Get("tab")
+
+	cursor := r.URL.Query().Get("cursor")
+	var next string
+	switch data.Tab {
+	case "", "molts":
+		data.Tab = "molts"
+		data.Molts, next, err = app.Search.Molts(r.Context(), data.Query, cursor)
+	case "crabs":
+		data.Crabs, next, err = app.Search.Crabs(r.Context(), data.Query, cursor)
+	default:
+		app.NotFound(w)
+		return
+	}
+	if err != nil {
+		app.modelError(w, r, err)
+		return
+	}
+
+	err = app.hydrate(r, data.Molts)
+	if err != nil {
+		app.serverError(w, r, err)
+		return
+	}
+	data.NextPage = nextPage(r, next)
+	app.Render(w, r, http.StatusOK, "results.html", data)
+}
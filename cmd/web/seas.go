@@ -1,6 +1,11 @@
 package web
 
-import "net/http"
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"time"
+)
 
 func (app *Application) sea(w http.ResponseWriter, r *http.Request) {
 	id := app.SessionManager.GetString(r.Context(), "authenticatedCrabID")
@@ -9,32 +14,50 @@ func (app *Application) sea(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 	// get crab by ID
-	c, err := app.Crabs.ByID(id)
+	c, err := app.Crabs.ByID(r.Context(), id)
 	if err != nil {
-		app.serverError(w, r, err)
+		app.modelError(w, r, err)
 		return
 	}
 
-	molts, err := app.Molts.Sea()
+	molts, cursor, err := app.Molts.Sea(r.Context(), id, r.URL.Query().Get("cursor"))
 	if err != nil {
-		app.serverError(w, r, err)
+		app.modelError(w, r, err)
 		return
 	}
 
 	data := app.NewTemplateData(r)
 	data.Molts = molts
 	data.Crab = c
-	// access by index instead of copy which is default behaviour
-	for i := range data.Molts {
-		comments, err := app.Comments.On(data.Molts[i].ID) // add get string here
+	data.NextPage = nextPage(r, cursor)
+	err = app.hydrate(r, data.Molts)
+	if err != nil {
+		app.serverError(w, r, err)
+		return
+	}
+	app.Render(w, r, http.StatusOK, "sea.html", data)
+}
+
+// RunSea rebuilds the sea and the trending crabtags every interval until
+// ctx is done, starting straight away so a fresh start doesn't wait a whole
+// interval for them. Both look back over the past day, so they are kept
+// fresh together.
+func (app *Application) RunSea(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		err := app.Molts.FillSea(ctx)
 		if err != nil {
-			app.serverError(w, r, err)
-			return
+			fmt.Println("ERROR filling the sea: ", err)
 		}
-		for _, c := range comments {
-			data.Molts[i].Comments = append(data.Molts[i].Comments, c)
+		_, err = app.Tags.FillTrending(ctx)
+		if err != nil {
+			fmt.Println("ERROR filling trending: ", err)
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
 		}
 	}
-
-	app.Render(w, r, http.StatusOK, "sea.html", data)
 }
@@ -1,21 +1,241 @@
 package web
 
-import "net/http"
+import (
+	"errors"
+	"fmt"
+	"krabber.net/internal/models"
+	"krabber.net/internal/models/validator"
+	"net/http"
+	"strings"
+)
+
+type settingsForm struct {
+	Display             string `form:"display"`
+	Description         string `form:"description"`
+	Website             string `form:"website"`
+	Email               string `form:"email"`
+	validator.Validator `form:"-"`
+}
+
+type settingsEmailForm struct {
+	Token               string `form:"token"`
+	validator.Validator `form:"-"`
+}
 
 func (app *Application) settings(w http.ResponseWriter, r *http.Request) {
-	// for now show this logged in crabs molts
 	id := app.SessionManager.GetString(r.Context(), "authenticatedCrabID")
 	if id == "" {
 		app.NotFound(w)
 		return
 	}
-	molts, err := app.Molts.Show(id) // add get string here
+	c, err := app.Crabs.ByID(r.Context(), id)
 	if err != nil {
-		app.serverError(w, r, err)
+		app.modelError(w, r, err)
 		return
 	}
 
 	data := app.NewTemplateData(r)
-	data.Molts = molts
+	data.Crab = c
+	data.Form = settingsForm{
+		Display:     c.Display,
+		Description: c.Description,
+		Website:     c.Website,
+		Email:       c.Email,
+	}
 	app.Render(w, r, http.StatusOK, "settings.html", data)
 }
+
+func (app *Application) settingsPost(w http.ResponseWriter, r *http.Request) {
+	crabID := app.SessionManager.GetString(r.Context(), "authenticatedCrabID")
+	c, err := app.Crabs.ByID(r.Context(), crabID)
+	if err != nil {
+		app.modelError(w, r, err)
+		return
+	}
+	r.Body = http.MaxBytesReader(w, r.Body, models.MaxImageSize+1<<20)
+	err = r.ParseMultipartForm(1 << 20)
+	if err != nil && !errors.Is(err, http.ErrNotMultipart) {
+		app.uploadError(w, err)
+		return
+	}
+	var form settingsForm
+	err = app.DecodePostForm(r, &form)
+	if err != nil {
+		app.clientError(w, http.StatusBadRequest)
+		return
+	}
+
+	c.Display = strings.TrimSpace(form.Display)
+	c.Description = strings.TrimSpace(form.Description)
+	c.Website = strings.TrimSpace(form.Website)
+	models.ValidateProfile(&form.Validator, c)
+
+	form.Email = strings.TrimSpace(form.Email)
+	emailChanged := form.Email != c.Email
+	if emailChanged {
+		models.ValidateEmail(&form.Validator, form.Email)
+	}
+
+	// the banner is optional, leaving the file input empty keeps the current one
+	var banner []byte
+	file, _, err := r.FormFile("bannerfile")
+	switch {
+	case err == nil:
+		banner, err = readUpload(file)
+		file.Close()
+		if err != nil {
+			app.serverError(w, r, err)
+			return
+		}
+	case errors.Is(err, http.ErrMissingFile), errors.Is(err, http.ErrNotMultipart):
+	default:
+		app.clientError(w, http.StatusBadRequest)
+		return
+	}
+
+	if emailChanged && form.Valid() {
+		_, err = app.Crabs.ByEmail(r.Context(), form.Email)
+		switch {
+		case err == nil:
+			form.AddFieldError("email", "Email address is already in use")
+		case !errors.Is(err, models.ErrNoRecord):
+			app.serverError(w, r, err)
+			return
+		}
+	}
+
+	// the banner is only made once nothing else can stop it being saved
+	var oldBanner []string
+	if banner != nil && form.Valid() {
+		oldBanner, err = app.Crabs.UploadBanner(r.Context(), c, banner)
+		if problem := imageProblem(err); problem != "" {
+			form.AddFieldError("banner", problem)
+		} else if err != nil {
+			app.serverError(w, r, err)
+			return
+		}
+	}
+
+	if !form.Valid() {
+		data := app.NewTemplateData(r)
+		data.Crab = c
+		data.Form = form
+		app.Render(w, r, http.StatusUnprocessableEntity, "settings.html", data)
+		return
+	}
+
+	err = app.Crabs.UpdateProfile(r.Context(), c)
+	if err != nil {
+		if banner != nil {
+			var made []string
+			for _, key := range c.Banners {
+				made = append(made, key)
+			}
+			app.Crabs.RemoveBanner(r.Context(), made)
+		}
+		app.modelError(w, r, err)
+		return
+	}
+	err = app.Crabs.RemoveBanner(r.Context(), oldBanner)
+	if err != nil {
+		fmt.Println("Error removing old banner: ", err)
+	}
+
+	if !emailChanged {
+		app.SessionManager.Put(r.Context(), "flash", "Your profile has been updated.")
+		http.Redirect(w, r, "/settings", http.StatusSeeOther)
+		return
+	}
+
+	// The new address only replaces the old one once the crab shows they can
+	// read mail sent to it.
+	token, err := app.Tokens.NewEmailChange(r.Context(), c, form.Email)
+	if err != nil {
+		app.serverError(w, r, err)
+		return
+	}
+	app.background(func() {
+		data := map[string]any{
+			"emailChangeToken": token.Plaintext,
+		}
+		err := app.Mailer.Send(token.NewEmail, "token_email_change.html", data)
+		if err != nil {
+			fmt.Println("Error: ", err)
+		}
+	})
+
+	app.SessionManager.Put(r.Context(), "flash", "Your profile has been updated. Check your new e-mail to confirm the change of address.")
+	http.Redirect(w, r, "/settings/email", http.StatusSeeOther)
+}
+
+func (app *Application) settingsEmail(w http.ResponseWriter, r *http.Request) {
+	data := app.NewTemplateData(r)
+	// the emailed link carries the token so it only has to be submitted
+	data.Form = settingsEmailForm{Token: r.URL.Query().Get("token")}
+	app.Render(w, r, http.StatusOK, "settings_email.html", data)
+}
+
+func (app *Application) settingsEmailPost(w http.ResponseWriter, r *http.Request) {
+	var form settingsEmailForm
+
+	err := app.DecodePostForm(r, &form)
+	if err != nil {
+		app.clientError(w, http.StatusBadRequest)
+		return
+	}
+
+	models.ValidateTokenPlaintext(&form.Validator, form.Token)
+
+	if !form.Valid() {
+		data := app.NewTemplateData(r)
+		data.Form = form
+		app.Render(w, r, http.StatusUnprocessableEntity, "settings_email.html", data)
+		return
+	}
+
+	t, err := app.Tokens.Get(r.Context(), models.ScopeEmailChange, form.Token)
+	if err != nil {
+		switch {
+		case errors.Is(err, models.ErrRecordNotFound):
+			form.AddFieldError("token", "Invalid or expired e-mail change token")
+			data := app.NewTemplateData(r)
+			data.Form = form
+			app.Render(w, r, http.StatusUnprocessableEntity, "settings_email.html", data)
+		default:
+			app.serverError(w, r, err)
+		}
+		return
+	}
+
+	crab, err := app.Crabs.ByID(r.Context(), t.CrabID)
+	if err != nil {
+		app.modelError(w, r, err)
+		return
+	}
+	_, err = app.Crabs.ChangeEmail(r.Context(), crab, t.NewEmail)
+	if err != nil {
+		switch {
+		case errors.Is(err, models.ErrDuplicateEmail):
+			form.AddFieldError("token", "That e-mail address is already in use")
+			data := app.NewTemplateData(r)
+			data.Form = form
+			app.Render(w, r, http.StatusUnprocessableEntity, "settings_email.html", data)
+		default:
+			app.modelError(w, r, err)
+		}
+		return
+	}
+
+	err = app.Tokens.DeleteAllForCrab(r.Context(), models.ScopeEmailChange, crab.ID)
+	if err != nil {
+		app.serverError(w, r, err)
+		return
+	}
+
+	app.SessionManager.Put(r.Context(), "flash", "Your e-mail address has been changed.")
+	if !app.isAuthenticated(r) {
+		http.Redirect(w, r, "/crab/login", http.StatusSeeOther)
+		return
+	}
+	http.Redirect(w, r, "/settings", http.StatusSeeOther)
+}
@@ -1,6 +1,7 @@
 package web
 
 import (
+	"context"
 	"fmt"
 	"net/http"
 	"os"
@@ -38,38 +39,142 @@ func (app *Application) crabminCreateSea(w http.ResponseWriter, r *http.Request)
 		return
 	}
 
-	err := app.Molts.FillSea()
+	err := app.Molts.FillSea(r.Context())
 	if err != nil {
 		app.serverError(w, r, err)
+		return
 	}
 
 	data := app.NewTemplateData(r)
 	app.Render(w, r, http.StatusOK, "crabmin.html", data)
 }
 
-func (app *Application) allCrabs(w http.ResponseWriter, r *http.Request) {
-	// for now show this logged in crabs molts
+// crabminIndexUserNames backfills the user name index used by the
+// /crab/:username profiles, and the items holding each name, for crabs that
+// signed up before they existed.
+func (app *Application) crabminIndexUserNames(w http.ResponseWriter, r *http.Request) {
 	id := app.SessionManager.GetString(r.Context(), "authenticatedCrabID")
 	if id == "" {
 		app.NotFound(w)
 		return
 	}
-	c, err := app.Crabs.ByID(id)
+	ca := os.Getenv("CRABMIN")
+	if id != ca {
+		app.NotFound(w)
+		return
+	}
+
+	n, err := app.Crabs.IndexUserNames(r.Context())
 	if err != nil {
-		fmt.Printf("ERROR getting crab %v", err)
 		app.serverError(w, r, err)
 		return
 	}
+	app.SessionManager.Put(r.Context(), "flash", fmt.Sprintf("Indexed %d crab user names", n))
+
+	data := app.NewTemplateData(r)
+	app.Render(w, r, http.StatusOK, "crabmin.html", data)
+}
+
+// crabminRebuildSearch re-indexes every crab and molt for search.
+func (app *Application) crabminRebuildSearch(w http.ResponseWriter, r *http.Request) {
+	id := app.SessionManager.GetString(r.Context(), "authenticatedCrabID")
+	if id == "" {
+		app.NotFound(w)
+		return
+	}
+	ca := os.Getenv("CRABMIN")
+	if id != ca {
+		app.NotFound(w)
+		return
+	}
+
+	app.background(func() {
+		n, err := app.Search.Rebuild(context.Background())
+		if err != nil {
+			fmt.Println("ERROR rebuilding search: ", err)
+			return
+		}
+		fmt.Printf("Indexed %d crabs and molts for search\n", n)
+	})
+	app.SessionManager.Put(r.Context(), "flash", "Rebuilding the search index, this can take a while")
+
+	data := app.NewTemplateData(r)
+	app.Render(w, r, http.StatusOK, "crabmin.html", data)
+}
 
-	crabs, err := app.Crabs.Show() /// add get string here
+// crabminFillTrending refreshes the trending crabtags cache.
+func (app *Application) crabminFillTrending(w http.ResponseWriter, r *http.Request) {
+	id := app.SessionManager.GetString(r.Context(), "authenticatedCrabID")
+	if id == "" {
+		app.NotFound(w)
+		return
+	}
+	ca := os.Getenv("CRABMIN")
+	if id != ca {
+		app.NotFound(w)
+		return
+	}
+
+	trends, err := app.Tags.FillTrending(r.Context())
 	if err != nil {
 		app.serverError(w, r, err)
 		return
 	}
+	app.SessionManager.Put(r.Context(), "flash", fmt.Sprintf("%d crabtags are trending", len(trends)))
+
+	data := app.NewTemplateData(r)
+	app.Render(w, r, http.StatusOK, "crabmin.html", data)
+}
+
+func (app *Application) crabminMigrateComments(w http.ResponseWriter, r *http.Request) {
+	id := app.SessionManager.GetString(r.Context(), "authenticatedCrabID")
+	if id == "" {
+		app.NotFound(w)
+		return
+	}
+	ca := os.Getenv("CRABMIN")
+	if id != ca {
+		app.NotFound(w)
+		return
+	}
+
+	app.background(func() {
+		n, err := app.Molts.MigrateComments(context.Background())
+		if err != nil {
+			fmt.Println("ERROR migrating comments: ", err)
+			return
+		}
+		fmt.Printf("Migrated %d comments to replies\n", n)
+	})
+	app.SessionManager.Put(r.Context(), "flash", "Migrating comments to replies, this can take a while")
+
+	data := app.NewTemplateData(r)
+	app.Render(w, r, http.StatusOK, "crabmin.html", data)
+}
+
+func (app *Application) allCrabs(w http.ResponseWriter, r *http.Request) {
+	// for now show this logged in crabs molts
+	id := app.SessionManager.GetString(r.Context(), "authenticatedCrabID")
+	if id == "" {
+		app.NotFound(w)
+		return
+	}
+	c, err := app.Crabs.ByID(r.Context(), id)
+	if err != nil {
+		app.modelError(w, r, err)
+		return
+	}
+
+	crabs, cursor, err := app.Crabs.Show(r.Context(), r.URL.Query().Get("cursor"))
+	if err != nil {
+		app.modelError(w, r, err)
+		return
+	}
 
 	data := app.NewTemplateData(r)
 	data.Crabs = crabs
 	data.Crab = c
+	data.NextPage = nextPage(r, cursor)
 	app.Render(w, r, http.StatusOK, "crabs.html", data)
 }
 
@@ -0,0 +1,25 @@
+package web
+
+import (
+	"context"
+	"fmt"
+	"time"
+)
+
+// RunSuggestions works out every crab's who to follow suggestions every
+// interval until ctx is done, starting straight away.
+func (app *Application) RunSuggestions(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		_, err := app.Suggestions.Fill(ctx)
+		if err != nil {
+			fmt.Println("ERROR suggesting crabs to follow: ", err)
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
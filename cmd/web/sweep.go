@@ -0,0 +1,36 @@
+package web
+
+import (
+	"context"
+	"fmt"
+	"time"
+)
+
+// sweeper is an item store that has to delete expired items itself.
+// DynamoDB does it on its own, so only the memory and SQLite stores are.
+type sweeper interface {
+	Sweep(ctx context.Context, now time.Time) (int, error)
+}
+
+// RunSweep deletes the items whose ttl has passed every interval until ctx
+// is done, starting straight away. It returns at once for stores that
+// expire items themselves.
+func (app *Application) RunSweep(ctx context.Context, interval time.Duration) {
+	store, ok := app.Molts.SVC.ItemTable.(sweeper)
+	if !ok {
+		return
+	}
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		_, err := store.Sweep(ctx, time.Now())
+		if err != nil {
+			fmt.Println("ERROR sweeping expired items: ", err)
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
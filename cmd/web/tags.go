@@ -0,0 +1,48 @@
+package web
+
+import (
+	"github.com/julienschmidt/httprouter"
+	"net/http"
+	"strings"
+)
+
+func (app *Application) tagTimeline(w http.ResponseWriter, r *http.Request) {
+	id := app.SessionManager.GetString(r.Context(), "authenticatedCrabID")
+	if id == "" {
+		app.NotFound(w)
+		return
+	}
+	c, err := app.Crabs.ByID(r.Context(), id)
+	if err != nil {
+		app.modelError(w, r, err)
+		return
+	}
+
+	tag := strings.ToLower(strings.TrimPrefix(httprouter.ParamsFromContext(r.Context()).ByName("name"), "#"))
+	if tag == "" {
+		app.NotFound(w)
+		return
+	}
+	tags, cursor, err := app.Tags.Timeline(r.Context(), tag, r.URL.Query().Get("cursor"))
+	if err != nil {
+		app.modelError(w, r, err)
+		return
+	}
+	molts, err := app.hydrator(r).TagMolts(r.Context(), tags)
+	if err != nil {
+		app.modelError(w, r, err)
+		return
+	}
+
+	data := app.NewTemplateData(r)
+	data.Crab = c
+	data.Tag = tag
+	data.Molts = molts
+	data.NextPage = nextPage(r, cursor)
+	err = app.hydrate(r, data.Molts)
+	if err != nil {
+		app.serverError(w, r, err)
+		return
+	}
+	app.Render(w, r, http.StatusOK, "tag.html", data)
+}
@@ -1,11 +1,15 @@
 package web
 
 import (
+	"fmt"
 	"html/template"
 	"io/fs"
 	"krabber.net/internal/models"
+	"krabber.net/internal/models/storage"
 	"krabber.net/public"
+	"net/url"
 	"path/filepath"
+	"strings"
 	"time"
 )
 
@@ -14,10 +18,15 @@ import (
 type templateData struct {
 	Molt            models.Molt
 	Molts           []models.Molt
+	History         []models.MoltEdit
+	Ancestors       []models.Molt
 	Likes           []models.Like
 	Crab            *models.Crab
 	Crabs           []models.Crab
 	Follows         models.Follow
+	Following       bool
+	Blocking        bool
+	Muting          bool
 	Notifications   []models.Notification
 	Form            any
 	Flash           string
@@ -27,6 +36,12 @@ type templateData struct {
 	Trench          []models.Trench
 	PageNumber      int
 	Page            string
+	NextPage        string
+	Tab             string
+	Query           string
+	Tag             string
+	Trending        []models.Trend
+	Suggestions     []models.Suggestion
 }
 
 // Create a humanDate function which returns a nicely formatted string
@@ -35,14 +50,53 @@ func humanDate(t time.Time) string {
 	return t.Format("02 Jan 2006 at 15:04")
 }
 
+// linkMentions renders content with each of its resolved mentions linked to
+// the mentioned crab's profile. Anything else that looks like a mention is
+// left as text.
+func linkMentions(content string, mentions []string) template.HTML {
+	resolved := make(map[string]string, len(mentions))
+	for _, name := range mentions {
+		resolved[strings.ToLower(name)] = name
+	}
+	var b strings.Builder
+	last := 0
+	for _, m := range models.MentionRX.FindAllStringSubmatchIndex(content, -1) {
+		// m[2]:m[3] is the user name, the @ comes right before it
+		name := content[m[2]:m[3]]
+		userName, ok := resolved[strings.ToLower(name)]
+		if !ok {
+			continue
+		}
+		b.WriteString(template.HTMLEscapeString(content[last : m[2]-1]))
+		fmt.Fprintf(&b, `<a href="/crab/%s">@%s</a>`, template.HTMLEscapeString(url.PathEscape(userName)), template.HTMLEscapeString(name))
+		last = m[3]
+	}
+	b.WriteString(template.HTMLEscapeString(content[last:]))
+	return template.HTML(b.String())
+}
+
 // Initialize a template.FuncMap object and store it in a global variable. This is
 // essentially a string-keyed map which acts as a lookup between the names of our
 // custom template functions and the functions themselves.
 var functions = template.FuncMap{
 	"humanDate": humanDate,
+	"mentions":  linkMentions,
+}
+
+// mediaURL makes the media template function, which turns the key of an
+// uploaded file into where the browser can load it from.
+func mediaURL(store storage.Store) func(string) string {
+	return func(key string) string {
+		if key == "" {
+			return ""
+		}
+		return store.URL(key)
+	}
 }
 
-func NewTemplateCache() (map[string]*template.Template, error) {
+// NewTemplateCache parses the pages. Uploaded files in them are resolved
+// against store.
+func NewTemplateCache(store storage.Store) (map[string]*template.Template, error) {
 	cache := map[string]*template.Template{}
 
 	// Use fs.Glob() to get a slice of all filepaths in the ui.Files embedded
@@ -68,7 +122,7 @@ func NewTemplateCache() (map[string]*template.Template, error) {
 
 		// Use ParseFS() instead of ParseFiles() to parse the template files
 		// from the ui.Files embedded filesystem.
-		ts, err := template.New(name).Funcs(functions).ParseFS(public.Files, patterns...)
+		ts, err := template.New(name).Funcs(functions).Funcs(template.FuncMap{"media": mediaURL(store)}).ParseFS(public.Files, patterns...)
 		if err != nil {
 			return nil, err
 		}
@@ -1,8 +1,13 @@
 package web
 
 import (
+	"context"
+	"errors"
 	"fmt"
+	"krabber.net/internal/models"
 	"net/http"
+	"net/url"
+	"time"
 )
 
 func (app *Application) crabTrench(w http.ResponseWriter, r *http.Request) {
@@ -12,38 +17,134 @@ func (app *Application) crabTrench(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	trench, err := app.Trench.Get(id)
+	trench, cursor, err := app.Trench.Get(r.Context(), id, r.URL.Query().Get("cursor"))
 	if err != nil {
-		fmt.Printf("ERROR getting trench %v", trench)
-		app.serverError(w, r, err)
+		app.modelError(w, r, err)
 		return
 	}
 
-	c, err := app.Crabs.ByID(id)
+	c, err := app.Crabs.ByID(r.Context(), id)
 	if err != nil {
-		fmt.Printf("ERROR getting crab %v", err)
-		app.serverError(w, r, err)
+		app.modelError(w, r, err)
 		return
 	}
 
-	molts := app.Molts.GetTrenchMolts(trench)
-	data := app.NewTemplateData(r)
-	if molts != nil {
-		data.Molts = molts
+	molts, err := app.hydrator(r).TrenchMolts(r.Context(), trench)
+	if err != nil {
+		app.serverError(w, r, err)
+		return
+	}
+	// before is where the last page left off for the celebrities' molts
+	before, _ := time.Parse(time.RFC3339, r.URL.Query().Get("before"))
+	molts, floor, err := app.readCelebrities(r.Context(), id, molts, before, cursor != "")
+	if err != nil {
+		app.serverError(w, r, err)
+		return
 	}
+	data := app.NewTemplateData(r)
+	data.Molts = molts
 	data.Crab = c
-	if len(molts) > 0 {
-		for i := range data.Molts {
-			comments, err := app.Comments.On(data.Molts[i].ID) // add get string here
-			if err != nil {
-				app.serverError(w, r, err)
-				return
+	data.NextPage = nextPage(r, cursor)
+	if data.NextPage != "" && !floor.IsZero() {
+		u, _ := url.Parse(data.NextPage)
+		q := u.Query()
+		q.Set("before", floor.Format(time.RFC3339))
+		u.RawQuery = q.Encode()
+		data.NextPage = u.RequestURI()
+	}
+	err = app.hydrate(r, data.Molts)
+	if err != nil {
+		app.serverError(w, r, err)
+		return
+	}
+	app.Render(w, r, http.StatusOK, "trench.html", data)
+}
+
+// readCelebrities merges the molts of the celebrities crabID follows, which
+// fan-out leaves out of trenches, into a page of their trench. It takes
+// every one posted before before, down to the oldest molt on the page when
+// more of the trench follows, or a page of each when it doesn't, and
+// returns that floor for the next page to carry on from.
+func (app *Application) readCelebrities(ctx context.Context, crabID string, page []models.Molt, before time.Time, more bool) ([]models.Molt, time.Time, error) {
+	var floor time.Time
+	if more {
+		for _, molt := range page {
+			t, err := molt.Created()
+			if err == nil && (floor.IsZero() || t.Before(floor)) {
+				floor = t
 			}
-			for _, c := range comments {
-				data.Molts[i].Comments = append(data.Molts[i].Comments, c)
+		}
+	}
+	celebrities, err := app.Trench.Celebrities(ctx, crabID)
+	if err != nil {
+		return nil, floor, err
+	}
+	lists := [][]models.Molt{page}
+	for _, id := range celebrities {
+		molts, err := app.Molts.Before(ctx, id, before, floor)
+		if err != nil {
+			return nil, floor, err
+		}
+		lists = append(lists, molts)
+	}
+	return models.MergeMolts(lists...), floor, nil
+}
+
+// RunFanOut writes queued molts into their followers' trenches, and takes
+// deleted ones back out, until ctx is done. It looks for due jobs every interval, and straight away when a
+// handler has just queued one, so jobs left from before a restart are
+// picked up on the first pass.
+func (app *Application) RunFanOut(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		jobs, err := app.Trench.DueFanOuts(ctx, time.Now())
+		if err != nil {
+			fmt.Println("ERROR listing fan-outs: ", err)
+		}
+		for _, job := range jobs {
+			err := app.Trench.FanOut(ctx, job)
+			// a conflict is another worker or a deleted molt, not a failure
+			if err != nil && !errors.Is(err, models.ErrConflict) {
+				fmt.Printf("ERROR fanning out molt %s, attempt %d: %v\n", job.MoltID, job.Attempts+1, err)
 			}
 		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		case <-app.FanOuts:
+		}
 	}
+}
 
-	app.Render(w, r, http.StatusOK, "trench.html", data)
+// wakeFanOut tells RunFanOut a molt has been queued, or deleted. It never waits: if
+// the worker is busy it will look again when it is done.
+func (app *Application) wakeFanOut() {
+	select {
+	case app.FanOuts <- struct{}{}:
+	default:
+	}
+}
+
+// backfill puts followee's recent molts in the trench of follower, who has
+// just followed them, without holding up the request.
+func (app *Application) backfill(follower, followee *models.Crab) {
+	app.background(func() {
+		err := app.Trench.Backfill(context.Background(), follower, followee)
+		if err != nil {
+			fmt.Println("ERROR backfilling trench: ", err)
+		}
+	})
+}
+
+// purge takes followee's molts out of the trench of follower, who has just
+// unfollowed them, without holding up the request.
+func (app *Application) purge(followerID, followeeID string) {
+	app.background(func() {
+		err := app.Trench.Purge(context.Background(), followerID, followeeID)
+		if err != nil {
+			fmt.Println("ERROR purging trench: ", err)
+		}
+	})
 }
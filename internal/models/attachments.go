@@ -0,0 +1,118 @@
+package models
+
+import (
+	"context"
+	"fmt"
+	"github.com/google/uuid"
+	"unicode/utf8"
+)
+
+const (
+	// MaxAttachments is how many images one molt can carry.
+	MaxAttachments = 4
+	// MaxAltText is the most characters an image's description can be.
+	MaxAltText = 1000
+	// thumbSide is the longest side of the thumbnails molt lists show.
+	thumbSide = 400
+)
+
+// Attachment is an image on a molt. The keys are where it and its thumbnail
+// are in the blob store; templates turn them into URLs with media.
+type Attachment struct {
+	Key      string `dynamodbav:"key"`
+	ThumbKey string `dynamodbav:"thumb_key"`
+	Type     string `dynamodbav:"type"`
+	Width    int    `dynamodbav:"width"`
+	Height   int    `dynamodbav:"height"`
+	Alt      string `dynamodbav:"alt"`
+}
+
+// Upload is an image a crab wants to attach to a molt, as sent.
+type Upload struct {
+	Data []byte
+	Alt  string
+}
+
+// Attach checks and cleans up the images crabID uploaded and stores them,
+// with a thumbnail each, ready to go on a molt. If any upload isn't an
+// image we take nothing is kept and the error says why.
+func (m MoltModel) Attach(ctx context.Context, crabID string, uploads []Upload) ([]Attachment, error) {
+	if len(uploads) > MaxAttachments {
+		return nil, fmt.Errorf("models: %d attachments, at most %d", len(uploads), MaxAttachments)
+	}
+	attachments := make([]Attachment, 0, len(uploads))
+	for _, u := range uploads {
+		if utf8.RuneCountInString(u.Alt) > MaxAltText {
+			m.Detach(ctx, attachments)
+			return nil, fmt.Errorf("models: alt text longer than %d characters", MaxAltText)
+		}
+		a, err := m.attach(ctx, crabID, u)
+		if err != nil {
+			m.Detach(ctx, attachments)
+			return nil, err
+		}
+		attachments = append(attachments, *a)
+	}
+	return attachments, nil
+}
+
+func (m MoltModel) attach(ctx context.Context, crabID string, u Upload) (*Attachment, error) {
+	img, err := decodeImage(u.Data)
+	if err != nil {
+		return nil, err
+	}
+	data, contentType, err := encodeImage(img)
+	if err != nil {
+		return nil, err
+	}
+	name := fmt.Sprintf("m/%s/%s", crabID, uuid.New().String())
+	a := &Attachment{
+		Key:    name + extension(contentType),
+		Type:   contentType,
+		Width:  img.Bounds().Dx(),
+		Height: img.Bounds().Dy(),
+		Alt:    u.Alt,
+	}
+	err = m.Blobs.Put(ctx, a.Key, contentType, data)
+	if err != nil {
+		return nil, err
+	}
+
+	// small images are their own thumbnail
+	a.ThumbKey = a.Key
+	thumb := fit(img, thumbSide)
+	if thumb != img {
+		data, contentType, err = encodeImage(thumb)
+		if err != nil {
+			m.Detach(ctx, []Attachment{*a})
+			return nil, err
+		}
+		a.ThumbKey = name + "_thumb" + extension(contentType)
+		err = m.Blobs.Put(ctx, a.ThumbKey, contentType, data)
+		if err != nil {
+			a.ThumbKey = a.Key
+			m.Detach(ctx, []Attachment{*a})
+			return nil, err
+		}
+	}
+	return a, nil
+}
+
+// Detach removes attachments from the blob store. It carries on past
+// failures so as much as possible goes, and returns the first.
+func (m MoltModel) Detach(ctx context.Context, attachments []Attachment) error {
+	var first error
+	for _, a := range attachments {
+		keys := []string{a.Key}
+		if a.ThumbKey != a.Key {
+			keys = append(keys, a.ThumbKey)
+		}
+		for _, key := range keys {
+			err := m.Blobs.Delete(ctx, key)
+			if err != nil && first == nil {
+				first = err
+			}
+		}
+	}
+	return first
+}
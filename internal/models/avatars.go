@@ -0,0 +1,147 @@
+package models
+
+import (
+	"context"
+	"fmt"
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/feature/dynamodb/attributevalue"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+	"github.com/google/uuid"
+	"image"
+	"strconv"
+)
+
+var (
+	// AvatarSizes are the widths avatars are made at, or smaller when the
+	// upload is. They are square.
+	AvatarSizes = []int{48, 96, 512}
+	// BannerSizes are the widths banners are made at. They are three times
+	// as wide as they are tall.
+	BannerSizes = []int{600, 1500}
+)
+
+// ListAvatar is the avatar size molt lists show next to each molt.
+const ListAvatar = 96
+
+// AvatarAt is the key of the crab's avatar at width, one of AvatarSizes.
+// Crabs whose avatar predates sizes just have the one. It takes a Crab
+// rather than a pointer so templates can call it on lists of crabs.
+func (c Crab) AvatarAt(width int) string {
+	if key, ok := c.Avatars[strconv.Itoa(width)]; ok {
+		return key
+	}
+	return c.Avatar
+}
+
+// BannerAt is the key of the crab's banner at width, one of BannerSizes.
+func (c Crab) BannerAt(width int) string {
+	if key, ok := c.Banners[strconv.Itoa(width)]; ok {
+		return key
+	}
+	return c.Banner
+}
+
+// UpdateAvatar makes the crab a new avatar out of data, an image they
+// uploaded, and saves it on them. Old avatars are left where they are:
+// molts posted with them still show them.
+func (m CrabModel) UpdateAvatar(ctx context.Context, c *Crab, data []byte) error {
+	img, err := decodeImage(data)
+	if err != nil {
+		return err
+	}
+	avatars, err := m.putSizes(ctx, fmt.Sprintf("a/%s", c.ID), img, AvatarSizes, 1, 1)
+	if err != nil {
+		return err
+	}
+	avatar := avatars[strconv.Itoa(AvatarSizes[len(AvatarSizes)-1])]
+	sizes, err := attributevalue.Marshal(avatars)
+	if err != nil {
+		m.removeSizes(ctx, avatars)
+		return fmt.Errorf("Marshal: %w", err)
+	}
+	_, err = m.SVC.ItemTable.UpdateItem(ctx, &dynamodb.UpdateItemInput{
+		TableName: aws.String(TableName),
+		Key: map[string]types.AttributeValue{
+			"PK": &types.AttributeValueMemberS{Value: c.PK},
+			"SK": &types.AttributeValueMemberS{Value: c.SK},
+		},
+		ConditionExpression: aws.String("attribute_exists(PK)"),
+		UpdateExpression:    aws.String("set avatar = :avatar, avatars = :avatars"),
+		ExpressionAttributeValues: map[string]types.AttributeValue{
+			":avatar":  &types.AttributeValueMemberS{Value: avatar},
+			":avatars": sizes,
+		},
+	})
+	if err != nil {
+		m.removeSizes(ctx, avatars)
+		return fmt.Errorf("UpdateItem: %w", conflict(err))
+	}
+	c.Avatar, c.Avatars = avatar, avatars
+	return nil
+}
+
+// UploadBanner makes the crab a new banner out of data and puts it on c,
+// for UpdateProfile to save. It returns the keys of the banner it replaces,
+// to remove with RemoveBanner once the new one is saved.
+func (m CrabModel) UploadBanner(ctx context.Context, c *Crab, data []byte) ([]string, error) {
+	img, err := decodeImage(data)
+	if err != nil {
+		return nil, err
+	}
+	banners, err := m.putSizes(ctx, fmt.Sprintf("b/%s", c.ID), img, BannerSizes, 3, 1)
+	if err != nil {
+		return nil, err
+	}
+	old := make([]string, 0, len(c.Banners)+1)
+	for _, key := range c.Banners {
+		old = append(old, key)
+	}
+	if len(c.Banners) == 0 && c.Banner != "" {
+		old = append(old, c.Banner)
+	}
+	c.Banner, c.Banners = banners[strconv.Itoa(BannerSizes[len(BannerSizes)-1])], banners
+	return old, nil
+}
+
+// RemoveBanner deletes the images of a banner that has been replaced. It
+// carries on past failures and returns the first.
+func (m CrabModel) RemoveBanner(ctx context.Context, keys []string) error {
+	var first error
+	for _, key := range keys {
+		err := m.Blobs.Delete(ctx, key)
+		if err != nil && first == nil {
+			first = err
+		}
+	}
+	return first
+}
+
+// putSizes stores img cropped to an aw:ah shape at each of widths, under
+// prefix, and returns their keys by width. Nothing is left behind if one
+// fails.
+func (m CrabModel) putSizes(ctx context.Context, prefix string, img image.Image, widths []int, aw, ah int) (map[string]string, error) {
+	id := uuid.New().String()
+	keys := make(map[string]string, len(widths))
+	for _, w := range widths {
+		data, contentType, err := encodeImage(cover(img, w, w*ah/aw))
+		if err != nil {
+			m.removeSizes(ctx, keys)
+			return nil, err
+		}
+		key := fmt.Sprintf("%s/%s_%d%s", prefix, id, w, extension(contentType))
+		err = m.Blobs.Put(ctx, key, contentType, data)
+		if err != nil {
+			m.removeSizes(ctx, keys)
+			return nil, err
+		}
+		keys[strconv.Itoa(w)] = key
+	}
+	return keys, nil
+}
+
+func (m CrabModel) removeSizes(ctx context.Context, keys map[string]string) {
+	for _, key := range keys {
+		m.Blobs.Delete(ctx, key)
+	}
+}
@@ -0,0 +1,79 @@
+package models
+
+import (
+	"context"
+	"fmt"
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/feature/dynamodb/attributevalue"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+)
+
+type BlockModel struct {
+	SVC ItemService
+}
+
+// Block records that one crab has blocked another.
+type Block struct {
+	PK string `dynamodbav:"PK"` // B#blockerID
+	SK string `dynamodbav:"SK"` // B#blockedID
+}
+
+func (m BlockModel) Insert(ctx context.Context, blockerID, blockedID string) error {
+	item, err := attributevalue.MarshalMap(
+		&Block{
+			PK: fmt.Sprintf("B#%s", blockerID),
+			SK: fmt.Sprintf("B#%s", blockedID),
+		})
+	if err != nil {
+		return fmt.Errorf("MarshalMap: %w", err)
+	}
+	_, err = m.SVC.ItemTable.PutItem(ctx, &dynamodb.PutItemInput{
+		TableName:           aws.String(TableName),
+		Item:                item,
+		ConditionExpression: aws.String("attribute_not_exists(PK)"),
+	})
+	if err != nil {
+		return fmt.Errorf("PutItem: %w", conflict(err))
+	}
+	return nil
+}
+
+func (m BlockModel) Delete(ctx context.Context, blockerID, blockedID string) error {
+	_, err := m.SVC.ItemTable.DeleteItem(ctx, &dynamodb.DeleteItemInput{
+		TableName: aws.String(TableName),
+		Key: map[string]types.AttributeValue{
+			"PK": &types.AttributeValueMemberS{Value: fmt.Sprintf("B#%s", blockerID)},
+			"SK": &types.AttributeValueMemberS{Value: fmt.Sprintf("B#%s", blockedID)},
+		},
+		ConditionExpression: aws.String("attribute_exists(PK)"),
+	})
+	if err != nil {
+		return fmt.Errorf("DeleteItem: %w", conflict(err))
+	}
+	return nil
+}
+
+// Exists reports whether blocker has blocked blocked
+func (m BlockModel) Exists(ctx context.Context, blockerID, blockedID string) (bool, error) {
+	data, err := m.SVC.ItemTable.GetItem(ctx, &dynamodb.GetItemInput{
+		TableName: aws.String(TableName),
+		Key: map[string]types.AttributeValue{
+			"PK": &types.AttributeValueMemberS{Value: fmt.Sprintf("B#%s", blockerID)},
+			"SK": &types.AttributeValueMemberS{Value: fmt.Sprintf("B#%s", blockedID)},
+		},
+	})
+	if err != nil {
+		return false, fmt.Errorf("GetItem: %w", err)
+	}
+	return data.Item != nil, nil
+}
+
+// Between reports whether either crab has blocked the other
+func (m BlockModel) Between(ctx context.Context, a, b string) (bool, error) {
+	blocked, err := m.Exists(ctx, a, b)
+	if err != nil || blocked {
+		return blocked, err
+	}
+	return m.Exists(ctx, b, a)
+}
@@ -0,0 +1,240 @@
+package models
+
+import (
+	"context"
+	"fmt"
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/feature/dynamodb/attributevalue"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+	"krabber.net/internal/models/ksuid"
+	"sort"
+	"time"
+)
+
+// Celebrity marks a crab with so many followers that their molts aren't
+// written into trenches. Trenches read them in instead, see Celebrities.
+// The fan-out worker keeps the marks in step with follower counts each
+// time the crab molts.
+type Celebrity struct {
+	PK     string `dynamodbav:"PK"` // CB
+	SK     string `dynamodbav:"SK"` // CB#crabID
+	CrabID string `dynamodbav:"crab_id"`
+}
+
+// celebrity reports whether c has too many followers for their molts to be
+// written into trenches.
+func (m TrenchModel) celebrity(c *Crab) bool {
+	return m.CelebrityFollowers > 0 && c.FollowerCount >= m.CelebrityFollowers
+}
+
+// mark records whether the crab is a celebrity. It is called on every
+// fan-out so a crab who gains or loses followers moves across; demote has
+// to have run first for one who loses them.
+func (m TrenchModel) mark(ctx context.Context, c *Crab) error {
+	key := map[string]types.AttributeValue{
+		"PK": &types.AttributeValueMemberS{Value: "CB"},
+		"SK": &types.AttributeValueMemberS{Value: "CB#" + c.ID},
+	}
+	if !m.celebrity(c) {
+		_, err := m.SVC.ItemTable.DeleteItem(ctx, &dynamodb.DeleteItemInput{
+			TableName: aws.String(TableName),
+			Key:       key,
+		})
+		if err != nil {
+			return fmt.Errorf("DeleteItem: %w", err)
+		}
+		return nil
+	}
+	item, err := attributevalue.MarshalMap(&Celebrity{PK: "CB", SK: "CB#" + c.ID, CrabID: c.ID})
+	if err != nil {
+		return fmt.Errorf("MarshalMap: %w", err)
+	}
+	_, err = m.SVC.ItemTable.PutItem(ctx, &dynamodb.PutItemInput{
+		TableName: aws.String(TableName),
+		Item:      item,
+	})
+	if err != nil {
+		return fmt.Errorf("PutItem: %w", err)
+	}
+	return nil
+}
+
+// demote writes the molts c posted as a celebrity into their followers'
+// trenches once c has too few followers to be one, before mark takes the
+// mark away and trenches stop reading them in. Only molts young enough to
+// still be in trenches are written. It does nothing unless c is still
+// marked, so a job that fails part way through does it all again when it
+// is retried.
+func (m TrenchModel) demote(ctx context.Context, job *FanOut, c *Crab) error {
+	if m.celebrity(c) {
+		return nil
+	}
+	out, err := m.SVC.ItemTable.GetItem(ctx, &dynamodb.GetItemInput{
+		TableName: aws.String(TableName),
+		Key: map[string]types.AttributeValue{
+			"PK": &types.AttributeValueMemberS{Value: "CB"},
+			"SK": &types.AttributeValueMemberS{Value: "CB#" + c.ID},
+		},
+	})
+	if err != nil {
+		return fmt.Errorf("GetItem: %w", err)
+	}
+	if out.Item == nil {
+		return nil
+	}
+	molts, err := MoltModel{SVC: m.SVC}.Before(ctx, c.ID, time.Time{}, time.Now().Add(-TrenchTTL))
+	if err != nil || len(molts) == 0 {
+		return err
+	}
+	cursor := ""
+	for {
+		followers, next, err := FollowModel{SVC: m.SVC}.Followers(ctx, c.ID, cursor)
+		if err != nil {
+			return err
+		}
+		requests := make([]types.WriteRequest, 0, len(followers)*len(molts))
+		for _, f := range followers {
+			for i := range molts {
+				put, err := trenchPut(f.FollowerID(), &molts[i])
+				if err != nil {
+					return err
+				}
+				requests = append(requests, put)
+			}
+		}
+		err = batchWrite(ctx, m.SVC.ItemTable, requests)
+		if err != nil {
+			return err
+		}
+		if next == "" {
+			return nil
+		}
+		err = m.lease(ctx, job, time.Now().Add(FanOutLease), "", nil)
+		if err != nil {
+			return err
+		}
+		cursor = next
+	}
+}
+
+// Celebrities returns the ids of the celebrities crabID follows, whose
+// molts their trench has to read in. There are few celebrities, so each is
+// checked against crabID's follows rather than the other way round.
+func (m TrenchModel) Celebrities(ctx context.Context, crabID string) ([]string, error) {
+	p := dynamodb.NewQueryPaginator(m.SVC.ItemTable, &dynamodb.QueryInput{
+		TableName:              aws.String(TableName),
+		KeyConditionExpression: aws.String("PK = :pk"),
+		ExpressionAttributeValues: map[string]types.AttributeValue{
+			":pk": &types.AttributeValueMemberS{Value: "CB"},
+		},
+	})
+	ids := make([]string, 0)
+	for p.HasMorePages() {
+		out, err := p.NextPage(ctx)
+		if err != nil {
+			return nil, fmt.Errorf("Query: %w", err)
+		}
+		celebrities := make([]Celebrity, 0, len(out.Items))
+		err = attributevalue.UnmarshalListOfMaps(out.Items, &celebrities)
+		if err != nil {
+			return nil, fmt.Errorf("UnmarshalListOfMaps: %w", err)
+		}
+		for _, c := range celebrities {
+			follows, err := FollowModel{SVC: m.SVC}.Exists(ctx, crabID, c.CrabID)
+			if err != nil {
+				return nil, err
+			}
+			if follows {
+				ids = append(ids, c.CrabID)
+			}
+		}
+	}
+	return ids, nil
+}
+
+// Before returns crabID's molts posted before before, or their newest if it
+// is zero, newest first. With a zero floor that is up to a page of them;
+// otherwise it is every one posted since floor, however many pages that
+// takes. Replies, remolts and deleted molts are left out, as fan-out leaves
+// them out of trenches.
+func (m MoltModel) Before(ctx context.Context, crabID string, before, floor time.Time) ([]Molt, error) {
+	values := map[string]types.AttributeValue{
+		":hashKey": &types.AttributeValueMemberS{Value: "M#" + crabID},
+		":deleted": &types.AttributeValueMemberBOOL{Value: true},
+		":remolt":  &types.AttributeValueMemberBOOL{Value: true},
+	}
+	// the smallest KSUIDs of those seconds, so before's second is left out
+	// and floor's is kept
+	if !before.IsZero() {
+		values[":before"] = &types.AttributeValueMemberS{Value: fmt.Sprintf("M#%s#%s", crabID, ksuid.Floor(before))}
+	}
+	if !floor.IsZero() {
+		values[":floor"] = &types.AttributeValueMemberS{Value: fmt.Sprintf("M#%s#%s", crabID, ksuid.Floor(floor))}
+	}
+	cond := "PK = :hashKey"
+	switch {
+	case !before.IsZero() && !floor.IsZero():
+		cond += " AND SK BETWEEN :floor AND :before"
+	case !before.IsZero():
+		cond += " AND SK < :before"
+	case !floor.IsZero():
+		cond += " AND SK >= :floor"
+	}
+	in := &dynamodb.QueryInput{
+		TableName:                 aws.String(TableName),
+		Limit:                     aws.Int32(PageSize),
+		KeyConditionExpression:    aws.String(cond),
+		FilterExpression:          aws.String("deleted <> :deleted AND remolt <> :remolt AND attribute_not_exists(in_reply_to)"),
+		ExpressionAttributeValues: values,
+		ScanIndexForward:          aws.Bool(false),
+	}
+	molts := make([]Molt, 0)
+	cursor := ""
+	for {
+		items, next, err := queryPage(ctx, m.SVC.ItemTable, in, cursor)
+		if err != nil {
+			return nil, err
+		}
+		page := make([]Molt, 0, len(items))
+		err = attributevalue.UnmarshalListOfMaps(items, &page)
+		if err != nil {
+			return nil, err
+		}
+		molts = append(molts, page...)
+		if floor.IsZero() || next == "" {
+			return molts, nil
+		}
+		cursor = next
+	}
+}
+
+// MergeMolts puts molts from several lists into one, newest first by the
+// time in their KSUIDs, keeping the first of any that appear twice.
+func MergeMolts(lists ...[]Molt) []Molt {
+	seen := make(map[string]bool)
+	merged := make([]Molt, 0)
+	for _, list := range lists {
+		for _, molt := range list {
+			if seen[molt.ID] {
+				continue
+			}
+			seen[molt.ID] = true
+			merged = append(merged, molt)
+		}
+	}
+	sort.SliceStable(merged, func(i, j int) bool {
+		return moltTime(merged[i]).After(moltTime(merged[j]))
+	})
+	return merged
+}
+
+// moltTime is when molt was posted, or the zero time if its key is too old
+// to say.
+func moltTime(molt Molt) time.Time {
+	t, err := molt.Created()
+	if err != nil {
+		return time.Time{}
+	}
+	return t
+}
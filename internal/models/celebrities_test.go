@@ -0,0 +1,125 @@
+package models
+
+import (
+	"context"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"krabber.net/internal/models/ksuid"
+	"krabber.net/internal/models/memdb"
+)
+
+// TestCelebrityDemoted has a celebrity molt and remolt, then lose enough
+// followers to stop being one, and checks what their follower's trench
+// shows at each step.
+func TestCelebrityDemoted(t *testing.T) {
+	ctx := context.Background()
+	svc := ItemService{ItemTable: memdb.New()}
+	crabs := CrabModel{SVC: svc}
+	star, err := crabs.Insert(ctx, &Crab{Email: "star@example.com", UserName: "star"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	fan, err := crabs.Insert(ctx, &Crab{Email: "fan@example.com", UserName: "fan"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	other, err := crabs.Insert(ctx, &Crab{Email: "other@example.com", UserName: "other"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := (FollowModel{SVC: svc}).Insert(ctx, fan, star); err != nil {
+		t.Fatal(err)
+	}
+	molts := MoltModel{SVC: svc}
+	post := func(c *Crab, content string) *Molt {
+		t.Helper()
+		k := ksuid.GenerateKSUID().String()
+		molt := &Molt{
+			ID:      uuid.New().String(),
+			PK:      "M#" + c.ID,
+			SK:      fmt.Sprintf("M#%s#%s", c.ID, k),
+			GSI5PK:  "M#" + k,
+			GSI5SK:  "M#" + k,
+			Author:  c.ID,
+			Content: content,
+		}
+		if err := molts.Insert(ctx, molt); err != nil {
+			t.Fatal(err)
+		}
+		return molt
+	}
+	fanOut := func(trench TrenchModel) {
+		t.Helper()
+		jobs, err := trench.DueFanOuts(ctx, time.Now())
+		if err != nil {
+			t.Fatal(err)
+		}
+		for _, job := range jobs {
+			if err := trench.FanOut(ctx, job); err != nil {
+				t.Fatal(err)
+			}
+		}
+	}
+	// what the fan's trench shows: what was written into it, and the
+	// molts of the celebrities they follow
+	shown := func(trench TrenchModel) map[string]bool {
+		t.Helper()
+		entries, _, err := trench.Get(ctx, fan.ID, "")
+		if err != nil {
+			t.Fatal(err)
+		}
+		page, err := NewHydrator(svc, fan.ID).TrenchMolts(ctx, entries)
+		if err != nil {
+			t.Fatal(err)
+		}
+		lists := [][]Molt{page}
+		celebrities, err := trench.Celebrities(ctx, fan.ID)
+		if err != nil {
+			t.Fatal(err)
+		}
+		for _, id := range celebrities {
+			molts, err := molts.Before(ctx, id, time.Time{}, time.Time{})
+			if err != nil {
+				t.Fatal(err)
+			}
+			lists = append(lists, molts)
+		}
+		contents := map[string]bool{}
+		for _, molt := range MergeMolts(lists...) {
+			contents[molt.Content] = true
+		}
+		return contents
+	}
+
+	celebrity := TrenchModel{SVC: svc, CelebrityFollowers: 1}
+	post(star, "famous")
+	original := post(other, "someone else's")
+	fanOut(celebrity)
+	star, _ = crabs.ByID(ctx, star.ID)
+	remolt := &Molt{
+		ID:      uuid.New().String(),
+		PK:      "M#" + star.ID,
+		SK:      fmt.Sprintf("M#%s#%s", star.ID, ksuid.GenerateKSUID()),
+		Author:  original.Author,
+		Content: original.Content,
+	}
+	if err := molts.ReMolt(ctx, star, original, remolt); err != nil {
+		t.Fatal(err)
+	}
+	got := shown(celebrity)
+	if !got["famous"] || got["someone else's"] {
+		t.Fatalf("as a celebrity: shown %v, want only the celebrity's own molt", got)
+	}
+
+	// the star's next molt finds them with too few followers
+	demoted := TrenchModel{SVC: svc, CelebrityFollowers: 2}
+	post(star, "ordinary")
+	fanOut(demoted)
+	got = shown(demoted)
+	if !got["famous"] || !got["ordinary"] || got["someone else's"] {
+		t.Errorf("demoted: shown %v, want both of the crab's own molts", got)
+	}
+}
@@ -1,7 +1,6 @@
 package models
 
 import (
-	"bytes"
 	"context"
 	"errors"
 	"fmt"
@@ -9,15 +8,10 @@ import (
 	"github.com/aws/aws-sdk-go-v2/feature/dynamodb/attributevalue"
 	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
 	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
-	"github.com/aws/aws-sdk-go/aws/session"
-	"github.com/aws/aws-sdk-go/service/s3"
-	"github.com/globalsign/mgo/bson"
 	"github.com/google/uuid"
 	"golang.org/x/crypto/bcrypt"
+	"krabber.net/internal/models/storage"
 	"krabber.net/internal/models/validator"
-	"mime/multipart"
-	"net/http"
-	"path/filepath"
 	"strings"
 	"time"
 )
@@ -25,10 +19,15 @@ import (
 // Define a custom ErrDuplicateEmail error.
 var (
 	ErrDuplicateEmail = errors.New("duplicate email")
+	// ErrDuplicateUserName is returned when another crab has the name,
+	// ignoring case.
+	ErrDuplicateUserName = errors.New("duplicate user name")
 )
 
 type CrabModel struct {
 	SVC ItemService
+	// Blobs is where avatars and banners are kept.
+	Blobs storage.Store
 }
 
 // Declare a new AnonymousUser variable.
@@ -42,10 +41,12 @@ type Crab struct {
 	GSI1SK         string   `dynamodbav:"GSI1SK"`
 	GSI2PK         string   `dynamodbav:"GSI2PK"`
 	GSI2SK         string   `dynamodbav:"GSI2SK"`
+	GSI8PK         string   `dynamodbav:"GSI8PK,omitempty"`
+	GSI8SK         string   `dynamodbav:"GSI8SK,omitempty"`
 	Activated      bool     `dynamodbav:"activated"`
-	Avatar         string   `dynamodbav:"avatar"`
+	Avatar         string   `dynamodbav:"avatar"` // largest of Avatars
 	Banned         bool     `dynamodbav:"banned"`
-	Banner         string   `dynamodbav:"banner"`
+	Banner         string   `dynamodbav:"banner"` // largest of Banners
 	Created        string   `dynamodbav:"created"`
 	Description    string   `dynamodbav:"description"`
 	Display        string   `dynamodbav:"display"`
@@ -61,6 +62,14 @@ type Crab struct {
 	PasswordHash   []byte   `dynamodbav:"password_hash"`
 	Website        string   `dynamodbav:"website"`
 	Verified       bool     `dynamodbav:"verified"`
+	// Avatars and Banners are the keys of each size the crab's avatar and
+	// banner were made at, by width.
+	Avatars map[string]string `dynamodbav:"avatars,omitempty"`
+	Banners map[string]string `dynamodbav:"banners,omitempty"`
+	// Followed and FollowsYou say whether the crab looking follows this
+	// crab and whether this crab follows them back, when it is being listed.
+	Followed   bool `dynamodbav:"-"`
+	FollowsYou bool `dynamodbav:"-"`
 }
 
 // Check if a User instance is the AnonymousUser.
@@ -77,75 +86,127 @@ type password struct {
 	hash      []byte
 }
 
-func (m CrabModel) UpdateAvatar(c *Crab, s *session.Session, file multipart.File, fileHeader *multipart.FileHeader, bucket string) (string, error) {
-	size := fileHeader.Size
-	buffer := make([]byte, size)
-	file.Read(buffer)
-	// create a unique file name for the file
-	tempFileName := c.ID + "/" + bson.NewObjectId().Hex() + filepath.Ext(fileHeader.Filename)
-	// filename, content-type and storage class of the file
-	// you're uploading
-	_, err := s3.New(s).PutObject(&s3.PutObjectInput{
-		Bucket:               aws.String(bucket),
-		Key:                  aws.String(tempFileName),
-		ACL:                  aws.String("private"), // could be private if you want it to be access by only authorized users
-		Body:                 bytes.NewReader(buffer),
-		ContentLength:        aws.Int64(int64(size)),
-		ContentType:          aws.String(http.DetectContentType(buffer)),
-		ContentDisposition:   aws.String("attachment"),
-		ServerSideEncryption: aws.String("AES256"),
-		StorageClass:         aws.String("INTELLIGENT_TIERING"),
-	})
+// UpdateProfile saves the parts of a crab's profile they can edit in settings.
+func (m CrabModel) UpdateProfile(ctx context.Context, c *Crab) error {
+	banners, err := attributevalue.Marshal(c.Banners)
 	if err != nil {
-		return "", err
+		return fmt.Errorf("Marshal: %w", err)
 	}
-
-	_, err = m.SVC.ItemTable.UpdateItem(context.TODO(), &dynamodb.UpdateItemInput{
+	_, err = m.SVC.ItemTable.UpdateItem(ctx, &dynamodb.UpdateItemInput{
 		TableName: aws.String(TableName),
 		Key: map[string]types.AttributeValue{
 			"PK": &types.AttributeValueMemberS{Value: c.PK},
 			"SK": &types.AttributeValueMemberS{Value: c.SK},
 		},
-		UpdateExpression: aws.String(fmt.Sprintf("set %s = :%s", "avatar", "avatar")),
+		ConditionExpression: aws.String("attribute_exists(PK)"),
+		UpdateExpression:    aws.String("set display = :display, description = :description, website = :website, banner = :banner, banners = :banners"),
 		ExpressionAttributeValues: map[string]types.AttributeValue{
-			fmt.Sprintf(":%s", "avatar"): &types.AttributeValueMemberS{Value: tempFileName},
+			":display":     &types.AttributeValueMemberS{Value: c.Display},
+			":description": &types.AttributeValueMemberS{Value: c.Description},
+			":website":     &types.AttributeValueMemberS{Value: c.Website},
+			":banner":      &types.AttributeValueMemberS{Value: c.Banner},
+			":banners":     banners,
 		},
 	})
-	fmt.Printf("ERROr Updating Crab avatar: %v", err)
 	if err != nil {
-		panic(err)
+		return fmt.Errorf("UpdateItem: %w", conflict(err))
+	}
+	SearchModel{SVC: m.SVC}.reindexCrab(ctx, c)
+	return nil
+}
+
+// ChangeEmail moves a crab to a new email. The email is part of the key, so the
+// crab is written under the new one and the old item deleted in one transaction.
+func (m CrabModel) ChangeEmail(ctx context.Context, c *Crab, email string) (*Crab, error) {
+	_, err := m.ByEmail(ctx, email)
+	switch {
+	case err == nil:
+		return nil, ErrDuplicateEmail
+	case !errors.Is(err, ErrNoRecord):
+		return nil, err
 	}
+	moved := *c
+	moved.PK = fmt.Sprintf("C#%s", email)
+	moved.GSI1PK = fmt.Sprintf("C#%s", email)
+	moved.GSI1SK = fmt.Sprintf("C#%s", email)
+	moved.Email = email
 
-	return tempFileName, err
+	item, err := attributevalue.MarshalMap(&moved)
+	if err != nil {
+		return nil, fmt.Errorf("MarshalMap: %w", err)
+	}
+	_, err = m.SVC.ItemTable.TransactWriteItems(ctx, &dynamodb.TransactWriteItemsInput{
+		TransactItems: []types.TransactWriteItem{
+			{
+				Put: &types.Put{
+					Item:                item,
+					TableName:           aws.String(TableName),
+					ConditionExpression: aws.String("attribute_not_exists(PK)"),
+				},
+			},
+			{
+				Delete: &types.Delete{
+					Key: map[string]types.AttributeValue{
+						"PK": &types.AttributeValueMemberS{Value: c.PK},
+						"SK": &types.AttributeValueMemberS{Value: c.SK},
+					},
+					TableName:           aws.String(TableName),
+					ConditionExpression: aws.String("attribute_exists(PK)"),
+				},
+			},
+		},
+	})
+	if err != nil {
+		if errors.Is(conflict(err), ErrConflict) {
+			return nil, ErrDuplicateEmail
+		}
+		return nil, fmt.Errorf("TransactWriteItems: %w", err)
+	}
+	// search finds crabs by their key
+	SearchModel{SVC: m.SVC}.reindexCrab(ctx, &moved)
+	return &moved, nil
 }
 
-func (m CrabModel) Show() ([]Crab, error) {
-	p := dynamodb.NewScanPaginator(m.SVC.ItemTable, &dynamodb.ScanInput{
+// Show a page of every crab
+func (m CrabModel) Show(ctx context.Context, cursor string) ([]Crab, string, error) {
+	items, next, err := scanPage(ctx, m.SVC.ItemTable, &dynamodb.ScanInput{
 		TableName: aws.String(TableName),
 		Limit:     aws.Int32(PageSize),
 		IndexName: aws.String("GSI2"),
-	})
-	var items []Crab
-	for p.HasMorePages() {
-		out, err := p.NextPage(context.TODO())
-		if err != nil {
-			fmt.Printf("ERR: %s", err)
-			panic(err)
-		}
-		var pItems []Crab
-		err = attributevalue.UnmarshalListOfMaps(out.Items, &pItems)
-		if err != nil {
-			fmt.Printf("ERR: %s", err)
-			panic(err)
-		}
-		items = append(items, pItems...)
+	}, cursor)
+	if err != nil {
+		return nil, "", err
+	}
+	crabs := make([]Crab, 0)
+	err = attributevalue.UnmarshalListOfMaps(items, &crabs)
+	if err != nil {
+		return nil, "", err
+	}
+	return crabs, next, nil
+}
 
+// userNameKey is the key of the item that holds a user name for one crab.
+// GSI8 finds crabs by name but can't keep two from sharing one, so the crab
+// is written with this item, which can only be put once.
+func userNameKey(name string) map[string]types.AttributeValue {
+	key := fmt.Sprintf("CU#%s", strings.ToLower(name))
+	return map[string]types.AttributeValue{
+		"PK": &types.AttributeValueMemberS{Value: key},
+		"SK": &types.AttributeValueMemberS{Value: key},
 	}
-	return items, nil
 }
 
-// Insert - creates user record in table
-func (m CrabModel) Insert(crab *Crab) (*Crab, error) {
+// Insert - creates user record in table. The key only makes the email and
+// user name pair unique, so the email is looked up first to keep it to one crab
+// and the name is held by its own item, put in the same transaction.
+func (m CrabModel) Insert(ctx context.Context, crab *Crab) (*Crab, error) {
+	_, err := m.ByEmail(ctx, crab.Email)
+	switch {
+	case err == nil:
+		return nil, ErrDuplicateEmail
+	case !errors.Is(err, ErrNoRecord):
+		return nil, err
+	}
 	id := uuid.New().String()
 	c := &Crab{
 		ID:           id,
@@ -155,6 +216,8 @@ func (m CrabModel) Insert(crab *Crab) (*Crab, error) {
 		GSI1SK:       fmt.Sprintf("C#%s", crab.Email),
 		GSI2PK:       fmt.Sprintf("ID#%s", id),
 		GSI2SK:       fmt.Sprintf("ID#%s", id),
+		GSI8PK:       fmt.Sprintf("CU#%s", strings.ToLower(crab.UserName)),
+		GSI8SK:       fmt.Sprintf("CU#%s", strings.ToLower(crab.UserName)),
 		Created:      fmt.Sprintf(time.Now().Format(time.RFC3339)),
 		Email:        crab.Email,
 		PasswordHash: crab.Password.hash,
@@ -163,86 +226,117 @@ func (m CrabModel) Insert(crab *Crab) (*Crab, error) {
 
 	item, err := attributevalue.MarshalMap(c)
 	if err != nil {
-		panic(err)
+		return nil, fmt.Errorf("MarshalMap: %w", err)
 	}
-	_, err = m.SVC.ItemTable.PutItem(context.TODO(), &dynamodb.PutItemInput{
-		TableName:           aws.String(TableName),
-		Item:                item,
-		ConditionExpression: aws.String("attribute_not_exists(PK)"), // one email to one user...
+	name := userNameKey(c.UserName)
+	name["id"] = &types.AttributeValueMemberS{Value: id}
+	_, err = m.SVC.ItemTable.TransactWriteItems(ctx, &dynamodb.TransactWriteItemsInput{
+		TransactItems: []types.TransactWriteItem{
+			{
+				Put: &types.Put{
+					TableName:           aws.String(TableName),
+					Item:                item,
+					ConditionExpression: aws.String("attribute_not_exists(PK)"), // one email to one user...
+				},
+			},
+			{
+				Put: &types.Put{
+					TableName:           aws.String(TableName),
+					Item:                name,
+					ConditionExpression: aws.String("attribute_not_exists(PK)"), // ...and one user to one name
+				},
+			},
+		},
 	})
 	if err != nil {
-		fmt.Printf("\n\nERROR Inserting Crab Item: %v", item)
-		fmt.Printf("\n\nERROR Inserting Crab: %v", err)
+		var tce *types.TransactionCanceledException
+		if errors.As(err, &tce) && len(tce.CancellationReasons) == 2 &&
+			aws.ToString(tce.CancellationReasons[1].Code) == "ConditionalCheckFailed" {
+			return nil, ErrDuplicateUserName
+		}
+		if errors.Is(conflict(err), ErrConflict) {
+			return nil, ErrDuplicateEmail
+		}
+		return nil, fmt.Errorf("TransactWriteItems: %w", err)
 	}
-	return c, err
+	SearchModel{SVC: m.SVC}.reindexCrab(ctx, c)
+	return c, nil
 }
 
-func (m CrabModel) Activate(crab *Crab) error {
-	//fmt.Println("update crab ", prettyPrint(crab))
-	_, err := m.SVC.ItemTable.UpdateItem(context.TODO(), &dynamodb.UpdateItemInput{
+func (m CrabModel) Activate(ctx context.Context, crab *Crab) error {
+	_, err := m.SVC.ItemTable.UpdateItem(ctx, &dynamodb.UpdateItemInput{
 		TableName: aws.String(TableName),
 		Key: map[string]types.AttributeValue{
 			"PK": &types.AttributeValueMemberS{Value: crab.PK},
 			"SK": &types.AttributeValueMemberS{Value: crab.SK},
 		},
-		UpdateExpression: aws.String(fmt.Sprintf("set %s = :%s", "activated", "activated")),
+		ConditionExpression: aws.String("attribute_exists(PK)"),
+		UpdateExpression:    aws.String(fmt.Sprintf("set %s = :%s", "activated", "activated")),
 		ExpressionAttributeValues: map[string]types.AttributeValue{
 			fmt.Sprintf(":%s", "activated"): &types.AttributeValueMemberBOOL{Value: crab.Activated},
 		},
 	})
-
 	if err != nil {
-		panic(err)
+		return fmt.Errorf("UpdateItem: %w", conflict(err))
 	}
-
 	return nil
 }
 
-func (m CrabModel) ResetPassword(crab *Crab) error {
-	_, err := m.SVC.ItemTable.UpdateItem(context.TODO(), &dynamodb.UpdateItemInput{
+func (m CrabModel) ResetPassword(ctx context.Context, crab *Crab) error {
+	_, err := m.SVC.ItemTable.UpdateItem(ctx, &dynamodb.UpdateItemInput{
 		TableName: aws.String(TableName),
 		Key: map[string]types.AttributeValue{
 			"PK": &types.AttributeValueMemberS{Value: crab.PK},
 			"SK": &types.AttributeValueMemberS{Value: crab.SK},
 		},
-		UpdateExpression: aws.String(fmt.Sprintf("set %s = :%s", "password_hash", "password_hash")),
+		ConditionExpression: aws.String("attribute_exists(PK)"),
+		UpdateExpression:    aws.String(fmt.Sprintf("set %s = :%s", "password_hash", "password_hash")),
 		ExpressionAttributeValues: map[string]types.AttributeValue{
 			fmt.Sprintf(":%s", "password_hash"): &types.AttributeValueMemberB{Value: crab.Password.hash},
 		},
 	})
-
 	if err != nil {
-		panic(err)
+		return fmt.Errorf("UpdateItem: %w", conflict(err))
 	}
-
 	return nil
 }
 
-func (m CrabModel) Exists(id string) (bool, error) {
-	c := make([]Crab, 0)
-	ut, err := m.SVC.ItemTable.Query(context.TODO(), &dynamodb.QueryInput{
+func (m CrabModel) Exists(ctx context.Context, id string) (bool, error) {
+	ut, err := m.SVC.ItemTable.Query(ctx, &dynamodb.QueryInput{
 		TableName:              aws.String(TableName),
 		IndexName:              aws.String("GSI2"),
 		KeyConditionExpression: aws.String("GSI2PK = :gsi2pk"),
 		ExpressionAttributeValues: map[string]types.AttributeValue{
-			":gsi2pk": &types.AttributeValueMemberS{Value: fmt.Sprintf("C#%s", id)},
+			":gsi2pk": &types.AttributeValueMemberS{Value: fmt.Sprintf("ID#%s", id)},
 		},
+		Limit: aws.Int32(1),
 	})
 	if err != nil {
-		panic(err)
+		return false, fmt.Errorf("Query: %w", err)
+	}
+	return len(ut.Items) > 0, nil
+}
+
+// oneCrab queries for a single crab, returning ErrNoRecord when there isn't one.
+func (m CrabModel) oneCrab(ctx context.Context, in *dynamodb.QueryInput) (*Crab, error) {
+	ut, err := m.SVC.ItemTable.Query(ctx, in)
+	if err != nil {
+		return nil, fmt.Errorf("Query: %w", err)
 	}
-	err = attributevalue.UnmarshalListOfMaps(ut.Items, &c)
+	if len(ut.Items) == 0 {
+		return nil, ErrNoRecord
+	}
+	c := &Crab{}
+	err = attributevalue.UnmarshalMap(ut.Items[0], c)
 	if err != nil {
-		return false, err
+		return nil, fmt.Errorf("UnmarshalMap: %w", err)
 	}
-	return true, nil
-
+	return c, nil
 }
 
 // Change this to be by Email -> Add e-mail to param store ->
-func (m CrabModel) ByID(id string) (*Crab, error) {
-	c := make([]Crab, 0)
-	ut, err := m.SVC.ItemTable.Query(context.TODO(), &dynamodb.QueryInput{
+func (m CrabModel) ByID(ctx context.Context, id string) (*Crab, error) {
+	return m.oneCrab(ctx, &dynamodb.QueryInput{
 		TableName:              aws.String(TableName),
 		IndexName:              aws.String("GSI2"),
 		KeyConditionExpression: aws.String("GSI2PK = :gsi2pk"),
@@ -250,22 +344,116 @@ func (m CrabModel) ByID(id string) (*Crab, error) {
 			":gsi2pk": &types.AttributeValueMemberS{Value: fmt.Sprintf("ID#%s", id)},
 		},
 	})
+}
+
+// ByUserName looks a crab up by user name, ignoring case.
+func (m CrabModel) ByUserName(ctx context.Context, name string) (*Crab, error) {
+	return m.oneCrab(ctx, &dynamodb.QueryInput{
+		TableName:              aws.String(TableName),
+		IndexName:              aws.String("GSI8"),
+		KeyConditionExpression: aws.String("GSI8PK = :gsi8pk"),
+		ExpressionAttributeValues: map[string]types.AttributeValue{
+			":gsi8pk": &types.AttributeValueMemberS{Value: fmt.Sprintf("CU#%s", strings.ToLower(name))},
+		},
+	})
+}
+
+// IndexUserNames adds the user name index, and the item that holds the name,
+// to crabs that signed up before they existed, returning how many were
+// updated. When older crabs share a name the first one seen keeps it and the
+// others are taken out of the index, so ByUserName finds one crab.
+func (m CrabModel) IndexUserNames(ctx context.Context) (int, error) {
+	n := 0
+	cursor := ""
+	for {
+		crabs, next, err := m.Show(ctx, cursor)
+		if err != nil {
+			return n, err
+		}
+		for _, c := range crabs {
+			held, err := m.holdUserName(ctx, &c)
+			if err != nil {
+				return n, err
+			}
+			if held {
+				n++
+			}
+		}
+		if next == "" {
+			return n, nil
+		}
+		cursor = next
+	}
+}
+
+// holdUserName puts the item holding c's name and indexes c under it, unless
+// another crab holds the name, in which case c is taken out of the index.
+// It reports whether anything was added.
+func (m CrabModel) holdUserName(ctx context.Context, c *Crab) (bool, error) {
+	key := fmt.Sprintf("CU#%s", strings.ToLower(c.UserName))
+	name := userNameKey(c.UserName)
+	out, err := m.SVC.ItemTable.GetItem(ctx, &dynamodb.GetItemInput{
+		TableName: aws.String(TableName),
+		Key:       name,
+	})
 	if err != nil {
-		fmt.Printf("BYID ERROR %v", err)
-		panic(err)
+		return false, fmt.Errorf("GetItem: %w", err)
+	}
+	crab := map[string]types.AttributeValue{
+		"PK": &types.AttributeValueMemberS{Value: c.PK},
+		"SK": &types.AttributeValueMemberS{Value: c.SK},
+	}
+	if out.Item != nil {
+		if id, ok := out.Item["id"].(*types.AttributeValueMemberS); ok && id.Value == c.ID {
+			return false, nil
+		}
+		if c.GSI8PK == "" {
+			return false, nil
+		}
+		_, err = m.SVC.ItemTable.UpdateItem(ctx, &dynamodb.UpdateItemInput{
+			TableName:           aws.String(TableName),
+			Key:                 crab,
+			ConditionExpression: aws.String("attribute_exists(PK)"),
+			UpdateExpression:    aws.String("remove GSI8PK, GSI8SK"),
+		})
+		if err != nil {
+			return false, fmt.Errorf("UpdateItem: %w", conflict(err))
+		}
+		fmt.Println("ERROR duplicate user name: ", c.UserName, c.ID)
+		return false, nil
 	}
-	err = attributevalue.UnmarshalListOfMaps(ut.Items, &c)
+	name["id"] = &types.AttributeValueMemberS{Value: c.ID}
+	_, err = m.SVC.ItemTable.TransactWriteItems(ctx, &dynamodb.TransactWriteItemsInput{
+		TransactItems: []types.TransactWriteItem{
+			{
+				Put: &types.Put{
+					TableName:           aws.String(TableName),
+					Item:                name,
+					ConditionExpression: aws.String("attribute_not_exists(PK)"),
+				},
+			},
+			{
+				Update: &types.Update{
+					TableName:           aws.String(TableName),
+					Key:                 crab,
+					ConditionExpression: aws.String("attribute_exists(PK)"),
+					UpdateExpression:    aws.String("set GSI8PK = :key, GSI8SK = :key"),
+					ExpressionAttributeValues: map[string]types.AttributeValue{
+						":key": &types.AttributeValueMemberS{Value: key},
+					},
+				},
+			},
+		},
+	})
 	if err != nil {
-		fmt.Errorf("UnmarshalMap: %v\n", err)
+		return false, fmt.Errorf("TransactWriteItems: %w", conflict(err))
 	}
-	//fmt.Println("HERES BY ID", prettyPrint(&c[0]))
-	return &c[0], nil
+	return true, nil
 }
 
 // Change this to be by Email -> Add e-mail to param store ->
-func (m CrabModel) ByEmailForID(email string) (*Crab, error) {
-	c := make([]Crab, 0)
-	ut, err := m.SVC.ItemTable.Query(context.TODO(), &dynamodb.QueryInput{
+func (m CrabModel) ByEmailForID(ctx context.Context, email string) (*Crab, error) {
+	return m.oneCrab(ctx, &dynamodb.QueryInput{
 		TableName:              aws.String(TableName),
 		IndexName:              aws.String("GSI2"),
 		KeyConditionExpression: aws.String("GSI2PK = :gsi2pk"),
@@ -273,20 +461,10 @@ func (m CrabModel) ByEmailForID(email string) (*Crab, error) {
 			":gsi2pk": &types.AttributeValueMemberS{Value: fmt.Sprintf("C#%s", email)},
 		},
 	})
-	if err != nil {
-		panic(err)
-	}
-	err = attributevalue.UnmarshalListOfMaps(ut.Items, &c)
-	if err != nil {
-		fmt.Errorf("UnmarshalMap: %v\n", err)
-	}
-	//fmt.Println("HERES BY ID", prettyPrint(&c[0]))
-	return &c[0], nil
 }
 
-func (m CrabModel) ByEmail(email string) (*Crab, error) {
-	c := make([]Crab, 0)
-	ut, err := m.SVC.ItemTable.Query(context.TODO(), &dynamodb.QueryInput{
+func (m CrabModel) ByEmail(ctx context.Context, email string) (*Crab, error) {
+	return m.oneCrab(ctx, &dynamodb.QueryInput{
 		TableName:              aws.String(TableName),
 		IndexName:              aws.String("GSI1"),
 		KeyConditionExpression: aws.String("GSI1PK = :gsi1pk"),
@@ -294,38 +472,26 @@ func (m CrabModel) ByEmail(email string) (*Crab, error) {
 			":gsi1pk": &types.AttributeValueMemberS{Value: fmt.Sprintf("C#%s", email)},
 		},
 	})
-	if err != nil {
-		panic(err)
-	}
-	err = attributevalue.UnmarshalListOfMaps(ut.Items, &c)
-	if err != nil {
-		fmt.Errorf("UnmarshalMap: %v\n", err)
-	}
-	//fmt.Println("heres crab", prettyPrint(&c[0]))
-	return &c[0], nil
 }
 
-func (m CrabModel) ByToken(t *Token) (*Crab, error) {
-	c := &Crab{}
-	selectedKeys := map[string]string{
-		"PK": fmt.Sprintf("C#%s", t.CrabEmail),
-		"SK": fmt.Sprintf("CU#%s", t.CrabUserName),
-	}
-	key, err := attributevalue.MarshalMap(selectedKeys)
-	data, err := m.SVC.ItemTable.GetItem(context.TODO(), &dynamodb.GetItemInput{
+func (m CrabModel) ByToken(ctx context.Context, t *Token) (*Crab, error) {
+	data, err := m.SVC.ItemTable.GetItem(ctx, &dynamodb.GetItemInput{
 		TableName: aws.String(TableName),
-		Key:       key,
+		Key: map[string]types.AttributeValue{
+			"PK": &types.AttributeValueMemberS{Value: fmt.Sprintf("C#%s", t.CrabEmail)},
+			"SK": &types.AttributeValueMemberS{Value: fmt.Sprintf("CU#%s", strings.ToLower(t.CrabUserName))},
+		},
 	})
 	if err != nil {
-		return c, fmt.Errorf("GetItem: %v\n", err)
+		return nil, fmt.Errorf("GetItem: %w", err)
 	}
-
 	if data.Item == nil {
-		return c, fmt.Errorf("GetItem: Data not found.\n")
+		return nil, ErrNoRecord
 	}
-	err = attributevalue.UnmarshalMap(data.Item, &c)
+	c := &Crab{}
+	err = attributevalue.UnmarshalMap(data.Item, c)
 	if err != nil {
-		return c, fmt.Errorf("UnmarshalMap: %v\n", err)
+		return nil, fmt.Errorf("UnmarshalMap: %w", err)
 	}
 	return c, nil
 }
@@ -386,9 +552,25 @@ func ValidatePasswordPlaintext(v *validator.Validator, password string) {
 	v.Check(len(password) <= 72, "password", "must not be more than 72 bytes long")
 }
 
+func ValidateProfile(v *validator.Validator, crab *Crab) {
+	v.Check(validator.MaxChars(crab.Display, 50), "display", "must not be more than 50 characters long")
+	v.Check(validator.MaxChars(crab.Description, 160), "description", "must not be more than 160 characters long")
+	v.Check(validator.MaxChars(crab.Website, 100), "website", "must not be more than 100 characters long")
+	v.Check(crab.Website == "" || validator.URL(crab.Website), "website", "must be a valid http or https address")
+}
+
+// ReservedUserNames are the /crab pages a profile's url would otherwise shadow.
+var ReservedUserNames = []string{"signup", "login", "activate", "password"}
+
+// ValidUserName reports whether name can be served at /crab/<name>.
+func ValidUserName(name string) bool {
+	return !strings.Contains(name, "/") && !validator.PermittedValue(strings.ToLower(name), ReservedUserNames...)
+}
+
 func ValidateCrab(v *validator.Validator, crab *Crab) {
 	v.Check(crab.UserName != "", "name", "must be provided")
 	v.Check(len(crab.UserName) <= 500, "name", "must not be more than 500 bytes long")
+	v.Check(ValidUserName(crab.UserName), "name", "is reserved")
 
 	// Call the standalone ValidateEmail() helper.
 	ValidateEmail(v, crab.Email)
@@ -0,0 +1,39 @@
+package models
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"krabber.net/internal/models/memdb"
+)
+
+func TestInsertDuplicates(t *testing.T) {
+	ctx := context.Background()
+	m := CrabModel{SVC: ItemService{ItemTable: memdb.New()}}
+	if _, err := m.Insert(ctx, &Crab{Email: "crab@example.com", UserName: "Crab"}); err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		email, name string
+		want        error
+	}{
+		{email: "crab@example.com", name: "other", want: ErrDuplicateEmail},
+		{email: "other@example.com", name: "crab", want: ErrDuplicateUserName},
+		{email: "other@example.com", name: "CRAB", want: ErrDuplicateUserName},
+		{email: "other@example.com", name: "other"},
+	}
+	for _, tt := range tests {
+		_, err := m.Insert(ctx, &Crab{Email: tt.email, UserName: tt.name})
+		if tt.want == nil && err != nil || !errors.Is(err, tt.want) {
+			t.Errorf("%s %s: got %v, want %v", tt.email, tt.name, err, tt.want)
+		}
+	}
+	c, err := m.ByUserName(ctx, "CrAb")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if c.Email != "crab@example.com" {
+		t.Errorf("ByUserName found %s", c.Email)
+	}
+}
@@ -0,0 +1,162 @@
+package models
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+	"krabber.net/internal/models/expr"
+)
+
+// ErrInvalidCursor is returned when a cursor from a request can't be decoded,
+// or doesn't hold a key the list it was passed to could have handed out.
+var ErrInvalidCursor = errors.New("models: invalid cursor")
+
+// EncodeCursor turns a LastEvaluatedKey into an opaque, URL safe string that
+// can be handed back to the list method to read the next page. A nil key (no
+// more pages) encodes to "".
+func EncodeCursor(key map[string]types.AttributeValue) (string, error) {
+	if len(key) == 0 {
+		return "", nil
+	}
+	flat := make(map[string]string, len(key))
+	for k, v := range key {
+		s, ok := v.(*types.AttributeValueMemberS)
+		if !ok {
+			return "", fmt.Errorf("cursor: key attribute %s is not a string", k)
+		}
+		flat[k] = s.Value
+	}
+	b, err := json.Marshal(flat)
+	if err != nil {
+		return "", err
+	}
+	return base64.RawURLEncoding.EncodeToString(b), nil
+}
+
+// DecodeCursor is the inverse of EncodeCursor. An empty cursor is the first
+// page and decodes to a nil key.
+func DecodeCursor(cursor string) (map[string]types.AttributeValue, error) {
+	if cursor == "" {
+		return nil, nil
+	}
+	b, err := base64.RawURLEncoding.DecodeString(cursor)
+	if err != nil {
+		return nil, ErrInvalidCursor
+	}
+	var flat map[string]string
+	if err := json.Unmarshal(b, &flat); err != nil || len(flat) == 0 {
+		return nil, ErrInvalidCursor
+	}
+	key := make(map[string]types.AttributeValue, len(flat))
+	for k, v := range flat {
+		key[k] = &types.AttributeValueMemberS{Value: v}
+	}
+	return key, nil
+}
+
+// startKey decodes cursor into the key a read of index ("" for the table)
+// carries on from. A cursor that decodes but holds anything other than that
+// index's key attributes, or a key from another partition than partition
+// when one is given, is ErrInvalidCursor: DynamoDB would reject it as an
+// invalid request.
+func startKey(cursor, index, partition string) (map[string]types.AttributeValue, error) {
+	key, err := DecodeCursor(cursor)
+	if err != nil || key == nil {
+		return key, err
+	}
+	pkAttr, skAttr := expr.KeyAttributes(index)
+	attrs := []string{"PK", "SK"}
+	if index != "" {
+		attrs = append(attrs, pkAttr, skAttr)
+	}
+	if len(key) != len(attrs) {
+		return nil, ErrInvalidCursor
+	}
+	for _, attr := range attrs {
+		v, ok := key[attr].(*types.AttributeValueMemberS)
+		if !ok || v.Value == "" {
+			return nil, ErrInvalidCursor
+		}
+	}
+	if partition != "" && key[pkAttr].(*types.AttributeValueMemberS).Value != partition {
+		return nil, ErrInvalidCursor
+	}
+	return key, nil
+}
+
+// queryPage reads one page starting at cursor and returns it with the cursor
+// of the next page ("" once the partition is exhausted). The input's Limit is
+// the page size, PageSize when it isn't set. A filter expression can leave a
+// DynamoDB page short, so it keeps reading until the page is full, asking each
+// time for no more than the items still missing so the returned cursor never
+// skips anything.
+func queryPage(ctx context.Context, store ItemStore, in *dynamodb.QueryInput, cursor string) ([]map[string]types.AttributeValue, string, error) {
+	partition, err := expr.Partition(in)
+	if err != nil {
+		return nil, "", err
+	}
+	start, err := startKey(cursor, aws.ToString(in.IndexName), partition)
+	if err != nil {
+		return nil, "", err
+	}
+	q := *in
+	q.ExclusiveStartKey = start
+	size := pageSize(in.Limit)
+	items := make([]map[string]types.AttributeValue, 0, size)
+	for {
+		q.Limit = aws.Int32(int32(size - len(items)))
+		out, err := store.Query(ctx, &q)
+		if err != nil {
+			return nil, "", err
+		}
+		items = append(items, out.Items...)
+		if out.LastEvaluatedKey == nil {
+			return items, "", nil
+		}
+		if len(items) >= size {
+			next, err := EncodeCursor(out.LastEvaluatedKey)
+			return items, next, err
+		}
+		q.ExclusiveStartKey = out.LastEvaluatedKey
+	}
+}
+
+// scanPage is queryPage for scans.
+func scanPage(ctx context.Context, store ItemStore, in *dynamodb.ScanInput, cursor string) ([]map[string]types.AttributeValue, string, error) {
+	start, err := startKey(cursor, aws.ToString(in.IndexName), "")
+	if err != nil {
+		return nil, "", err
+	}
+	s := *in
+	s.ExclusiveStartKey = start
+	size := pageSize(in.Limit)
+	items := make([]map[string]types.AttributeValue, 0, size)
+	for {
+		s.Limit = aws.Int32(int32(size - len(items)))
+		out, err := store.Scan(ctx, &s)
+		if err != nil {
+			return nil, "", err
+		}
+		items = append(items, out.Items...)
+		if out.LastEvaluatedKey == nil {
+			return items, "", nil
+		}
+		if len(items) >= size {
+			next, err := EncodeCursor(out.LastEvaluatedKey)
+			return items, next, err
+		}
+		s.ExclusiveStartKey = out.LastEvaluatedKey
+	}
+}
+
+func pageSize(limit *int32) int {
+	if limit == nil || *limit <= 0 {
+		return PageSize
+	}
+	return int(*limit)
+}
@@ -0,0 +1,142 @@
+package models
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"testing"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+	"krabber.net/internal/models/memdb"
+)
+
+func TestCursorRoundTrip(t *testing.T) {
+	key := map[string]types.AttributeValue{
+		"PK": &types.AttributeValueMemberS{Value: "M#crab"},
+		"SK": &types.AttributeValueMemberS{Value: "M#crab#2/+="},
+	}
+	cursor, err := EncodeCursor(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	got, err := DecodeCursor(cursor)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if fmt.Sprint(got["SK"]) != fmt.Sprint(key["SK"]) || len(got) != 2 {
+		t.Errorf("got %v, want %v", got, key)
+	}
+	for _, bad := range []string{"%%%", "bm90IGpzb24", "e30"} {
+		if _, err := DecodeCursor(bad); !errors.Is(err, ErrInvalidCursor) {
+			t.Errorf("DecodeCursor(%q) = %v, want ErrInvalidCursor", bad, err)
+		}
+	}
+}
+
+// TestQueryPage checks pages come back full even when the filter drops most
+// of what is read, and that following the cursors reads everything once.
+func TestQueryPage(t *testing.T) {
+	ctx := context.Background()
+	store := memdb.New()
+	for i := 0; i < 30; i++ {
+		_, err := store.PutItem(ctx, &dynamodb.PutItemInput{
+			TableName: aws.String(TableName),
+			Item: map[string]types.AttributeValue{
+				"PK":      &types.AttributeValueMemberS{Value: "M#crab"},
+				"SK":      &types.AttributeValueMemberS{Value: fmt.Sprintf("M#crab#%02d", i)},
+				"deleted": &types.AttributeValueMemberBOOL{Value: i%3 != 0},
+			},
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	in := &dynamodb.QueryInput{
+		TableName:              aws.String(TableName),
+		Limit:                  aws.Int32(4),
+		KeyConditionExpression: aws.String("PK = :pk"),
+		FilterExpression:       aws.String("deleted <> :deleted"),
+		ExpressionAttributeValues: map[string]types.AttributeValue{
+			":pk":      &types.AttributeValueMemberS{Value: "M#crab"},
+			":deleted": &types.AttributeValueMemberBOOL{Value: true},
+		},
+		ScanIndexForward: aws.Bool(false),
+	}
+	var sizes []int
+	var got []string
+	cursor := ""
+	for pages := 0; ; pages++ {
+		if pages > 10 {
+			t.Fatal("paging doesn't end")
+		}
+		items, next, err := queryPage(ctx, store, in, cursor)
+		if err != nil {
+			t.Fatal(err)
+		}
+		sizes = append(sizes, len(items))
+		for _, item := range items {
+			got = append(got, item["SK"].(*types.AttributeValueMemberS).Value[7:])
+		}
+		if next == "" {
+			break
+		}
+		cursor = next
+	}
+	if fmt.Sprint(sizes) != "[4 4 2]" {
+		t.Errorf("page sizes %v, want [4 4 2]", sizes)
+	}
+	if want := "[27 24 21 18 15 12 09 06 03 00]"; fmt.Sprint(got) != want {
+		t.Errorf("got %v, want %v", got, want)
+	}
+	for _, bad := range []string{"%%%", "eyJQSyI6Ik0jb3RoZXIiLCJTSyI6Ik0jb3RoZXIjMSJ9"} {
+		if _, _, err := queryPage(ctx, store, in, bad); !errors.Is(err, ErrInvalidCursor) {
+			t.Errorf("cursor %q: got %v, want ErrInvalidCursor", bad, err)
+		}
+	}
+}
+
+func TestStartKey(t *testing.T) {
+	cursor := func(attrs ...string) string {
+		key := map[string]types.AttributeValue{}
+		for i := 0; i < len(attrs); i += 2 {
+			key[attrs[i]] = &types.AttributeValueMemberS{Value: attrs[i+1]}
+		}
+		c, err := EncodeCursor(key)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return c
+	}
+	tests := []struct {
+		name      string
+		cursor    string
+		index     string
+		partition string
+		ok        bool
+	}{
+		{name: "first page", cursor: "", partition: "M#crab", ok: true},
+		{name: "table key", cursor: cursor("PK", "M#crab", "SK", "M#crab#1"), partition: "M#crab", ok: true},
+		{name: "scan key", cursor: cursor("PK", "M#other", "SK", "M#other#1"), ok: true},
+		{name: "index key", cursor: cursor("PK", "M#crab", "SK", "M#crab#1", "GSI3PK", "M#day", "GSI3SK", "M#1"), index: "GSI3", partition: "M#day", ok: true},
+		{name: "another partition", cursor: cursor("PK", "M#other", "SK", "M#other#1"), partition: "M#crab"},
+		{name: "missing sort key", cursor: cursor("PK", "M#crab"), partition: "M#crab"},
+		{name: "extra attribute", cursor: cursor("PK", "M#crab", "SK", "M#crab#1", "content", "hi"), partition: "M#crab"},
+		{name: "table key for an index", cursor: cursor("PK", "M#crab", "SK", "M#crab#1"), index: "GSI3", partition: "M#day"},
+		{name: "another index's key", cursor: cursor("PK", "M#crab", "SK", "M#crab#1", "GSI4PK", "M#day", "GSI4SK", "M#1"), index: "GSI3"},
+		{name: "empty value", cursor: cursor("PK", "M#crab", "SK", ""), partition: "M#crab"},
+		{name: "not a cursor", cursor: "%%%"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := startKey(tt.cursor, tt.index, tt.partition)
+			if tt.ok && err != nil {
+				t.Fatal(err)
+			}
+			if !tt.ok && !errors.Is(err, ErrInvalidCursor) {
+				t.Fatalf("got %v, want ErrInvalidCursor", err)
+			}
+		})
+	}
+}
@@ -1,9 +1,100 @@
 package models
 
 import (
+	"context"
+	"fmt"
+	"time"
+
 	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
 )
 
+// ItemStore is the subset of the DynamoDB client the models use. It is
+// satisfied by *dynamodb.Client and by the local backends, so the models can
+// run without an AWS account. Query and Scan keep the client's signatures so
+// the SDK paginators accept any ItemStore.
+type ItemStore interface {
+	GetItem(ctx context.Context, params *dynamodb.GetItemInput, optFns ...func(*dynamodb.Options)) (*dynamodb.GetItemOutput, error)
+	BatchGetItem(ctx context.Context, params *dynamodb.BatchGetItemInput, optFns ...func(*dynamodb.Options)) (*dynamodb.BatchGetItemOutput, error)
+	PutItem(ctx context.Context, params *dynamodb.PutItemInput, optFns ...func(*dynamodb.Options)) (*dynamodb.PutItemOutput, error)
+	UpdateItem(ctx context.Context, params *dynamodb.UpdateItemInput, optFns ...func(*dynamodb.Options)) (*dynamodb.UpdateItemOutput, error)
+	DeleteItem(ctx context.Context, params *dynamodb.DeleteItemInput, optFns ...func(*dynamodb.Options)) (*dynamodb.DeleteItemOutput, error)
+	Query(ctx context.Context, params *dynamodb.QueryInput, optFns ...func(*dynamodb.Options)) (*dynamodb.QueryOutput, error)
+	Scan(ctx context.Context, params *dynamodb.ScanInput, optFns ...func(*dynamodb.Options)) (*dynamodb.ScanOutput, error)
+	TransactWriteItems(ctx context.Context, params *dynamodb.TransactWriteItemsInput, optFns ...func(*dynamodb.Options)) (*dynamodb.TransactWriteItemsOutput, error)
+	BatchWriteItem(ctx context.Context, params *dynamodb.BatchWriteItemInput, optFns ...func(*dynamodb.Options)) (*dynamodb.BatchWriteItemOutput, error)
+}
+
 type ItemService struct {
-	ItemTable *dynamodb.Client
+	ItemTable ItemStore
+}
+
+// batchWrite sends requests to the table 25 at a time, the most a
+// BatchWriteItem call takes, resending whatever DynamoDB leaves unprocessed
+// with a growing back off.
+func batchWrite(ctx context.Context, store ItemStore, requests []types.WriteRequest) error {
+	for len(requests) > 0 {
+		n := len(requests)
+		if n > 25 {
+			n = 25
+		}
+		pending := map[string][]types.WriteRequest{TableName: requests[:n]}
+		for attempt := 0; len(pending) > 0; attempt++ {
+			if attempt == 8 {
+				return fmt.Errorf("BatchWriteItem: %d requests left unprocessed", len(pending[TableName]))
+			}
+			if attempt > 0 {
+				time.Sleep(time.Duration(attempt*attempt) * 50 * time.Millisecond)
+			}
+			out, err := store.BatchWriteItem(ctx, &dynamodb.BatchWriteItemInput{RequestItems: pending})
+			if err != nil {
+				return fmt.Errorf("BatchWriteItem: %w", err)
+			}
+			pending = out.UnprocessedItems
+		}
+		requests = requests[n:]
+	}
+	return nil
+}
+
+// batchGet reads the items at keys 100 at a time, the most a BatchGetItem
+// call takes, asking again for whatever DynamoDB leaves unprocessed. Keys
+// asked for twice are only read once, items that don't exist are left out
+// and the rest come back in no particular order.
+func batchGet(ctx context.Context, store ItemStore, keys []map[string]types.AttributeValue) ([]map[string]types.AttributeValue, error) {
+	seen := make(map[[2]string]bool, len(keys))
+	unique := make([]map[string]types.AttributeValue, 0, len(keys))
+	for _, k := range keys {
+		pk, _ := k["PK"].(*types.AttributeValueMemberS)
+		sk, _ := k["SK"].(*types.AttributeValueMemberS)
+		if pk == nil || sk == nil || seen[[2]string{pk.Value, sk.Value}] {
+			continue
+		}
+		seen[[2]string{pk.Value, sk.Value}] = true
+		unique = append(unique, k)
+	}
+	items := make([]map[string]types.AttributeValue, 0, len(unique))
+	for len(unique) > 0 {
+		n := len(unique)
+		if n > 100 {
+			n = 100
+		}
+		pending := map[string]types.KeysAndAttributes{TableName: {Keys: unique[:n]}}
+		for attempt := 0; len(pending) > 0; attempt++ {
+			if attempt == 8 {
+				return nil, fmt.Errorf("BatchGetItem: %d keys left unprocessed", len(pending[TableName].Keys))
+			}
+			if attempt > 0 {
+				time.Sleep(time.Duration(attempt*attempt) * 50 * time.Millisecond)
+			}
+			out, err := store.BatchGetItem(ctx, &dynamodb.BatchGetItemInput{RequestItems: pending})
+			if err != nil {
+				return nil, fmt.Errorf("BatchGetItem: %w", err)
+			}
+			items = append(items, out.Responses[TableName]...)
+			pending = out.UnprocessedKeys
+		}
+		unique = unique[n:]
+	}
+	return items, nil
 }
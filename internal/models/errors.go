@@ -2,9 +2,38 @@ package models
 
 import (
 	"errors"
+	"fmt"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
 )
 
 var (
 	ErrNoRecord           = errors.New("models: no matching record found")
 	ErrInvalidCredentials = errors.New("models: invalid credentials")
+	// ErrConflict is returned when a write's condition check fails: the item
+	// already exists, is already gone, or the crab it updates doesn't exist.
+	ErrConflict = errors.New("models: conflicting write")
+	// ErrThreadTooDeep is returned for a reply that would nest deeper than
+	// MaxReplyDepth.
+	ErrThreadTooDeep = errors.New("models: thread too deep")
 )
+
+// conflict turns a failed condition check, on its own or as the reason a
+// transaction was cancelled, into ErrConflict. Any other error is returned
+// unchanged.
+func conflict(err error) error {
+	var ccf *types.ConditionalCheckFailedException
+	if errors.As(err, &ccf) {
+		return fmt.Errorf("%w: %w", ErrConflict, err)
+	}
+	var tce *types.TransactionCanceledException
+	if errors.As(err, &tce) {
+		for _, reason := range tce.CancellationReasons {
+			if aws.ToString(reason.Code) == "ConditionalCheckFailed" {
+				return fmt.Errorf("%w: %w", ErrConflict, err)
+			}
+		}
+	}
+	return err
+}
@@ -0,0 +1,122 @@
+package models
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+	"krabber.net/internal/models/memdb"
+	"krabber.net/internal/models/sqldb"
+)
+
+// TestConflict runs transactions against each backend and checks a failed
+// condition comes back as ErrConflict with nothing written.
+func TestConflict(t *testing.T) {
+	key := func(pk string) map[string]types.AttributeValue {
+		return map[string]types.AttributeValue{
+			"PK": &types.AttributeValueMemberS{Value: pk},
+			"SK": &types.AttributeValueMemberS{Value: pk},
+		}
+	}
+	put := func(pk string) types.TransactWriteItem {
+		return types.TransactWriteItem{Put: &types.Put{
+			TableName:           aws.String(TableName),
+			Item:                key(pk),
+			ConditionExpression: aws.String("attribute_not_exists(PK)"),
+		}}
+	}
+	count := func(pk string) types.TransactWriteItem {
+		return types.TransactWriteItem{Update: &types.Update{
+			TableName:           aws.String(TableName),
+			Key:                 key(pk),
+			UpdateExpression:    aws.String("set #count = #count + :one"),
+			ConditionExpression: aws.String("attribute_exists(PK)"),
+			ExpressionAttributeNames: map[string]string{
+				"#count": "count",
+			},
+			ExpressionAttributeValues: map[string]types.AttributeValue{
+				":one": &types.AttributeValueMemberN{Value: "1"},
+			},
+		}}
+	}
+	del := func(pk string) types.TransactWriteItem {
+		return types.TransactWriteItem{Delete: &types.Delete{
+			TableName:           aws.String(TableName),
+			Key:                 key(pk),
+			ConditionExpression: aws.String("attribute_exists(PK)"),
+		}}
+	}
+
+	tests := []struct {
+		name     string
+		items    []types.TransactWriteItem
+		conflict bool
+		// exists is whether F#new is there after the transaction.
+		exists bool
+	}{
+		{name: "goes through", items: []types.TransactWriteItem{put("F#new"), count("C#crab")}, exists: true},
+		{name: "item already there", items: []types.TransactWriteItem{put("F#new"), count("C#crab"), put("F#old")}, conflict: true},
+		{name: "item already gone", items: []types.TransactWriteItem{put("F#new"), del("F#gone")}, conflict: true},
+		{name: "counted crab missing", items: []types.TransactWriteItem{put("F#new"), count("C#gone")}, conflict: true},
+		{name: "one item twice", items: []types.TransactWriteItem{put("F#new"), del("C#crab"), count("C#crab")}},
+	}
+	backends := map[string]func(t *testing.T) ItemStore{
+		"memdb": func(t *testing.T) ItemStore { return memdb.New() },
+		"sqldb": func(t *testing.T) ItemStore {
+			db, err := sqldb.Open("file::memory:")
+			if err != nil {
+				t.Fatal(err)
+			}
+			t.Cleanup(func() { db.Close() })
+			return db
+		},
+	}
+	for backend, open := range backends {
+		for _, tt := range tests {
+			t.Run(backend+"/"+tt.name, func(t *testing.T) {
+				ctx := context.Background()
+				table := open(t)
+				for _, pk := range []string{"F#old", "C#crab"} {
+					item := key(pk)
+					item["count"] = &types.AttributeValueMemberN{Value: "1"}
+					_, err := table.PutItem(ctx, &dynamodb.PutItemInput{TableName: aws.String(TableName), Item: item})
+					if err != nil {
+						t.Fatal(err)
+					}
+				}
+				_, err := table.TransactWriteItems(ctx, &dynamodb.TransactWriteItemsInput{TransactItems: tt.items})
+				err = conflict(err)
+				switch {
+				case tt.conflict && !errors.Is(err, ErrConflict):
+					t.Fatalf("got %v, want ErrConflict", err)
+				case !tt.conflict && tt.exists && err != nil:
+					t.Fatal(err)
+				case !tt.conflict && !tt.exists && (err == nil || errors.Is(err, ErrConflict)):
+					// one item twice in a transaction is a mistake, not a conflict
+					t.Fatalf("got %v, want a validation error", err)
+				}
+				out, err := table.GetItem(ctx, &dynamodb.GetItemInput{TableName: aws.String(TableName), Key: key("F#new")})
+				if err != nil {
+					t.Fatal(err)
+				}
+				if (out.Item != nil) != tt.exists {
+					t.Errorf("F#new written: %v, want %v", out.Item != nil, tt.exists)
+				}
+				out, err = table.GetItem(ctx, &dynamodb.GetItemInput{TableName: aws.String(TableName), Key: key("C#crab")})
+				if err != nil {
+					t.Fatal(err)
+				}
+				want := "1"
+				if tt.exists {
+					want = "2"
+				}
+				if got := out.Item["count"].(*types.AttributeValueMemberN).Value; got != want {
+					t.Errorf("count %s, want %s", got, want)
+				}
+			})
+		}
+	}
+}
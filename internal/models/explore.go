@@ -0,0 +1,276 @@
+package models
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/feature/dynamodb/attributevalue"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+	"math"
+	"math/rand"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Ranking weighs what brings a molt to the top of a crab's sea. Each like,
+// remolt and comment adds its weight to a molt's score, which then halves
+// every HalfLife of the molt's age. The rest multiply the score by how the
+// viewer stands to the molt: above 1 lifts it, below 1 sinks it.
+type Ranking struct {
+	Likes    float64
+	Remolts  float64
+	Comments float64
+	HalfLife time.Duration
+	// Friends is for molts by crabs that crabs the viewer follows follow.
+	Friends float64
+	// Muted is for molts by crabs the viewer has muted.
+	Muted float64
+	// Seen is for molts already shown to the viewer in an earlier sea.
+	Seen float64
+}
+
+var DefaultRanking = Ranking{
+	Likes:    1,
+	Remolts:  2,
+	Comments: 1.5,
+	HalfLife: 6 * time.Hour,
+	Friends:  2,
+	Muted:    0.01,
+	Seen:     0.2,
+}
+
+// ParseRanking reads a ranking written as comma separated name=value
+// pairs, e.g. "likes=1,remolts=2,halflife=6h". The names are those of the
+// Ranking fields in lower case; any left out keep DefaultRanking's value.
+func ParseRanking(s string) (Ranking, error) {
+	r := DefaultRanking
+	for _, field := range strings.Split(s, ",") {
+		if strings.TrimSpace(field) == "" {
+			continue
+		}
+		name, value, ok := strings.Cut(field, "=")
+		if !ok {
+			return r, fmt.Errorf("ranking: %q is not name=value", field)
+		}
+		name, value = strings.TrimSpace(name), strings.TrimSpace(value)
+		if name == "halflife" {
+			d, err := time.ParseDuration(value)
+			if err != nil || d <= 0 {
+				return r, fmt.Errorf("ranking: halflife must be a positive duration, not %q", value)
+			}
+			r.HalfLife = d
+			continue
+		}
+		w, err := strconv.ParseFloat(value, 64)
+		if err != nil || w < 0 || math.IsInf(w, 0) {
+			return r, fmt.Errorf("ranking: %s must be a number no less than 0, not %q", name, value)
+		}
+		switch name {
+		case "likes":
+			r.Likes = w
+		case "remolts":
+			r.Remolts = w
+		case "comments":
+			r.Comments = w
+		case "friends":
+			r.Friends = w
+		case "muted":
+			r.Muted = w
+		case "seen":
+			r.Seen = w
+		default:
+			return r, fmt.Errorf("ranking: unknown weight %q", name)
+		}
+	}
+	return r, nil
+}
+
+// score is how high molt ranks at now for a viewer who stands to it as
+// friend, muted and seen say.
+func (r Ranking) score(molt Molt, now time.Time, friend, muted, seen bool) float64 {
+	score := 1 + r.Likes*float64(molt.LikeCount) +
+		r.Remolts*float64(molt.RemoltCount) +
+		r.Comments*float64(molt.CommentCount)
+	if age := now.Sub(moltTime(molt)); age > 0 {
+		score *= math.Pow(0.5, age.Seconds()/r.HalfLife.Seconds())
+	}
+	if friend {
+		score *= r.Friends
+	}
+	if muted {
+		score *= r.Muted
+	}
+	if seen {
+		score *= r.Seen
+	}
+	return score
+}
+
+// Explore is a crab's ranking of a sea shard, kept so the pages after the
+// first follow on from it however the shard's counts move meanwhile.
+type Explore struct {
+	PK    string   `dynamodbav:"PK"` // EX#crabID
+	SK    string   `dynamodbav:"SK"` // EX#crabID
+	Shard int      `dynamodbav:"shard"`
+	Molts []string `dynamodbav:"molts"` // ids, best first
+	// Served is how many of Molts have been shown.
+	Served int `dynamodbav:"served"`
+	// Seen are the ids of molts shown in earlier rankings that are still in
+	// the sea.
+	Seen []string `dynamodbav:"seen,omitempty"`
+	TTL  int64    `dynamodbav:"ttl"`
+}
+
+func exploreKey(crabID string) map[string]types.AttributeValue {
+	return map[string]types.AttributeValue{
+		"PK": &types.AttributeValueMemberS{Value: "EX#" + crabID},
+		"SK": &types.AttributeValueMemberS{Value: "EX#" + crabID},
+	}
+}
+
+// explore reads crabID's latest ranking.
+func (m MoltModel) explore(ctx context.Context, crabID string) (*Explore, error) {
+	out, err := m.SVC.ItemTable.GetItem(ctx, &dynamodb.GetItemInput{
+		TableName: aws.String(TableName),
+		Key:       exploreKey(crabID),
+	})
+	if err != nil {
+		return nil, fmt.Errorf("GetItem: %w", err)
+	}
+	if out.Item == nil {
+		return nil, ErrNoRecord
+	}
+	ex := &Explore{}
+	err = attributevalue.UnmarshalMap(out.Item, ex)
+	if err != nil {
+		return nil, fmt.Errorf("UnmarshalMap: %w", err)
+	}
+	return ex, nil
+}
+
+// rank ranks a random shard of the sea for crabID at now, replacing their
+// last ranking, and returns it with the shard's molts.
+func (m MoltModel) rank(ctx context.Context, crabID string, now time.Time) (*Explore, []Molt, error) {
+	shard := rand.Intn(ShardSize)
+	molts, err := m.shard(ctx, shard)
+	if err != nil {
+		return nil, nil, err
+	}
+	seen := make(map[string]bool)
+	last, err := m.explore(ctx, crabID)
+	switch {
+	case err == nil:
+		for _, id := range last.Seen {
+			seen[id] = true
+		}
+		for _, id := range last.Molts[:min(last.Served, len(last.Molts))] {
+			seen[id] = true
+		}
+	case !errors.Is(err, ErrNoRecord):
+		return nil, nil, err
+	}
+	muted, err := MuteModel{SVC: m.SVC}.Muted(ctx, crabID)
+	if err != nil {
+		return nil, nil, err
+	}
+	friends, err := m.friends(ctx, crabID)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	r := m.Ranking
+	if r == (Ranking{}) {
+		r = DefaultRanking
+	}
+	scores := make(map[string]float64, len(molts))
+	for _, molt := range molts {
+		author := molt.PK[2:]
+		scores[molt.ID] = r.score(molt, now, friends[author], muted[author], seen[molt.ID])
+	}
+	ranked := make([]Molt, len(molts))
+	copy(ranked, molts)
+	sort.SliceStable(ranked, func(i, j int) bool {
+		return scores[ranked[i].ID] > scores[ranked[j].ID]
+	})
+
+	ex := &Explore{
+		PK:     "EX#" + crabID,
+		SK:     "EX#" + crabID,
+		Shard:  shard,
+		Molts:  make([]string, 0, len(ranked)),
+		Served: min(PageSize, len(ranked)),
+		TTL:    now.Add(SeaWindow).Unix(),
+	}
+	for _, molt := range ranked {
+		ex.Molts = append(ex.Molts, molt.ID)
+		// seen molts that have left the sea are forgotten
+		if seen[molt.ID] {
+			ex.Seen = append(ex.Seen, molt.ID)
+		}
+	}
+	item, err := attributevalue.MarshalMap(ex)
+	if err != nil {
+		return nil, nil, fmt.Errorf("MarshalMap: %w", err)
+	}
+	_, err = m.SVC.ItemTable.PutItem(ctx, &dynamodb.PutItemInput{
+		TableName: aws.String(TableName),
+		Item:      item,
+	})
+	if err != nil {
+		return nil, nil, fmt.Errorf("PutItem: %w", err)
+	}
+	return ex, molts, nil
+}
+
+// friends returns the ids of the crabs followed by the crabs crabID
+// follows. It only looks a page deep on each side, which is enough to
+// nudge a ranking and keeps the first page of the sea quick.
+func (m MoltModel) friends(ctx context.Context, crabID string) (map[string]bool, error) {
+	follows := FollowModel{SVC: m.SVC}
+	following, _, err := follows.Show(ctx, crabID, "")
+	if err != nil {
+		return nil, err
+	}
+	friends := make(map[string]bool)
+	for _, f := range following {
+		theirs, _, err := follows.Show(ctx, f.FolloweeID(), "")
+		if err != nil {
+			return nil, err
+		}
+		for _, c := range theirs {
+			if id := c.FolloweeID(); id != crabID {
+				friends[id] = true
+			}
+		}
+	}
+	return friends, nil
+}
+
+// served records that the first n molts of crabID's ranking have been
+// shown. It never goes back, so an old page loaded again changes nothing.
+func (m MoltModel) served(ctx context.Context, crabID string, n int) error {
+	_, err := m.SVC.ItemTable.UpdateItem(ctx, &dynamodb.UpdateItemInput{
+		TableName:           aws.String(TableName),
+		Key:                 exploreKey(crabID),
+		ConditionExpression: aws.String("served < :served"),
+		UpdateExpression:    aws.String("set served = :served"),
+		ExpressionAttributeValues: map[string]types.AttributeValue{
+			":served": &types.AttributeValueMemberN{Value: strconv.Itoa(n)},
+		},
+	})
+	if err != nil && !errors.Is(conflict(err), ErrConflict) {
+		return fmt.Errorf("UpdateItem: %w", err)
+	}
+	return nil
+}
+
+func min(a, b int) int {
+	if a < b {
+		return a
+	}
+	return b
+}
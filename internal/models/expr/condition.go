@@ -0,0 +1,592 @@
+package expr
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+)
+
+// env carries the placeholder substitutions an expression is evaluated with.
+type env struct {
+	names  map[string]string
+	values map[string]types.AttributeValue
+}
+
+func (e env) name(placeholder string) (string, error) {
+	n, ok := e.names[placeholder]
+	if !ok {
+		return "", fmt.Errorf("expr: ExpressionAttributeNames has no %s", placeholder)
+	}
+	return n, nil
+}
+
+func (e env) value(placeholder string) (types.AttributeValue, error) {
+	v, ok := e.values[placeholder]
+	if !ok {
+		return nil, fmt.Errorf("expr: ExpressionAttributeValues has no %s", placeholder)
+	}
+	return v, nil
+}
+
+// path is a top level attribute reference, either literal or a #placeholder.
+type path struct {
+	text string
+}
+
+func (p path) resolve(e env) (string, error) {
+	if strings.HasPrefix(p.text, "#") {
+		return e.name(p.text)
+	}
+	return p.text, nil
+}
+
+// operand is anything that produces a value: an attribute path, a :value
+// placeholder or size(path).
+type operand interface {
+	eval(item Item, e env) (types.AttributeValue, bool, error)
+}
+
+func (p path) eval(item Item, e env) (types.AttributeValue, bool, error) {
+	n, err := p.resolve(e)
+	if err != nil {
+		return nil, false, err
+	}
+	v, ok := item[n]
+	return v, ok, nil
+}
+
+type placeholder struct {
+	text string
+}
+
+func (p placeholder) eval(_ Item, e env) (types.AttributeValue, bool, error) {
+	v, err := e.value(p.text)
+	return v, err == nil, err
+}
+
+type sizeOf struct {
+	path path
+}
+
+func (s sizeOf) eval(item Item, e env) (types.AttributeValue, bool, error) {
+	v, ok, err := s.path.eval(item, e)
+	if err != nil || !ok {
+		return nil, false, err
+	}
+	n, ok := size(v)
+	if !ok {
+		return nil, false, nil
+	}
+	return &types.AttributeValueMemberN{Value: strconv.Itoa(n)}, true, nil
+}
+
+// node is a boolean expression.
+type node interface {
+	test(item Item, e env) (bool, error)
+}
+
+type andNode struct{ l, r node }
+type orNode struct{ l, r node }
+type notNode struct{ n node }
+
+func (n andNode) test(item Item, e env) (bool, error) {
+	ok, err := n.l.test(item, e)
+	if err != nil || !ok {
+		return false, err
+	}
+	return n.r.test(item, e)
+}
+
+func (n orNode) test(item Item, e env) (bool, error) {
+	ok, err := n.l.test(item, e)
+	if err != nil || ok {
+		return ok, err
+	}
+	return n.r.test(item, e)
+}
+
+func (n notNode) test(item Item, e env) (bool, error) {
+	ok, err := n.n.test(item, e)
+	return !ok, err
+}
+
+type compareNode struct {
+	op   string
+	l, r operand
+}
+
+func (n compareNode) test(item Item, e env) (bool, error) {
+	l, lok, err := n.l.eval(item, e)
+	if err != nil {
+		return false, err
+	}
+	r, rok, err := n.r.eval(item, e)
+	if err != nil {
+		return false, err
+	}
+	// A missing attribute is never equal to, or ordered against, anything, so
+	// only <> can hold.
+	if !lok || !rok {
+		return n.op == "<>", nil
+	}
+	switch n.op {
+	case "=":
+		return Equal(l, r), nil
+	case "<>":
+		return !Equal(l, r), nil
+	}
+	c, ok := Compare(l, r)
+	if !ok {
+		return false, nil
+	}
+	switch n.op {
+	case "<":
+		return c < 0, nil
+	case "<=":
+		return c <= 0, nil
+	case ">":
+		return c > 0, nil
+	case ">=":
+		return c >= 0, nil
+	}
+	return false, fmt.Errorf("expr: unknown comparator %q", n.op)
+}
+
+type betweenNode struct {
+	v, lo, hi operand
+}
+
+func (n betweenNode) test(item Item, e env) (bool, error) {
+	lower, err := compareNode{">=", n.v, n.lo}.test(item, e)
+	if err != nil || !lower {
+		return false, err
+	}
+	return compareNode{"<=", n.v, n.hi}.test(item, e)
+}
+
+type inNode struct {
+	v    operand
+	list []operand
+}
+
+func (n inNode) test(item Item, e env) (bool, error) {
+	for _, o := range n.list {
+		ok, err := compareNode{"=", n.v, o}.test(item, e)
+		if err != nil || ok {
+			return ok, err
+		}
+	}
+	return false, nil
+}
+
+type funcNode struct {
+	name string
+	args []operand
+}
+
+func (n funcNode) test(item Item, e env) (bool, error) {
+	p, isPath := n.args[0].(path)
+	switch n.name {
+	case "attribute_exists", "attribute_not_exists":
+		if !isPath || len(n.args) != 1 {
+			return false, fmt.Errorf("expr: %s takes a single attribute path", n.name)
+		}
+		_, ok, err := p.eval(item, e)
+		if n.name == "attribute_not_exists" {
+			ok = !ok
+		}
+		return ok, err
+	}
+	if len(n.args) != 2 {
+		return false, fmt.Errorf("expr: %s takes two arguments", n.name)
+	}
+	v, ok, err := n.args[0].eval(item, e)
+	if err != nil || !ok {
+		return false, err
+	}
+	arg, _, err := n.args[1].eval(item, e)
+	if err != nil {
+		return false, err
+	}
+	switch n.name {
+	case "begins_with":
+		switch x := v.(type) {
+		case *types.AttributeValueMemberS:
+			y, ok := arg.(*types.AttributeValueMemberS)
+			return ok && strings.HasPrefix(x.Value, y.Value), nil
+		case *types.AttributeValueMemberB:
+			y, ok := arg.(*types.AttributeValueMemberB)
+			return ok && strings.HasPrefix(string(x.Value), string(y.Value)), nil
+		}
+		return false, nil
+	case "contains":
+		switch x := v.(type) {
+		case *types.AttributeValueMemberS:
+			y, ok := arg.(*types.AttributeValueMemberS)
+			return ok && strings.Contains(x.Value, y.Value), nil
+		case *types.AttributeValueMemberSS, *types.AttributeValueMemberNS, *types.AttributeValueMemberBS, *types.AttributeValueMemberL:
+			for _, member := range members(x) {
+				if Equal(member, arg) {
+					return true, nil
+				}
+			}
+		}
+		return false, nil
+	case "attribute_type":
+		want, ok := arg.(*types.AttributeValueMemberS)
+		return ok && typeName(v) == want.Value, nil
+	}
+	return false, fmt.Errorf("expr: unknown function %s", n.name)
+}
+
+// members flattens a set or list into individual values.
+func members(v types.AttributeValue) []types.AttributeValue {
+	var out []types.AttributeValue
+	switch t := v.(type) {
+	case *types.AttributeValueMemberSS:
+		for _, s := range t.Value {
+			out = append(out, &types.AttributeValueMemberS{Value: s})
+		}
+	case *types.AttributeValueMemberNS:
+		for _, n := range t.Value {
+			out = append(out, &types.AttributeValueMemberN{Value: n})
+		}
+	case *types.AttributeValueMemberBS:
+		for _, b := range t.Value {
+			out = append(out, &types.AttributeValueMemberB{Value: b})
+		}
+	case *types.AttributeValueMemberL:
+		out = append(out, t.Value...)
+	}
+	return out
+}
+
+// Condition is a parsed key condition, filter or condition expression.
+type Condition struct {
+	root node
+}
+
+// ParseCondition parses a condition expression such as
+// "attribute_not_exists(PK)" or "GSI2PK = :gsi2pk AND deleted <> :deleted".
+func ParseCondition(s string) (*Condition, error) {
+	p, err := newParser(s)
+	if err != nil {
+		return nil, err
+	}
+	root, err := p.parseOr()
+	if err != nil {
+		return nil, err
+	}
+	if t := p.peek(); t.kind != tokEOF {
+		return nil, p.errorf("unexpected %q", t.text)
+	}
+	return &Condition{root: root}, nil
+}
+
+// Eval reports whether item satisfies the condition.
+func (c *Condition) Eval(item Item, names map[string]string, values map[string]types.AttributeValue) (bool, error) {
+	return c.root.test(item, env{names: names, values: values})
+}
+
+// Match parses and evaluates an optional expression; a nil or empty
+// expression matches every item.
+func Match(expression *string, item Item, names map[string]string, values map[string]types.AttributeValue) (bool, error) {
+	if expression == nil || strings.TrimSpace(*expression) == "" {
+		return true, nil
+	}
+	c, err := ParseCondition(*expression)
+	if err != nil {
+		return false, err
+	}
+	return c.Eval(item, names, values)
+}
+
+func (p *parser) parseOr() (node, error) {
+	l, err := p.parseAnd()
+	if err != nil {
+		return nil, err
+	}
+	for p.keyword("OR") {
+		r, err := p.parseAnd()
+		if err != nil {
+			return nil, err
+		}
+		l = orNode{l, r}
+	}
+	return l, nil
+}
+
+func (p *parser) parseAnd() (node, error) {
+	l, err := p.parseNot()
+	if err != nil {
+		return nil, err
+	}
+	for p.keyword("AND") {
+		r, err := p.parseNot()
+		if err != nil {
+			return nil, err
+		}
+		l = andNode{l, r}
+	}
+	return l, nil
+}
+
+func (p *parser) parseNot() (node, error) {
+	if p.keyword("NOT") {
+		n, err := p.parseNot()
+		if err != nil {
+			return nil, err
+		}
+		return notNode{n}, nil
+	}
+	return p.parsePrimary()
+}
+
+var conditionFuncs = map[string]bool{
+	"attribute_exists":     true,
+	"attribute_not_exists": true,
+	"attribute_type":       true,
+	"begins_with":          true,
+	"contains":             true,
+}
+
+func (p *parser) parsePrimary() (node, error) {
+	if p.peek().kind == tokLParen {
+		p.next()
+		n, err := p.parseOr()
+		if err != nil {
+			return nil, err
+		}
+		if _, err := p.expect(tokRParen, ")"); err != nil {
+			return nil, err
+		}
+		return n, nil
+	}
+
+	t := p.peek()
+	if t.kind == tokIdent && p.tokens[p.pos+1].kind == tokLParen && conditionFuncs[strings.ToLower(t.text)] {
+		p.next()
+		args, err := p.parseArgs()
+		if err != nil {
+			return nil, err
+		}
+		if len(args) == 0 {
+			return nil, p.errorf("%s needs arguments", t.text)
+		}
+		return funcNode{name: strings.ToLower(t.text), args: args}, nil
+	}
+
+	l, err := p.parseOperand()
+	if err != nil {
+		return nil, err
+	}
+	switch {
+	case p.keyword("BETWEEN"):
+		lo, err := p.parseOperand()
+		if err != nil {
+			return nil, err
+		}
+		if !p.keyword("AND") {
+			return nil, p.errorf("BETWEEN needs AND")
+		}
+		hi, err := p.parseOperand()
+		if err != nil {
+			return nil, err
+		}
+		return betweenNode{l, lo, hi}, nil
+	case p.keyword("IN"):
+		list, err := p.parseArgs()
+		if err != nil {
+			return nil, err
+		}
+		return inNode{l, list}, nil
+	}
+	op := p.next()
+	if op.kind != tokOp || op.text == "+" || op.text == "-" {
+		return nil, p.errorf("expected comparator, found %q", op.text)
+	}
+	r, err := p.parseOperand()
+	if err != nil {
+		return nil, err
+	}
+	return compareNode{op.text, l, r}, nil
+}
+
+// parseArgs parses a parenthesised, comma separated list of operands.
+func (p *parser) parseArgs() ([]operand, error) {
+	if _, err := p.expect(tokLParen, "("); err != nil {
+		return nil, err
+	}
+	var args []operand
+	for p.peek().kind != tokRParen {
+		a, err := p.parseOperand()
+		if err != nil {
+			return nil, err
+		}
+		args = append(args, a)
+		if p.peek().kind == tokComma {
+			p.next()
+		}
+	}
+	p.next()
+	return args, nil
+}
+
+func (p *parser) parseOperand() (operand, error) {
+	t := p.next()
+	switch t.kind {
+	case tokValue:
+		return placeholder{t.text}, nil
+	case tokName:
+		return path{t.text}, nil
+	case tokIdent:
+		if strings.EqualFold(t.text, "size") && p.peek().kind == tokLParen {
+			args, err := p.parseArgs()
+			if err != nil {
+				return nil, err
+			}
+			pth, ok := firstPath(args)
+			if !ok {
+				return nil, p.errorf("size takes a single attribute path")
+			}
+			return sizeOf{pth}, nil
+		}
+		return path{t.text}, nil
+	}
+	return nil, p.errorf("expected operand, found %q", t.text)
+}
+
+func firstPath(args []operand) (path, bool) {
+	if len(args) != 1 {
+		return path{}, false
+	}
+	p, ok := args[0].(path)
+	return p, ok
+}
+
+// PartitionValue finds the "attr = :value" equality a key condition must
+// contain and returns the value it pins the partition key to.
+func (c *Condition) PartitionValue(attr string, names map[string]string, values map[string]types.AttributeValue) (types.AttributeValue, error) {
+	e := env{names: names, values: values}
+	var find func(n node) (types.AttributeValue, error)
+	find = func(n node) (types.AttributeValue, error) {
+		switch t := n.(type) {
+		case andNode:
+			if v, err := find(t.l); v != nil || err != nil {
+				return v, err
+			}
+			return find(t.r)
+		case compareNode:
+			if t.op != "=" {
+				return nil, nil
+			}
+			l, r := t.l, t.r
+			if _, ok := l.(placeholder); ok {
+				l, r = r, l
+			}
+			p, ok := l.(path)
+			if !ok {
+				return nil, nil
+			}
+			n, err := p.resolve(e)
+			if err != nil || n != attr {
+				return nil, err
+			}
+			v, _, err := r.eval(nil, e)
+			return v, err
+		}
+		return nil, nil
+	}
+	v, err := find(c.root)
+	if err != nil {
+		return nil, err
+	}
+	if v == nil {
+		return nil, fmt.Errorf("expr: key condition must test %s with =", attr)
+	}
+	return v, nil
+}
+
+// SortValues finds the test a key condition puts on the sort key attr and
+// returns its operator, one of = < <= > >= BETWEEN or begins_with, with the
+// values it compares against. op is empty when there is no such test. Keys
+// in the single table are strings, so anything else is an error, as is a
+// test DynamoDB doesn't allow in a key condition.
+func (c *Condition) SortValues(attr string, names map[string]string, values map[string]types.AttributeValue) (op string, args []string, err error) {
+	e := env{names: names, values: values}
+	isAttr := func(o operand) (bool, error) {
+		p, ok := o.(path)
+		if !ok {
+			return false, nil
+		}
+		n, err := p.resolve(e)
+		return n == attr, err
+	}
+	strs := func(os ...operand) ([]string, error) {
+		out := make([]string, 0, len(os))
+		for _, o := range os {
+			v, _, err := o.eval(nil, e)
+			if err != nil {
+				return nil, err
+			}
+			s, ok := v.(*types.AttributeValueMemberS)
+			if !ok {
+				return nil, fmt.Errorf("expr: sort key %s must be compared with strings", attr)
+			}
+			out = append(out, s.Value)
+		}
+		return out, nil
+	}
+	flip := map[string]string{"=": "=", "<>": "<>", "<": ">", "<=": ">=", ">": "<", ">=": "<="}
+	var find func(n node) (string, []string, error)
+	find = func(n node) (string, []string, error) {
+		switch t := n.(type) {
+		case andNode:
+			if op, args, err := find(t.l); op != "" || err != nil {
+				return op, args, err
+			}
+			return find(t.r)
+		case compareNode:
+			op, l, r := t.op, t.l, t.r
+			if _, ok := l.(placeholder); ok {
+				op, l, r = flip[op], r, l
+			}
+			if ok, err := isAttr(l); !ok || err != nil {
+				return "", nil, err
+			}
+			if op == "<>" {
+				return "", nil, fmt.Errorf("expr: key condition can't test %s with <>", attr)
+			}
+			args, err := strs(r)
+			if err != nil {
+				return "", nil, err
+			}
+			return op, args, nil
+		case betweenNode:
+			if ok, err := isAttr(t.v); !ok || err != nil {
+				return "", nil, err
+			}
+			args, err := strs(t.lo, t.hi)
+			if err != nil {
+				return "", nil, err
+			}
+			return "BETWEEN", args, nil
+		case funcNode:
+			if t.name != "begins_with" || len(t.args) != 2 {
+				return "", nil, nil
+			}
+			if ok, err := isAttr(t.args[0]); !ok || err != nil {
+				return "", nil, err
+			}
+			args, err := strs(t.args[1])
+			if err != nil {
+				return "", nil, err
+			}
+			return "begins_with", args, nil
+		}
+		return "", nil, nil
+	}
+	return find(c.root)
+}
@@ -0,0 +1,132 @@
+package expr
+
+import (
+	"testing"
+
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+)
+
+func s(v string) types.AttributeValue { return &types.AttributeValueMemberS{Value: v} }
+func n(v string) types.AttributeValue { return &types.AttributeValueMemberN{Value: v} }
+
+func TestCondition(t *testing.T) {
+	item := Item{
+		"PK":      s("M#crab"),
+		"SK":      s("M#crab#2"),
+		"content": s("hello #crabs"),
+		"count":   n("3"),
+		"deleted": &types.AttributeValueMemberBOOL{Value: false},
+		"tags":    &types.AttributeValueMemberSS{Value: []string{"crabs", "sea"}},
+		"list":    &types.AttributeValueMemberL{Value: []types.AttributeValue{s("a"), s("b")}},
+	}
+	names := map[string]string{"#c": "count", "#missing": "nope"}
+	values := map[string]types.AttributeValue{
+		":pk":    s("M#crab"),
+		":one":   n("1"),
+		":three": n("3.0"),
+		":ten":   n("10"),
+		":true":  &types.AttributeValueMemberBOOL{Value: true},
+		":pre":   s("M#crab#"),
+		":word":  s("#crabs"),
+		":tag":   s("sea"),
+		":ss":    s("SS"),
+	}
+	tests := []struct {
+		expr    string
+		want    bool
+		wantErr bool
+	}{
+		{expr: "PK = :pk", want: true},
+		{expr: "PK <> :pk", want: false},
+		{expr: "#c = :three", want: true},
+		{expr: "#c > :one AND #c < :ten", want: true},
+		{expr: "#c >= :ten OR #c <= :one", want: false},
+		{expr: "NOT #c = :one", want: true},
+		{expr: "#c BETWEEN :one AND :three", want: true},
+		{expr: "#c IN (:one, :ten)", want: false},
+		{expr: "#c IN (:one, :three)", want: true},
+		{expr: "begins_with(SK, :pre)", want: true},
+		{expr: "contains(content, :word)", want: true},
+		{expr: "contains(tags, :tag)", want: true},
+		{expr: "attribute_type(tags, :ss)", want: true},
+		{expr: "size(list) = :one", want: false},
+		{expr: "attribute_exists(PK) AND attribute_not_exists(#missing)", want: true},
+		{expr: "(deleted = :true OR #c = :three) AND PK = :pk", want: true},
+		// a missing attribute only satisfies <>
+		{expr: "#missing = :one", want: false},
+		{expr: "#missing <> :one", want: true},
+		{expr: "#unknown = :one", wantErr: true},
+		{expr: "PK = :unknown", wantErr: true},
+		{expr: "PK =", wantErr: true},
+		{expr: "#c BETWEEN :one :ten", wantErr: true},
+		{expr: "(PK = :pk", wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.expr, func(t *testing.T) {
+			got, err := Match(&tt.expr, item, names, values)
+			if tt.wantErr {
+				if err == nil {
+					t.Fatalf("got %v, want an error", got)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got != tt.want {
+				t.Errorf("got %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestSortValues(t *testing.T) {
+	values := map[string]types.AttributeValue{
+		":pk": s("P"),
+		":a":  s("a"),
+		":b":  s("b"),
+		":n":  n("1"),
+	}
+	tests := []struct {
+		expr    string
+		op      string
+		args    []string
+		wantErr bool
+	}{
+		{expr: "PK = :pk"},
+		{expr: "PK = :pk AND SK = :a", op: "=", args: []string{"a"}},
+		{expr: "PK = :pk AND SK < :a", op: "<", args: []string{"a"}},
+		{expr: "PK = :pk AND :a < SK", op: ">", args: []string{"a"}},
+		{expr: "#sk >= :a AND PK = :pk", op: ">=", args: []string{"a"}},
+		{expr: "PK = :pk AND SK BETWEEN :a AND :b", op: "BETWEEN", args: []string{"a", "b"}},
+		{expr: "PK = :pk AND begins_with(SK, :a)", op: "begins_with", args: []string{"a"}},
+		{expr: "PK = :pk AND SK <> :a", wantErr: true},
+		{expr: "PK = :pk AND SK = :n", wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.expr, func(t *testing.T) {
+			c, err := ParseCondition(tt.expr)
+			if err != nil {
+				t.Fatal(err)
+			}
+			op, args, err := c.SortValues("SK", map[string]string{"#sk": "SK"}, values)
+			if tt.wantErr {
+				if err == nil {
+					t.Fatalf("got %q %q, want an error", op, args)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if op != tt.op || len(args) != len(tt.args) {
+				t.Fatalf("got %q %q, want %q %q", op, args, tt.op, tt.args)
+			}
+			for i := range args {
+				if args[i] != tt.args[i] {
+					t.Fatalf("got %q %q, want %q %q", op, args, tt.op, tt.args)
+				}
+			}
+		})
+	}
+}
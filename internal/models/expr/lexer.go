@@ -0,0 +1,150 @@
+// Package expr evaluates the DynamoDB expression language (key conditions,
+// filters, condition expressions and update expressions) against items held
+// outside of DynamoDB. It backs the local storage drivers so the models can
+// run without an AWS account.
+package expr
+
+import (
+	"fmt"
+	"strings"
+	"unicode"
+)
+
+type tokenKind int
+
+const (
+	tokEOF tokenKind = iota
+	tokIdent
+	tokName  // #name placeholder
+	tokValue // :value placeholder
+	tokOp    // = <> < <= > >= + -
+	tokLParen
+	tokRParen
+	tokComma
+)
+
+type token struct {
+	kind tokenKind
+	text string
+}
+
+// lex splits an expression into tokens. Identifiers are returned as written,
+// keywords are matched case-insensitively by the parser.
+func lex(s string) ([]token, error) {
+	var tokens []token
+	runes := []rune(s)
+	for i := 0; i < len(runes); {
+		r := runes[i]
+		switch {
+		case unicode.IsSpace(r):
+			i++
+		case r == '(':
+			tokens = append(tokens, token{tokLParen, "("})
+			i++
+		case r == ')':
+			tokens = append(tokens, token{tokRParen, ")"})
+			i++
+		case r == ',':
+			tokens = append(tokens, token{tokComma, ","})
+			i++
+		case r == '=' || r == '+' || r == '-':
+			tokens = append(tokens, token{tokOp, string(r)})
+			i++
+		case r == '<':
+			if i+1 < len(runes) && (runes[i+1] == '=' || runes[i+1] == '>') {
+				tokens = append(tokens, token{tokOp, string(runes[i : i+2])})
+				i += 2
+				continue
+			}
+			tokens = append(tokens, token{tokOp, "<"})
+			i++
+		case r == '>':
+			if i+1 < len(runes) && runes[i+1] == '=' {
+				tokens = append(tokens, token{tokOp, ">="})
+				i += 2
+				continue
+			}
+			tokens = append(tokens, token{tokOp, ">"})
+			i++
+		case r == '#' || r == ':':
+			j := i + 1
+			for j < len(runes) && isIdentRune(runes[j]) {
+				j++
+			}
+			if j == i+1 {
+				return nil, fmt.Errorf("expr: empty placeholder at offset %d in %q", i, s)
+			}
+			kind := tokName
+			if r == ':' {
+				kind = tokValue
+			}
+			tokens = append(tokens, token{kind, string(runes[i:j])})
+			i = j
+		case isIdentRune(r):
+			j := i
+			for j < len(runes) && isIdentRune(runes[j]) {
+				j++
+			}
+			tokens = append(tokens, token{tokIdent, string(runes[i:j])})
+			i = j
+		default:
+			return nil, fmt.Errorf("expr: unexpected %q at offset %d in %q", r, i, s)
+		}
+	}
+	return append(tokens, token{kind: tokEOF}), nil
+}
+
+func isIdentRune(r rune) bool {
+	return r == '_' || unicode.IsLetter(r) || unicode.IsDigit(r)
+}
+
+// parser is a small recursive descent parser shared by the condition and
+// update grammars.
+type parser struct {
+	src    string
+	tokens []token
+	pos    int
+}
+
+func newParser(s string) (*parser, error) {
+	tokens, err := lex(s)
+	if err != nil {
+		return nil, err
+	}
+	return &parser{src: s, tokens: tokens}, nil
+}
+
+func (p *parser) peek() token {
+	return p.tokens[p.pos]
+}
+
+func (p *parser) next() token {
+	t := p.tokens[p.pos]
+	if t.kind != tokEOF {
+		p.pos++
+	}
+	return t
+}
+
+// keyword reports whether the next token is the (case-insensitive) keyword kw
+// and consumes it if so.
+func (p *parser) keyword(kw string) bool {
+	t := p.peek()
+	if t.kind == tokIdent && strings.EqualFold(t.text, kw) {
+		p.pos++
+		return true
+	}
+	return false
+}
+
+func (p *parser) expect(kind tokenKind, what string) (token, error) {
+	t := p.next()
+	if t.kind != kind {
+		return t, p.errorf("expected %s, found %q", what, t.text)
+	}
+	return t, nil
+}
+
+func (p *parser) errorf(format string, args ...any) error {
+	return fmt.Errorf("expr: %s in %q", fmt.Sprintf(format, args...), p.src)
+}
@@ -0,0 +1,320 @@
+package expr
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+)
+
+// KeyAttributes returns the partition and sort key attribute names of the
+// base table (index "") or of one of the single table's GSIn indexes, which
+// are always keyed on GSInPK and GSInSK.
+func KeyAttributes(index string) (string, string) {
+	if index == "" {
+		return "PK", "SK"
+	}
+	return index + "PK", index + "SK"
+}
+
+// stringAttr returns the value of a string attribute.
+func stringAttr(item Item, name string) (string, bool) {
+	v, ok := item[name].(*types.AttributeValueMemberS)
+	if !ok {
+		return "", false
+	}
+	return v.Value, true
+}
+
+// Key returns the primary key of an item or key map.
+func Key(item Item) (string, string, error) {
+	pk, ok := stringAttr(item, "PK")
+	if !ok || pk == "" {
+		return "", "", fmt.Errorf("expr: missing string key attribute PK")
+	}
+	sk, ok := stringAttr(item, "SK")
+	if !ok || sk == "" {
+		return "", "", fmt.Errorf("expr: missing string key attribute SK")
+	}
+	return pk, sk, nil
+}
+
+// IndexKey returns the key an item is stored under in an index. Indexes are
+// sparse: ok is false when the item doesn't carry both index attributes.
+func IndexKey(item Item, index string) (pk, sk string, ok bool) {
+	pkAttr, skAttr := KeyAttributes(index)
+	pk, pkOK := stringAttr(item, pkAttr)
+	sk, skOK := stringAttr(item, skAttr)
+	return pk, sk, pkOK && skOK && pk != "" && sk != ""
+}
+
+// KeyOf copies the attributes DynamoDB would return as a LastEvaluatedKey
+// for an item read through index.
+func KeyOf(item Item, index string) Item {
+	key := Item{"PK": CloneValue(item["PK"]), "SK": CloneValue(item["SK"])}
+	if index != "" {
+		pkAttr, skAttr := KeyAttributes(index)
+		key[pkAttr] = CloneValue(item[pkAttr])
+		key[skAttr] = CloneValue(item[skAttr])
+	}
+	return key
+}
+
+// position is the ordering tuple of an item within an index: index
+// partition, index sort key, then the primary key to break ties.
+func position(item Item, index string) []string {
+	pk, _ := stringAttr(item, "PK")
+	sk, _ := stringAttr(item, "SK")
+	if index == "" {
+		return []string{pk, sk}
+	}
+	ipk, isk, _ := IndexKey(item, index)
+	return []string{ipk, isk, pk, sk}
+}
+
+func comparePositions(a, b []string) int {
+	for i := range a {
+		if c := strings.Compare(a[i], b[i]); c != 0 {
+			return c
+		}
+	}
+	return 0
+}
+
+// Sort orders items the way an index returns them.
+func Sort(items []Item, index string) {
+	sort.SliceStable(items, func(i, j int) bool {
+		return comparePositions(position(items[i], index), position(items[j], index)) < 0
+	})
+}
+
+// Partition parses a query's key condition and returns the partition key
+// value it selects, so a backend only has to load that partition.
+func Partition(in *dynamodb.QueryInput) (string, error) {
+	if in.KeyConditionExpression == nil {
+		return "", fmt.Errorf("expr: query needs a KeyConditionExpression")
+	}
+	c, err := ParseCondition(*in.KeyConditionExpression)
+	if err != nil {
+		return "", err
+	}
+	pkAttr, _ := KeyAttributes(aws.ToString(in.IndexName))
+	v, err := c.PartitionValue(pkAttr, in.ExpressionAttributeNames, in.ExpressionAttributeValues)
+	if err != nil {
+		return "", err
+	}
+	s, ok := v.(*types.AttributeValueMemberS)
+	if !ok {
+		return "", fmt.Errorf("expr: partition key %s must be a string", pkAttr)
+	}
+	return s.Value, nil
+}
+
+// SortCondition parses a query's key condition and returns the test it puts
+// on the sort key, as Condition.SortValues does, so a backend can read just
+// that range of the partition. op is empty when the whole partition has to
+// be read.
+func SortCondition(in *dynamodb.QueryInput) (op string, args []string, err error) {
+	if in.KeyConditionExpression == nil {
+		return "", nil, fmt.Errorf("expr: query needs a KeyConditionExpression")
+	}
+	c, err := ParseCondition(*in.KeyConditionExpression)
+	if err != nil {
+		return "", nil, err
+	}
+	_, skAttr := KeyAttributes(aws.ToString(in.IndexName))
+	return c.SortValues(skAttr, in.ExpressionAttributeNames, in.ExpressionAttributeValues)
+}
+
+// page holds the shared options of Query and Scan.
+type page struct {
+	index      string
+	keyCond    *string
+	filter     *string
+	projection *string
+	names      map[string]string
+	values     map[string]types.AttributeValue
+	startKey   Item
+	limit      *int32
+	forward    bool
+	count      bool
+}
+
+// QueryPage evaluates a Query against the items of the partition it targets.
+// candidates may be in any order and may include items outside the key
+// condition's sort key range.
+func QueryPage(candidates []Item, in *dynamodb.QueryInput) (*dynamodb.QueryOutput, error) {
+	if in.KeyConditionExpression == nil {
+		return nil, fmt.Errorf("expr: query needs a KeyConditionExpression")
+	}
+	items, last, scanned, err := run(candidates, page{
+		index:      aws.ToString(in.IndexName),
+		keyCond:    in.KeyConditionExpression,
+		filter:     in.FilterExpression,
+		projection: in.ProjectionExpression,
+		names:      in.ExpressionAttributeNames,
+		values:     in.ExpressionAttributeValues,
+		startKey:   in.ExclusiveStartKey,
+		limit:      in.Limit,
+		forward:    in.ScanIndexForward == nil || *in.ScanIndexForward,
+		count:      in.Select == types.SelectCount,
+	})
+	if err != nil {
+		return nil, err
+	}
+	out := &dynamodb.QueryOutput{
+		Count:            int32(len(items)),
+		ScannedCount:     scanned,
+		LastEvaluatedKey: last,
+	}
+	if in.Select != types.SelectCount {
+		out.Items = items
+	}
+	return out, nil
+}
+
+// ScanPage evaluates a Scan against every item of the table or index.
+func ScanPage(candidates []Item, in *dynamodb.ScanInput) (*dynamodb.ScanOutput, error) {
+	items, last, scanned, err := run(candidates, page{
+		index:      aws.ToString(in.IndexName),
+		filter:     in.FilterExpression,
+		projection: in.ProjectionExpression,
+		names:      in.ExpressionAttributeNames,
+		values:     in.ExpressionAttributeValues,
+		startKey:   in.ExclusiveStartKey,
+		limit:      in.Limit,
+		forward:    true,
+		count:      in.Select == types.SelectCount,
+	})
+	if err != nil {
+		return nil, err
+	}
+	out := &dynamodb.ScanOutput{
+		Count:            int32(len(items)),
+		ScannedCount:     scanned,
+		LastEvaluatedKey: last,
+	}
+	if in.Select != types.SelectCount {
+		out.Items = items
+	}
+	return out, nil
+}
+
+// run applies the key condition, ordering, ExclusiveStartKey, Limit, filter
+// and projection, in that order. Limit caps the number of items evaluated,
+// not returned, so a page can come back short when the filter drops items.
+func run(candidates []Item, p page) ([]Item, Item, int32, error) {
+	var keyCond *Condition
+	if p.keyCond != nil {
+		c, err := ParseCondition(*p.keyCond)
+		if err != nil {
+			return nil, nil, 0, err
+		}
+		keyCond = c
+	}
+	var filter *Condition
+	if p.filter != nil && strings.TrimSpace(*p.filter) != "" {
+		c, err := ParseCondition(*p.filter)
+		if err != nil {
+			return nil, nil, 0, err
+		}
+		filter = c
+	}
+
+	var inRange []Item
+	for _, item := range candidates {
+		if p.index != "" {
+			if _, _, ok := IndexKey(item, p.index); !ok {
+				continue
+			}
+		}
+		if keyCond != nil {
+			ok, err := keyCond.Eval(item, p.names, p.values)
+			if err != nil {
+				return nil, nil, 0, err
+			}
+			if !ok {
+				continue
+			}
+		}
+		inRange = append(inRange, item)
+	}
+	Sort(inRange, p.index)
+	if !p.forward {
+		for i, j := 0, len(inRange)-1; i < j; i, j = i+1, j-1 {
+			inRange[i], inRange[j] = inRange[j], inRange[i]
+		}
+	}
+
+	if p.startKey != nil {
+		start := position(p.startKey, p.index)
+		skip := 0
+		for skip < len(inRange) {
+			c := comparePositions(position(inRange[skip], p.index), start)
+			if (p.forward && c > 0) || (!p.forward && c < 0) {
+				break
+			}
+			skip++
+		}
+		inRange = inRange[skip:]
+	}
+
+	var (
+		out     []Item
+		scanned int32
+		last    Item
+	)
+	for i, item := range inRange {
+		if p.limit != nil && scanned >= *p.limit {
+			last = KeyOf(inRange[i-1], p.index)
+			break
+		}
+		scanned++
+		if filter != nil {
+			ok, err := filter.Eval(item, p.names, p.values)
+			if err != nil {
+				return nil, nil, 0, err
+			}
+			if !ok {
+				continue
+			}
+		}
+		projected, err := project(item, p.projection, p.names)
+		if err != nil {
+			return nil, nil, 0, err
+		}
+		out = append(out, projected)
+	}
+	return out, last, scanned, nil
+}
+
+// project keeps the top level attributes named by a projection expression.
+func project(item Item, projection *string, names map[string]string) (Item, error) {
+	if projection == nil || strings.TrimSpace(*projection) == "" {
+		return Clone(item), nil
+	}
+	out := Item{}
+	e := env{names: names}
+	for _, field := range strings.Split(*projection, ",") {
+		n, err := path{strings.TrimSpace(field)}.resolve(e)
+		if err != nil {
+			return nil, err
+		}
+		if v, ok := item[n]; ok {
+			out[n] = CloneValue(v)
+		}
+	}
+	return out, nil
+}
+
+// Project applies an optional projection expression to a single item, as
+// GetItem does.
+func Project(item Item, projection *string, names map[string]string) (Item, error) {
+	if item == nil {
+		return nil, nil
+	}
+	return project(item, projection, names)
+}
@@ -0,0 +1,280 @@
+package expr
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+)
+
+// molts are five molts of one crab, every other one deleted and the odd
+// ones filed on GSI1, given out of order.
+func molts() []Item {
+	var items []Item
+	for _, i := range []int{3, 1, 4, 0, 2} {
+		item := Item{
+			"PK":      s("M#crab"),
+			"SK":      s(fmt.Sprintf("M#crab#%d", i)),
+			"deleted": &types.AttributeValueMemberBOOL{Value: i%2 == 0},
+		}
+		if i%2 == 1 {
+			item["GSI1PK"] = s("G")
+			item["GSI1SK"] = s(fmt.Sprintf("G#%d", 9-i))
+		}
+		items = append(items, item)
+	}
+	return append(items, Item{"PK": s("M#other"), "SK": s("M#other#0")})
+}
+
+func sks(items []Item) []string {
+	out := make([]string, 0, len(items))
+	for _, item := range items {
+		v, _ := stringAttr(item, "SK")
+		out = append(out, v)
+	}
+	return out
+}
+
+func TestQueryPage(t *testing.T) {
+	values := map[string]types.AttributeValue{
+		":pk":      s("M#crab"),
+		":from":    s("M#crab#1"),
+		":to":      s("M#crab#3"),
+		":g":       s("G"),
+		":deleted": &types.AttributeValueMemberBOOL{Value: true},
+	}
+	tests := []struct {
+		name     string
+		in       dynamodb.QueryInput
+		want     []string
+		wantLast bool
+		scanned  int32
+	}{
+		{
+			name:    "whole partition in order",
+			in:      dynamodb.QueryInput{KeyConditionExpression: aws.String("PK = :pk")},
+			want:    []string{"M#crab#0", "M#crab#1", "M#crab#2", "M#crab#3", "M#crab#4"},
+			scanned: 5,
+		},
+		{
+			name: "backwards",
+			in: dynamodb.QueryInput{
+				KeyConditionExpression: aws.String("PK = :pk"),
+				ScanIndexForward:       aws.Bool(false),
+			},
+			want:    []string{"M#crab#4", "M#crab#3", "M#crab#2", "M#crab#1", "M#crab#0"},
+			scanned: 5,
+		},
+		{
+			name:    "sort key range",
+			in:      dynamodb.QueryInput{KeyConditionExpression: aws.String("PK = :pk AND SK BETWEEN :from AND :to")},
+			want:    []string{"M#crab#1", "M#crab#2", "M#crab#3"},
+			scanned: 3,
+		},
+		{
+			name: "limit leaves a key to carry on from",
+			in: dynamodb.QueryInput{
+				KeyConditionExpression: aws.String("PK = :pk"),
+				Limit:                  aws.Int32(2),
+			},
+			want:     []string{"M#crab#0", "M#crab#1"},
+			wantLast: true,
+			scanned:  2,
+		},
+		{
+			name: "limit counts items read, not returned",
+			in: dynamodb.QueryInput{
+				KeyConditionExpression: aws.String("PK = :pk"),
+				FilterExpression:       aws.String("deleted <> :deleted"),
+				Limit:                  aws.Int32(3),
+			},
+			want:     []string{"M#crab#1"},
+			wantLast: true,
+			scanned:  3,
+		},
+		{
+			name: "a limit that reaches the end leaves no key",
+			in: dynamodb.QueryInput{
+				KeyConditionExpression: aws.String("PK = :pk"),
+				Limit:                  aws.Int32(5),
+			},
+			want:    []string{"M#crab#0", "M#crab#1", "M#crab#2", "M#crab#3", "M#crab#4"},
+			scanned: 5,
+		},
+		{
+			name: "exclusive start key",
+			in: dynamodb.QueryInput{
+				KeyConditionExpression: aws.String("PK = :pk"),
+				ExclusiveStartKey:      Item{"PK": s("M#crab"), "SK": s("M#crab#2")},
+			},
+			want:    []string{"M#crab#3", "M#crab#4"},
+			scanned: 2,
+		},
+		{
+			name: "exclusive start key backwards",
+			in: dynamodb.QueryInput{
+				KeyConditionExpression: aws.String("PK = :pk"),
+				ExclusiveStartKey:      Item{"PK": s("M#crab"), "SK": s("M#crab#2")},
+				ScanIndexForward:       aws.Bool(false),
+			},
+			want:    []string{"M#crab#1", "M#crab#0"},
+			scanned: 2,
+		},
+		{
+			name: "index is sparse and ordered on its own key",
+			in: dynamodb.QueryInput{
+				IndexName:              aws.String("GSI1"),
+				KeyConditionExpression: aws.String("GSI1PK = :g"),
+			},
+			want:    []string{"M#crab#3", "M#crab#1"},
+			scanned: 2,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			in := tt.in
+			in.ExpressionAttributeValues = values
+			out, err := QueryPage(molts(), &in)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got := sks(out.Items); fmt.Sprint(got) != fmt.Sprint(tt.want) {
+				t.Errorf("got %v, want %v", got, tt.want)
+			}
+			if (out.LastEvaluatedKey != nil) != tt.wantLast {
+				t.Errorf("LastEvaluatedKey %v, want one: %v", out.LastEvaluatedKey, tt.wantLast)
+			}
+			if out.ScannedCount != tt.scanned || out.Count != int32(len(tt.want)) {
+				t.Errorf("scanned %d counted %d, want %d and %d", out.ScannedCount, out.Count, tt.scanned, len(tt.want))
+			}
+		})
+	}
+}
+
+// TestQueryPages reads a partition a page at a time and checks nothing is
+// lost or repeated between pages.
+func TestQueryPages(t *testing.T) {
+	for _, forward := range []bool{true, false} {
+		in := &dynamodb.QueryInput{
+			KeyConditionExpression:    aws.String("PK = :pk"),
+			ExpressionAttributeValues: map[string]types.AttributeValue{":pk": s("M#crab")},
+			ScanIndexForward:          aws.Bool(forward),
+			Limit:                     aws.Int32(2),
+		}
+		var got []string
+		for pages := 0; ; pages++ {
+			if pages > 5 {
+				t.Fatal("paging doesn't end")
+			}
+			out, err := QueryPage(molts(), in)
+			if err != nil {
+				t.Fatal(err)
+			}
+			got = append(got, sks(out.Items)...)
+			if out.LastEvaluatedKey == nil {
+				break
+			}
+			in.ExclusiveStartKey = out.LastEvaluatedKey
+		}
+		want := []string{"M#crab#0", "M#crab#1", "M#crab#2", "M#crab#3", "M#crab#4"}
+		if !forward {
+			want = []string{"M#crab#4", "M#crab#3", "M#crab#2", "M#crab#1", "M#crab#0"}
+		}
+		if fmt.Sprint(got) != fmt.Sprint(want) {
+			t.Errorf("forward %v: got %v, want %v", forward, got, want)
+		}
+	}
+}
+
+func TestQueryPageErrors(t *testing.T) {
+	tests := []struct {
+		name string
+		in   dynamodb.QueryInput
+	}{
+		{name: "no key condition", in: dynamodb.QueryInput{}},
+		{name: "bad key condition", in: dynamodb.QueryInput{KeyConditionExpression: aws.String("PK =")}},
+		{name: "bad filter", in: dynamodb.QueryInput{
+			KeyConditionExpression: aws.String("PK = :pk"),
+			FilterExpression:       aws.String("deleted <>"),
+		}},
+		{name: "unknown value", in: dynamodb.QueryInput{KeyConditionExpression: aws.String("PK = :nope")}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			in := tt.in
+			in.ExpressionAttributeValues = map[string]types.AttributeValue{":pk": s("M#crab")}
+			if _, err := QueryPage(molts(), &in); err == nil {
+				t.Error("want an error")
+			}
+		})
+	}
+}
+
+func TestScanPage(t *testing.T) {
+	tests := []struct {
+		name     string
+		in       dynamodb.ScanInput
+		want     []string
+		wantLast bool
+	}{
+		{
+			name: "every item in key order",
+			in:   dynamodb.ScanInput{},
+			want: []string{"M#crab#0", "M#crab#1", "M#crab#2", "M#crab#3", "M#crab#4", "M#other#0"},
+		},
+		{
+			name: "filtered",
+			in: dynamodb.ScanInput{
+				FilterExpression:          aws.String("begins_with(PK, :other)"),
+				ExpressionAttributeValues: map[string]types.AttributeValue{":other": s("M#other")},
+			},
+			want: []string{"M#other#0"},
+		},
+		{
+			name:     "limited",
+			in:       dynamodb.ScanInput{Limit: aws.Int32(4)},
+			want:     []string{"M#crab#0", "M#crab#1", "M#crab#2", "M#crab#3"},
+			wantLast: true,
+		},
+		{
+			name: "from a start key",
+			in:   dynamodb.ScanInput{ExclusiveStartKey: Item{"PK": s("M#crab"), "SK": s("M#crab#4")}},
+			want: []string{"M#other#0"},
+		},
+		{
+			name: "an index holds only what carries its keys",
+			in:   dynamodb.ScanInput{IndexName: aws.String("GSI1")},
+			want: []string{"M#crab#3", "M#crab#1"},
+		},
+		{
+			name:     "projected",
+			in:       dynamodb.ScanInput{ProjectionExpression: aws.String("SK"), Limit: aws.Int32(1)},
+			want:     []string{"M#crab#0"},
+			wantLast: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			in := tt.in
+			out, err := ScanPage(molts(), &in)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got := sks(out.Items); fmt.Sprint(got) != fmt.Sprint(tt.want) {
+				t.Errorf("got %v, want %v", got, tt.want)
+			}
+			if (out.LastEvaluatedKey != nil) != tt.wantLast {
+				t.Errorf("LastEvaluatedKey %v, want one: %v", out.LastEvaluatedKey, tt.wantLast)
+			}
+			if in.ProjectionExpression != nil {
+				for _, item := range out.Items {
+					if len(item) != 1 {
+						t.Errorf("projected item %v", item)
+					}
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,368 @@
+package expr
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+)
+
+// Update is a parsed update expression: any mix of SET, REMOVE, ADD and
+// DELETE clauses.
+type Update struct {
+	actions []action
+}
+
+type action struct {
+	kind  string // SET, REMOVE, ADD or DELETE
+	path  path
+	value valueExpr
+}
+
+// valueExpr is the right hand side of a SET action.
+type valueExpr interface {
+	eval(item Item, e env) (types.AttributeValue, bool, error)
+}
+
+type arithmetic struct {
+	op   string
+	l, r valueExpr
+}
+
+func (a arithmetic) eval(item Item, e env) (types.AttributeValue, bool, error) {
+	l, lok, err := a.l.eval(item, e)
+	if err != nil {
+		return nil, false, err
+	}
+	r, rok, err := a.r.eval(item, e)
+	if err != nil {
+		return nil, false, err
+	}
+	if !lok || !rok {
+		return nil, false, fmt.Errorf("expr: the provided expression refers to an attribute that does not exist in the item")
+	}
+	ln, lIsN := l.(*types.AttributeValueMemberN)
+	rn, rIsN := r.(*types.AttributeValueMemberN)
+	if !lIsN || !rIsN {
+		return nil, false, fmt.Errorf("expr: incorrect operand type for operator %s", a.op)
+	}
+	x, err := parseNumber(ln.Value)
+	if err != nil {
+		return nil, false, err
+	}
+	y, err := parseNumber(rn.Value)
+	if err != nil {
+		return nil, false, err
+	}
+	if a.op == "+" {
+		x.Add(x, y)
+	} else {
+		x.Sub(x, y)
+	}
+	return &types.AttributeValueMemberN{Value: formatNumber(x)}, true, nil
+}
+
+type ifNotExists struct {
+	path     path
+	fallback valueExpr
+}
+
+func (f ifNotExists) eval(item Item, e env) (types.AttributeValue, bool, error) {
+	v, ok, err := f.path.eval(item, e)
+	if err != nil || ok {
+		return v, ok, err
+	}
+	return f.fallback.eval(item, e)
+}
+
+type listAppend struct {
+	l, r valueExpr
+}
+
+func (f listAppend) eval(item Item, e env) (types.AttributeValue, bool, error) {
+	l, lok, err := f.l.eval(item, e)
+	if err != nil {
+		return nil, false, err
+	}
+	r, rok, err := f.r.eval(item, e)
+	if err != nil {
+		return nil, false, err
+	}
+	ll, lIsL := l.(*types.AttributeValueMemberL)
+	rl, rIsL := r.(*types.AttributeValueMemberL)
+	if !lok || !rok || !lIsL || !rIsL {
+		return nil, false, fmt.Errorf("expr: list_append takes two lists")
+	}
+	out := append(append([]types.AttributeValue{}, ll.Value...), rl.Value...)
+	return &types.AttributeValueMemberL{Value: out}, true, nil
+}
+
+// ParseUpdate parses an update expression such as
+// "set #like_count = #like_count + :value".
+func ParseUpdate(s string) (*Update, error) {
+	p, err := newParser(s)
+	if err != nil {
+		return nil, err
+	}
+	u := &Update{}
+	for p.peek().kind != tokEOF {
+		t := p.next()
+		kind := strings.ToUpper(t.text)
+		if t.kind != tokIdent || (kind != "SET" && kind != "REMOVE" && kind != "ADD" && kind != "DELETE") {
+			return nil, p.errorf("expected SET, REMOVE, ADD or DELETE, found %q", t.text)
+		}
+		for {
+			a, err := p.parseAction(kind)
+			if err != nil {
+				return nil, err
+			}
+			u.actions = append(u.actions, a)
+			if p.peek().kind != tokComma {
+				break
+			}
+			p.next()
+		}
+	}
+	if len(u.actions) == 0 {
+		return nil, p.errorf("empty update expression")
+	}
+	return u, nil
+}
+
+func (p *parser) parsePath() (path, error) {
+	t := p.next()
+	if t.kind != tokIdent && t.kind != tokName {
+		return path{}, p.errorf("expected attribute path, found %q", t.text)
+	}
+	return path{t.text}, nil
+}
+
+func (p *parser) parseAction(kind string) (action, error) {
+	target, err := p.parsePath()
+	if err != nil {
+		return action{}, err
+	}
+	a := action{kind: kind, path: target}
+	switch kind {
+	case "SET":
+		if t := p.next(); t.kind != tokOp || t.text != "=" {
+			return a, p.errorf("expected = after %s", target.text)
+		}
+		a.value, err = p.parseValueExpr()
+	case "ADD", "DELETE":
+		var v operand
+		v, err = p.parseOperand()
+		a.value = v
+	}
+	return a, err
+}
+
+func (p *parser) parseValueExpr() (valueExpr, error) {
+	l, err := p.parseTerm()
+	if err != nil {
+		return nil, err
+	}
+	if t := p.peek(); t.kind == tokOp && (t.text == "+" || t.text == "-") {
+		p.next()
+		r, err := p.parseTerm()
+		if err != nil {
+			return nil, err
+		}
+		return arithmetic{t.text, l, r}, nil
+	}
+	return l, nil
+}
+
+func (p *parser) parseTerm() (valueExpr, error) {
+	t := p.peek()
+	if t.kind == tokIdent && p.tokens[p.pos+1].kind == tokLParen {
+		switch strings.ToLower(t.text) {
+		case "if_not_exists":
+			p.next()
+			p.next()
+			target, err := p.parsePath()
+			if err != nil {
+				return nil, err
+			}
+			if _, err := p.expect(tokComma, ","); err != nil {
+				return nil, err
+			}
+			fallback, err := p.parseTerm()
+			if err != nil {
+				return nil, err
+			}
+			if _, err := p.expect(tokRParen, ")"); err != nil {
+				return nil, err
+			}
+			return ifNotExists{target, fallback}, nil
+		case "list_append":
+			p.next()
+			p.next()
+			l, err := p.parseTerm()
+			if err != nil {
+				return nil, err
+			}
+			if _, err := p.expect(tokComma, ","); err != nil {
+				return nil, err
+			}
+			r, err := p.parseTerm()
+			if err != nil {
+				return nil, err
+			}
+			if _, err := p.expect(tokRParen, ")"); err != nil {
+				return nil, err
+			}
+			return listAppend{l, r}, nil
+		}
+	}
+	return p.parseOperand()
+}
+
+// Apply runs the update against item in place. Every right hand side is
+// evaluated against the item as it was before the update, like DynamoDB does.
+func (u *Update) Apply(item Item, names map[string]string, values map[string]types.AttributeValue) error {
+	e := env{names: names, values: values}
+	before := Clone(item)
+	for _, a := range u.actions {
+		n, err := a.path.resolve(e)
+		if err != nil {
+			return err
+		}
+		if n == "PK" || n == "SK" {
+			return fmt.Errorf("expr: cannot update key attribute %s", n)
+		}
+		switch a.kind {
+		case "SET":
+			v, ok, err := a.value.eval(before, e)
+			if err != nil {
+				return err
+			}
+			if !ok {
+				return fmt.Errorf("expr: the provided expression refers to an attribute that does not exist in the item")
+			}
+			item[n] = CloneValue(v)
+		case "REMOVE":
+			delete(item, n)
+		case "ADD":
+			v, _, err := a.value.eval(before, e)
+			if err != nil {
+				return err
+			}
+			if err := add(item, n, v); err != nil {
+				return err
+			}
+		case "DELETE":
+			v, _, err := a.value.eval(before, e)
+			if err != nil {
+				return err
+			}
+			if err := remove(item, n, v); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// add implements the ADD action for numbers and sets.
+func add(item Item, name string, v types.AttributeValue) error {
+	cur, ok := item[name]
+	if !ok {
+		item[name] = CloneValue(v)
+		return nil
+	}
+	switch x := cur.(type) {
+	case *types.AttributeValueMemberN:
+		y, ok := v.(*types.AttributeValueMemberN)
+		if !ok {
+			return fmt.Errorf("expr: ADD of mismatched types to %s", name)
+		}
+		sum, _, err := arithmetic{"+", literal{x}, literal{y}}.eval(nil, env{})
+		if err != nil {
+			return err
+		}
+		item[name] = sum
+		return nil
+	case *types.AttributeValueMemberSS, *types.AttributeValueMemberNS, *types.AttributeValueMemberBS:
+		if typeName(cur) != typeName(v) {
+			return fmt.Errorf("expr: ADD of mismatched types to %s", name)
+		}
+		merged := members(cur)
+		for _, m := range members(v) {
+			found := false
+			for _, c := range merged {
+				if Equal(c, m) {
+					found = true
+					break
+				}
+			}
+			if !found {
+				merged = append(merged, m)
+			}
+		}
+		item[name] = toSet(typeName(cur), merged)
+		return nil
+	}
+	return fmt.Errorf("expr: ADD only supports numbers and sets")
+}
+
+// remove implements the DELETE action, which removes elements from a set.
+func remove(item Item, name string, v types.AttributeValue) error {
+	cur, ok := item[name]
+	if !ok {
+		return nil
+	}
+	if typeName(cur) != typeName(v) {
+		return fmt.Errorf("expr: DELETE of mismatched types from %s", name)
+	}
+	var kept []types.AttributeValue
+	for _, c := range members(cur) {
+		drop := false
+		for _, m := range members(v) {
+			if Equal(c, m) {
+				drop = true
+				break
+			}
+		}
+		if !drop {
+			kept = append(kept, c)
+		}
+	}
+	if len(kept) == 0 {
+		delete(item, name)
+		return nil
+	}
+	item[name] = toSet(typeName(cur), kept)
+	return nil
+}
+
+func toSet(kind string, values []types.AttributeValue) types.AttributeValue {
+	switch kind {
+	case "SS":
+		s := make([]string, len(values))
+		for i, v := range values {
+			s[i] = v.(*types.AttributeValueMemberS).Value
+		}
+		return &types.AttributeValueMemberSS{Value: s}
+	case "NS":
+		s := make([]string, len(values))
+		for i, v := range values {
+			s[i] = v.(*types.AttributeValueMemberN).Value
+		}
+		return &types.AttributeValueMemberNS{Value: s}
+	}
+	s := make([][]byte, len(values))
+	for i, v := range values {
+		s[i] = v.(*types.AttributeValueMemberB).Value
+	}
+	return &types.AttributeValueMemberBS{Value: s}
+}
+
+// literal wraps an already evaluated value so it can be reused as a term.
+type literal struct {
+	v types.AttributeValue
+}
+
+func (l literal) eval(Item, env) (types.AttributeValue, bool, error) {
+	return l.v, true, nil
+}
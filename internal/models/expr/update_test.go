@@ -0,0 +1,118 @@
+package expr
+
+import (
+	"testing"
+
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+)
+
+func TestUpdate(t *testing.T) {
+	base := func() Item {
+		return Item{
+			"PK":    s("P"),
+			"SK":    s("S"),
+			"count": n("2"),
+			"name":  s("crab"),
+			"tags":  &types.AttributeValueMemberSS{Value: []string{"a", "b"}},
+			"list":  &types.AttributeValueMemberL{Value: []types.AttributeValue{s("x")}},
+		}
+	}
+	names := map[string]string{"#c": "count", "#n": "name"}
+	values := map[string]types.AttributeValue{
+		":one":  n("1"),
+		":half": n("0.5"),
+		":new":  s("lobster"),
+		":tagc": &types.AttributeValueMemberSS{Value: []string{"c"}},
+		":taga": &types.AttributeValueMemberSS{Value: []string{"a"}},
+		":list": &types.AttributeValueMemberL{Value: []types.AttributeValue{s("y")}},
+	}
+	tests := []struct {
+		name    string
+		expr    string
+		check   func(Item) bool
+		wantErr bool
+	}{
+		{
+			name:  "set arithmetic",
+			expr:  "set #c = #c + :one",
+			check: func(i Item) bool { return Equal(i["count"], n("3")) },
+		},
+		{
+			name:  "set subtracts fractions",
+			expr:  "SET #c = #c - :half",
+			check: func(i Item) bool { return Equal(i["count"], n("1.5")) },
+		},
+		{
+			name: "right hand sides see the item before the update",
+			expr: "set #c = #c + :one, other = #c",
+			check: func(i Item) bool {
+				return Equal(i["count"], n("3")) && Equal(i["other"], n("2"))
+			},
+		},
+		{
+			name:  "if_not_exists keeps what is there",
+			expr:  "set #n = if_not_exists(#n, :new)",
+			check: func(i Item) bool { return Equal(i["name"], s("crab")) },
+		},
+		{
+			name:  "if_not_exists fills in what isn't",
+			expr:  "set fresh = if_not_exists(fresh, :new)",
+			check: func(i Item) bool { return Equal(i["fresh"], s("lobster")) },
+		},
+		{
+			name: "list_append",
+			expr: "set list = list_append(list, :list)",
+			check: func(i Item) bool {
+				return Equal(i["list"], &types.AttributeValueMemberL{Value: []types.AttributeValue{s("x"), s("y")}})
+			},
+		},
+		{
+			name: "remove and add in one expression",
+			expr: "REMOVE #n ADD #c :one, tags :tagc",
+			check: func(i Item) bool {
+				_, ok := i["name"]
+				return !ok && Equal(i["count"], n("3")) &&
+					Equal(i["tags"], &types.AttributeValueMemberSS{Value: []string{"a", "b", "c"}})
+			},
+		},
+		{
+			name:  "add creates a missing number",
+			expr:  "add views :one",
+			check: func(i Item) bool { return Equal(i["views"], n("1")) },
+		},
+		{
+			name: "delete from a set",
+			expr: "delete tags :taga",
+			check: func(i Item) bool {
+				return Equal(i["tags"], &types.AttributeValueMemberSS{Value: []string{"b"}})
+			},
+		},
+		{name: "arithmetic on a missing attribute", expr: "set #c = missing + :one", wantErr: true},
+		{name: "arithmetic on a string", expr: "set #c = #n + :one", wantErr: true},
+		{name: "key attributes can't change", expr: "set SK = :new", wantErr: true},
+		{name: "unknown clause", expr: "put #c = :one", wantErr: true},
+		{name: "empty", expr: "", wantErr: true},
+		{name: "unknown placeholder", expr: "set #c = :nope", wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			item := base()
+			u, err := ParseUpdate(tt.expr)
+			if err == nil {
+				err = u.Apply(item, names, values)
+			}
+			if tt.wantErr {
+				if err == nil {
+					t.Fatalf("got %v, want an error", item)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !tt.check(item) {
+				t.Errorf("unexpected result %v", item)
+			}
+		})
+	}
+}
@@ -0,0 +1,263 @@
+package expr
+
+import (
+	"bytes"
+	"fmt"
+	"math/big"
+	"sort"
+
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+)
+
+// Item is a single table item, the same shape the DynamoDB client returns.
+type Item = map[string]types.AttributeValue
+
+// Clone returns a deep copy of an item so stored state can't be mutated
+// through a value handed to or returned from a backend.
+func Clone(item Item) Item {
+	if item == nil {
+		return nil
+	}
+	out := make(Item, len(item))
+	for k, v := range item {
+		out[k] = CloneValue(v)
+	}
+	return out
+}
+
+// CloneValue returns a deep copy of a single attribute value.
+func CloneValue(v types.AttributeValue) types.AttributeValue {
+	switch t := v.(type) {
+	case *types.AttributeValueMemberS:
+		return &types.AttributeValueMemberS{Value: t.Value}
+	case *types.AttributeValueMemberN:
+		return &types.AttributeValueMemberN{Value: t.Value}
+	case *types.AttributeValueMemberB:
+		return &types.AttributeValueMemberB{Value: append([]byte(nil), t.Value...)}
+	case *types.AttributeValueMemberBOOL:
+		return &types.AttributeValueMemberBOOL{Value: t.Value}
+	case *types.AttributeValueMemberNULL:
+		return &types.AttributeValueMemberNULL{Value: t.Value}
+	case *types.AttributeValueMemberSS:
+		return &types.AttributeValueMemberSS{Value: append([]string(nil), t.Value...)}
+	case *types.AttributeValueMemberNS:
+		return &types.AttributeValueMemberNS{Value: append([]string(nil), t.Value...)}
+	case *types.AttributeValueMemberBS:
+		bs := make([][]byte, len(t.Value))
+		for i, b := range t.Value {
+			bs[i] = append([]byte(nil), b...)
+		}
+		return &types.AttributeValueMemberBS{Value: bs}
+	case *types.AttributeValueMemberL:
+		l := make([]types.AttributeValue, len(t.Value))
+		for i, e := range t.Value {
+			l[i] = CloneValue(e)
+		}
+		return &types.AttributeValueMemberL{Value: l}
+	case *types.AttributeValueMemberM:
+		return &types.AttributeValueMemberM{Value: Clone(t.Value)}
+	}
+	return v
+}
+
+// typeName returns the DynamoDB type descriptor of a value (S, N, B, ...).
+func typeName(v types.AttributeValue) string {
+	switch v.(type) {
+	case *types.AttributeValueMemberS:
+		return "S"
+	case *types.AttributeValueMemberN:
+		return "N"
+	case *types.AttributeValueMemberB:
+		return "B"
+	case *types.AttributeValueMemberBOOL:
+		return "BOOL"
+	case *types.AttributeValueMemberNULL:
+		return "NULL"
+	case *types.AttributeValueMemberSS:
+		return "SS"
+	case *types.AttributeValueMemberNS:
+		return "NS"
+	case *types.AttributeValueMemberBS:
+		return "BS"
+	case *types.AttributeValueMemberL:
+		return "L"
+	case *types.AttributeValueMemberM:
+		return "M"
+	}
+	return ""
+}
+
+func parseNumber(s string) (*big.Rat, error) {
+	r, ok := new(big.Rat).SetString(s)
+	if !ok {
+		return nil, fmt.Errorf("expr: invalid number %q", s)
+	}
+	return r, nil
+}
+
+func formatNumber(r *big.Rat) string {
+	if r.IsInt() {
+		return r.Num().String()
+	}
+	f, _ := r.Float64()
+	return big.NewFloat(f).Text('g', -1)
+}
+
+// Compare orders two scalar values of the same type. ok is false when the
+// values can't be ordered (different types, or a type with no ordering).
+func Compare(a, b types.AttributeValue) (cmp int, ok bool) {
+	switch x := a.(type) {
+	case *types.AttributeValueMemberS:
+		y, isS := b.(*types.AttributeValueMemberS)
+		if !isS {
+			return 0, false
+		}
+		switch {
+		case x.Value < y.Value:
+			return -1, true
+		case x.Value > y.Value:
+			return 1, true
+		}
+		return 0, true
+	case *types.AttributeValueMemberN:
+		y, isN := b.(*types.AttributeValueMemberN)
+		if !isN {
+			return 0, false
+		}
+		rx, err := parseNumber(x.Value)
+		if err != nil {
+			return 0, false
+		}
+		ry, err := parseNumber(y.Value)
+		if err != nil {
+			return 0, false
+		}
+		return rx.Cmp(ry), true
+	case *types.AttributeValueMemberB:
+		y, isB := b.(*types.AttributeValueMemberB)
+		if !isB {
+			return 0, false
+		}
+		return bytes.Compare(x.Value, y.Value), true
+	}
+	return 0, false
+}
+
+// Equal reports whether two attribute values are the same type and value.
+func Equal(a, b types.AttributeValue) bool {
+	if typeName(a) != typeName(b) {
+		return false
+	}
+	switch x := a.(type) {
+	case *types.AttributeValueMemberS, *types.AttributeValueMemberN, *types.AttributeValueMemberB:
+		c, ok := Compare(a, b)
+		return ok && c == 0
+	case *types.AttributeValueMemberBOOL:
+		return x.Value == b.(*types.AttributeValueMemberBOOL).Value
+	case *types.AttributeValueMemberNULL:
+		return true
+	case *types.AttributeValueMemberSS:
+		return sameStrings(x.Value, b.(*types.AttributeValueMemberSS).Value)
+	case *types.AttributeValueMemberNS:
+		return sameNumbers(x.Value, b.(*types.AttributeValueMemberNS).Value)
+	case *types.AttributeValueMemberBS:
+		y := b.(*types.AttributeValueMemberBS).Value
+		if len(x.Value) != len(y) {
+			return false
+		}
+		for _, e := range x.Value {
+			found := false
+			for _, f := range y {
+				if bytes.Equal(e, f) {
+					found = true
+					break
+				}
+			}
+			if !found {
+				return false
+			}
+		}
+		return true
+	case *types.AttributeValueMemberL:
+		y := b.(*types.AttributeValueMemberL).Value
+		if len(x.Value) != len(y) {
+			return false
+		}
+		for i := range x.Value {
+			if !Equal(x.Value[i], y[i]) {
+				return false
+			}
+		}
+		return true
+	case *types.AttributeValueMemberM:
+		y := b.(*types.AttributeValueMemberM).Value
+		if len(x.Value) != len(y) {
+			return false
+		}
+		for k, v := range x.Value {
+			w, ok := y[k]
+			if !ok || !Equal(v, w) {
+				return false
+			}
+		}
+		return true
+	}
+	return false
+}
+
+func sameStrings(a, b []string) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	x := append([]string(nil), a...)
+	y := append([]string(nil), b...)
+	sort.Strings(x)
+	sort.Strings(y)
+	for i := range x {
+		if x[i] != y[i] {
+			return false
+		}
+	}
+	return true
+}
+
+func sameNumbers(a, b []string) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for _, e := range a {
+		found := false
+		for _, f := range b {
+			if Equal(&types.AttributeValueMemberN{Value: e}, &types.AttributeValueMemberN{Value: f}) {
+				found = true
+				break
+			}
+		}
+		if !found {
+			return false
+		}
+	}
+	return true
+}
+
+// size implements the size() function: string length, binary length, or the
+// number of elements in a set, list or map.
+func size(v types.AttributeValue) (int, bool) {
+	switch t := v.(type) {
+	case *types.AttributeValueMemberS:
+		return len(t.Value), true
+	case *types.AttributeValueMemberB:
+		return len(t.Value), true
+	case *types.AttributeValueMemberSS:
+		return len(t.Value), true
+	case *types.AttributeValueMemberNS:
+		return len(t.Value), true
+	case *types.AttributeValueMemberBS:
+		return len(t.Value), true
+	case *types.AttributeValueMemberL:
+		return len(t.Value), true
+	case *types.AttributeValueMemberM:
+		return len(t.Value), true
+	}
+	return 0, false
+}
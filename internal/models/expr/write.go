@@ -0,0 +1,269 @@
+package expr
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+)
+
+// Write is one mutation resolved against the current version of its item.
+// Backends plan every write first and then persist the New images, which is
+// what lets a transaction be all or nothing.
+type Write struct {
+	Table  string
+	PK, SK string
+	Old    Item // nil when the item didn't exist
+	New    Item // nil when the write deletes the item
+}
+
+// Getter loads the current version of an item, or nil if there is none.
+type Getter func(table, pk, sk string) (Item, error)
+
+// TTL is the attribute the table's time to live reads.
+const TTL = "ttl"
+
+// Expiry is when item expires, in unix seconds. As with DynamoDB only a
+// Number ttl counts: an item without one, or with one of another type,
+// never expires.
+func Expiry(item Item) (int64, bool) {
+	ttl, ok := item[TTL].(*types.AttributeValueMemberN)
+	if !ok {
+		return 0, false
+	}
+	r, err := parseNumber(ttl.Value)
+	if err != nil {
+		return 0, false
+	}
+	f, _ := r.Float64()
+	return int64(f), true
+}
+
+// ConditionFailed is the error PutItem and UpdateItem return when their
+// condition expression doesn't hold, matching the DynamoDB client.
+func ConditionFailed() error {
+	return &types.ConditionalCheckFailedException{Message: aws.String("The conditional request failed")}
+}
+
+func check(current Item, condition *string, names map[string]string, values map[string]types.AttributeValue) error {
+	item := current
+	if item == nil {
+		item = Item{}
+	}
+	ok, err := Match(condition, item, names, values)
+	if err != nil {
+		return err
+	}
+	if !ok {
+		return ConditionFailed()
+	}
+	return nil
+}
+
+// PlanPut resolves a PutItem.
+func PlanPut(get Getter, in *dynamodb.PutItemInput) (Write, error) {
+	pk, sk, err := Key(in.Item)
+	if err != nil {
+		return Write{}, err
+	}
+	table := aws.ToString(in.TableName)
+	old, err := get(table, pk, sk)
+	if err != nil {
+		return Write{}, err
+	}
+	if err := check(old, in.ConditionExpression, in.ExpressionAttributeNames, in.ExpressionAttributeValues); err != nil {
+		return Write{}, err
+	}
+	return Write{Table: table, PK: pk, SK: sk, Old: old, New: Clone(in.Item)}, nil
+}
+
+// PlanUpdate resolves an UpdateItem. Like DynamoDB it creates the item when
+// it doesn't exist yet, unless the condition expression prevents that.
+func PlanUpdate(get Getter, in *dynamodb.UpdateItemInput) (Write, error) {
+	pk, sk, err := Key(in.Key)
+	if err != nil {
+		return Write{}, err
+	}
+	table := aws.ToString(in.TableName)
+	old, err := get(table, pk, sk)
+	if err != nil {
+		return Write{}, err
+	}
+	if err := check(old, in.ConditionExpression, in.ExpressionAttributeNames, in.ExpressionAttributeValues); err != nil {
+		return Write{}, err
+	}
+	next := Clone(old)
+	if next == nil {
+		next = Clone(in.Key)
+	}
+	if in.UpdateExpression != nil {
+		u, err := ParseUpdate(*in.UpdateExpression)
+		if err != nil {
+			return Write{}, err
+		}
+		if err := u.Apply(next, in.ExpressionAttributeNames, in.ExpressionAttributeValues); err != nil {
+			return Write{}, err
+		}
+	}
+	return Write{Table: table, PK: pk, SK: sk, Old: old, New: next}, nil
+}
+
+// PlanDelete resolves a DeleteItem.
+func PlanDelete(get Getter, in *dynamodb.DeleteItemInput) (Write, error) {
+	pk, sk, err := Key(in.Key)
+	if err != nil {
+		return Write{}, err
+	}
+	table := aws.ToString(in.TableName)
+	old, err := get(table, pk, sk)
+	if err != nil {
+		return Write{}, err
+	}
+	if err := check(old, in.ConditionExpression, in.ExpressionAttributeNames, in.ExpressionAttributeValues); err != nil {
+		return Write{}, err
+	}
+	return Write{Table: table, PK: pk, SK: sk, Old: old}, nil
+}
+
+// PlanTransaction resolves every action of a TransactWriteItems call. If any
+// condition fails nothing is returned but a TransactionCanceledException
+// whose reasons line up with the actions, as the DynamoDB client reports it.
+func PlanTransaction(get Getter, in *dynamodb.TransactWriteItemsInput) ([]Write, error) {
+	if len(in.TransactItems) == 0 || len(in.TransactItems) > 100 {
+		return nil, fmt.Errorf("expr: a transaction must have between 1 and 100 actions")
+	}
+	var (
+		writes  []Write
+		reasons = make([]types.CancellationReason, len(in.TransactItems))
+		failed  bool
+		seen    = map[[3]string]bool{}
+	)
+	for i, ti := range in.TransactItems {
+		var (
+			w   Write
+			err error
+		)
+		switch {
+		case ti.Put != nil:
+			w, err = PlanPut(get, &dynamodb.PutItemInput{
+				TableName:                 ti.Put.TableName,
+				Item:                      ti.Put.Item,
+				ConditionExpression:       ti.Put.ConditionExpression,
+				ExpressionAttributeNames:  ti.Put.ExpressionAttributeNames,
+				ExpressionAttributeValues: ti.Put.ExpressionAttributeValues,
+			})
+		case ti.Update != nil:
+			w, err = PlanUpdate(get, &dynamodb.UpdateItemInput{
+				TableName:                 ti.Update.TableName,
+				Key:                       ti.Update.Key,
+				UpdateExpression:          ti.Update.UpdateExpression,
+				ConditionExpression:       ti.Update.ConditionExpression,
+				ExpressionAttributeNames:  ti.Update.ExpressionAttributeNames,
+				ExpressionAttributeValues: ti.Update.ExpressionAttributeValues,
+			})
+		case ti.Delete != nil:
+			w, err = PlanDelete(get, &dynamodb.DeleteItemInput{
+				TableName:                 ti.Delete.TableName,
+				Key:                       ti.Delete.Key,
+				ConditionExpression:       ti.Delete.ConditionExpression,
+				ExpressionAttributeNames:  ti.Delete.ExpressionAttributeNames,
+				ExpressionAttributeValues: ti.Delete.ExpressionAttributeValues,
+			})
+		case ti.ConditionCheck != nil:
+			// A condition check is a delete-shaped plan that is never applied.
+			w, err = PlanDelete(get, &dynamodb.DeleteItemInput{
+				TableName:                 ti.ConditionCheck.TableName,
+				Key:                       ti.ConditionCheck.Key,
+				ConditionExpression:       ti.ConditionCheck.ConditionExpression,
+				ExpressionAttributeNames:  ti.ConditionCheck.ExpressionAttributeNames,
+				ExpressionAttributeValues: ti.ConditionCheck.ExpressionAttributeValues,
+			})
+			w.New = w.Old
+		default:
+			return nil, fmt.Errorf("expr: transaction action %d is empty", i)
+		}
+
+		reasons[i] = types.CancellationReason{Code: aws.String("None")}
+		if err != nil {
+			var ccf *types.ConditionalCheckFailedException
+			if !errors.As(err, &ccf) {
+				return nil, err
+			}
+			reasons[i] = types.CancellationReason{
+				Code:    aws.String("ConditionalCheckFailed"),
+				Message: aws.String("The conditional request failed"),
+			}
+			failed = true
+			continue
+		}
+
+		k := [3]string{w.Table, w.PK, w.SK}
+		if seen[k] {
+			return nil, fmt.Errorf("expr: transaction request cannot include multiple operations on one item")
+		}
+		seen[k] = true
+		if ti.ConditionCheck == nil {
+			writes = append(writes, w)
+		}
+	}
+	if failed {
+		return nil, &types.TransactionCanceledException{
+			Message:             aws.String("Transaction cancelled, please refer cancellation reasons for specific reasons"),
+			CancellationReasons: reasons,
+		}
+	}
+	return writes, nil
+}
+
+// PlanBatch resolves the puts and deletes of a BatchWriteItem call. Unlike a
+// transaction a batch has no conditions, but it still can't hold more than
+// 25 requests or touch one item twice.
+func PlanBatch(get Getter, in *dynamodb.BatchWriteItemInput) ([]Write, error) {
+	var (
+		writes []Write
+		seen   = map[[3]string]bool{}
+	)
+	for table, requests := range in.RequestItems {
+		for i, r := range requests {
+			var (
+				w   Write
+				err error
+			)
+			switch {
+			case r.PutRequest != nil:
+				w, err = PlanPut(get, &dynamodb.PutItemInput{TableName: aws.String(table), Item: r.PutRequest.Item})
+			case r.DeleteRequest != nil:
+				w, err = PlanDelete(get, &dynamodb.DeleteItemInput{TableName: aws.String(table), Key: r.DeleteRequest.Key})
+			default:
+				return nil, fmt.Errorf("expr: batch request %d for %s is empty", i, table)
+			}
+			if err != nil {
+				return nil, err
+			}
+			k := [3]string{w.Table, w.PK, w.SK}
+			if seen[k] {
+				return nil, fmt.Errorf("expr: batch request cannot include multiple operations on one item")
+			}
+			seen[k] = true
+			writes = append(writes, w)
+		}
+	}
+	if len(writes) == 0 || len(writes) > 25 {
+		return nil, fmt.Errorf("expr: a batch must have between 1 and 25 requests")
+	}
+	return writes, nil
+}
+
+// ReturnValues picks the image a write returns for the requested
+// ReturnValue setting.
+func ReturnValues(w Write, rv types.ReturnValue) Item {
+	switch rv {
+	case types.ReturnValueAllOld, types.ReturnValueUpdatedOld:
+		return Clone(w.Old)
+	case types.ReturnValueAllNew, types.ReturnValueUpdatedNew:
+		return Clone(w.New)
+	}
+	return nil
+}
@@ -0,0 +1,151 @@
+package expr
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+)
+
+func TestPlanTransaction(t *testing.T) {
+	stored := map[string]Item{
+		"C#crab": {"PK": s("C#crab"), "SK": s("C#crab"), "count": n("1")},
+	}
+	get := func(table, pk, sk string) (Item, error) {
+		return stored[pk], nil
+	}
+	key := func(pk string) Item { return Item{"PK": s(pk), "SK": s(pk)} }
+	put := func(pk string, cond string) types.TransactWriteItem {
+		p := &types.Put{TableName: aws.String("t"), Item: key(pk)}
+		if cond != "" {
+			p.ConditionExpression = aws.String(cond)
+		}
+		return types.TransactWriteItem{Put: p}
+	}
+	bump := types.TransactWriteItem{Update: &types.Update{
+		TableName:                 aws.String("t"),
+		Key:                       key("C#crab"),
+		UpdateExpression:          aws.String("set #count = #count + :one"),
+		ConditionExpression:       aws.String("attribute_exists(PK)"),
+		ExpressionAttributeNames:  map[string]string{"#count": "count"},
+		ExpressionAttributeValues: map[string]types.AttributeValue{":one": n("1")},
+	}}
+	check := func(pk string) types.TransactWriteItem {
+		return types.TransactWriteItem{ConditionCheck: &types.ConditionCheck{
+			TableName:           aws.String("t"),
+			Key:                 key(pk),
+			ConditionExpression: aws.String("attribute_exists(PK)"),
+		}}
+	}
+	del := func(pk string) types.TransactWriteItem {
+		return types.TransactWriteItem{Delete: &types.Delete{
+			TableName:           aws.String("t"),
+			Key:                 key(pk),
+			ConditionExpression: aws.String("attribute_exists(PK)"),
+		}}
+	}
+
+	tests := []struct {
+		name  string
+		items []types.TransactWriteItem
+		// writes is how many writes a transaction that goes through plans,
+		// failed the positions of the actions whose conditions fail.
+		writes  int
+		failed  []int
+		wantErr bool
+	}{
+		{
+			name:   "every condition holds",
+			items:  []types.TransactWriteItem{put("M#new", "attribute_not_exists(PK)"), bump},
+			writes: 2,
+		},
+		{
+			name:   "a condition check is not written",
+			items:  []types.TransactWriteItem{check("C#crab"), put("M#new", "")},
+			writes: 1,
+		},
+		{
+			name:   "one failed condition cancels the rest",
+			items:  []types.TransactWriteItem{bump, put("C#crab", "attribute_not_exists(PK)")},
+			failed: []int{1},
+		},
+		{
+			name:   "every failure is reported",
+			items:  []types.TransactWriteItem{del("M#gone"), bump, check("M#gone")},
+			failed: []int{0, 2},
+		},
+		{
+			name:    "one item twice",
+			items:   []types.TransactWriteItem{bump, bump},
+			wantErr: true,
+		},
+		{
+			name:    "empty action",
+			items:   []types.TransactWriteItem{{}},
+			wantErr: true,
+		},
+		{
+			name:    "nothing to do",
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			writes, err := PlanTransaction(get, &dynamodb.TransactWriteItemsInput{TransactItems: tt.items})
+			var tce *types.TransactionCanceledException
+			switch {
+			case tt.failed != nil:
+				if !errors.As(err, &tce) {
+					t.Fatalf("got %v, want a TransactionCanceledException", err)
+				}
+				if writes != nil {
+					t.Errorf("a cancelled transaction planned %d writes", len(writes))
+				}
+				if len(tce.CancellationReasons) != len(tt.items) {
+					t.Fatalf("%d reasons for %d actions", len(tce.CancellationReasons), len(tt.items))
+				}
+				failed := map[int]bool{}
+				for _, i := range tt.failed {
+					failed[i] = true
+				}
+				for i, reason := range tce.CancellationReasons {
+					want := "None"
+					if failed[i] {
+						want = "ConditionalCheckFailed"
+					}
+					if aws.ToString(reason.Code) != want {
+						t.Errorf("action %d: reason %s, want %s", i, aws.ToString(reason.Code), want)
+					}
+				}
+			case tt.wantErr:
+				if err == nil || errors.As(err, &tce) {
+					t.Fatalf("got %v, want a validation error", err)
+				}
+			default:
+				if err != nil {
+					t.Fatal(err)
+				}
+				if len(writes) != tt.writes {
+					t.Errorf("planned %d writes, want %d", len(writes), tt.writes)
+				}
+			}
+		})
+	}
+}
+
+func TestPlanConditionFailed(t *testing.T) {
+	get := func(table, pk, sk string) (Item, error) {
+		return Item{"PK": s(pk), "SK": s(sk)}, nil
+	}
+	_, err := PlanPut(get, &dynamodb.PutItemInput{
+		TableName:           aws.String("t"),
+		Item:                Item{"PK": s("P"), "SK": s("S")},
+		ConditionExpression: aws.String("attribute_not_exists(PK)"),
+	})
+	var ccf *types.ConditionalCheckFailedException
+	if !errors.As(err, &ccf) {
+		t.Errorf("got %v, want a ConditionalCheckFailedException", err)
+	}
+}
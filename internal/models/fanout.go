@@ -0,0 +1,322 @@
+package models
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/feature/dynamodb/attributevalue"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+	"strconv"
+	"time"
+)
+
+const (
+	// FanOutLease is how long a worker has a fan-out job to itself. Each
+	// page of followers it gets through renews it; if the worker dies the
+	// job comes due again once it runs out and picks up where it stopped.
+	FanOutLease = time.Minute
+	// maxFanOutBackoff caps how long a failing job waits between attempts.
+	maxFanOutBackoff = time.Hour
+)
+
+// FanOut is a queued job to write a molt into the trench of every follower
+// of its crab. It is put in the same transaction as the molt, so no molt
+// is left without one, and deleted once every follower has it. Deleting
+// the molt swaps it for a job that takes the molt back out again and
+// deletes its remolts.
+type FanOut struct {
+	PK     string `dynamodbav:"PK"` // FO
+	SK     string `dynamodbav:"SK"` // FO#moltID
+	CrabID string `dynamodbav:"crab_id"`
+	MoltID string `dynamodbav:"molt_id"`
+	MoltPK string `dynamodbav:"molt_pk"`
+	MoltSK string `dynamodbav:"molt_sk"`
+	// Cursor is the page of followers to carry on from, empty to start.
+	Cursor string `dynamodbav:"follower_cursor"`
+	// Due is when, in unix nanoseconds, the job may next be run: as soon
+	// as it is queued, after a lease runs out, or after a failure backs off.
+	Due      int64  `dynamodbav:"due"`
+	Attempts int    `dynamodbav:"attempts"`
+	Error    string `dynamodbav:"last_error,omitempty"`
+	// Retract says the molt has been deleted: its remolts go with it, and it
+	// comes out of the trenches rather than going in, unless it is a Reply,
+	// which never went in.
+	Retract bool `dynamodbav:"retract,omitempty"`
+	Reply   bool `dynamodbav:"reply,omitempty"`
+}
+
+func fanOutKey(moltID string) map[string]types.AttributeValue {
+	return map[string]types.AttributeValue{
+		"PK": &types.AttributeValueMemberS{Value: "FO"},
+		"SK": &types.AttributeValueMemberS{Value: "FO#" + moltID},
+	}
+}
+
+// fanOutPut queues the fan-out of molt, for Insert's transaction.
+func fanOutPut(molt *Molt, now time.Time) (types.TransactWriteItem, error) {
+	item, err := attributevalue.MarshalMap(
+		&FanOut{
+			PK:     "FO",
+			SK:     "FO#" + molt.ID,
+			CrabID: molt.PK[2:],
+			MoltID: molt.ID,
+			MoltPK: molt.PK,
+			MoltSK: molt.SK,
+			Due:    now.UnixNano(),
+		})
+	if err != nil {
+		return types.TransactWriteItem{}, fmt.Errorf("MarshalMap: %w", err)
+	}
+	return types.TransactWriteItem{
+		Put: &types.Put{
+			Item:                item,
+			TableName:           aws.String(TableName),
+			ConditionExpression: aws.String("attribute_not_exists(PK)"),
+		},
+	}, nil
+}
+
+// retractPut queues taking molt back out of the trenches and deleting its
+// remolts, for Delete's transaction. It replaces the molt's fan-out job if
+// that hasn't finished, which stops it at its next page.
+func retractPut(molt *Molt, now time.Time) (types.TransactWriteItem, error) {
+	item, err := attributevalue.MarshalMap(
+		&FanOut{
+			PK:      "FO",
+			SK:      "FO#" + molt.ID,
+			CrabID:  molt.PK[2:],
+			MoltID:  molt.ID,
+			MoltPK:  molt.PK,
+			MoltSK:  molt.SK,
+			Due:     now.UnixNano(),
+			Retract: true,
+			Reply:   molt.InReplyTo != "",
+		})
+	if err != nil {
+		return types.TransactWriteItem{}, fmt.Errorf("MarshalMap: %w", err)
+	}
+	return types.TransactWriteItem{
+		Put: &types.Put{
+			Item:      item,
+			TableName: aws.String(TableName),
+		},
+	}, nil
+}
+
+// DueFanOuts returns the fan-out jobs that are ready to run at now.
+func (m TrenchModel) DueFanOuts(ctx context.Context, now time.Time) ([]FanOut, error) {
+	jobs := make([]FanOut, 0)
+	p := dynamodb.NewQueryPaginator(m.SVC.ItemTable, &dynamodb.QueryInput{
+		TableName:              aws.String(TableName),
+		KeyConditionExpression: aws.String("PK = :pk"),
+		FilterExpression:       aws.String("due <= :now"),
+		ExpressionAttributeValues: map[string]types.AttributeValue{
+			":pk":  &types.AttributeValueMemberS{Value: "FO"},
+			":now": &types.AttributeValueMemberN{Value: strconv.FormatInt(now.UnixNano(), 10)},
+		},
+	})
+	for p.HasMorePages() {
+		out, err := p.NextPage(ctx)
+		if err != nil {
+			return nil, fmt.Errorf("Query: %w", err)
+		}
+		page := make([]FanOut, 0, len(out.Items))
+		err = attributevalue.UnmarshalListOfMaps(out.Items, &page)
+		if err != nil {
+			return nil, fmt.Errorf("UnmarshalListOfMaps: %w", err)
+		}
+		jobs = append(jobs, page...)
+	}
+	return jobs, nil
+}
+
+// lease pushes job's due time to until, as long as it is still the job
+// that was read. ErrConflict means another worker got to it first or it
+// was cancelled.
+func (m TrenchModel) lease(ctx context.Context, job *FanOut, until time.Time, set string, values map[string]types.AttributeValue) error {
+	if values == nil {
+		values = map[string]types.AttributeValue{}
+	}
+	values[":due"] = &types.AttributeValueMemberN{Value: strconv.FormatInt(job.Due, 10)}
+	values[":until"] = &types.AttributeValueMemberN{Value: strconv.FormatInt(until.UnixNano(), 10)}
+	_, err := m.SVC.ItemTable.UpdateItem(ctx, &dynamodb.UpdateItemInput{
+		TableName:                 aws.String(TableName),
+		Key:                       fanOutKey(job.MoltID),
+		ConditionExpression:       aws.String("due = :due"),
+		UpdateExpression:          aws.String("set due = :until" + set),
+		ExpressionAttributeValues: values,
+	})
+	if err != nil {
+		return fmt.Errorf("UpdateItem: %w", conflict(err))
+	}
+	job.Due = until.UnixNano()
+	return nil
+}
+
+// FanOut runs job: it claims it, writes the molt into the trenches of the
+// crab's followers a page at a time, saving how far it got after each, and
+// marks the molt fanned when done. A retract job deletes the molt's remolts
+// and takes it out of the same trenches instead. A failure is recorded on the job, which
+// is tried again after a back off that doubles each time. ErrConflict
+// means the job was taken by another worker or cancelled, and is no
+// failure.
+func (m TrenchModel) FanOut(ctx context.Context, job FanOut) error {
+	err := m.lease(ctx, &job, time.Now().Add(FanOutLease), "", nil)
+	if err != nil {
+		return err
+	}
+	err = m.fanOut(ctx, &job)
+	if err == nil || errors.Is(err, ErrConflict) {
+		return err
+	}
+	job.Attempts++
+	retry := m.lease(ctx, &job, time.Now().Add(fanOutBackoff(job.Attempts)), ", attempts = :attempts, last_error = :error", map[string]types.AttributeValue{
+		":attempts": &types.AttributeValueMemberN{Value: strconv.Itoa(job.Attempts)},
+		":error":    &types.AttributeValueMemberS{Value: err.Error()},
+	})
+	if retry != nil && !errors.Is(retry, ErrConflict) {
+		return fmt.Errorf("%w (recording it: %v)", err, retry)
+	}
+	return err
+}
+
+// fanOutBackoff is how long to wait after a job's attempts-th failure:
+// two seconds, then four, and so on up to maxFanOutBackoff.
+func fanOutBackoff(attempts int) time.Duration {
+	if attempts > 12 { // 2^12s is already over the cap
+		return maxFanOutBackoff
+	}
+	backoff := time.Duration(1<<attempts) * time.Second
+	if backoff > maxFanOutBackoff {
+		return maxFanOutBackoff
+	}
+	return backoff
+}
+
+func (m TrenchModel) fanOut(ctx context.Context, job *FanOut) error {
+	crab, err := CrabModel{SVC: m.SVC}.ByID(ctx, job.CrabID)
+	if errors.Is(err, ErrNoRecord) {
+		return m.drop(ctx, job) // nobody left to fan out for
+	}
+	if err != nil {
+		return err
+	}
+	if job.Retract {
+		return m.retract(ctx, job, crab)
+	}
+	err = m.demote(ctx, job, crab)
+	if err != nil {
+		return err
+	}
+	err = m.mark(ctx, crab)
+	if err != nil {
+		return err
+	}
+	molt := &Molt{ID: job.MoltID, PK: job.MoltPK, SK: job.MoltSK}
+	for !m.celebrity(crab) {
+		followers, next, err := FollowModel{SVC: m.SVC}.Followers(ctx, job.CrabID, job.Cursor)
+		if err != nil {
+			return err
+		}
+		err = m.Insert(ctx, followers, molt)
+		if err != nil {
+			return err
+		}
+		if next == "" {
+			break
+		}
+		// the lease renews along with the cursor, and a cancelled job stops here
+		err = m.lease(ctx, job, time.Now().Add(FanOutLease), ", follower_cursor = :cursor", map[string]types.AttributeValue{
+			":cursor": &types.AttributeValueMemberS{Value: next},
+		})
+		if err != nil {
+			return err
+		}
+		job.Cursor = next
+	}
+
+	_, err = m.SVC.ItemTable.UpdateItem(ctx, &dynamodb.UpdateItemInput{
+		TableName: aws.String(TableName),
+		Key: map[string]types.AttributeValue{
+			"PK": &types.AttributeValueMemberS{Value: job.MoltPK},
+			"SK": &types.AttributeValueMemberS{Value: job.MoltSK},
+		},
+		ConditionExpression: aws.String("attribute_exists(PK)"),
+		UpdateExpression:    aws.String("set fanned = :fanned"),
+		ExpressionAttributeValues: map[string]types.AttributeValue{
+			":fanned": &types.AttributeValueMemberBOOL{Value: true},
+		},
+	})
+	if err != nil && !errors.Is(conflict(err), ErrConflict) {
+		return fmt.Errorf("UpdateItem: %w", err)
+	}
+	return m.drop(ctx, job)
+}
+
+// retract deletes the remolts of job's molt and takes the molt back out of
+// the trenches of crab's followers, a page at a time as fanOut put it in.
+// A celebrity's molts never went in.
+func (m TrenchModel) retract(ctx context.Context, job *FanOut, crab *Crab) error {
+	// deleted remolts drop out of the index's reads, so the first page is
+	// always the next one
+	for {
+		remolts, err := MoltModel{SVC: m.SVC}.reMoltsOf(ctx, job.MoltID)
+		if err != nil {
+			return err
+		}
+		if len(remolts) == 0 {
+			break
+		}
+		for i := range remolts {
+			err = MoltModel{SVC: m.SVC}.Delete(ctx, &remolts[i])
+			if err != nil && !errors.Is(err, ErrConflict) {
+				return err
+			}
+		}
+		err = m.lease(ctx, job, time.Now().Add(FanOutLease), "", nil)
+		if err != nil {
+			return err
+		}
+	}
+	molt := &Molt{ID: job.MoltID}
+	for !job.Reply && !m.celebrity(crab) {
+		followers, next, err := FollowModel{SVC: m.SVC}.Followers(ctx, job.CrabID, job.Cursor)
+		if err != nil {
+			return err
+		}
+		err = m.Delete(ctx, followers, molt)
+		if err != nil {
+			return err
+		}
+		if next == "" {
+			break
+		}
+		err = m.lease(ctx, job, time.Now().Add(FanOutLease), ", follower_cursor = :cursor", map[string]types.AttributeValue{
+			":cursor": &types.AttributeValueMemberS{Value: next},
+		})
+		if err != nil {
+			return err
+		}
+		job.Cursor = next
+	}
+	return m.drop(ctx, job)
+}
+
+// drop takes a finished job off the queue, unless it has been replaced
+// since it was claimed.
+func (m TrenchModel) drop(ctx context.Context, job *FanOut) error {
+	_, err := m.SVC.ItemTable.DeleteItem(ctx, &dynamodb.DeleteItemInput{
+		TableName:           aws.String(TableName),
+		Key:                 fanOutKey(job.MoltID),
+		ConditionExpression: aws.String("due = :due"),
+		ExpressionAttributeValues: map[string]types.AttributeValue{
+			":due": &types.AttributeValueMemberN{Value: strconv.FormatInt(job.Due, 10)},
+		},
+	})
+	if err != nil {
+		return fmt.Errorf("DeleteItem: %w", conflict(err))
+	}
+	return nil
+}
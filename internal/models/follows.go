@@ -15,13 +15,23 @@ type FollowModel struct {
 }
 
 type Follow struct {
-	PK     string `dynamodbav:"PK"`
-	SK     string `dynamodbav:"SK"`
-	GSI6PK string `dynamodbav:"GSI6PK"`
-	GSI6SK string `dynamodbav:"GSI6SK"`
+	PK     string `dynamodbav:"PK"`     // F#followerID
+	SK     string `dynamodbav:"SK"`     // F#followeeID
+	GSI6PK string `dynamodbav:"GSI6PK"` // F#followeeID
+	GSI6SK string `dynamodbav:"GSI6SK"` // F#followerID
 }
 
-func (m FollowModel) Insert(Follower, Followee *Crab) error {
+// FollowerID is the id of the crab doing the following.
+func (f Follow) FollowerID() string {
+	return f.PK[2:]
+}
+
+// FolloweeID is the id of the crab being followed.
+func (f Follow) FolloweeID() string {
+	return f.SK[2:]
+}
+
+func (m FollowModel) Insert(ctx context.Context, Follower, Followee *Crab) error {
 	item, err := attributevalue.MarshalMap(
 		&Follow{
 			PK:     fmt.Sprintf("F#%s", Follower.ID),
@@ -30,20 +40,19 @@ func (m FollowModel) Insert(Follower, Followee *Crab) error {
 			GSI6SK: fmt.Sprintf("F#%s", Follower.ID),
 		})
 	if err != nil {
-		fmt.Println("ERR: ", err)
-		panic(err)
+		return fmt.Errorf("MarshalMap: %w", err)
 	}
 	notification, err := attributevalue.MarshalMap(
 		&Notification{
 			PK:       fmt.Sprintf("N#%s", Followee.ID),
-			SK:       fmt.Sprintf("N#%s#%s#%s", Follower.ID, "F", Followee.ID), // needs to be unique enough...
+			SK:       followSK(Followee.ID, Follower.ID),
 			UserName: Follower.UserName,
+			Scope:    ScopeFollower,
 			Viewed:   false,
-			TTL:      fmt.Sprintf("%d", time.Now().Add(time.Hour*24*7).Unix()), // delete notifs in a week to keep table smaller
+			TTL:      Expiry(time.Now().Add(time.Hour * 24 * 7).Unix()), // delete notifs in a week to keep table smaller
 		})
 	if err != nil {
-		fmt.Println("Notification ERR: ", err)
-		panic(err)
+		return fmt.Errorf("MarshalMap: %w", err)
 	}
 	tItems := make([]types.TransactWriteItem, 0)
 	tw1 := types.TransactWriteItem{
@@ -96,12 +105,11 @@ func (m FollowModel) Insert(Follower, Followee *Crab) error {
 			},
 		},
 	}
-	// notify
+	// notify; following again after an unfollow just refreshes it
 	tw4 := types.TransactWriteItem{
 		Put: &types.Put{
-			Item:                notification,
-			TableName:           aws.String(TableName),
-			ConditionExpression: aws.String("attribute_not_exists(PK)"),
+			Item:      notification,
+			TableName: aws.String(TableName),
 		},
 	}
 	tItems = append(tItems, tw1)
@@ -109,47 +117,41 @@ func (m FollowModel) Insert(Follower, Followee *Crab) error {
 	tItems = append(tItems, tw3)
 	tItems = append(tItems, tw4)
 
-	_, err = m.SVC.ItemTable.TransactWriteItems(context.TODO(), &dynamodb.TransactWriteItemsInput{
+	_, err = m.SVC.ItemTable.TransactWriteItems(ctx, &dynamodb.TransactWriteItemsInput{
 		TransactItems: tItems,
 	})
-
 	if err != nil {
-		return err
+		return fmt.Errorf("TransactWriteItems: %w", conflict(err))
 	}
+	SearchModel{SVC: m.SVC}.rerankCrab(ctx, Followee, 1)
 	return nil
-
 }
 
-// Show the crabs you are following
-func (m FollowModel) Show(id string) []Crab {
-	p := dynamodb.NewQueryPaginator(m.SVC.ItemTable, &dynamodb.QueryInput{
+// Show returns a page of id's follows, one for each crab id follows
+func (m FollowModel) Show(ctx context.Context, id, cursor string) ([]Follow, string, error) {
+	items, next, err := queryPage(ctx, m.SVC.ItemTable, &dynamodb.QueryInput{
 		TableName:              aws.String(TableName),
 		Limit:                  aws.Int32(PageSize),
 		KeyConditionExpression: aws.String("PK = :hashKey"),
 		ExpressionAttributeValues: map[string]types.AttributeValue{
 			":hashKey": &types.AttributeValueMemberS{Value: "F#" + id},
 		},
-	})
-	following := make([]Crab, 0)
-	for p.HasMorePages() {
-		out, err := p.NextPage(context.TODO())
-		if err != nil {
-			fmt.Printf("ERR: %s", err)
-			panic(err)
-		}
-		var follow []Crab
-		err = attributevalue.UnmarshalListOfMaps(out.Items, &following)
-		if err != nil {
-			fmt.Printf("ERR: %s", err)
-			panic(err)
-		}
-		following = append(following, follow...)
-	}
-	return following
+	}, cursor)
+	if err != nil {
+		return nil, "", err
+	}
+	following := make([]Follow, 0)
+	err = attributevalue.UnmarshalListOfMaps(items, &following)
+	if err != nil {
+		return nil, "", err
+	}
+	return following, next, nil
 }
 
-func (m FollowModel) Followers(id string) []Crab {
-	p := dynamodb.NewQueryPaginator(m.SVC.ItemTable, &dynamodb.QueryInput{
+// Followers returns a page of the follows of id, one for each crab
+// following id
+func (m FollowModel) Followers(ctx context.Context, id, cursor string) ([]Follow, string, error) {
+	items, next, err := queryPage(ctx, m.SVC.ItemTable, &dynamodb.QueryInput{
 		TableName:              aws.String(TableName),
 		Limit:                  aws.Int32(PageSize),
 		IndexName:              aws.String("GSI6"),
@@ -157,26 +159,34 @@ func (m FollowModel) Followers(id string) []Crab {
 		ExpressionAttributeValues: map[string]types.AttributeValue{
 			":gsi6pk": &types.AttributeValueMemberS{Value: "F#" + id},
 		},
+	}, cursor)
+	if err != nil {
+		return nil, "", err
+	}
+	followers := make([]Follow, 0)
+	err = attributevalue.UnmarshalListOfMaps(items, &followers)
+	if err != nil {
+		return nil, "", err
+	}
+	return followers, next, nil
+}
+
+// Exists reports whether follower follows followee
+func (m FollowModel) Exists(ctx context.Context, followerID, followeeID string) (bool, error) {
+	data, err := m.SVC.ItemTable.GetItem(ctx, &dynamodb.GetItemInput{
+		TableName: aws.String(TableName),
+		Key: map[string]types.AttributeValue{
+			"PK": &types.AttributeValueMemberS{Value: fmt.Sprintf("F#%s", followerID)},
+			"SK": &types.AttributeValueMemberS{Value: fmt.Sprintf("F#%s", followeeID)},
+		},
 	})
-	followers := make([]Crab, 0)
-	for p.HasMorePages() {
-		out, err := p.NextPage(context.TODO())
-		if err != nil {
-			fmt.Printf("ERR: %s", err)
-			panic(err)
-		}
-		var follow []Crab
-		err = attributevalue.UnmarshalListOfMaps(out.Items, &followers)
-		if err != nil {
-			fmt.Printf("ERR: %s", err)
-			panic(err)
-		}
-		followers = append(followers, follow...)
-	}
-	return followers
+	if err != nil {
+		return false, fmt.Errorf("GetItem: %w", err)
+	}
+	return data.Item != nil, nil
 }
 
-func (m FollowModel) Delete(Follower, Followee *Crab) error {
+func (m FollowModel) Delete(ctx context.Context, Follower, Followee *Crab) error {
 	tItems := make([]types.TransactWriteItem, 0)
 	// delete it from the main table
 	tw1 := types.TransactWriteItem{
@@ -189,7 +199,8 @@ func (m FollowModel) Delete(Follower, Followee *Crab) error {
 					Value: fmt.Sprintf("F#%s", Followee.ID),
 				},
 			},
-			TableName: aws.String(TableName),
+			TableName:           aws.String(TableName),
+			ConditionExpression: aws.String("attribute_exists(PK)"),
 		},
 	}
 	tw2 := types.TransactWriteItem{
@@ -216,10 +227,10 @@ func (m FollowModel) Delete(Follower, Followee *Crab) error {
 		Update: &types.Update{
 			Key: map[string]types.AttributeValue{
 				"PK": &types.AttributeValueMemberS{
-					Value: fmt.Sprintf("C#%s", Followee.Email),
+					Value: Followee.PK,
 				},
 				"SK": &types.AttributeValueMemberS{
-					Value: fmt.Sprintf("CU#%s", Followee.UserName), // need the email...
+					Value: Followee.SK,
 				},
 			},
 			TableName:        aws.String(TableName),
@@ -232,16 +243,37 @@ func (m FollowModel) Delete(Follower, Followee *Crab) error {
 			},
 		},
 	}
+	// and take back telling the followee about it, under its old key too
+	tw4 := types.TransactWriteItem{
+		Delete: &types.Delete{
+			Key: map[string]types.AttributeValue{
+				"PK": &types.AttributeValueMemberS{Value: fmt.Sprintf("N#%s", Followee.ID)},
+				"SK": &types.AttributeValueMemberS{Value: followSK(Followee.ID, Follower.ID)},
+			},
+			TableName: aws.String(TableName),
+		},
+	}
+	tw5 := types.TransactWriteItem{
+		Delete: &types.Delete{
+			Key: map[string]types.AttributeValue{
+				"PK": &types.AttributeValueMemberS{Value: fmt.Sprintf("N#%s", Followee.ID)},
+				"SK": &types.AttributeValueMemberS{Value: fmt.Sprintf("N#%s#%s#%s", Follower.ID, ScopeFollower, Followee.ID)},
+			},
+			TableName: aws.String(TableName),
+		},
+	}
 	tItems = append(tItems, tw1)
 	tItems = append(tItems, tw2)
 	tItems = append(tItems, tw3)
+	tItems = append(tItems, tw4)
+	tItems = append(tItems, tw5)
 
-	_, err := m.SVC.ItemTable.TransactWriteItems(context.TODO(), &dynamodb.TransactWriteItemsInput{
+	_, err := m.SVC.ItemTable.TransactWriteItems(ctx, &dynamodb.TransactWriteItemsInput{
 		TransactItems: tItems,
 	})
-
 	if err != nil {
-		fmt.Printf("\nErr: %v\n", err)
+		return fmt.Errorf("TransactWriteItems: %w", conflict(err))
 	}
-	return err
+	SearchModel{SVC: m.SVC}.rerankCrab(ctx, Followee, -1)
+	return nil
 }
@@ -0,0 +1,347 @@
+package models
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"github.com/aws/aws-sdk-go-v2/feature/dynamodb/attributevalue"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+)
+
+// Hydrator fills in what showing molts needs beyond what is stored with
+// them, for one crab looking at them. It reads in batches wherever the
+// table allows and remembers what it has read, so it is made for a single
+// request and thrown away with it.
+type Hydrator struct {
+	SVC ItemService
+	// Viewer is the id of the crab looking, empty when nobody is logged in.
+	Viewer string
+	molts  map[string]*Molt // by id, nil if deleted
+	crabs  map[string]*Crab // by id, nil if gone
+}
+
+func NewHydrator(svc ItemService, viewer string) *Hydrator {
+	return &Hydrator{
+		SVC:    svc,
+		Viewer: viewer,
+		molts:  make(map[string]*Molt),
+		crabs:  make(map[string]*Crab),
+	}
+}
+
+// moltRef is where a list keeps a molt it points at: the molt's id and,
+// for entries written since lists began keeping it, the molt's own key.
+type moltRef struct {
+	id     string
+	pk, sk string
+}
+
+// TrenchMolts loads the molts a page of trench entries point at, in the
+// same order. Molts that have since been deleted are skipped.
+func (h *Hydrator) TrenchMolts(ctx context.Context, trench []Trench) ([]Molt, error) {
+	refs := make([]moltRef, 0, len(trench))
+	for _, t := range trench {
+		refs = append(refs, moltRef{id: t.SK[2:], pk: t.MoltPK, sk: t.MoltSK})
+	}
+	return h.refMolts(ctx, refs)
+}
+
+// LikedMolts loads the molts a page of a crab's likes are on, in the same
+// order. Molts that have since been deleted are skipped.
+func (h *Hydrator) LikedMolts(ctx context.Context, likes []Like) ([]Molt, error) {
+	refs := make([]moltRef, 0, len(likes))
+	for _, l := range likes {
+		refs = append(refs, moltRef{id: l.SK[2:], pk: l.MoltPK, sk: l.MoltSK})
+	}
+	return h.refMolts(ctx, refs)
+}
+
+// TagMolts loads the molts a page of tags file, in the same order. Molts
+// that have since been deleted are skipped.
+func (h *Hydrator) TagMolts(ctx context.Context, tags []Tag) ([]Molt, error) {
+	refs := make([]moltRef, 0, len(tags))
+	for _, t := range tags {
+		refs = append(refs, moltRef{id: t.MoltID, pk: t.MoltPK, sk: t.MoltSK})
+	}
+	return h.refMolts(ctx, refs)
+}
+
+// refMolts loads the molts refs point at, in the same order. Refs that
+// carry their molt's key are read in one batch, older ones one at a time.
+// Molts that have since been deleted are skipped.
+func (h *Hydrator) refMolts(ctx context.Context, refs []moltRef) ([]Molt, error) {
+	keys := make([]map[string]types.AttributeValue, 0, len(refs))
+	for _, ref := range refs {
+		if _, ok := h.molts[ref.id]; ok || ref.pk == "" {
+			continue
+		}
+		keys = append(keys, map[string]types.AttributeValue{
+			"PK": &types.AttributeValueMemberS{Value: ref.pk},
+			"SK": &types.AttributeValueMemberS{Value: ref.sk},
+		})
+	}
+	_, err := h.batchMolts(ctx, keys)
+	if err != nil {
+		return nil, err
+	}
+	molts := make([]Molt, 0, len(refs))
+	for _, ref := range refs {
+		molt, err := h.molt(ctx, ref.id)
+		if err != nil {
+			return nil, err
+		}
+		if molt != nil {
+			molts = append(molts, *molt)
+		}
+	}
+	return molts, nil
+}
+
+// batchMolts reads the molts at keys into the cache. It returns the ones it
+// found, in no particular order, deleted ones included.
+func (h *Hydrator) batchMolts(ctx context.Context, keys []map[string]types.AttributeValue) ([]Molt, error) {
+	if len(keys) == 0 {
+		return nil, nil
+	}
+	items, err := batchGet(ctx, h.SVC.ItemTable, keys)
+	if err != nil {
+		return nil, err
+	}
+	molts := make([]Molt, 0, len(items))
+	err = attributevalue.UnmarshalListOfMaps(items, &molts)
+	if err != nil {
+		return nil, fmt.Errorf("UnmarshalListOfMaps: %w", err)
+	}
+	for i := range molts {
+		if molts[i].Deleted {
+			h.molts[molts[i].ID] = nil
+			continue
+		}
+		h.molts[molts[i].ID] = &molts[i]
+	}
+	return molts, nil
+}
+
+// molt is the molt with id, from the cache if it has been read. It is nil
+// if the molt has been deleted.
+func (h *Hydrator) molt(ctx context.Context, id string) (*Molt, error) {
+	if molt, ok := h.molts[id]; ok {
+		return molt, nil
+	}
+	molt, err := MoltModel{SVC: h.SVC}.ByID(ctx, id)
+	if errors.Is(err, ErrNoRecord) {
+		h.molts[id] = nil
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	h.molts[id] = molt
+	return molt, nil
+}
+
+// crab is the crab with id, from the cache if it has been read. It is nil
+// if there is no such crab any more.
+func (h *Hydrator) crab(ctx context.Context, id string) (*Crab, error) {
+	if c, ok := h.crabs[id]; ok {
+		return c, nil
+	}
+	c, err := CrabModel{SVC: h.SVC}.ByID(ctx, id)
+	if errors.Is(err, ErrNoRecord) {
+		h.crabs[id] = nil
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	h.crabs[id] = c
+	return c, nil
+}
+
+// Hydrate fills in molts for showing: the molts quotes embed, the first
+// reply under each, their authors' current avatars and names, and whether
+// the viewer has liked or remolted each. Quoted molts and authors are read
+// once each however often they appear, and the replies and the viewer's
+// likes and remolts in one batch each.
+func (h *Hydrator) Hydrate(ctx context.Context, molts []Molt) error {
+	for i := range molts {
+		if molts[i].QuoteOf == "" {
+			continue
+		}
+		original, err := h.molt(ctx, molts[i].QuoteOf)
+		if err != nil {
+			return err
+		}
+		if original != nil {
+			quoted := *original
+			molts[i].Quoted = &quoted
+		}
+	}
+	err := h.previews(ctx, molts)
+	if err != nil {
+		return err
+	}
+	for i := range molts {
+		err = h.author(ctx, &molts[i])
+		if err != nil {
+			return err
+		}
+		if molts[i].Quoted != nil {
+			err = h.author(ctx, molts[i].Quoted)
+			if err != nil {
+				return err
+			}
+		}
+		if molts[i].Preview != nil {
+			err = h.author(ctx, molts[i].Preview)
+			if err != nil {
+				return err
+			}
+		}
+	}
+	return h.Pressed(ctx, molts)
+}
+
+// previews reads the first reply under each of molts in one batch. Molts
+// only replied to before first replies were kept get no preview.
+func (h *Hydrator) previews(ctx context.Context, molts []Molt) error {
+	keys := make([]map[string]types.AttributeValue, 0, len(molts))
+	for _, molt := range molts {
+		if molt.FirstReplyPK == "" {
+			continue
+		}
+		keys = append(keys, map[string]types.AttributeValue{
+			"PK": &types.AttributeValueMemberS{Value: molt.FirstReplyPK},
+			"SK": &types.AttributeValueMemberS{Value: molt.FirstReplySK},
+		})
+	}
+	replies, err := h.batchMolts(ctx, keys)
+	if err != nil {
+		return err
+	}
+	bySK := make(map[string]*Molt, len(replies))
+	for i := range replies {
+		if !replies[i].Deleted {
+			bySK[replies[i].SK] = &replies[i]
+		}
+	}
+	for i := range molts {
+		if reply, ok := bySK[molts[i].FirstReplySK]; ok {
+			preview := *reply
+			molts[i].Preview = &preview
+		}
+	}
+	return nil
+}
+
+// author brings molt's author up to date with their crab. A remolt is kept
+// under the remolter's key, so it is left as it was copied.
+func (h *Hydrator) author(ctx context.Context, molt *Molt) error {
+	if molt.Remolt || len(molt.PK) < 2 {
+		return nil
+	}
+	c, err := h.crab(ctx, molt.PK[2:])
+	if err != nil || c == nil {
+		return err
+	}
+	molt.Author = c.UserName
+	molt.Display = c.Display
+	molt.CreatorAvatar = c.AvatarAt(ListAvatar)
+	return nil
+}
+
+// Pressed marks which of molts the viewer has liked or remolted, reading
+// both kinds of mark for the whole list in one batch.
+func (h *Hydrator) Pressed(ctx context.Context, molts []Molt) error {
+	if h.Viewer == "" || len(molts) == 0 {
+		return nil
+	}
+	keys := make([]map[string]types.AttributeValue, 0, 2*len(molts))
+	for _, molt := range molts {
+		keys = append(keys,
+			map[string]types.AttributeValue{
+				"PK": &types.AttributeValueMemberS{Value: fmt.Sprintf("L#%s", h.Viewer)},
+				"SK": &types.AttributeValueMemberS{Value: fmt.Sprintf("L#%s", molt.ID)},
+			},
+			map[string]types.AttributeValue{
+				"PK": &types.AttributeValueMemberS{Value: fmt.Sprintf("RM#%s", h.Viewer)},
+				"SK": &types.AttributeValueMemberS{Value: fmt.Sprintf("RM#%s", molt.ID)},
+			})
+	}
+	items, err := batchGet(ctx, h.SVC.ItemTable, keys)
+	if err != nil {
+		return err
+	}
+	marks := make(map[string]bool, len(items))
+	for _, item := range items {
+		sk, _ := item["SK"].(*types.AttributeValueMemberS)
+		if sk != nil {
+			marks[sk.Value] = true
+		}
+	}
+	for i := range molts {
+		molts[i].Liked = marks["L#"+molts[i].ID]
+		molts[i].ReMolted = marks["RM#"+molts[i].ID]
+	}
+	return nil
+}
+
+// Crabs loads the crabs with ids, in the same order, leaving out any that
+// are gone. Crabs are looked up by id through an index, which can't be read
+// in batches, so each is read on its own but only once per request.
+func (h *Hydrator) Crabs(ctx context.Context, ids []string) ([]Crab, error) {
+	crabs := make([]Crab, 0, len(ids))
+	for _, id := range ids {
+		c, err := h.crab(ctx, id)
+		if err != nil {
+			return nil, err
+		}
+		if c != nil {
+			crabs = append(crabs, *c)
+		}
+	}
+	return crabs, nil
+}
+
+// Follows marks which of crabs the viewer follows and which follow the
+// viewer, reading both ways for the whole list in one batch.
+func (h *Hydrator) Follows(ctx context.Context, crabs []Crab) error {
+	if h.Viewer == "" || len(crabs) == 0 {
+		return nil
+	}
+	key := func(followerID, followeeID string) map[string]types.AttributeValue {
+		return map[string]types.AttributeValue{
+			"PK": &types.AttributeValueMemberS{Value: fmt.Sprintf("F#%s", followerID)},
+			"SK": &types.AttributeValueMemberS{Value: fmt.Sprintf("F#%s", followeeID)},
+		}
+	}
+	keys := make([]map[string]types.AttributeValue, 0, 2*len(crabs))
+	for _, c := range crabs {
+		if c.ID != h.Viewer {
+			keys = append(keys, key(h.Viewer, c.ID), key(c.ID, h.Viewer))
+		}
+	}
+	items, err := batchGet(ctx, h.SVC.ItemTable, keys)
+	if err != nil {
+		return err
+	}
+	follows := make([]Follow, 0, len(items))
+	err = attributevalue.UnmarshalListOfMaps(items, &follows)
+	if err != nil {
+		return fmt.Errorf("UnmarshalListOfMaps: %w", err)
+	}
+	followed := make(map[string]bool, len(follows))
+	followsYou := make(map[string]bool, len(follows))
+	for _, f := range follows {
+		if f.FollowerID() == h.Viewer {
+			followed[f.FolloweeID()] = true
+		} else {
+			followsYou[f.FollowerID()] = true
+		}
+	}
+	for i := range crabs {
+		crabs[i].Followed = followed[crabs[i].ID]
+		crabs[i].FollowsYou = followsYou[crabs[i].ID]
+	}
+	return nil
+}
@@ -0,0 +1,231 @@
+package models
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"golang.org/x/image/draw"
+	"golang.org/x/image/math/f64"
+	"golang.org/x/image/webp"
+	"image"
+	"image/gif"
+	"image/jpeg"
+	"image/png"
+	"io"
+	"net/http"
+)
+
+var (
+	ErrImageTooLarge    = errors.New("models: image too large")
+	ErrUnsupportedImage = errors.New("models: not a JPEG, PNG, GIF or WebP image")
+)
+
+const (
+	// MaxImageSize is the most bytes an uploaded image can be.
+	MaxImageSize = 5 << 20
+	// MaxImagePixels stops small files that decode into huge images. It
+	// leaves room for a 12 megapixel phone photo.
+	MaxImagePixels = 16_000_000
+)
+
+// decodeImage sniffs what data is and decodes it if it is an image we take,
+// turned the right way up. Only the pixels are kept, which is what strips
+// EXIF and the like once it is encoded again. GIFs keep their first frame:
+// an animation can unpack to far more than its file size suggests.
+func decodeImage(data []byte) (image.Image, error) {
+	if len(data) > MaxImageSize {
+		return nil, ErrImageTooLarge
+	}
+	kind := http.DetectContentType(data)
+	var decodeConfig func(io.Reader) (image.Config, error)
+	var decode func(io.Reader) (image.Image, error)
+	switch kind {
+	case "image/jpeg":
+		decodeConfig, decode = jpeg.DecodeConfig, jpeg.Decode
+	case "image/png":
+		decodeConfig, decode = png.DecodeConfig, png.Decode
+	case "image/gif":
+		decodeConfig, decode = gif.DecodeConfig, gif.Decode
+	case "image/webp":
+		decodeConfig, decode = webp.DecodeConfig, webp.Decode
+	default:
+		return nil, ErrUnsupportedImage
+	}
+	cfg, err := decodeConfig(bytes.NewReader(data))
+	if err != nil {
+		return nil, ErrUnsupportedImage
+	}
+	if cfg.Width <= 0 || cfg.Height <= 0 || cfg.Width*cfg.Height > MaxImagePixels {
+		return nil, ErrImageTooLarge
+	}
+	img, err := decode(bytes.NewReader(data))
+	if err != nil {
+		return nil, ErrUnsupportedImage
+	}
+	if kind == "image/jpeg" {
+		img = orient(img, exifOrientation(data))
+	}
+	return img, nil
+}
+
+// encodeImage writes img out as a JPEG, or as a PNG if it has see-through
+// parts.
+func encodeImage(img image.Image) ([]byte, string, error) {
+	var b bytes.Buffer
+	if opaque(img) {
+		err := jpeg.Encode(&b, img, &jpeg.Options{Quality: 85})
+		if err != nil {
+			return nil, "", fmt.Errorf("jpeg.Encode: %w", err)
+		}
+		return b.Bytes(), "image/jpeg", nil
+	}
+	err := png.Encode(&b, img)
+	if err != nil {
+		return nil, "", fmt.Errorf("png.Encode: %w", err)
+	}
+	return b.Bytes(), "image/png", nil
+}
+
+// extension is the file extension for the types encodeImage writes.
+func extension(contentType string) string {
+	if contentType == "image/png" {
+		return ".png"
+	}
+	return ".jpg"
+}
+
+func opaque(img image.Image) bool {
+	if o, ok := img.(interface{ Opaque() bool }); ok {
+		return o.Opaque()
+	}
+	return false
+}
+
+// fit scales img down to fit in a side by side square, keeping its shape.
+// Images that already fit come back as they are.
+func fit(img image.Image, side int) image.Image {
+	b := img.Bounds()
+	w, h := b.Dx(), b.Dy()
+	if w <= side && h <= side {
+		return img
+	}
+	if w >= h {
+		w, h = side, max(1, h*side/w)
+	} else {
+		w, h = max(1, w*side/h), side
+	}
+	dst := image.NewNRGBA(image.Rect(0, 0, w, h))
+	draw.CatmullRom.Scale(dst, dst.Bounds(), img, b, draw.Src, nil)
+	return dst
+}
+
+// cover crops the middle of img to the shape of a w by h box and scales it
+// to fill the box. Images smaller than the box aren't blown up: they come
+// back cropped to its shape at their own size.
+func cover(img image.Image, w, h int) image.Image {
+	b := img.Bounds()
+	cw, ch := b.Dx(), b.Dy()
+	if cw*h > ch*w {
+		cw = max(1, ch*w/h)
+	} else {
+		ch = max(1, cw*h/w)
+	}
+	crop := image.Rect(0, 0, cw, ch).Add(b.Min).Add(image.Pt((b.Dx()-cw)/2, (b.Dy()-ch)/2))
+	if cw < w {
+		w, h = cw, ch
+	}
+	dst := image.NewNRGBA(image.Rect(0, 0, w, h))
+	draw.CatmullRom.Scale(dst, dst.Bounds(), img, crop, draw.Src, nil)
+	return dst
+}
+
+func max(a, b int) int {
+	if a > b {
+		return a
+	}
+	return b
+}
+
+// exifOrientation reads the orientation tag phones put in a JPEG's EXIF
+// instead of turning the pixels. It is 1, upright, if there isn't one.
+func exifOrientation(data []byte) int {
+	if len(data) < 4 || data[0] != 0xFF || data[1] != 0xD8 {
+		return 1
+	}
+	for i := 2; i+4 <= len(data) && data[i] == 0xFF; {
+		marker := data[i+1]
+		size := int(binary.BigEndian.Uint16(data[i+2:]))
+		if marker == 0xDA || size < 2 || i+2+size > len(data) {
+			break // image data starts, or the file is broken
+		}
+		segment := data[i+4 : i+2+size]
+		if marker == 0xE1 && bytes.HasPrefix(segment, []byte("Exif\x00\x00")) {
+			return tiffOrientation(segment[6:])
+		}
+		i += 2 + size
+	}
+	return 1
+}
+
+func tiffOrientation(tiff []byte) int {
+	if len(tiff) < 8 {
+		return 1
+	}
+	var order binary.ByteOrder
+	switch string(tiff[:2]) {
+	case "II":
+		order = binary.LittleEndian
+	case "MM":
+		order = binary.BigEndian
+	default:
+		return 1
+	}
+	ifd := int(order.Uint32(tiff[4:]))
+	if ifd < 8 || ifd+2 > len(tiff) {
+		return 1
+	}
+	n := int(order.Uint16(tiff[ifd:]))
+	for e := ifd + 2; e+12 <= len(tiff) && n > 0; e, n = e+12, n-1 {
+		if order.Uint16(tiff[e:]) == 0x0112 {
+			o := int(order.Uint16(tiff[e+8:]))
+			if o < 1 || o > 8 {
+				return 1
+			}
+			return o
+		}
+	}
+	return 1
+}
+
+// orient turns img the way EXIF orientation o says it should be shown.
+func orient(img image.Image, o int) image.Image {
+	if o <= 1 || o > 8 {
+		return img
+	}
+	b := img.Bounds()
+	w, h := float64(b.Dx()), float64(b.Dy())
+	// where a pixel at x, y (from the image's corner) lands, as
+	// dx = a*x + b*y + c and dy = d*x + e*y + f
+	m := map[int]f64.Aff3{
+		2: {-1, 0, w, 0, 1, 0},
+		3: {-1, 0, w, 0, -1, h},
+		4: {1, 0, 0, 0, -1, h},
+		5: {0, 1, 0, 1, 0, 0},
+		6: {0, -1, h, 1, 0, 0},
+		7: {0, -1, h, -1, 0, w},
+		8: {0, 1, 0, -1, 0, w},
+	}[o]
+	// the matrix takes img's own coordinates, so fold its corner in
+	minX, minY := float64(b.Min.X), float64(b.Min.Y)
+	m[2] -= m[0]*minX + m[1]*minY
+	m[5] -= m[3]*minX + m[4]*minY
+	dw, dh := b.Dx(), b.Dy()
+	// 5 to 8 are turned on their side
+	if o >= 5 {
+		dw, dh = dh, dw
+	}
+	dst := image.NewNRGBA(image.Rect(0, 0, dw, dh))
+	draw.NearestNeighbor.Transform(dst, m, img, b, draw.Src, nil)
+	return dst
+}
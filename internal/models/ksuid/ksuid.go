@@ -2,29 +2,36 @@ package ksuid
 
 import (
 	cr "crypto/rand"
-	"encoding/binary"
 	"fmt"
 	"github.com/segmentio/ksuid"
 	"time"
 )
 
 func GenerateKSUID() ksuid.KSUID {
+	return At(time.Now())
+}
+
+// At makes a KSUID for something that happened at t, for backfilling items
+// with the time they were really made.
+func At(t time.Time) ksuid.KSUID {
 	b := make([]byte, 16)
-	r, err := cr.Read(b) // random
+	_, err := cr.Read(b) // random, so two made in the same second still differ
 	if err != nil {
 		fmt.Printf("ERR %s", err)
 	}
-	p := toByteArray(r)
-	bar := p[:]
-	t := time.Unix(time.Now().Unix(), 0)
-	k, err := ksuid.FromParts(t, bar)
+	k, err := ksuid.FromParts(time.Unix(t.Unix(), 0), b)
 	if err != nil {
 		fmt.Printf("err: %s", err)
 	}
 	return k
 }
 
-func toByteArray(i int) (arr [16]byte) {
-	binary.BigEndian.PutUint32(arr[0:16], uint32(i))
-	return
+// Floor is the smallest KSUID of the second t falls in. Every KSUID made
+// in an earlier second sorts before it, so it bounds key ranges by time.
+func Floor(t time.Time) ksuid.KSUID {
+	k, err := ksuid.FromParts(time.Unix(t.Unix(), 0), make([]byte, 16))
+	if err != nil {
+		fmt.Printf("err: %s", err)
+	}
+	return k
 }
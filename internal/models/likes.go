@@ -15,40 +15,26 @@ type Like struct {
 	SK     string `dynamodbav:"SK"`
 	GSI7PK string `dynamodbav:"GSI7PK"`
 	GSI7SK string `dynamodbav:"GSI7SK"`
+	// MoltPK and MoltSK are the liked molt's own key, so a page of likes can
+	// be read in one batch. Likes from before they were kept don't have them.
+	MoltPK string `dynamodbav:"molt_pk,omitempty"`
+	MoltSK string `dynamodbav:"molt_sk,omitempty"`
 }
 
 type LikesModel struct {
 	SVC ItemService
 }
 
-// Change this to be by Email -> Add e-mail to param store ->
-func (m LikesModel) ByID(id string) (*Crab, error) {
-	c := make([]Crab, 0)
-	ut, err := m.SVC.ItemTable.Query(context.TODO(), &dynamodb.QueryInput{
-		TableName:              aws.String(TableName),
-		IndexName:              aws.String("GSI2"),
-		KeyConditionExpression: aws.String("GSI2PK = :gsi2pk"),
-		ExpressionAttributeValues: map[string]types.AttributeValue{
-			":gsi2pk": &types.AttributeValueMemberS{Value: fmt.Sprintf("ID#%s", id)},
-		},
-	})
-	if err != nil {
-		fmt.Printf("BYID ERROR %v", err)
-		panic(err)
-	}
-	err = attributevalue.UnmarshalListOfMaps(ut.Items, &c)
-	if err != nil {
-		fmt.Errorf("UnmarshalMap: %v\n", err)
-	}
-	//fmt.Println("HERES BY ID", prettyPrint(&c[0]))
-	return &c[0], nil
+// ByID looks up the crab that liked a molt
+func (m LikesModel) ByID(ctx context.Context, id string) (*Crab, error) {
+	return CrabModel{SVC: m.SVC}.ByID(ctx, id)
 }
 
 // Insert a Like record
-func (m LikesModel) Insert(cid string, molt *Molt) error {
-	c, err := m.ByID(cid)
+func (m LikesModel) Insert(ctx context.Context, cid string, molt *Molt) error {
+	c, err := m.ByID(ctx, cid)
 	if err != nil {
-		fmt.Printf("ERR getting crab that liked the molt... %v", err)
+		return err
 	}
 	item, err := attributevalue.MarshalMap(
 		&Like{
@@ -56,24 +42,25 @@ func (m LikesModel) Insert(cid string, molt *Molt) error {
 			SK:     fmt.Sprintf("L#%s", molt.ID),
 			GSI7PK: fmt.Sprintf("L#%s", molt.ID),
 			GSI7SK: fmt.Sprintf("L#%s", cid),
+			MoltPK: molt.PK,
+			MoltSK: molt.SK,
 		})
 	if err != nil {
-		fmt.Println("ERR: ", err)
-		panic(err)
+		return fmt.Errorf("MarshalMap: %w", err)
 	}
 	ownerID := molt.PK[2:]
-	fmt.Println("OWNER ID", ownerID)
 	notification, err := attributevalue.MarshalMap(
 		&Notification{
-			PK:       fmt.Sprintf("N#%s", ownerID),                     // slice the crabs id
-			SK:       fmt.Sprintf("N#%s#%s#%s", ownerID, "L", molt.ID), // needs to be unique enough...
-			UserName: c.UserName,                                       // need to fetch crab
+			PK:       fmt.Sprintf("N#%s", ownerID), // slice the crabs id
+			SK:       reactionSK(ownerID, ScopeLike, molt.ID, cid),
+			UserName: c.UserName, // need to fetch crab
+			Scope:    ScopeLike,
+			MoltID:   molt.ID,
 			Viewed:   false,
-			TTL:      fmt.Sprintf("%d", time.Now().Add(time.Hour*24*7).Unix()), // delete notifs in a week to keep table smaller
+			TTL:      Expiry(time.Now().Add(time.Hour * 24 * 7).Unix()), // delete notifs in a week to keep table smaller
 		})
 	if err != nil {
-		fmt.Println("Notification ERR: ", err)
-		panic(err)
+		return fmt.Errorf("MarshalMap: %w", err)
 	}
 	tItems := make([]types.TransactWriteItem, 0)
 	tw1 := types.TransactWriteItem{
@@ -114,46 +101,55 @@ func (m LikesModel) Insert(cid string, molt *Molt) error {
 	tItems = append(tItems, tw2)
 	tItems = append(tItems, tw3)
 
-	_, err = m.SVC.ItemTable.TransactWriteItems(context.TODO(), &dynamodb.TransactWriteItemsInput{
+	_, err = m.SVC.ItemTable.TransactWriteItems(ctx, &dynamodb.TransactWriteItemsInput{
 		TransactItems: tItems,
 	})
+	if err != nil {
+		return fmt.Errorf("TransactWriteItems: %w", conflict(err))
+	}
+	SearchModel{SVC: m.SVC}.rerankMolt(ctx, molt, 1, 0)
+	return nil
+}
 
+// Exists reports whether the crab has liked the molt
+func (m LikesModel) Exists(ctx context.Context, crabID, moltID string) (bool, error) {
+	data, err := m.SVC.ItemTable.GetItem(ctx, &dynamodb.GetItemInput{
+		TableName: aws.String(TableName),
+		Key: map[string]types.AttributeValue{
+			"PK": &types.AttributeValueMemberS{Value: fmt.Sprintf("L#%s", crabID)},
+			"SK": &types.AttributeValueMemberS{Value: fmt.Sprintf("L#%s", moltID)},
+		},
+	})
 	if err != nil {
-		fmt.Printf("\nErr: %v", err)
+		return false, fmt.Errorf("GetItem: %w", err)
 	}
-	return err
+	return data.Item != nil, nil
 }
 
-// Show a crab's likes by id
-func (m LikesModel) Show(id string) []Molt {
-	p := dynamodb.NewQueryPaginator(m.SVC.ItemTable, &dynamodb.QueryInput{
+// Show a page of the likes of the crab with id. The Hydrator's LikedMolts
+// loads the molts they are on.
+func (m LikesModel) Show(ctx context.Context, id, cursor string) ([]Like, string, error) {
+	items, next, err := queryPage(ctx, m.SVC.ItemTable, &dynamodb.QueryInput{
 		TableName:              aws.String(TableName),
-		Limit:                  aws.Int32(5),
+		Limit:                  aws.Int32(PageSize),
 		KeyConditionExpression: aws.String("PK = :hashKey"),
 		ExpressionAttributeValues: map[string]types.AttributeValue{
 			":hashKey": &types.AttributeValueMemberS{Value: "L#" + id},
 		},
-	})
-	molts := make([]Molt, 0)
-	for p.HasMorePages() {
-		out, err := p.NextPage(context.TODO())
-		if err != nil {
-			fmt.Printf("ERR: %s", err)
-			panic(err)
-		}
-		var molt []Molt
-		err = attributevalue.UnmarshalListOfMaps(out.Items, &molts)
-		if err != nil {
-			fmt.Printf("ERR: %s", err)
-			panic(err)
-		}
-		molts = append(molts, molt...)
-	}
-	return molts
+	}, cursor)
+	if err != nil {
+		return nil, "", err
+	}
+	likes := make([]Like, 0)
+	err = attributevalue.UnmarshalListOfMaps(items, &likes)
+	if err != nil {
+		return nil, "", err
+	}
+	return likes, next, nil
 }
 
 // Delete a like record based on current logged in crab
-func (m LikesModel) Delete(c *Crab, molt *Molt) error {
+func (m LikesModel) Delete(ctx context.Context, c *Crab, molt *Molt) error {
 	tItems := make([]types.TransactWriteItem, 0)
 	// delete it from the main table
 	tw1 := types.TransactWriteItem{
@@ -191,44 +187,47 @@ func (m LikesModel) Delete(c *Crab, molt *Molt) error {
 			},
 		},
 	}
+	// and take back telling the molt's crab about it
+	tw3 := types.TransactWriteItem{
+		Delete: &types.Delete{
+			Key: map[string]types.AttributeValue{
+				"PK": &types.AttributeValueMemberS{Value: fmt.Sprintf("N#%s", molt.PK[2:])},
+				"SK": &types.AttributeValueMemberS{Value: reactionSK(molt.PK[2:], ScopeLike, molt.ID, c.ID)},
+			},
+			TableName: aws.String(TableName),
+		},
+	}
 	tItems = append(tItems, tw1)
 	tItems = append(tItems, tw2)
-	_, err := m.SVC.ItemTable.TransactWriteItems(context.TODO(), &dynamodb.TransactWriteItemsInput{
+	tItems = append(tItems, tw3)
+	_, err := m.SVC.ItemTable.TransactWriteItems(ctx, &dynamodb.TransactWriteItemsInput{
 		TransactItems: tItems,
 	})
-
 	if err != nil {
-		fmt.Printf("\nErr: %v\n", err)
+		return fmt.Errorf("TransactWriteItems: %w", conflict(err))
 	}
-	return err
+	SearchModel{SVC: m.SVC}.rerankMolt(ctx, molt, -1, 0)
+	return nil
 }
 
-// GET - Crabs that have liked a specific molt
-func (m LikesModel) On(moltID string) ([]Like, error) {
-	p := dynamodb.NewQueryPaginator(m.SVC.ItemTable, &dynamodb.QueryInput{
+// GET - A page of crabs that have liked a specific molt
+func (m LikesModel) On(ctx context.Context, moltID, cursor string) ([]Like, string, error) {
+	items, next, err := queryPage(ctx, m.SVC.ItemTable, &dynamodb.QueryInput{
 		TableName:              aws.String(TableName),
 		IndexName:              aws.String("GSI7"),
-		Limit:                  aws.Int32(5),
+		Limit:                  aws.Int32(PageSize),
 		KeyConditionExpression: aws.String("GSI7PK = :gsi7pk"),
 		ExpressionAttributeValues: map[string]types.AttributeValue{
 			":gsi7pk": &types.AttributeValueMemberS{Value: fmt.Sprintf("L#%s", moltID)},
 		},
-	})
-	// update this for pagination
+	}, cursor)
+	if err != nil {
+		return nil, "", err
+	}
 	likes := make([]Like, 0)
-	for p.HasMorePages() {
-		out, err := p.NextPage(context.TODO())
-		if err != nil {
-			fmt.Printf("ERR: %s", err)
-			panic(err)
-		}
-		var like []Like
-		err = attributevalue.UnmarshalListOfMaps(out.Items, &like)
-		if err != nil {
-			fmt.Printf("ERR: %s", err)
-			panic(err)
-		}
-		likes = append(likes, like...)
-	}
-	return likes, nil
+	err = attributevalue.UnmarshalListOfMaps(items, &likes)
+	if err != nil {
+		return nil, "", err
+	}
+	return likes, next, nil
 }
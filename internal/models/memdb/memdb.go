@@ -0,0 +1,194 @@
+// Package memdb is an in-memory models.ItemStore. It keeps every table in a
+// map and evaluates key conditions, filters, condition expressions and
+// transactions with the expr package, so the web app runs against it the same
+// way it runs against DynamoDB. Nothing is persisted between restarts.
+package memdb
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+	"krabber.net/internal/models/expr"
+)
+
+type key struct {
+	pk, sk string
+}
+
+// Table holds the items of every table name it has been written to.
+type Table struct {
+	mu     sync.RWMutex
+	tables map[string]map[key]expr.Item
+}
+
+// New returns an empty in-memory store.
+func New() *Table {
+	return &Table{tables: map[string]map[key]expr.Item{}}
+}
+
+// get is the expr.Getter for the planners. Callers must hold the lock.
+func (t *Table) get(table, pk, sk string) (expr.Item, error) {
+	return t.tables[table][key{pk, sk}], nil
+}
+
+// apply persists planned writes. Callers must hold the write lock.
+func (t *Table) apply(writes ...expr.Write) {
+	for _, w := range writes {
+		items, ok := t.tables[w.Table]
+		if !ok {
+			items = map[key]expr.Item{}
+			t.tables[w.Table] = items
+		}
+		if w.New == nil {
+			delete(items, key{w.PK, w.SK})
+			continue
+		}
+		items[key{w.PK, w.SK}] = w.New
+	}
+}
+
+// Sweep deletes every item whose ttl has passed by now, as DynamoDB's time
+// to live does in the background, and returns how many it deleted.
+func (t *Table) Sweep(ctx context.Context, now time.Time) (int, error) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	n := 0
+	for _, items := range t.tables {
+		for k, item := range items {
+			if expiry, ok := expr.Expiry(item); ok && expiry <= now.Unix() {
+				delete(items, k)
+				n++
+			}
+		}
+	}
+	return n, nil
+}
+
+func (t *Table) GetItem(ctx context.Context, in *dynamodb.GetItemInput, _ ...func(*dynamodb.Options)) (*dynamodb.GetItemOutput, error) {
+	pk, sk, err := expr.Key(in.Key)
+	if err != nil {
+		return nil, err
+	}
+	t.mu.RLock()
+	defer t.mu.RUnlock()
+	item, err := expr.Project(t.tables[aws.ToString(in.TableName)][key{pk, sk}], in.ProjectionExpression, in.ExpressionAttributeNames)
+	if err != nil {
+		return nil, err
+	}
+	return &dynamodb.GetItemOutput{Item: item}, nil
+}
+
+// BatchGetItem reads every key asked for; nothing is ever left unprocessed.
+func (t *Table) BatchGetItem(ctx context.Context, in *dynamodb.BatchGetItemInput, _ ...func(*dynamodb.Options)) (*dynamodb.BatchGetItemOutput, error) {
+	t.mu.RLock()
+	defer t.mu.RUnlock()
+	out := &dynamodb.BatchGetItemOutput{Responses: map[string][]expr.Item{}}
+	for table, ka := range in.RequestItems {
+		items := make([]expr.Item, 0, len(ka.Keys))
+		for _, k := range ka.Keys {
+			pk, sk, err := expr.Key(k)
+			if err != nil {
+				return nil, err
+			}
+			item, ok := t.tables[table][key{pk, sk}]
+			if !ok {
+				continue
+			}
+			item, err = expr.Project(item, ka.ProjectionExpression, ka.ExpressionAttributeNames)
+			if err != nil {
+				return nil, err
+			}
+			items = append(items, item)
+		}
+		out.Responses[table] = items
+	}
+	return out, nil
+}
+
+func (t *Table) PutItem(ctx context.Context, in *dynamodb.PutItemInput, _ ...func(*dynamodb.Options)) (*dynamodb.PutItemOutput, error) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	w, err := expr.PlanPut(t.get, in)
+	if err != nil {
+		return nil, err
+	}
+	t.apply(w)
+	return &dynamodb.PutItemOutput{Attributes: expr.ReturnValues(w, in.ReturnValues)}, nil
+}
+
+func (t *Table) UpdateItem(ctx context.Context, in *dynamodb.UpdateItemInput, _ ...func(*dynamodb.Options)) (*dynamodb.UpdateItemOutput, error) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	w, err := expr.PlanUpdate(t.get, in)
+	if err != nil {
+		return nil, err
+	}
+	t.apply(w)
+	return &dynamodb.UpdateItemOutput{Attributes: expr.ReturnValues(w, in.ReturnValues)}, nil
+}
+
+func (t *Table) DeleteItem(ctx context.Context, in *dynamodb.DeleteItemInput, _ ...func(*dynamodb.Options)) (*dynamodb.DeleteItemOutput, error) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	w, err := expr.PlanDelete(t.get, in)
+	if err != nil {
+		return nil, err
+	}
+	t.apply(w)
+	return &dynamodb.DeleteItemOutput{Attributes: expr.ReturnValues(w, in.ReturnValues)}, nil
+}
+
+func (t *Table) TransactWriteItems(ctx context.Context, in *dynamodb.TransactWriteItemsInput, _ ...func(*dynamodb.Options)) (*dynamodb.TransactWriteItemsOutput, error) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	writes, err := expr.PlanTransaction(t.get, in)
+	if err != nil {
+		return nil, err
+	}
+	t.apply(writes...)
+	return &dynamodb.TransactWriteItemsOutput{}, nil
+}
+
+func (t *Table) BatchWriteItem(ctx context.Context, in *dynamodb.BatchWriteItemInput, _ ...func(*dynamodb.Options)) (*dynamodb.BatchWriteItemOutput, error) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	writes, err := expr.PlanBatch(t.get, in)
+	if err != nil {
+		return nil, err
+	}
+	t.apply(writes...)
+	return &dynamodb.BatchWriteItemOutput{}, nil
+}
+
+func (t *Table) Query(ctx context.Context, in *dynamodb.QueryInput, _ ...func(*dynamodb.Options)) (*dynamodb.QueryOutput, error) {
+	partition, err := expr.Partition(in)
+	if err != nil {
+		return nil, err
+	}
+	index := aws.ToString(in.IndexName)
+
+	t.mu.RLock()
+	defer t.mu.RUnlock()
+	var candidates []expr.Item
+	for _, item := range t.tables[aws.ToString(in.TableName)] {
+		pk, _, ok := expr.IndexKey(item, index)
+		if ok && pk == partition {
+			candidates = append(candidates, item)
+		}
+	}
+	return expr.QueryPage(candidates, in)
+}
+
+func (t *Table) Scan(ctx context.Context, in *dynamodb.ScanInput, _ ...func(*dynamodb.Options)) (*dynamodb.ScanOutput, error) {
+	t.mu.RLock()
+	defer t.mu.RUnlock()
+	items := t.tables[aws.ToString(in.TableName)]
+	candidates := make([]expr.Item, 0, len(items))
+	for _, item := range items {
+		candidates = append(candidates, item)
+	}
+	return expr.ScanPage(candidates, in)
+}
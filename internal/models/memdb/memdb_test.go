@@ -0,0 +1,13 @@
+package memdb
+
+import (
+	"testing"
+
+	"krabber.net/internal/models/storetest"
+)
+
+func TestConformance(t *testing.T) {
+	storetest.Run(t, func(t *testing.T) storetest.Store {
+		return New()
+	})
+}
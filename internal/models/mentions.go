@@ -0,0 +1,105 @@
+package models
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/feature/dynamodb/attributevalue"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+	"regexp"
+	"strings"
+	"time"
+)
+
+// maxMentions caps how many crabs one molt or comment can notify.
+const maxMentions = 10
+
+// MentionRX finds @mentions. The @ can't follow a letter or digit, so e-mail
+// addresses are left alone.
+var MentionRX = regexp.MustCompile(`(?:^|[^\p{L}\p{N}_])@([\p{L}\p{N}_]+)`)
+
+// Mentions returns the user names mentioned in content, lower cased, in the
+// order they first appear.
+func Mentions(content string) []string {
+	seen := map[string]bool{}
+	names := make([]string, 0)
+	for _, m := range MentionRX.FindAllStringSubmatch(content, -1) {
+		name := strings.ToLower(m[1])
+		if seen[name] {
+			continue
+		}
+		seen[name] = true
+		names = append(names, name)
+	}
+	return names
+}
+
+// resolveMentions looks up the crabs content mentions. Names that aren't
+// crabs, the author themselves and crabs on either side of a block with the
+// author are left out.
+func resolveMentions(ctx context.Context, svc ItemService, author *Crab, content string) ([]*Crab, error) {
+	crabs := make([]*Crab, 0)
+	for _, name := range Mentions(content) {
+		if len(crabs) == maxMentions {
+			break
+		}
+		if strings.EqualFold(name, author.UserName) {
+			continue
+		}
+		c, err := CrabModel{SVC: svc}.ByUserName(ctx, name)
+		if errors.Is(err, ErrNoRecord) {
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+		blocked, err := BlockModel{SVC: svc}.Between(ctx, author.ID, c.ID)
+		if err != nil {
+			return nil, err
+		}
+		if blocked {
+			continue
+		}
+		crabs = append(crabs, c)
+	}
+	return crabs, nil
+}
+
+// mentionPuts returns the notifications telling each mentioned crab that
+// author mentioned them in content, on or in the molt moltID.
+func mentionPuts(author *Crab, mentioned []*Crab, moltID, content string, now time.Time) ([]types.TransactWriteItem, error) {
+	puts := make([]types.TransactWriteItem, 0, len(mentioned))
+	for _, c := range mentioned {
+		notification, err := attributevalue.MarshalMap(
+			&Notification{
+				PK:       fmt.Sprintf("N#%s", c.ID),
+				SK:       fmt.Sprintf("N#%s#@#%s#%d", c.ID, moltID, now.UnixNano()), // a comment can mention someone the molt already did
+				UserName: author.UserName,
+				Content:  content,
+				Scope:    ScopeMention,
+				MoltID:   moltID,
+				Viewed:   false,
+				TTL:      Expiry(now.Add(time.Hour * 24 * 7).Unix()), // delete notifs in a week to keep table smaller
+			})
+		if err != nil {
+			return nil, fmt.Errorf("MarshalMap: %w", err)
+		}
+		puts = append(puts, types.TransactWriteItem{
+			Put: &types.Put{
+				Item:      notification,
+				TableName: aws.String(TableName),
+			},
+		})
+	}
+	return puts, nil
+}
+
+// userNames lists the user names of crabs.
+func userNames(crabs []*Crab) []string {
+	names := make([]string, 0, len(crabs))
+	for _, c := range crabs {
+		names = append(names, c.UserName)
+	}
+	return names
+}
@@ -13,25 +13,29 @@ var (
 // Create a Models struct which wraps the MovieModel. We'll add other models to this,
 // like a UserModel and PermissionModel, as our build progresses.
 type Models struct {
-	Molts    MoltModel
-	Crabs    CrabModel
-	Tokens   TokenModel
-	Follows  FollowModel
-	Comments CommentModel
-	Likes    LikesModel
-	Trench   TrenchModel
+	Molts   MoltModel
+	Crabs   CrabModel
+	Tokens  TokenModel
+	Follows FollowModel
+	Likes   LikesModel
+	Trench  TrenchModel
+	Search  SearchModel
+	Tags    TagModel
+	Blocks  BlockModel
 }
 
 // For ease of use, we also add a New() method which returns a Models struct containing
 // the initialized MovieModel.
 func NewModels(db ItemService) Models {
 	return Models{
-		Crabs:    CrabModel{SVC: db},
-		Molts:    MoltModel{SVC: db},
-		Tokens:   TokenModel{SVC: db},
-		Follows:  FollowModel{SVC: db},
-		Comments: CommentModel{SVC: db},
-		Likes:    LikesModel{SVC: db},
-		Trench:   TrenchModel{SVC: db},
+		Crabs:   CrabModel{SVC: db},
+		Molts:   MoltModel{SVC: db},
+		Tokens:  TokenModel{SVC: db},
+		Follows: FollowModel{SVC: db},
+		Likes:   LikesModel{SVC: db},
+		Trench:  TrenchModel{SVC: db},
+		Search:  SearchModel{SVC: db},
+		Tags:    TagModel{SVC: db},
+		Blocks:  BlockModel{SVC: db},
 	}
 }
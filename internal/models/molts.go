@@ -7,54 +7,146 @@ import (
 	"github.com/aws/aws-sdk-go-v2/feature/dynamodb/attributevalue"
 	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
 	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+	"github.com/segmentio/ksuid"
+	"krabber.net/internal/models/storage"
 	"krabber.net/internal/models/validator"
+	"strings"
 	"time"
 )
 
 type MoltModel struct {
 	SVC ItemService
+	// Blobs is where attached images are kept.
+	Blobs storage.Store
+	// Ranking orders each crab's sea, DefaultRanking if it is left zero.
+	Ranking Ranking
 }
 
 type Molt struct {
 	ID            string `dynamodbav:"id"`
 	CreatorAvatar string `dynamodbav:"creator_avatar"`
-	Comments      []Comment
 	Likes         []Like
 	PK            string `dynamodbav:"PK"`
 	SK            string `dynamodbav:"SK"`
-	GSI3PK        string `dynamodbav:"GSI3PK"`
-	GSI3SK        string `dynamodbav:"GSI3SK"`
+	GSI3PK        string `dynamodbav:"GSI3PK,omitempty"` // replies stay out of the sea
+	GSI3SK        string `dynamodbav:"GSI3SK,omitempty"`
+	GSI4PK        string `dynamodbav:"GSI4PK,omitempty"` // R#conversationID for replies, RO#originalID for remolts
+	GSI4SK        string `dynamodbav:"GSI4SK,omitempty"` // R#KSUID, or the remolt's SK
 	GSI5PK        string `dynamodbav:"GSI5PK"`
 	GSI5SK        string `dynamodbav:"GSI5SK"`
 	Author        string `dynamodbav:"author"`
-	CommentCount  int    `dynamodbav:"comment_count"`
+	CommentCount  int    `dynamodbav:"comment_count"` // replies under the molt, at any depth
 	Content       string `dynamodbav:"content"`
 	Deleted       bool   `dynamodbav:"deleted"`
 	LikeCount     int    `dynamodbav:"like_count"`
 	Remolt        bool   `dynamodbav:"remolt"`
 	RemoltCount   int    `dynamodbav:"remolt_count"`
-	Url           string `dynamodbav:"url"`
+	QuoteCount    int    `dynamodbav:"quote_count"`
+	// Fanned says the molt has been through fan-out: written into the
+	// trench of every crab that followed its crab when it was posted, or
+	// left for trenches to read in if its crab is a celebrity.
+	Fanned bool   `dynamodbav:"fanned"`
+	Url    string `dynamodbav:"url"`
+	// Mentions are the user names of the crabs mentioned in Content, as
+	// resolved when it was written.
+	Mentions []string `dynamodbav:"mentions,omitempty"`
+	// Attachments are the images posted with the molt. A remolt shares its
+	// original's.
+	Attachments []Attachment `dynamodbav:"attachments,omitempty"`
+	// Edited is when the content was last changed, empty if it never was.
+	Edited string `dynamodbav:"edited,omitempty"`
+	// ReMoltOf is the id of the molt a remolt copies.
+	ReMoltOf string `dynamodbav:"remolt_of,omitempty"`
+	// QuoteOf is the id of the molt a quote embeds, and Quoted that molt
+	// when the quote is being shown. Quoted stays nil if the original has
+	// been deleted.
+	QuoteOf string `dynamodbav:"quote_of,omitempty"`
+	Quoted  *Molt  `dynamodbav:"-"`
+	// InReplyTo is the id of the molt a reply answers and ConversationID the
+	// id of the molt at the top of its thread. Ancestors lists every molt
+	// above the reply, top first. All three are empty on a molt that isn't a
+	// reply.
+	InReplyTo      string   `dynamodbav:"in_reply_to,omitempty"`
+	ConversationID string   `dynamodbav:"conversation_id,omitempty"`
+	Ancestors      []string `dynamodbav:"ancestors,omitempty"`
+	// Replies are the replies under the molt, each with its own, when a
+	// thread is being shown. They are never stored.
+	Replies []Molt `dynamodbav:"-"`
+	// FirstReplyPK and FirstReplySK are the key of the first reply posted
+	// straight under the molt, and Preview that reply when a list of molts
+	// is being shown. Preview stays nil once the reply is deleted.
+	FirstReplyPK string `dynamodbav:"first_reply_pk,omitempty"`
+	FirstReplySK string `dynamodbav:"first_reply_sk,omitempty"`
+	Preview      *Molt  `dynamodbav:"-"`
+	// Liked and ReMolted say whether the crab looking at the molt has liked
+	// or remolted it. They are worked out per request and never stored.
+	Liked    bool `dynamodbav:"-"`
+	ReMolted bool `dynamodbav:"-"`
+	// Display is the author's display name, filled in with their current
+	// avatar when the molt is being shown.
+	Display string `dynamodbav:"-"`
 }
 
-// Insert a molt into the db
-func (m MoltModel) Insert(molt *Molt) error {
+// MoltEdit keeps what a molt said before one of its edits.
+type MoltEdit struct {
+	PK      string `dynamodbav:"PK"` // ME#moltID
+	SK      string `dynamodbav:"SK"` // ME#editedAt
+	Content string `dynamodbav:"content"`
+	Edited  string `dynamodbav:"edited"`
+}
+
+// Created is when the molt was posted, read from the KSUID its sort key
+// ends in.
+func (molt Molt) Created() (time.Time, error) {
+	k, err := ksuid.Parse(molt.SK[strings.LastIndex(molt.SK, "#")+1:])
+	if err != nil {
+		return time.Time{}, err
+	}
+	return k.Time(), nil
+}
+
+// Insert a molt into the db. An error means nothing was written, so the
+// caller can let go of anything it set up for the molt, like its images.
+func (m MoltModel) Insert(ctx context.Context, molt *Molt) error {
+	author, err := CrabModel{SVC: m.SVC}.ByID(ctx, molt.PK[2:])
+	if err != nil {
+		return err
+	}
+	mentioned, err := resolveMentions(ctx, m.SVC, author, molt.Content)
+	if err != nil {
+		return err
+	}
+	if len(mentioned) > 0 {
+		molt.Mentions = userNames(mentioned)
+	}
+	mentions, err := mentionPuts(author, mentioned, molt.ID, molt.Content, time.Now())
+	if err != nil {
+		return err
+	}
 	item, err := attributevalue.MarshalMap(
 		&Molt{
-			ID:            molt.ID,
-			PK:            molt.PK,
-			SK:            molt.SK,
-			CreatorAvatar: molt.CreatorAvatar,
-			GSI3PK:        molt.GSI3PK,
-			GSI3SK:        molt.GSI3SK,
-			GSI5PK:        molt.GSI5PK,
-			GSI5SK:        molt.GSI5SK,
-			Author:        molt.Author,
-			Content:       molt.Content,
-			Deleted:       molt.Deleted,
+			ID:             molt.ID,
+			PK:             molt.PK,
+			SK:             molt.SK,
+			CreatorAvatar:  molt.CreatorAvatar,
+			GSI3PK:         molt.GSI3PK,
+			GSI3SK:         molt.GSI3SK,
+			GSI4PK:         molt.GSI4PK,
+			GSI4SK:         molt.GSI4SK,
+			GSI5PK:         molt.GSI5PK,
+			GSI5SK:         molt.GSI5SK,
+			Author:         molt.Author,
+			Content:        molt.Content,
+			Deleted:        molt.Deleted,
+			Mentions:       molt.Mentions,
+			InReplyTo:      molt.InReplyTo,
+			ConversationID: molt.ConversationID,
+			Ancestors:      molt.Ancestors,
+			QuoteOf:        molt.QuoteOf,
+			Attachments:    molt.Attachments,
 		})
 	if err != nil {
-		fmt.Println("ERROR MARSHALLING: ", err)
-		panic(err)
+		return fmt.Errorf("MarshalMap: %w", err)
 	}
 	tItems := make([]types.TransactWriteItem, 0)
 	tw1 := types.TransactWriteItem{
@@ -64,23 +156,75 @@ func (m MoltModel) Insert(molt *Molt) error {
 			ConditionExpression: aws.String("attribute_not_exists(PK)"),
 		},
 	}
+	// increments how many molts the crab has
+	tw2 := types.TransactWriteItem{
+		Update: &types.Update{
+			Key: map[string]types.AttributeValue{
+				"PK": &types.AttributeValueMemberS{
+					Value: author.PK,
+				},
+				"SK": &types.AttributeValueMemberS{
+					Value: author.SK,
+				},
+			},
+			ConditionExpression: aws.String("attribute_exists(PK)"),
+			TableName:           aws.String(TableName),
+			UpdateExpression:    aws.String("set #molt_count = #molt_count + :value"),
+			ExpressionAttributeNames: map[string]string{
+				"#molt_count": "molt_count",
+			},
+			ExpressionAttributeValues: map[string]types.AttributeValue{
+				":value": &types.AttributeValueMemberN{Value: "1"},
+			},
+		},
+	}
 	tItems = append(tItems, tw1)
+	tItems = append(tItems, tw2)
+	// file it under its crabtags in the same transaction
+	tags, err := tagPuts(molt, Crabtags(molt.Content), time.Now())
+	if err != nil {
+		return err
+	}
+	tItems = append(tItems, tags...)
+	// and tell the crabs it mentions
+	tItems = append(tItems, mentions...)
+	if molt.InReplyTo != "" {
+		thread, err := m.replyItems(ctx, author, molt)
+		if err != nil {
+			return err
+		}
+		tItems = append(tItems, thread...)
+	}
+	if molt.QuoteOf != "" {
+		quote, err := m.quoteItems(ctx, author, molt)
+		if err != nil {
+			return err
+		}
+		tItems = append(tItems, quote...)
+	}
+	// replies only show in their thread, everything else goes to the
+	// followers' trenches in the background
+	if molt.InReplyTo == "" {
+		job, err := fanOutPut(molt, time.Now())
+		if err != nil {
+			return err
+		}
+		tItems = append(tItems, job)
+	}
 	// Worried about this part
-	_, err = m.SVC.ItemTable.TransactWriteItems(context.TODO(), &dynamodb.TransactWriteItemsInput{
+	_, err = m.SVC.ItemTable.TransactWriteItems(ctx, &dynamodb.TransactWriteItemsInput{
 		TransactItems: tItems,
 	})
-
 	if err != nil {
-		fmt.Printf("\nERROR INSERTING: %v", err)
+		return fmt.Errorf("TransactWriteItems: %w", conflict(err))
 	}
-	return err
+	SearchModel{SVC: m.SVC}.reindexMolt(ctx, molt)
+	return nil
 }
 
 // By ID for individual viewing
-func (m MoltModel) ByID(id string) (*Molt, error) {
-	molt := make([]Molt, 0)
-	fmt.Println("CALLING BY ID HERE HO, ID:", id)
-	ut, err := m.SVC.ItemTable.Query(context.TODO(), &dynamodb.QueryInput{
+func (m MoltModel) ByID(ctx context.Context, id string) (*Molt, error) {
+	ut, err := m.SVC.ItemTable.Query(ctx, &dynamodb.QueryInput{
 		TableName:              aws.String(TableName),
 		IndexName:              aws.String("GSI5"),
 		FilterExpression:       aws.String("deleted <> :deleted"),
@@ -91,157 +235,294 @@ func (m MoltModel) ByID(id string) (*Molt, error) {
 		},
 	})
 	if err != nil {
-		fmt.Printf("HERE BY ID ERROR: %v", err)
+		return nil, fmt.Errorf("Query: %w", err)
 	}
-	err = attributevalue.UnmarshalListOfMaps(ut.Items, &molt)
-	fmt.Printf("HERE %v", err)
-	if err != nil {
-		fmt.Errorf("UnmarshalMap: %v\n", err)
-		return nil, err
+	if len(ut.Items) == 0 {
+		return nil, ErrNoRecord
 	}
-	if len(molt) > 0 {
-		return &molt[0], nil
+	molt := &Molt{}
+	err = attributevalue.UnmarshalMap(ut.Items[0], molt)
+	if err != nil {
+		return nil, fmt.Errorf("UnmarshalMap: %w", err)
 	}
-	return nil, nil
+	return molt, nil
 }
 
 // Get a molt by Author and ID for updates
-func (m MoltModel) Get(author, id string) (*Molt, error) {
-	molt := Molt{}
-	selectedKeys := map[string]string{
-		"PK": fmt.Sprintf("M#%s", author),
-		"SK": fmt.Sprintf("M#%s#%s", author, id),
-	}
-
-	key, err := attributevalue.MarshalMap(selectedKeys)
-
-	data, err := m.SVC.ItemTable.GetItem(context.TODO(), &dynamodb.GetItemInput{
+func (m MoltModel) Get(ctx context.Context, author, id string) (*Molt, error) {
+	data, err := m.SVC.ItemTable.GetItem(ctx, &dynamodb.GetItemInput{
 		TableName: aws.String(TableName),
-		Key:       key,
+		Key: map[string]types.AttributeValue{
+			"PK": &types.AttributeValueMemberS{Value: fmt.Sprintf("M#%s", author)},
+			"SK": &types.AttributeValueMemberS{Value: fmt.Sprintf("M#%s#%s", author, id)},
+		},
 	})
 	if err != nil {
-		return &molt, fmt.Errorf("GetItem: %v\n", err)
+		return nil, fmt.Errorf("GetItem: %w", err)
 	}
-
 	if data.Item == nil {
-		return &molt, fmt.Errorf("GetItem: Data not found.\n")
+		return nil, ErrNoRecord
 	}
-	err = attributevalue.UnmarshalMap(data.Item, &molt)
+	molt := &Molt{}
+	err = attributevalue.UnmarshalMap(data.Item, molt)
 	if err != nil {
-		return &molt, fmt.Errorf("UnmarshalMap: %v\n", err)
+		return nil, fmt.Errorf("UnmarshalMap: %w", err)
 	}
-	// if molt exists show it
-	if !molt.Deleted {
-		return &molt, nil
+	// a deleted molt is only hidden, it reads as gone
+	if molt.Deleted {
+		return nil, ErrNoRecord
 	}
-	// if it is deleted then deletedError TODO: some point add this...
-	return nil, nil
+	return molt, nil
 }
 
 // Update a molt that the crab has molted
-func (m MoltModel) Update(molt *Molt) error {
-	_, err := m.SVC.ItemTable.UpdateItem(context.TODO(), &dynamodb.UpdateItemInput{
-		TableName: aws.String(TableName),
-		Key: map[string]types.AttributeValue{
-			"PK": &types.AttributeValueMemberS{Value: molt.PK},
-			"SK": &types.AttributeValueMemberS{Value: molt.SK},
+// Update replaces the content of molt, keeping what it said before as an
+// edit in its history. Its crabtags and mentions follow the new content:
+// it is filed under the tags it gained and taken out from under those it
+// lost, and crabs it newly mentions are told. It fails with ErrConflict if
+// the molt has been deleted or changed since it was read.
+func (m MoltModel) Update(ctx context.Context, molt *Molt, content string) error {
+	author, err := CrabModel{SVC: m.SVC}.ByID(ctx, molt.PK[2:])
+	if err != nil {
+		return err
+	}
+	mentioned, err := resolveMentions(ctx, m.SVC, author, content)
+	if err != nil {
+		return err
+	}
+	told := map[string]bool{}
+	for _, name := range molt.Mentions {
+		told[strings.ToLower(name)] = true
+	}
+	newly := make([]*Crab, 0)
+	for _, c := range mentioned {
+		if !told[strings.ToLower(c.UserName)] {
+			newly = append(newly, c)
+		}
+	}
+	mentions, err := mentionPuts(author, newly, molt.ID, content, time.Now())
+	if err != nil {
+		return err
+	}
+	names, err := attributevalue.Marshal(userNames(mentioned))
+	if err != nil {
+		return fmt.Errorf("Marshal: %w", err)
+	}
+	// only the tags that changed are touched
+	oldTags, newTags := Crabtags(molt.Content), Crabtags(content)
+	tags, err := tagPuts(molt, tagsMissing(newTags, oldTags), moltTime(*molt))
+	if err != nil {
+		return err
+	}
+	untags, err := tagDeletes(ctx, m.SVC, molt, tagsMissing(oldTags, newTags))
+	if err != nil {
+		return err
+	}
+
+	now := time.Now().UTC().Format(time.RFC3339Nano)
+	edit, err := attributevalue.MarshalMap(
+		&MoltEdit{
+			PK:      fmt.Sprintf("ME#%s", molt.ID),
+			SK:      fmt.Sprintf("ME#%s", now),
+			Content: molt.Content,
+			Edited:  now,
+		})
+	if err != nil {
+		return fmt.Errorf("MarshalMap: %w", err)
+	}
+	tItems := make([]types.TransactWriteItem, 0)
+	tw1 := types.TransactWriteItem{
+		Update: &types.Update{
+			Key: map[string]types.AttributeValue{
+				"PK": &types.AttributeValueMemberS{Value: molt.PK},
+				"SK": &types.AttributeValueMemberS{Value: molt.SK},
+			},
+			TableName:           aws.String(TableName),
+			ConditionExpression: aws.String("content = :old AND deleted <> :deleted"),
+			UpdateExpression:    aws.String("set content = :content, edited = :edited, mentions = :mentions"),
+			ExpressionAttributeValues: map[string]types.AttributeValue{
+				":old":      &types.AttributeValueMemberS{Value: molt.Content},
+				":content":  &types.AttributeValueMemberS{Value: content},
+				":edited":   &types.AttributeValueMemberS{Value: now},
+				":deleted":  &types.AttributeValueMemberBOOL{Value: true},
+				":mentions": names,
+			},
 		},
-		UpdateExpression: aws.String(fmt.Sprintf("set %s = :%s", "content", "content")),
-		ExpressionAttributeValues: map[string]types.AttributeValue{
-			fmt.Sprintf(":%s", "content"): &types.AttributeValueMemberS{Value: molt.Content},
+	}
+	tw2 := types.TransactWriteItem{
+		Put: &types.Put{
+			Item:                edit,
+			TableName:           aws.String(TableName),
+			ConditionExpression: aws.String("attribute_not_exists(PK)"),
 		},
-	})
+	}
+	tItems = append(tItems, tw1)
+	tItems = append(tItems, tw2)
+	tItems = append(tItems, tags...)
+	tItems = append(tItems, untags...)
+	tItems = append(tItems, mentions...)
 
+	_, err = m.SVC.ItemTable.TransactWriteItems(ctx, &dynamodb.TransactWriteItemsInput{
+		TransactItems: tItems,
+	})
 	if err != nil {
-		panic(err)
+		return fmt.Errorf("TransactWriteItems: %w", conflict(err))
 	}
-
+	molt.Content = content
+	molt.Edited = now
+	molt.Mentions = userNames(mentioned)
+	SearchModel{SVC: m.SVC}.reindexMolt(ctx, molt)
 	return nil
 }
 
-// Show a crab's molts if not
-func (m MoltModel) Show(id string) ([]Molt, error) {
-	p := dynamodb.NewQueryPaginator(m.SVC.ItemTable, &dynamodb.QueryInput{
+// History returns a page of what a molt said before each of its edits,
+// newest first.
+func (m MoltModel) History(ctx context.Context, id, cursor string) ([]MoltEdit, string, error) {
+	items, next, err := queryPage(ctx, m.SVC.ItemTable, &dynamodb.QueryInput{
 		TableName:              aws.String(TableName),
 		Limit:                  aws.Int32(PageSize),
 		KeyConditionExpression: aws.String("PK = :hashKey"),
-		FilterExpression:       aws.String("deleted <> :deleted"),
 		ExpressionAttributeValues: map[string]types.AttributeValue{
-			":hashKey": &types.AttributeValueMemberS{Value: "M#" + id},
-			":deleted": &types.AttributeValueMemberBOOL{Value: true},
+			":hashKey": &types.AttributeValueMemberS{Value: "ME#" + id},
 		},
 		ScanIndexForward: aws.Bool(false),
-	})
-	molts := make([]Molt, 0)
-	for p.HasMorePages() {
-		out, err := p.NextPage(context.TODO())
-		if err != nil {
-			fmt.Printf("ERR: %s", err)
-			panic(err)
-		}
-		var molt []Molt
-		err = attributevalue.UnmarshalListOfMaps(out.Items, &molt)
-		if err != nil {
-			fmt.Printf("ERR: %s", err)
-			panic(err)
-		}
-		molts = append(molts, molt...)
+	}, cursor)
+	if err != nil {
+		return nil, "", err
 	}
-	return molts, nil
-}
-
-// Delete a molt that a crab has molted
-func (m MoltModel) Delete(molt *Molt) error {
-	_, err := m.SVC.ItemTable.UpdateItem(context.TODO(), &dynamodb.UpdateItemInput{
-		TableName: aws.String(TableName),
-		Key: map[string]types.AttributeValue{
-			"PK": &types.AttributeValueMemberS{Value: molt.PK},
-			"SK": &types.AttributeValueMemberS{Value: molt.SK},
-		},
-		UpdateExpression: aws.String(fmt.Sprintf("set %s = :%s", "deleted", "deleted")),
-		ExpressionAttributeValues: map[string]types.AttributeValue{
-			fmt.Sprintf(":%s", "deleted"): &types.AttributeValueMemberBOOL{Value: molt.Deleted},
-		},
-	})
-
+	edits := make([]MoltEdit, 0)
+	err = attributevalue.UnmarshalListOfMaps(items, &edits)
 	if err != nil {
-		panic(err)
+		return nil, "", err
 	}
-
-	return nil
+	return edits, next, nil
 }
 
-// Latest - returns all the molts from past day
-func (m MoltModel) latest() []Molt {
-	now := time.Now()
-	y, mnth, d := now.Date()
-	p := dynamodb.NewQueryPaginator(m.SVC.ItemTable, &dynamodb.QueryInput{
+// Show a page of a crab's molts, newest first, and the cursor of the next
+// page. Replies are shown by ShowReplies instead.
+func (m MoltModel) Show(ctx context.Context, id, cursor string) ([]Molt, string, error) {
+	items, next, err := queryPage(ctx, m.SVC.ItemTable, &dynamodb.QueryInput{
 		TableName:              aws.String(TableName),
 		Limit:                  aws.Int32(PageSize),
-		IndexName:              aws.String("GSI3"),
-		KeyConditionExpression: aws.String("GSI3PK = :hashKey"),
+		KeyConditionExpression: aws.String("PK = :hashKey"),
+		FilterExpression:       aws.String("deleted <> :deleted AND attribute_not_exists(in_reply_to)"),
 		ExpressionAttributeValues: map[string]types.AttributeValue{
-			":hashKey": &types.AttributeValueMemberS{Value: "M#" + fmt.Sprintf("%d-%d-%d", y, int(mnth), d)},
+			":hashKey": &types.AttributeValueMemberS{Value: "M#" + id},
+			":deleted": &types.AttributeValueMemberBOOL{Value: true},
 		},
 		ScanIndexForward: aws.Bool(false),
-	})
-	var items []Molt
-	for p.HasMorePages() {
-		out, err := p.NextPage(context.TODO())
+	}, cursor)
+	if err != nil {
+		return nil, "", err
+	}
+	molts := make([]Molt, 0)
+	err = attributevalue.UnmarshalListOfMaps(items, &molts)
+	if err != nil {
+		return nil, "", err
+	}
+	return molts, next, nil
+}
+
+// Delete a molt that a crab has molted
+// Delete marks molt as deleted and takes it off its crab's molt count and
+// out of search, and queues taking it out of the trenches and deleting its
+// remolts. The crab is the one whose molt list it is in, which for a
+// remolt isn't the author.
+func (m MoltModel) Delete(ctx context.Context, molt *Molt) error {
+	owner, err := CrabModel{SVC: m.SVC}.ByID(ctx, molt.PK[2:])
+	if err != nil {
+		return err
+	}
+	tItems := make([]types.TransactWriteItem, 0)
+	tw1 := types.TransactWriteItem{
+		Update: &types.Update{
+			Key: map[string]types.AttributeValue{
+				"PK": &types.AttributeValueMemberS{Value: molt.PK},
+				"SK": &types.AttributeValueMemberS{Value: molt.SK},
+			},
+			TableName:           aws.String(TableName),
+			ConditionExpression: aws.String("attribute_exists(PK) AND deleted <> :deleted"),
+			UpdateExpression:    aws.String("set deleted = :deleted"),
+			ExpressionAttributeValues: map[string]types.AttributeValue{
+				":deleted": &types.AttributeValueMemberBOOL{Value: true},
+			},
+		},
+	}
+	tItems = append(tItems, tw1)
+	// molts from before molt_count was kept have nothing to take off
+	if owner.MoltCount > 0 {
+		tw2 := types.TransactWriteItem{
+			Update: &types.Update{
+				Key: map[string]types.AttributeValue{
+					"PK": &types.AttributeValueMemberS{
+						Value: owner.PK,
+					},
+					"SK": &types.AttributeValueMemberS{
+						Value: owner.SK,
+					},
+				},
+				TableName:        aws.String(TableName),
+				UpdateExpression: aws.String("set #molt_count = #molt_count - :value"),
+				ExpressionAttributeNames: map[string]string{
+					"#molt_count": "molt_count",
+				},
+				ExpressionAttributeValues: map[string]types.AttributeValue{
+					":value": &types.AttributeValueMemberN{Value: "1"},
+				},
+			},
+		}
+		tItems = append(tItems, tw2)
+	}
+	if molt.InReplyTo != "" {
+		counts, err := m.threadCountItems(ctx, molt, "-")
+		if err != nil {
+			return err
+		}
+		tItems = append(tItems, counts...)
+	}
+	// a remolt of a quote carries QuoteOf too, but only the quote counts
+	if molt.QuoteOf != "" && !molt.Remolt {
+		unquote, err := m.unQuoteItems(ctx, molt.QuoteOf)
+		if err != nil {
+			return err
+		}
+		tItems = append(tItems, unquote...)
+	}
+	// anything but a remolt comes back out of the trenches, if it went in,
+	// and its remolts go with it
+	if !molt.Remolt {
+		job, err := retractPut(molt, time.Now())
 		if err != nil {
-			fmt.Printf("ERR: %s", err)
-			panic(err)
+			return err
 		}
-		var pItems []Molt
-		err = attributevalue.UnmarshalListOfMaps(out.Items, &pItems)
+		tItems = append(tItems, job)
+	}
+	var original *Molt
+	if molt.ReMoltOf != "" {
+		var undo []types.TransactWriteItem
+		undo, original, err = m.unReMoltItems(ctx, owner.ID, molt.ReMoltOf)
 		if err != nil {
-			fmt.Printf("ERR: %s", err)
-			panic(err)
+			return err
 		}
-		items = append(items, pItems...)
+		tItems = append(tItems, undo...)
+	}
 
+	_, err = m.SVC.ItemTable.TransactWriteItems(ctx, &dynamodb.TransactWriteItemsInput{
+		TransactItems: tItems,
+	})
+	if err != nil {
+		return fmt.Errorf("TransactWriteItems: %w", conflict(err))
+	}
+	molt.Deleted = true
+	SearchModel{SVC: m.SVC}.reindexMolt(ctx, molt)
+	if original != nil && original.RemoltCount > 0 {
+		SearchModel{SVC: m.SVC}.rerankMolt(ctx, original, 0, -1)
+	}
+	// the images go with the original; remolts only point at them
+	if molt.Remolt || len(molt.Attachments) == 0 {
+		return nil
 	}
-	return items
+	return m.Detach(ctx, molt.Attachments)
 }
 
 func ValidateMolt(v *validator.Validator, molt *Molt) {
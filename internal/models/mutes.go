@@ -0,0 +1,102 @@
+package models
+
+import (
+	"context"
+	"fmt"
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/feature/dynamodb/attributevalue"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+)
+
+type MuteModel struct {
+	SVC ItemService
+}
+
+// Mute records that one crab would rather see less of another. Unlike a
+// block it is never shown to the muted crab and only sinks their molts in
+// the muter's sea.
+type Mute struct {
+	PK     string `dynamodbav:"PK"` // MU#muterID
+	SK     string `dynamodbav:"SK"` // MU#mutedID
+	CrabID string `dynamodbav:"crab_id"`
+}
+
+func muteKey(muterID, mutedID string) map[string]types.AttributeValue {
+	return map[string]types.AttributeValue{
+		"PK": &types.AttributeValueMemberS{Value: fmt.Sprintf("MU#%s", muterID)},
+		"SK": &types.AttributeValueMemberS{Value: fmt.Sprintf("MU#%s", mutedID)},
+	}
+}
+
+func (m MuteModel) Insert(ctx context.Context, muterID, mutedID string) error {
+	item, err := attributevalue.MarshalMap(
+		&Mute{
+			PK:     fmt.Sprintf("MU#%s", muterID),
+			SK:     fmt.Sprintf("MU#%s", mutedID),
+			CrabID: mutedID,
+		})
+	if err != nil {
+		return fmt.Errorf("MarshalMap: %w", err)
+	}
+	_, err = m.SVC.ItemTable.PutItem(ctx, &dynamodb.PutItemInput{
+		TableName:           aws.String(TableName),
+		Item:                item,
+		ConditionExpression: aws.String("attribute_not_exists(PK)"),
+	})
+	if err != nil {
+		return fmt.Errorf("PutItem: %w", conflict(err))
+	}
+	return nil
+}
+
+func (m MuteModel) Delete(ctx context.Context, muterID, mutedID string) error {
+	_, err := m.SVC.ItemTable.DeleteItem(ctx, &dynamodb.DeleteItemInput{
+		TableName:           aws.String(TableName),
+		Key:                 muteKey(muterID, mutedID),
+		ConditionExpression: aws.String("attribute_exists(PK)"),
+	})
+	if err != nil {
+		return fmt.Errorf("DeleteItem: %w", conflict(err))
+	}
+	return nil
+}
+
+// Exists reports whether muter has muted muted
+func (m MuteModel) Exists(ctx context.Context, muterID, mutedID string) (bool, error) {
+	data, err := m.SVC.ItemTable.GetItem(ctx, &dynamodb.GetItemInput{
+		TableName: aws.String(TableName),
+		Key:       muteKey(muterID, mutedID),
+	})
+	if err != nil {
+		return false, fmt.Errorf("GetItem: %w", err)
+	}
+	return data.Item != nil, nil
+}
+
+// Muted returns the ids of every crab crabID has muted.
+func (m MuteModel) Muted(ctx context.Context, crabID string) (map[string]bool, error) {
+	p := dynamodb.NewQueryPaginator(m.SVC.ItemTable, &dynamodb.QueryInput{
+		TableName:              aws.String(TableName),
+		KeyConditionExpression: aws.String("PK = :pk"),
+		ExpressionAttributeValues: map[string]types.AttributeValue{
+			":pk": &types.AttributeValueMemberS{Value: "MU#" + crabID},
+		},
+	})
+	muted := make(map[string]bool)
+	for p.HasMorePages() {
+		out, err := p.NextPage(ctx)
+		if err != nil {
+			return nil, fmt.Errorf("Query: %w", err)
+		}
+		mutes := make([]Mute, 0, len(out.Items))
+		err = attributevalue.UnmarshalListOfMaps(out.Items, &mutes)
+		if err != nil {
+			return nil, fmt.Errorf("UnmarshalListOfMaps: %w", err)
+		}
+		for _, mute := range mutes {
+			muted[mute.CrabID] = true
+		}
+	}
+	return muted, nil
+}
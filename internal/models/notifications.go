@@ -7,6 +7,7 @@ import (
 	"github.com/aws/aws-sdk-go-v2/feature/dynamodb/attributevalue"
 	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
 	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+	"strconv"
 )
 
 const (
@@ -15,25 +16,66 @@ const (
 	ScopeComment  = "C"
 	ScopeMention  = "M"
 	ScopeFollower = "F"
+	ScopeQuote    = "Q"
 )
 
 type NotificationModel struct {
 	SVC ItemService
 }
 
+// reactionSK is the sort key of the notification telling ownerID that
+// actorID liked or remolted (scope) their molt moltID. There is one per
+// crab and molt, so undoing the like or remolt can take it back.
+func reactionSK(ownerID, scope, moltID, actorID string) string {
+	return fmt.Sprintf("N#%s#%s#%s#%s", ownerID, scope, moltID, actorID)
+}
+
+// followSK is the sort key of the notification telling followeeID that
+// followerID followed them, laid out like reactionSK. There is one per pair,
+// so following again after an unfollow just refreshes it.
+func followSK(followeeID, followerID string) string {
+	return fmt.Sprintf("N#%s#%s#%s", followeeID, ScopeFollower, followerID)
+}
+
+// Expiry is a ttl attribute: when the item expires, in unix seconds. It is
+// written as a Number, which is all the table's TTL reads. Items from
+// before then hold a String, which is still read.
+type Expiry int64
+
+func (e *Expiry) UnmarshalDynamoDBAttributeValue(av types.AttributeValue) error {
+	var s string
+	switch v := av.(type) {
+	case *types.AttributeValueMemberN:
+		s = v.Value
+	case *types.AttributeValueMemberS:
+		s = v.Value
+	case *types.AttributeValueMemberNULL:
+		return nil
+	default:
+		return fmt.Errorf("ttl: unexpected %T", av)
+	}
+	n, err := strconv.ParseInt(s, 10, 64)
+	if err != nil {
+		return fmt.Errorf("ttl: %w", err)
+	}
+	*e = Expiry(n)
+	return nil
+}
+
 type Notification struct {
 	PK       string `dynamodbav:"PK"`
 	SK       string `dynamodbav:"SK"`
 	UserName string `dynamodbav:"user_name"`
 	Content  string `dynamodbav:"content"`
 	Scope    string `dynamodbav:"scope"`
-	TTL      string `dynamodbav:"ttl"` // make them expire after 1 week so that the dynamodb table stays slim...
+	MoltID   string `dynamodbav:"molt_id,omitempty"`
+	TTL      Expiry `dynamodbav:"ttl"` // make them expire after 1 week so that the dynamodb table stays slim...
 	Viewed   bool   `dynamodbav:"viewed"`
 }
 
-// show all the notifications for the logged in crab
-func (m NotificationModel) Show(crabID string) ([]Notification, error) {
-	p := dynamodb.NewQueryPaginator(m.SVC.ItemTable, &dynamodb.QueryInput{
+// show a page of the unread notifications for the logged in crab
+func (m NotificationModel) Show(ctx context.Context, crabID, cursor string) ([]Notification, string, error) {
+	items, next, err := queryPage(ctx, m.SVC.ItemTable, &dynamodb.QueryInput{
 		TableName:              aws.String(TableName),
 		Limit:                  aws.Int32(PageSize),
 		KeyConditionExpression: aws.String("PK = :hashKey"),
@@ -43,29 +85,22 @@ func (m NotificationModel) Show(crabID string) ([]Notification, error) {
 			":viewed":  &types.AttributeValueMemberBOOL{Value: true},
 		},
 		ScanIndexForward: aws.Bool(false),
-	})
-	molts := make([]Notification, 0)
-	for p.HasMorePages() {
-		out, err := p.NextPage(context.TODO())
-		if err != nil {
-			fmt.Printf("ERR: %s", err)
-			panic(err)
-		}
-		var molt []Notification
-		err = attributevalue.UnmarshalListOfMaps(out.Items, &molt)
-		if err != nil {
-			fmt.Printf("ERR: %s", err)
-			panic(err)
-		}
-		molts = append(molts, molt...)
+	}, cursor)
+	if err != nil {
+		return nil, "", err
 	}
-	return molts, nil
+	notifications := make([]Notification, 0)
+	err = attributevalue.UnmarshalListOfMaps(items, &notifications)
+	if err != nil {
+		return nil, "", err
+	}
+	return notifications, next, nil
 }
 
 // mark as seen
-func (m NotificationModel) MarkAsViewed(n []Notification) error {
+func (m NotificationModel) MarkAsViewed(ctx context.Context, n []Notification) error {
 	for _, notification := range n {
-		_, err := m.SVC.ItemTable.UpdateItem(context.TODO(), &dynamodb.UpdateItemInput{
+		_, err := m.SVC.ItemTable.UpdateItem(ctx, &dynamodb.UpdateItemInput{
 			TableName: aws.String(TableName),
 			Key: map[string]types.AttributeValue{
 				"PK": &types.AttributeValueMemberS{Value: notification.PK},
@@ -78,9 +113,8 @@ func (m NotificationModel) MarkAsViewed(n []Notification) error {
 		})
 
 		if err != nil {
-			panic(err)
+			return fmt.Errorf("UpdateItem: %w", err)
 		}
-
 	}
 
 	return nil
@@ -0,0 +1,78 @@
+package models
+
+import (
+	"context"
+	"testing"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/feature/dynamodb/attributevalue"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+	"krabber.net/internal/models/memdb"
+)
+
+// TestFollowNotification follows, unfollows and follows again, checking the
+// notification comes and goes with the follow and expires through the
+// table's TTL.
+func TestFollowNotification(t *testing.T) {
+	ctx := context.Background()
+	svc := ItemService{ItemTable: memdb.New()}
+	crabs := CrabModel{SVC: svc}
+	follower, err := crabs.Insert(ctx, &Crab{Email: "follower@example.com", UserName: "follower"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	followee, err := crabs.Insert(ctx, &Crab{Email: "followee@example.com", UserName: "followee"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	notification := func() map[string]types.AttributeValue {
+		t.Helper()
+		out, err := svc.ItemTable.GetItem(ctx, &dynamodb.GetItemInput{
+			TableName: aws.String(TableName),
+			Key: map[string]types.AttributeValue{
+				"PK": &types.AttributeValueMemberS{Value: "N#" + followee.ID},
+				"SK": &types.AttributeValueMemberS{Value: followSK(followee.ID, follower.ID)},
+			},
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+		return out.Item
+	}
+	follows := FollowModel{SVC: svc}
+	for i := 0; i < 2; i++ {
+		if err := follows.Insert(ctx, follower, followee); err != nil {
+			t.Fatalf("follow %d: %v", i+1, err)
+		}
+		item := notification()
+		if item == nil {
+			t.Fatalf("follow %d: no notification", i+1)
+		}
+		if _, ok := item["ttl"].(*types.AttributeValueMemberN); !ok {
+			t.Errorf("follow %d: ttl is %T, want a Number", i+1, item["ttl"])
+		}
+		if err := follows.Delete(ctx, follower, followee); err != nil {
+			t.Fatalf("unfollow %d: %v", i+1, err)
+		}
+		if notification() != nil {
+			t.Errorf("unfollow %d: notification left behind", i+1)
+		}
+	}
+}
+
+func TestExpiry(t *testing.T) {
+	for _, av := range []types.AttributeValue{
+		&types.AttributeValueMemberN{Value: "1700000000"},
+		&types.AttributeValueMemberS{Value: "1700000000"}, // written before ttl was a Number
+	} {
+		var n Notification
+		err := attributevalue.UnmarshalMap(map[string]types.AttributeValue{"ttl": av}, &n)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if n.TTL != 1700000000 {
+			t.Errorf("%T: got %d", av, n.TTL)
+		}
+	}
+}
@@ -0,0 +1,103 @@
+package models
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/feature/dynamodb/attributevalue"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+	"time"
+)
+
+// Quote posts quote as a quote of original: a molt of the quoting crab's
+// own, shown with original embedded under its text.
+func (m MoltModel) Quote(ctx context.Context, original, quote *Molt) error {
+	quote.QuoteOf = original.ID
+	return m.Insert(ctx, quote)
+}
+
+// quoteItems returns what posting quote has to do besides putting it: count
+// it on the original and tell the original's crab.
+func (m MoltModel) quoteItems(ctx context.Context, author *Crab, quote *Molt) ([]types.TransactWriteItem, error) {
+	original, err := m.ByID(ctx, quote.QuoteOf)
+	if err != nil {
+		return nil, err
+	}
+	tItems := []types.TransactWriteItem{{
+		Update: &types.Update{
+			Key: map[string]types.AttributeValue{
+				"PK": &types.AttributeValueMemberS{Value: original.PK},
+				"SK": &types.AttributeValueMemberS{Value: original.SK},
+			},
+			ConditionExpression: aws.String("attribute_exists(PK)"),
+			TableName:           aws.String(TableName),
+			// molts from before quotes have no count to add to
+			UpdateExpression: aws.String("set #quote_count = if_not_exists(#quote_count, :zero) + :value"),
+			ExpressionAttributeNames: map[string]string{
+				"#quote_count": "quote_count",
+			},
+			ExpressionAttributeValues: map[string]types.AttributeValue{
+				":zero":  &types.AttributeValueMemberN{Value: "0"},
+				":value": &types.AttributeValueMemberN{Value: "1"},
+			},
+		},
+	}}
+	ownerID := original.PK[2:]
+	if ownerID == author.ID {
+		return tItems, nil
+	}
+	notification, err := attributevalue.MarshalMap(
+		&Notification{
+			PK:       fmt.Sprintf("N#%s", ownerID),
+			SK:       fmt.Sprintf("N#%s#%s#%s", ownerID, ScopeQuote, quote.ID),
+			UserName: author.UserName,
+			Content:  quote.Content,
+			Scope:    ScopeQuote,
+			MoltID:   quote.ID,
+			Viewed:   false,
+			TTL:      Expiry(time.Now().Add(time.Hour * 24 * 7).Unix()), // delete notifs in a week to keep table smaller
+		})
+	if err != nil {
+		return nil, fmt.Errorf("MarshalMap: %w", err)
+	}
+	tItems = append(tItems, types.TransactWriteItem{
+		Put: &types.Put{
+			Item:      notification,
+			TableName: aws.String(TableName),
+		},
+	})
+	return tItems, nil
+}
+
+// unQuoteItems returns the update taking a deleted quote off the count of
+// the molt it quoted, if that molt is still there.
+func (m MoltModel) unQuoteItems(ctx context.Context, originalID string) ([]types.TransactWriteItem, error) {
+	original, err := m.ByID(ctx, originalID)
+	if errors.Is(err, ErrNoRecord) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	if original.QuoteCount <= 0 {
+		return nil, nil
+	}
+	return []types.TransactWriteItem{{
+		Update: &types.Update{
+			Key: map[string]types.AttributeValue{
+				"PK": &types.AttributeValueMemberS{Value: original.PK},
+				"SK": &types.AttributeValueMemberS{Value: original.SK},
+			},
+			ConditionExpression: aws.String("attribute_exists(PK)"),
+			TableName:           aws.String(TableName),
+			UpdateExpression:    aws.String("set #quote_count = #quote_count - :value"),
+			ExpressionAttributeNames: map[string]string{
+				"#quote_count": "quote_count",
+			},
+			ExpressionAttributeValues: map[string]types.AttributeValue{
+				":value": &types.AttributeValueMemberN{Value: "1"},
+			},
+		},
+	}}, nil
+}
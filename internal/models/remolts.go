@@ -2,6 +2,7 @@ package models
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"github.com/aws/aws-sdk-go-v2/aws"
 	"github.com/aws/aws-sdk-go-v2/feature/dynamodb/attributevalue"
@@ -10,9 +11,17 @@ import (
 	"time"
 )
 
-// show a crab's remolts
-func (m MoltModel) ShowReMolts(id string) ([]Molt, error) {
-	p := dynamodb.NewQueryPaginator(m.SVC.ItemTable, &dynamodb.QueryInput{
+// ReMoltMark records that a crab remolted a molt, and which molt the remolt
+// is, so it can be undone.
+type ReMoltMark struct {
+	PK       string `dynamodbav:"PK"` // RM#crabID
+	SK       string `dynamodbav:"SK"` // RM#moltID
+	ReMoltID string `dynamodbav:"remolt_id"`
+}
+
+// show a page of a crab's remolts
+func (m MoltModel) ShowReMolts(ctx context.Context, id, cursor string) ([]Molt, string, error) {
+	items, next, err := queryPage(ctx, m.SVC.ItemTable, &dynamodb.QueryInput{
 		TableName:              aws.String(TableName),
 		Limit:                  aws.Int32(PageSize),
 		KeyConditionExpression: aws.String("PK = :hashKey"),
@@ -22,59 +31,67 @@ func (m MoltModel) ShowReMolts(id string) ([]Molt, error) {
 			":remolt":  &types.AttributeValueMemberBOOL{Value: false},
 		},
 		ScanIndexForward: aws.Bool(false),
-	})
+	}, cursor)
+	if err != nil {
+		return nil, "", err
+	}
 	molts := make([]Molt, 0)
-	for p.HasMorePages() {
-		out, err := p.NextPage(context.TODO())
-		if err != nil {
-			fmt.Printf("ERR: %s", err)
-			panic(err)
-		}
-		var molt []Molt
-		err = attributevalue.UnmarshalListOfMaps(out.Items, &molt)
-		if err != nil {
-			fmt.Printf("ERR: %s", err)
-			panic(err)
-		}
-		molts = append(molts, molt...)
+	err = attributevalue.UnmarshalListOfMaps(items, &molts)
+	if err != nil {
+		return nil, "", err
 	}
-	return molts, nil
+	return molts, next, nil
 }
 
-// This crab remolts another molt
-func (m MoltModel) ReMolt(c *Crab, other, molt *Molt) error {
+// This crab remolts another molt. The remolt is filed under the original on
+// GSI4 so it can be deleted along with it.
+func (m MoltModel) ReMolt(ctx context.Context, c *Crab, other, molt *Molt) error {
 	newMolt := &Molt{
-		ID:      molt.ID,
-		PK:      molt.PK,
-		SK:      molt.SK,
-		GSI3PK:  molt.GSI3PK,
-		GSI3SK:  molt.GSI3SK,
-		GSI5PK:  molt.GSI5PK,
-		GSI5SK:  molt.GSI5SK,
-		Author:  molt.Author,
-		Content: molt.Content,
-		Remolt:  true,
-		Deleted: molt.Deleted,
+		ID:          molt.ID,
+		PK:          molt.PK,
+		SK:          molt.SK,
+		GSI3PK:      molt.GSI3PK,
+		GSI3SK:      molt.GSI3SK,
+		GSI4PK:      fmt.Sprintf("RO#%s", other.ID),
+		GSI4SK:      molt.SK,
+		GSI5PK:      molt.GSI5PK,
+		GSI5SK:      molt.GSI5SK,
+		Author:      molt.Author,
+		Content:     molt.Content,
+		Remolt:      true,
+		Deleted:     molt.Deleted,
+		Mentions:    molt.Mentions,
+		ReMoltOf:    other.ID,
+		QuoteOf:     molt.QuoteOf,
+		Attachments: molt.Attachments,
 	}
 	ownerID := other.PK[2:]
 	notification, err := attributevalue.MarshalMap(
 		&Notification{
 			PK:       fmt.Sprintf("N#%s", ownerID), // alert original author of molt
-			SK:       fmt.Sprintf("N#%s#%s#%s", ownerID, "R", molt.ID),
-			UserName: other.Author, // person who remolted
+			SK:       reactionSK(ownerID, ScopeRemolt, other.ID, c.ID),
+			UserName: c.UserName, // person who remolted
+			Scope:    ScopeRemolt,
+			MoltID:   other.ID,
 			Viewed:   false,
-			TTL:      fmt.Sprintf("%d", time.Now().Add(time.Hour*24*7).Unix()), // delete notifs in a week to keep table smaller
+			TTL:      Expiry(time.Now().Add(time.Hour * 24 * 7).Unix()), // delete notifs in a week to keep table smaller
 		})
 	if err != nil {
-		fmt.Println("Notification ERR: ", err)
-		panic(err)
+		return fmt.Errorf("MarshalMap: %w", err)
 	}
 
 	item, err := attributevalue.MarshalMap(newMolt)
-
 	if err != nil {
-		fmt.Println("ERR: ", err)
-		panic(err)
+		return fmt.Errorf("MarshalMap: %w", err)
+	}
+	mark, err := attributevalue.MarshalMap(
+		&ReMoltMark{
+			PK:       fmt.Sprintf("RM#%s", c.ID),
+			SK:       fmt.Sprintf("RM#%s", other.ID),
+			ReMoltID: newMolt.ID,
+		})
+	if err != nil {
+		return fmt.Errorf("MarshalMap: %w", err)
 	}
 
 	tItems := make([]types.TransactWriteItem, 0)
@@ -128,9 +145,16 @@ func (m MoltModel) ReMolt(c *Crab, other, molt *Molt) error {
 			},
 		},
 	}
+	// a crab remolting something again after undoing it just refreshes the notification
 	tw4 := types.TransactWriteItem{
 		Put: &types.Put{
-			Item:                notification,
+			Item:      notification,
+			TableName: aws.String(TableName),
+		},
+	}
+	tw5 := types.TransactWriteItem{
+		Put: &types.Put{
+			Item:                mark,
 			TableName:           aws.String(TableName),
 			ConditionExpression: aws.String("attribute_not_exists(PK)"),
 		},
@@ -139,34 +163,135 @@ func (m MoltModel) ReMolt(c *Crab, other, molt *Molt) error {
 	tItems = append(tItems, tw2)
 	tItems = append(tItems, tw3)
 	tItems = append(tItems, tw4)
+	tItems = append(tItems, tw5)
 
-	_, err = m.SVC.ItemTable.TransactWriteItems(context.TODO(), &dynamodb.TransactWriteItemsInput{
+	_, err = m.SVC.ItemTable.TransactWriteItems(ctx, &dynamodb.TransactWriteItemsInput{
 		TransactItems: tItems,
 	})
+	if err != nil {
+		return fmt.Errorf("TransactWriteItems: %w", conflict(err))
+	}
+	SearchModel{SVC: m.SVC}.rerankMolt(ctx, other, 0, 1)
+	return nil
+}
 
+// reMoltsOf returns a page of the remolts of moltID that haven't been
+// deleted.
+func (m MoltModel) reMoltsOf(ctx context.Context, moltID string) ([]Molt, error) {
+	items, _, err := queryPage(ctx, m.SVC.ItemTable, &dynamodb.QueryInput{
+		TableName:              aws.String(TableName),
+		IndexName:              aws.String("GSI4"),
+		Limit:                  aws.Int32(PageSize),
+		KeyConditionExpression: aws.String("GSI4PK = :gsi4pk"),
+		FilterExpression:       aws.String("deleted <> :deleted"),
+		ExpressionAttributeValues: map[string]types.AttributeValue{
+			":gsi4pk":  &types.AttributeValueMemberS{Value: fmt.Sprintf("RO#%s", moltID)},
+			":deleted": &types.AttributeValueMemberBOOL{Value: true},
+		},
+	}, "")
 	if err != nil {
-		fmt.Printf("\nErr: %v", err)
+		return nil, err
+	}
+	molts := make([]Molt, 0)
+	err = attributevalue.UnmarshalListOfMaps(items, &molts)
+	if err != nil {
+		return nil, fmt.Errorf("UnmarshalListOfMaps: %w", err)
+	}
+	return molts, nil
+}
+
+// ReMolted reports whether the crab has remolted the molt
+func (m MoltModel) ReMolted(ctx context.Context, crabID, moltID string) (bool, error) {
+	_, err := m.reMoltMark(ctx, crabID, moltID)
+	if errors.Is(err, ErrNoRecord) {
+		return false, nil
 	}
-	return err
+	return err == nil, err
+}
 
+// DeleteReMolt undoes crab c's remolt of other by deleting the remolt.
+func (m MoltModel) DeleteReMolt(ctx context.Context, c *Crab, other *Molt) error {
+	mark, err := m.reMoltMark(ctx, c.ID, other.ID)
+	if err != nil {
+		return err
+	}
+	remolt, err := m.ByID(ctx, mark.ReMoltID)
+	if err != nil {
+		return err
+	}
+	return m.Delete(ctx, remolt)
 }
 
-func (m MoltModel) DeleteReMolt(molt *Molt) error {
-	_, err := m.SVC.ItemTable.UpdateItem(context.TODO(), &dynamodb.UpdateItemInput{
+func (m MoltModel) reMoltMark(ctx context.Context, crabID, moltID string) (*ReMoltMark, error) {
+	data, err := m.SVC.ItemTable.GetItem(ctx, &dynamodb.GetItemInput{
 		TableName: aws.String(TableName),
 		Key: map[string]types.AttributeValue{
-			"PK": &types.AttributeValueMemberS{Value: molt.PK},
-			"SK": &types.AttributeValueMemberS{Value: molt.SK},
-		},
-		UpdateExpression: aws.String(fmt.Sprintf("set %s = :%s", "remolt", "remolt")),
-		ExpressionAttributeValues: map[string]types.AttributeValue{
-			fmt.Sprintf(":%s", "remolt"): &types.AttributeValueMemberBOOL{Value: molt.Remolt},
+			"PK": &types.AttributeValueMemberS{Value: fmt.Sprintf("RM#%s", crabID)},
+			"SK": &types.AttributeValueMemberS{Value: fmt.Sprintf("RM#%s", moltID)},
 		},
 	})
-
 	if err != nil {
-		panic(err)
+		return nil, fmt.Errorf("GetItem: %w", err)
 	}
+	if data.Item == nil {
+		return nil, ErrNoRecord
+	}
+	mark := &ReMoltMark{}
+	err = attributevalue.UnmarshalMap(data.Item, mark)
+	if err != nil {
+		return nil, fmt.Errorf("UnmarshalMap: %w", err)
+	}
+	return mark, nil
+}
 
-	return nil
+// unReMoltItems returns what deleting crabID's remolt of moltID has to do
+// besides deleting the remolt itself: drop the mark, and take the remolt off
+// the original's count and its crab's notifications, if the original is
+// still there. The original is returned with them, nil if it is gone.
+func (m MoltModel) unReMoltItems(ctx context.Context, crabID, moltID string) ([]types.TransactWriteItem, *Molt, error) {
+	tItems := []types.TransactWriteItem{{
+		Delete: &types.Delete{
+			Key: map[string]types.AttributeValue{
+				"PK": &types.AttributeValueMemberS{Value: fmt.Sprintf("RM#%s", crabID)},
+				"SK": &types.AttributeValueMemberS{Value: fmt.Sprintf("RM#%s", moltID)},
+			},
+			TableName: aws.String(TableName),
+		},
+	}}
+	original, err := m.ByID(ctx, moltID)
+	if errors.Is(err, ErrNoRecord) {
+		return tItems, nil, nil
+	}
+	if err != nil {
+		return nil, nil, err
+	}
+	tItems = append(tItems, types.TransactWriteItem{
+		Delete: &types.Delete{
+			Key: map[string]types.AttributeValue{
+				"PK": &types.AttributeValueMemberS{Value: fmt.Sprintf("N#%s", original.PK[2:])},
+				"SK": &types.AttributeValueMemberS{Value: reactionSK(original.PK[2:], ScopeRemolt, original.ID, crabID)},
+			},
+			TableName: aws.String(TableName),
+		},
+	})
+	if original.RemoltCount > 0 {
+		tItems = append(tItems, types.TransactWriteItem{
+			Update: &types.Update{
+				Key: map[string]types.AttributeValue{
+					"PK": &types.AttributeValueMemberS{Value: original.PK},
+					"SK": &types.AttributeValueMemberS{Value: original.SK},
+				},
+				ConditionExpression: aws.String("attribute_exists(PK)"),
+				TableName:           aws.String(TableName),
+				UpdateExpression:    aws.String("set #remolt_count = #remolt_count - :value"),
+				ExpressionAttributeNames: map[string]string{
+					"#remolt_count": "remolt_count",
+				},
+				ExpressionAttributeValues: map[string]types.AttributeValue{
+					":value": &types.AttributeValueMemberN{Value: "1"},
+				},
+			},
+		})
+	}
+	return tItems, original, nil
 }
@@ -0,0 +1,366 @@
+package models
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/feature/dynamodb/attributevalue"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+	"github.com/google/uuid"
+	"krabber.net/internal/models/ksuid"
+	"strings"
+	"time"
+)
+
+const (
+	// MaxReplyDepth is how far below the top of a thread a reply can be.
+	// Every molt above a reply is counted in the same transaction that
+	// writes it, so this keeps that transaction under DynamoDB's limit.
+	MaxReplyDepth = 50
+	// maxThread caps how many replies are read to show one thread.
+	maxThread = 500
+)
+
+// Comment is how replies were kept before they were molts: keyed by the
+// commenting crab's user name and filed under the molt on GSI4. They are only
+// read now to migrate them.
+type Comment struct {
+	PK       string   `dynamodbav:"PK"`     // MC#username
+	SK       string   `dynamodbav:"SK"`     // MC#created
+	GSI4PK   string   `dynamodbav:"GSI4PK"` // MC#moltID
+	GSI4SK   string   `dynamodbav:"GSI4SK"`
+	Content  string   `dynamodbav:"content"`
+	Mentions []string `dynamodbav:"mentions,omitempty"`
+}
+
+// Reply posts reply as an answer to parent. The reply is a molt like any
+// other, filed under its thread on GSI4 rather than in the sea.
+func (m MoltModel) Reply(ctx context.Context, parent, reply *Molt) error {
+	ancestors := append(append([]string{}, parent.Ancestors...), parent.ID)
+	if len(ancestors) > MaxReplyDepth {
+		return ErrThreadTooDeep
+	}
+	reply.InReplyTo = parent.ID
+	reply.ConversationID = parent.ConversationID
+	if reply.ConversationID == "" {
+		reply.ConversationID = parent.ID
+	}
+	reply.Ancestors = ancestors
+	reply.GSI3PK, reply.GSI3SK = "", ""
+	reply.GSI4PK = fmt.Sprintf("R#%s", reply.ConversationID)
+	reply.GSI4SK = fmt.Sprintf("R#%s", reply.SK[strings.LastIndex(reply.SK, "#")+1:])
+	return m.Insert(ctx, reply)
+}
+
+// replyItems returns what posting reply has to do besides putting it: count
+// it on every molt above it and tell the crab whose molt it answers.
+func (m MoltModel) replyItems(ctx context.Context, author *Crab, reply *Molt) ([]types.TransactWriteItem, error) {
+	ancestors, err := m.Ancestors(ctx, reply)
+	if err != nil {
+		return nil, err
+	}
+	if len(ancestors) == 0 || ancestors[len(ancestors)-1].ID != reply.InReplyTo {
+		return nil, ErrNoRecord
+	}
+	tItems := replyCountItems(ancestors, "+")
+	// the parent is counted last, and keeps the first reply it gets for
+	// lists of molts to show under it
+	parent := tItems[len(tItems)-1].Update
+	parent.UpdateExpression = aws.String(*parent.UpdateExpression +
+		", #first_reply_pk = if_not_exists(#first_reply_pk, :reply_pk), #first_reply_sk = if_not_exists(#first_reply_sk, :reply_sk)")
+	parent.ExpressionAttributeNames["#first_reply_pk"] = "first_reply_pk"
+	parent.ExpressionAttributeNames["#first_reply_sk"] = "first_reply_sk"
+	parent.ExpressionAttributeValues[":reply_pk"] = &types.AttributeValueMemberS{Value: reply.PK}
+	parent.ExpressionAttributeValues[":reply_sk"] = &types.AttributeValueMemberS{Value: reply.SK}
+	ownerID := ancestors[len(ancestors)-1].PK[2:]
+	if ownerID == author.ID {
+		return tItems, nil
+	}
+	notification, err := attributevalue.MarshalMap(
+		&Notification{
+			PK:       fmt.Sprintf("N#%s", ownerID),
+			SK:       fmt.Sprintf("N#%s#%s#%s", ownerID, "MC", reply.ID),
+			UserName: author.UserName,
+			Content:  reply.Content,
+			Scope:    ScopeComment,
+			MoltID:   reply.ID,
+			Viewed:   false,
+			TTL:      Expiry(time.Now().Add(time.Hour * 24 * 7).Unix()), // delete notifs in a week to keep table smaller
+		})
+	if err != nil {
+		return nil, fmt.Errorf("MarshalMap: %w", err)
+	}
+	tItems = append(tItems, types.TransactWriteItem{
+		Put: &types.Put{
+			Item:      notification,
+			TableName: aws.String(TableName),
+		},
+	})
+	return tItems, nil
+}
+
+// threadCountItems returns the updates that add (op "+") or take away (op
+// "-") one reply on every molt above reply.
+func (m MoltModel) threadCountItems(ctx context.Context, reply *Molt, op string) ([]types.TransactWriteItem, error) {
+	ancestors, err := m.Ancestors(ctx, reply)
+	if err != nil {
+		return nil, err
+	}
+	return replyCountItems(ancestors, op), nil
+}
+
+func replyCountItems(molts []Molt, op string) []types.TransactWriteItem {
+	tItems := make([]types.TransactWriteItem, 0, len(molts))
+	for _, molt := range molts {
+		// replies from before counts rolled up may have nothing to take off
+		if op == "-" && molt.CommentCount <= 0 {
+			continue
+		}
+		tItems = append(tItems, types.TransactWriteItem{
+			Update: &types.Update{
+				Key: map[string]types.AttributeValue{
+					"PK": &types.AttributeValueMemberS{Value: molt.PK},
+					"SK": &types.AttributeValueMemberS{Value: molt.SK},
+				},
+				ConditionExpression: aws.String("attribute_exists(PK)"),
+				TableName:           aws.String(TableName),
+				UpdateExpression:    aws.String(fmt.Sprintf("set #comment_count = #comment_count %s :value", op)),
+				ExpressionAttributeNames: map[string]string{
+					"#comment_count": "comment_count",
+				},
+				ExpressionAttributeValues: map[string]types.AttributeValue{
+					":value": &types.AttributeValueMemberN{Value: "1"},
+				},
+			},
+		})
+	}
+	return tItems
+}
+
+// Ancestors returns the molts above molt in its thread, top first. Any that
+// have been deleted are left out.
+func (m MoltModel) Ancestors(ctx context.Context, molt *Molt) ([]Molt, error) {
+	molts := make([]Molt, 0, len(molt.Ancestors))
+	for _, id := range molt.Ancestors {
+		ancestor, err := m.ByID(ctx, id)
+		if errors.Is(err, ErrNoRecord) {
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+		molts = append(molts, *ancestor)
+	}
+	return molts, nil
+}
+
+// Replies returns the replies under molt as a tree, oldest first, each
+// carrying its own replies in Replies. A deleted reply stays where replies
+// hang off it, so the thread still reads in order, and is dropped where
+// none do.
+func (m MoltModel) Replies(ctx context.Context, molt *Molt) ([]Molt, error) {
+	conversation := molt.ConversationID
+	if conversation == "" {
+		conversation = molt.ID
+	}
+	p := dynamodb.NewQueryPaginator(m.SVC.ItemTable, &dynamodb.QueryInput{
+		TableName:              aws.String(TableName),
+		IndexName:              aws.String("GSI4"),
+		KeyConditionExpression: aws.String("GSI4PK = :gsi4pk"),
+		ExpressionAttributeValues: map[string]types.AttributeValue{
+			":gsi4pk": &types.AttributeValueMemberS{Value: fmt.Sprintf("R#%s", conversation)},
+		},
+	})
+	var thread []Molt
+	for p.HasMorePages() && len(thread) < maxThread {
+		out, err := p.NextPage(ctx)
+		if err != nil {
+			return nil, fmt.Errorf("Query: %w", err)
+		}
+		var page []Molt
+		err = attributevalue.UnmarshalListOfMaps(out.Items, &page)
+		if err != nil {
+			return nil, fmt.Errorf("UnmarshalListOfMaps: %w", err)
+		}
+		thread = append(thread, page...)
+	}
+
+	children := map[string][]Molt{}
+	for _, reply := range thread {
+		for _, id := range reply.Ancestors {
+			if id == molt.ID {
+				children[reply.InReplyTo] = append(children[reply.InReplyTo], reply)
+				break
+			}
+		}
+	}
+	return replyTree(children, molt.ID), nil
+}
+
+func replyTree(children map[string][]Molt, id string) []Molt {
+	replies := make([]Molt, 0, len(children[id]))
+	for _, reply := range children[id] {
+		reply.Replies = replyTree(children, reply.ID)
+		if reply.Deleted && len(reply.Replies) == 0 {
+			continue
+		}
+		replies = append(replies, reply)
+	}
+	return replies
+}
+
+// ShowReplies shows a page of the replies a crab has posted, newest first.
+func (m MoltModel) ShowReplies(ctx context.Context, id, cursor string) ([]Molt, string, error) {
+	items, next, err := queryPage(ctx, m.SVC.ItemTable, &dynamodb.QueryInput{
+		TableName:              aws.String(TableName),
+		Limit:                  aws.Int32(PageSize),
+		KeyConditionExpression: aws.String("PK = :hashKey"),
+		FilterExpression:       aws.String("deleted <> :deleted AND attribute_exists(in_reply_to)"),
+		ExpressionAttributeValues: map[string]types.AttributeValue{
+			":hashKey": &types.AttributeValueMemberS{Value: "M#" + id},
+			":deleted": &types.AttributeValueMemberBOOL{Value: true},
+		},
+		ScanIndexForward: aws.Bool(false),
+	}, cursor)
+	if err != nil {
+		return nil, "", err
+	}
+	molts := make([]Molt, 0)
+	err = attributevalue.UnmarshalListOfMaps(items, &molts)
+	if err != nil {
+		return nil, "", err
+	}
+	return molts, next, nil
+}
+
+// MigrateComments turns the comments left from before replies were molts
+// into replies, each by its crab to the molt it was on and dated when it was
+// made. The molt already counts it, so only the crab's molt count changes.
+// Comments whose crab or molt is gone are left where they are.
+func (m MoltModel) MigrateComments(ctx context.Context) (int, error) {
+	// read them all first, the scan would lose its place as they are deleted
+	var comments []Comment
+	cursor := ""
+	for {
+		items, next, err := scanPage(ctx, m.SVC.ItemTable, &dynamodb.ScanInput{
+			TableName:        aws.String(TableName),
+			IndexName:        aws.String("GSI4"),
+			Limit:            aws.Int32(PageSize),
+			FilterExpression: aws.String("begins_with(GSI4PK, :mc)"),
+			ExpressionAttributeValues: map[string]types.AttributeValue{
+				":mc": &types.AttributeValueMemberS{Value: "MC#"},
+			},
+		}, cursor)
+		if err != nil {
+			return 0, fmt.Errorf("Scan: %w", err)
+		}
+		var page []Comment
+		err = attributevalue.UnmarshalListOfMaps(items, &page)
+		if err != nil {
+			return 0, fmt.Errorf("UnmarshalListOfMaps: %w", err)
+		}
+		comments = append(comments, page...)
+		if next == "" {
+			break
+		}
+		cursor = next
+	}
+
+	n := 0
+	for i := range comments {
+		err := m.migrateComment(ctx, &comments[i])
+		if errors.Is(err, ErrNoRecord) {
+			continue
+		}
+		if err != nil {
+			return n, err
+		}
+		n++
+	}
+	return n, nil
+}
+
+func (m MoltModel) migrateComment(ctx context.Context, c *Comment) error {
+	parent, err := m.ByID(ctx, c.GSI4PK[3:])
+	if err != nil {
+		return err
+	}
+	author, err := CrabModel{SVC: m.SVC}.ByUserName(ctx, c.PK[3:])
+	if err != nil {
+		return err
+	}
+	created, err := time.Parse(time.RFC3339, c.SK[3:])
+	if err != nil {
+		created = time.Now()
+	}
+	conversation := parent.ConversationID
+	if conversation == "" {
+		conversation = parent.ID
+	}
+	id := uuid.New().String()
+	k := ksuid.At(created).String()
+	reply := &Molt{
+		ID:             id,
+		PK:             fmt.Sprintf("M#%s", author.ID),
+		SK:             fmt.Sprintf("M#%s#%s", author.ID, k),
+		GSI4PK:         fmt.Sprintf("R#%s", conversation),
+		GSI4SK:         fmt.Sprintf("R#%s", k),
+		GSI5PK:         fmt.Sprintf("M#%s", id),
+		GSI5SK:         fmt.Sprintf("M#%s", id),
+		Author:         author.UserName,
+		Content:        c.Content,
+		Mentions:       c.Mentions,
+		InReplyTo:      parent.ID,
+		ConversationID: conversation,
+		Ancestors:      append(append([]string{}, parent.Ancestors...), parent.ID),
+	}
+	item, err := attributevalue.MarshalMap(reply)
+	if err != nil {
+		return fmt.Errorf("MarshalMap: %w", err)
+	}
+	_, err = m.SVC.ItemTable.TransactWriteItems(ctx, &dynamodb.TransactWriteItemsInput{
+		TransactItems: []types.TransactWriteItem{
+			{
+				Put: &types.Put{
+					Item:                item,
+					TableName:           aws.String(TableName),
+					ConditionExpression: aws.String("attribute_not_exists(PK)"),
+				},
+			},
+			{
+				Delete: &types.Delete{
+					Key: map[string]types.AttributeValue{
+						"PK": &types.AttributeValueMemberS{Value: c.PK},
+						"SK": &types.AttributeValueMemberS{Value: c.SK},
+					},
+					TableName:           aws.String(TableName),
+					ConditionExpression: aws.String("attribute_exists(PK)"),
+				},
+			},
+			{
+				Update: &types.Update{
+					Key: map[string]types.AttributeValue{
+						"PK": &types.AttributeValueMemberS{Value: author.PK},
+						"SK": &types.AttributeValueMemberS{Value: author.SK},
+					},
+					ConditionExpression: aws.String("attribute_exists(PK)"),
+					TableName:           aws.String(TableName),
+					UpdateExpression:    aws.String("set #molt_count = #molt_count + :value"),
+					ExpressionAttributeNames: map[string]string{
+						"#molt_count": "molt_count",
+					},
+					ExpressionAttributeValues: map[string]types.AttributeValue{
+						":value": &types.AttributeValueMemberN{Value: "1"},
+					},
+				},
+			},
+		},
+	})
+	if err != nil {
+		return fmt.Errorf("TransactWriteItems: %w", conflict(err))
+	}
+	SearchModel{SVC: m.SVC}.reindexMolt(ctx, reply)
+	return nil
+}
@@ -0,0 +1,505 @@
+package models
+
+import (
+	"context"
+	"fmt"
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/feature/dynamodb/attributevalue"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+	"math/bits"
+	"regexp"
+	"strings"
+	"unicode/utf8"
+)
+
+// The kinds of document the search index holds.
+const (
+	SearchMolts = "M"
+	SearchCrabs = "C"
+)
+
+const (
+	// maxSearchTerms caps how many terms one document is indexed under.
+	maxSearchTerms = 40
+	// maxTermLength is the longest term that is indexed, in runes.
+	maxTermLength = 40
+	// maxSearchPrefix is the longest prefix a word is indexed under. Longer
+	// words in a query are looked up by their first maxSearchPrefix runes and
+	// checked against the documents that turns up.
+	maxSearchPrefix = 8
+	// searchExamined caps how many entries one page of results reads through,
+	// so terms that rarely meet give a short page to carry on from rather
+	// than a walk of the whole index.
+	searchExamined = 200
+)
+
+// termRX picks words out of text, keeping a leading # (crabtag) or @ (mention).
+var termRX = regexp.MustCompile(`[#@]?[\p{L}\p{N}_]+`)
+
+type SearchModel struct {
+	SVC ItemService
+}
+
+// SearchEntry files one document under one key: a #crabtag or @mention it
+// has, or a prefix of one of its words. Entries are partitioned by the kind
+// of document and the key, and sorted by the document's rank, so the
+// matches of a query word come out of one partition in the order they are
+// shown. GSI9 groups every entry of a document so it can be re-indexed
+// without knowing its old text.
+type SearchEntry struct {
+	PK     string `dynamodbav:"PK"`     // ST#kind#key
+	SK     string `dynamodbav:"SK"`     // SR#rank#docID
+	GSI9PK string `dynamodbav:"GSI9PK"` // SD#kind#docID
+	GSI9SK string `dynamodbav:"GSI9SK"` // ST#key
+	DocID  string `dynamodbav:"doc_id"`
+	// DocPK and DocSK are the document's own key, to batch-get it by.
+	DocPK string `dynamodbav:"doc_pk"`
+	DocSK string `dynamodbav:"doc_sk"`
+}
+
+// SearchTerms breaks text into the lower case terms it is indexed under. A
+// #crabtag or @mention is indexed both with and without its marker, so a
+// plain search finds it too.
+func SearchTerms(text string) []string {
+	seen := map[string]bool{}
+	terms := make([]string, 0)
+	add := func(t string) {
+		n := utf8.RuneCountInString(t)
+		if n < 2 || n > maxTermLength || seen[t] || len(terms) == maxSearchTerms {
+			return
+		}
+		seen[t] = true
+		terms = append(terms, t)
+	}
+	for _, t := range termRX.FindAllString(strings.ToLower(text), -1) {
+		if t[0] == '#' || t[0] == '@' {
+			add(t)
+			add(t[1:])
+			continue
+		}
+		add(t)
+	}
+	return terms
+}
+
+// searchKeys are the keys a document with terms is filed under: each
+// #crabtag and @mention as it is, and every word under each of its
+// prefixes up to maxSearchPrefix runes long.
+func searchKeys(terms []string) []string {
+	seen := map[string]bool{}
+	keys := make([]string, 0, len(terms))
+	for _, t := range terms {
+		if t[0] == '#' || t[0] == '@' {
+			if !seen[t] {
+				seen[t] = true
+				keys = append(keys, t)
+			}
+			continue
+		}
+		runes := []rune(t)
+		for n := 2; n <= len(runes) && n <= maxSearchPrefix; n++ {
+			if k := string(runes[:n]); !seen[k] {
+				seen[k] = true
+				keys = append(keys, k)
+			}
+		}
+	}
+	return keys
+}
+
+// moltRank sorts molts by the day they were posted, newest first, then by
+// how much they have been liked, remolted and commented on, then newest
+// first again. Engagement is bucketed by powers of two, like crabRank, so a
+// molt is only re-filed now and then as it is taken up; the day keeps a
+// popular molt from staying above everything posted after it.
+func moltRank(molt *Molt) string {
+	k := molt.SK[strings.LastIndex(molt.SK, "#")+1:]
+	day := "00000000"
+	if created, err := molt.Created(); err == nil {
+		day = created.UTC().Format("20060102")
+	}
+	engagement := molt.LikeCount + molt.RemoltCount + molt.CommentCount
+	if engagement < 0 {
+		engagement = 0
+	}
+	return fmt.Sprintf("%s%02d%s", day, bits.Len(uint(engagement)), k)
+}
+
+// crabRank sorts crabs most followed first. Follower counts are bucketed by
+// powers of two so a crab is only re-filed now and then as they grow.
+func crabRank(followers int) string {
+	if followers < 0 {
+		followers = 0
+	}
+	return fmt.Sprintf("%02d", bits.Len(uint(followers)))
+}
+
+// index makes terms the complete set of entries of a document, writing only
+// the entries that were added, dropped, re-ranked or that point at a key
+// the document has since moved from.
+func (m SearchModel) index(ctx context.Context, kind, docID, docPK, docSK, rank string, terms []string) error {
+	// the document key each entry points at, by the entry's own key
+	old := map[[2]string][2]string{}
+	cursor := ""
+	for {
+		items, next, err := queryPage(ctx, m.SVC.ItemTable, &dynamodb.QueryInput{
+			TableName:              aws.String(TableName),
+			IndexName:              aws.String("GSI9"),
+			KeyConditionExpression: aws.String("GSI9PK = :gsi9pk"),
+			ExpressionAttributeValues: map[string]types.AttributeValue{
+				":gsi9pk": &types.AttributeValueMemberS{Value: fmt.Sprintf("SD#%s#%s", kind, docID)},
+			},
+		}, cursor)
+		if err != nil {
+			return err
+		}
+		entries := make([]SearchEntry, 0)
+		err = attributevalue.UnmarshalListOfMaps(items, &entries)
+		if err != nil {
+			return err
+		}
+		for _, e := range entries {
+			old[[2]string{e.PK, e.SK}] = [2]string{e.DocPK, e.DocSK}
+		}
+		if next == "" {
+			break
+		}
+		cursor = next
+	}
+
+	requests := make([]types.WriteRequest, 0)
+	keep := map[[2]string]bool{}
+	for _, k := range searchKeys(terms) {
+		e := SearchEntry{
+			PK:     fmt.Sprintf("ST#%s#%s", kind, k),
+			SK:     fmt.Sprintf("SR#%s#%s", rank, docID),
+			GSI9PK: fmt.Sprintf("SD#%s#%s", kind, docID),
+			GSI9SK: fmt.Sprintf("ST#%s", k),
+			DocID:  docID,
+			DocPK:  docPK,
+			DocSK:  docSK,
+		}
+		keep[[2]string{e.PK, e.SK}] = true
+		if doc, ok := old[[2]string{e.PK, e.SK}]; ok && doc == [2]string{docPK, docSK} {
+			continue
+		}
+		item, err := attributevalue.MarshalMap(&e)
+		if err != nil {
+			return fmt.Errorf("MarshalMap: %w", err)
+		}
+		requests = append(requests, types.WriteRequest{PutRequest: &types.PutRequest{Item: item}})
+	}
+	for key := range old {
+		if keep[key] {
+			continue
+		}
+		requests = append(requests, types.WriteRequest{DeleteRequest: &types.DeleteRequest{
+			Key: map[string]types.AttributeValue{
+				"PK": &types.AttributeValueMemberS{Value: key[0]},
+				"SK": &types.AttributeValueMemberS{Value: key[1]},
+			},
+		}})
+	}
+	return batchWrite(ctx, m.SVC.ItemTable, requests)
+}
+
+// IndexMolt brings a molt's entries up to date with its content. A deleted
+// molt is taken out of the index.
+func (m SearchModel) IndexMolt(ctx context.Context, molt *Molt) error {
+	if molt.Deleted {
+		return m.index(ctx, SearchMolts, molt.ID, molt.PK, molt.SK, moltRank(molt), nil)
+	}
+	return m.index(ctx, SearchMolts, molt.ID, molt.PK, molt.SK, moltRank(molt), SearchTerms(molt.Content))
+}
+
+// IndexCrab brings a crab's entries up to date with their user and display
+// names and how many followers they have.
+func (m SearchModel) IndexCrab(ctx context.Context, c *Crab) error {
+	return m.index(ctx, SearchCrabs, c.ID, c.PK, c.SK, crabRank(c.FollowerCount), crabText(c))
+}
+
+func crabText(c *Crab) []string {
+	return SearchTerms("@" + c.UserName + " " + c.Display)
+}
+
+// reindexMolt is IndexMolt for after a molt's own write has gone through.
+// The index is a copy that Rebuild can put right, so failing to update it
+// is printed rather than failing a write that has already happened.
+func (m SearchModel) reindexMolt(ctx context.Context, molt *Molt) {
+	err := m.IndexMolt(ctx, molt)
+	if err != nil {
+		fmt.Println("ERROR indexing molt ", molt.ID, ": ", err)
+	}
+}
+
+// reindexCrab is reindexMolt for crabs.
+func (m SearchModel) reindexCrab(ctx context.Context, c *Crab) {
+	err := m.IndexCrab(ctx, c)
+	if err != nil {
+		fmt.Println("ERROR indexing crab ", c.ID, ": ", err)
+	}
+}
+
+// rerankCrab re-files c's entries if gaining more followers, or losing them
+// when it is negative, moves them to another rank.
+func (m SearchModel) rerankCrab(ctx context.Context, c *Crab, more int) {
+	if crabRank(c.FollowerCount) == crabRank(c.FollowerCount+more) {
+		return
+	}
+	moved := *c
+	moved.FollowerCount += more
+	m.reindexCrab(ctx, &moved)
+}
+
+// rerankMolt re-files molt's entries if more likes and remolts, or fewer
+// when they are negative, move them to another rank. Remolts and deleted
+// molts aren't in the index.
+func (m SearchModel) rerankMolt(ctx context.Context, molt *Molt, likes, remolts int) {
+	if molt.Remolt || molt.Deleted {
+		return
+	}
+	moved := *molt
+	moved.LikeCount += likes
+	moved.RemoltCount += remolts
+	if moltRank(molt) == moltRank(&moved) {
+		return
+	}
+	m.reindexMolt(ctx, &moved)
+}
+
+// Rebuild re-indexes every crab and molt in the table, returning how many
+// documents it went through.
+func (m SearchModel) Rebuild(ctx context.Context) (int, error) {
+	n := 0
+	cursor := ""
+	for {
+		crabs, next, err := CrabModel{SVC: m.SVC}.Show(ctx, cursor)
+		if err != nil {
+			return n, err
+		}
+		for i := range crabs {
+			err = m.IndexCrab(ctx, &crabs[i])
+			if err != nil {
+				return n, err
+			}
+			n++
+		}
+		if next == "" {
+			break
+		}
+		cursor = next
+	}
+
+	cursor = ""
+	for {
+		// remolts copy the original's content, only the original is indexed
+		items, next, err := scanPage(ctx, m.SVC.ItemTable, &dynamodb.ScanInput{
+			TableName:        aws.String(TableName),
+			IndexName:        aws.String("GSI5"),
+			Limit:            aws.Int32(PageSize),
+			FilterExpression: aws.String("remolt <> :remolt"),
+			ExpressionAttributeValues: map[string]types.AttributeValue{
+				":remolt": &types.AttributeValueMemberBOOL{Value: true},
+			},
+		}, cursor)
+		if err != nil {
+			return n, err
+		}
+		molts := make([]Molt, 0)
+		err = attributevalue.UnmarshalListOfMaps(items, &molts)
+		if err != nil {
+			return n, err
+		}
+		for i := range molts {
+			err = m.IndexMolt(ctx, &molts[i])
+			if err != nil {
+				return n, err
+			}
+			n++
+		}
+		if next == "" {
+			return n, nil
+		}
+		cursor = next
+	}
+}
+
+// searchTerm is one word of a query, which matches as a prefix, or a
+// #crabtag or @mention, which has to match exactly.
+type searchTerm struct {
+	term  string
+	exact bool
+}
+
+// key is the index key the term is looked up under.
+func (t searchTerm) key() string {
+	if runes := []rune(t.term); !t.exact && len(runes) > maxSearchPrefix {
+		return string(runes[:maxSearchPrefix])
+	}
+	return t.term
+}
+
+func parseQuery(q string) []searchTerm {
+	terms := make([]searchTerm, 0)
+	for _, t := range termRX.FindAllString(strings.ToLower(q), -1) {
+		if utf8.RuneCountInString(t) < 2 {
+			continue
+		}
+		terms = append(terms, searchTerm{term: t, exact: t[0] == '#' || t[0] == '@'})
+	}
+	return terms
+}
+
+// matches reports whether a document indexed under terms matches every
+// term of the query.
+func matches(query []searchTerm, terms []string) bool {
+	for _, q := range query {
+		found := false
+		for _, t := range terms {
+			if t == q.term || !q.exact && strings.HasPrefix(t, q.term) {
+				found = true
+				break
+			}
+		}
+		if !found {
+			return false
+		}
+	}
+	return true
+}
+
+// find reads a page of the documents matching every term of q, in the
+// order of their rank. It walks the entries of the query's longest key,
+// the fewest documents most likely, batch-getting the documents they point
+// at and keeping those whose terms, as text reads them off the item, match
+// the rest of the query. The cursor is the last entry it went through.
+func (m SearchModel) find(ctx context.Context, kind, q, cursor string, text func(map[string]types.AttributeValue) ([]string, error)) ([]map[string]types.AttributeValue, string, error) {
+	query := parseQuery(q)
+	if len(query) == 0 {
+		return nil, "", nil
+	}
+	key := query[0].key()
+	for _, t := range query[1:] {
+		if utf8.RuneCountInString(t.key()) > utf8.RuneCountInString(key) {
+			key = t.key()
+		}
+	}
+	pk := fmt.Sprintf("ST#%s#%s", kind, key)
+	start, err := startKey(cursor, "", pk)
+	if err != nil {
+		return nil, "", err
+	}
+	found := make([]map[string]types.AttributeValue, 0, PageSize)
+	examined := 0
+	for {
+		out, err := m.SVC.ItemTable.Query(ctx, &dynamodb.QueryInput{
+			TableName:              aws.String(TableName),
+			KeyConditionExpression: aws.String("PK = :pk"),
+			ExpressionAttributeValues: map[string]types.AttributeValue{
+				":pk": &types.AttributeValueMemberS{Value: pk},
+			},
+			ExclusiveStartKey: start,
+			Limit:             aws.Int32(PageSize),
+			ScanIndexForward:  aws.Bool(false),
+		})
+		if err != nil {
+			return nil, "", err
+		}
+		entries := make([]SearchEntry, 0, len(out.Items))
+		err = attributevalue.UnmarshalListOfMaps(out.Items, &entries)
+		if err != nil {
+			return nil, "", err
+		}
+		keys := make([]map[string]types.AttributeValue, 0, len(entries))
+		for _, e := range entries {
+			keys = append(keys, map[string]types.AttributeValue{
+				"PK": &types.AttributeValueMemberS{Value: e.DocPK},
+				"SK": &types.AttributeValueMemberS{Value: e.DocSK},
+			})
+		}
+		items, err := batchGet(ctx, m.SVC.ItemTable, keys)
+		if err != nil {
+			return nil, "", err
+		}
+		docs := make(map[[2]string]map[string]types.AttributeValue, len(items))
+		for _, item := range items {
+			pk, _ := item["PK"].(*types.AttributeValueMemberS)
+			sk, _ := item["SK"].(*types.AttributeValueMemberS)
+			if pk != nil && sk != nil {
+				docs[[2]string{pk.Value, sk.Value}] = item
+			}
+		}
+		for i, e := range entries {
+			examined++
+			// an entry can outlive its document for as long as it takes
+			// to re-index it
+			if item, ok := docs[[2]string{e.DocPK, e.DocSK}]; ok {
+				terms, err := text(item)
+				if err != nil {
+					return nil, "", err
+				}
+				if matches(query, terms) {
+					found = append(found, item)
+				}
+			}
+			last := i == len(entries)-1 && out.LastEvaluatedKey == nil
+			if last {
+				return found, "", nil
+			}
+			if len(found) == PageSize || examined == searchExamined {
+				next, err := EncodeCursor(map[string]types.AttributeValue{
+					"PK": &types.AttributeValueMemberS{Value: e.PK},
+					"SK": &types.AttributeValueMemberS{Value: e.SK},
+				})
+				return found, next, err
+			}
+		}
+		if out.LastEvaluatedKey == nil {
+			return found, "", nil
+		}
+		start = out.LastEvaluatedKey
+	}
+}
+
+// Molts returns a page of the molts matching q, the newest first.
+func (m SearchModel) Molts(ctx context.Context, q, cursor string) ([]Molt, string, error) {
+	items, next, err := m.find(ctx, SearchMolts, q, cursor, func(item map[string]types.AttributeValue) ([]string, error) {
+		var molt Molt
+		err := attributevalue.UnmarshalMap(item, &molt)
+		if err != nil || molt.Deleted {
+			return nil, err
+		}
+		return SearchTerms(molt.Content), nil
+	})
+	if err != nil {
+		return nil, "", err
+	}
+	molts := make([]Molt, 0, len(items))
+	err = attributevalue.UnmarshalListOfMaps(items, &molts)
+	if err != nil {
+		return nil, "", err
+	}
+	return molts, next, nil
+}
+
+// Crabs returns a page of the crabs matching q, the most followed first.
+func (m SearchModel) Crabs(ctx context.Context, q, cursor string) ([]Crab, string, error) {
+	items, next, err := m.find(ctx, SearchCrabs, q, cursor, func(item map[string]types.AttributeValue) ([]string, error) {
+		var c Crab
+		err := attributevalue.UnmarshalMap(item, &c)
+		if err != nil {
+			return nil, err
+		}
+		return crabText(&c), nil
+	})
+	if err != nil {
+		return nil, "", err
+	}
+	crabs := make([]Crab, 0, len(items))
+	err = attributevalue.UnmarshalListOfMaps(items, &crabs)
+	if err != nil {
+		return nil, "", err
+	}
+	return crabs, next, nil
+}
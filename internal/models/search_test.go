@@ -0,0 +1,42 @@
+package models
+
+import (
+	"testing"
+	"time"
+
+	"krabber.net/internal/models/ksuid"
+)
+
+func TestMoltRank(t *testing.T) {
+	morning := time.Date(2024, 5, 1, 9, 0, 0, 0, time.UTC)
+	molt := func(at time.Time, likes, remolts, comments int) *Molt {
+		return &Molt{
+			SK:           "M#crab#" + ksuid.At(at).String(),
+			LikeCount:    likes,
+			RemoltCount:  remolts,
+			CommentCount: comments,
+		}
+	}
+	// each is ranked above the one after it
+	order := []struct {
+		name string
+		molt *Molt
+	}{
+		{"next day, quiet", molt(morning.Add(24*time.Hour), 0, 0, 0)},
+		{"evening, popular", molt(morning.Add(10*time.Hour), 20, 5, 3)},
+		{"morning, popular", molt(morning, 30, 0, 0)},
+		{"evening, a few likes", molt(morning.Add(10*time.Hour), 2, 1, 0)},
+		{"noon, a few likes", molt(morning.Add(3*time.Hour), 0, 0, 3)},
+		{"evening, quiet", molt(morning.Add(10*time.Hour), 0, 0, 0)},
+	}
+	for i := 1; i < len(order); i++ {
+		above, below := moltRank(order[i-1].molt), moltRank(order[i].molt)
+		if above <= below {
+			t.Errorf("%s (%s) ranked at or below %s (%s)", order[i-1].name, above, order[i].name, below)
+		}
+	}
+	// likes within a bucket don't move a molt
+	if moltRank(molt(morning, 2, 0, 0))[:10] != moltRank(molt(morning, 3, 0, 0))[:10] {
+		t.Error("2 and 3 likes ranked apart")
+	}
+}
@@ -2,6 +2,7 @@ package models
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"github.com/aws/aws-sdk-go-v2/aws"
 	"github.com/aws/aws-sdk-go-v2/feature/dynamodb/attributevalue"
@@ -9,63 +10,275 @@ import (
 	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
 	"log"
 	"math/rand"
+	"sort"
+	"strconv"
 	"time"
 )
 
+const (
+	// SeaWindow is how far back the sea reaches.
+	SeaWindow = 24 * time.Hour
+	// maxShardBytes keeps a shard under DynamoDB's 400KB item limit, leaving
+	// room for its keys and for itemSize being an estimate.
+	maxShardBytes = 350 << 10
+	// seaJitter is the most a shard moves a molt from its place in time.
+	seaJitter = 30 * time.Minute
+)
+
+// Cache is a shard of the sea, MS#n, rebuilt by FillSea.
 type Cache struct {
 	PK    string `dynamodbav:"PK"`
 	SK    string `dynamodbav:"SK"`
 	Molts []Molt `dynamodbav:"molts"`
 }
 
-// Sea the latest molts from all the trenches
-func (m MoltModel) Sea() ([]Molt, error) {
-	rand.Seed(time.Now().UnixNano())
-	cache := rand.Intn(ShardSize)
-	out, err := m.SVC.ItemTable.GetItem(context.TODO(), &dynamodb.GetItemInput{
+// Sea returns a page of the latest molts from all the trenches, ranked for
+// viewerID. The first page ranks a random cache shard for them, see
+// Ranking, and the pages after it follow that ranking; the cursor says how
+// far into it they are.
+func (m MoltModel) Sea(ctx context.Context, viewerID, cursor string) ([]Molt, string, error) {
+	var ex *Explore
+	var molts []Molt
+	var err error
+	offset := 0
+	if cursor == "" {
+		ex, molts, err = m.rank(ctx, viewerID, time.Now())
+		if err != nil {
+			return nil, "", err
+		}
+	} else {
+		key, err := DecodeCursor(cursor)
+		if err != nil {
+			return nil, "", err
+		}
+		at, ok := key["offset"].(*types.AttributeValueMemberS)
+		if !ok {
+			return nil, "", ErrInvalidCursor
+		}
+		offset, err = strconv.Atoi(at.Value)
+		if err != nil || offset < 0 {
+			return nil, "", ErrInvalidCursor
+		}
+		ex, err = m.explore(ctx, viewerID)
+		if errors.Is(err, ErrNoRecord) {
+			return []Molt{}, "", nil // the ranking has expired
+		}
+		if err != nil {
+			return nil, "", err
+		}
+		molts, err = m.shard(ctx, ex.Shard)
+		if err != nil {
+			return nil, "", err
+		}
+	}
+	if offset >= len(ex.Molts) {
+		return []Molt{}, "", nil
+	}
+	end := offset + PageSize
+	if end > len(ex.Molts) {
+		end = len(ex.Molts)
+	}
+	if cursor != "" {
+		err = m.served(ctx, viewerID, end)
+		if err != nil {
+			return nil, "", err
+		}
+	}
+
+	// the shard may have been refilled since, dropping some of the ranking
+	byID := make(map[string]Molt, len(molts))
+	for _, molt := range molts {
+		byID[molt.ID] = molt
+	}
+	page := make([]Molt, 0, end-offset)
+	for _, id := range ex.Molts[offset:end] {
+		if molt, ok := byID[id]; ok {
+			page = append(page, molt)
+		}
+	}
+	if end == len(ex.Molts) {
+		return page, "", nil
+	}
+	next, err := EncodeCursor(map[string]types.AttributeValue{
+		"offset": &types.AttributeValueMemberS{Value: strconv.Itoa(end)},
+	})
+	return page, next, err
+}
+
+// shard reads the molts in cache shard n.
+func (m MoltModel) shard(ctx context.Context, n int) ([]Molt, error) {
+	out, err := m.SVC.ItemTable.GetItem(ctx, &dynamodb.GetItemInput{
 		TableName: aws.String(TableName),
 		Key: map[string]types.AttributeValue{
-			"PK": &types.AttributeValueMemberS{Value: fmt.Sprintf("MS#%d", cache)},
-			"SK": &types.AttributeValueMemberS{Value: fmt.Sprintf("MS#%d", cache)},
+			"PK": &types.AttributeValueMemberS{Value: fmt.Sprintf("MS#%d", n)},
+			"SK": &types.AttributeValueMemberS{Value: fmt.Sprintf("MS#%d", n)},
 		},
 	})
-	log.Printf("\nReading from Cache #: %d", cache)
 	if err != nil {
-		fmt.Errorf("ERR: %s", err)
+		return nil, fmt.Errorf("GetItem: %w", err)
 	}
-	molt := make([]Molt, 0)
-	molts := out.Item["molts"]
-	err = attributevalue.Unmarshal(molts, &molt)
+	molts := make([]Molt, 0)
+	item, ok := out.Item["molts"]
+	if !ok {
+		return molts, nil
+	}
+	err = attributevalue.Unmarshal(item, &molts)
 	if err != nil {
 		return nil, err
 	}
-	return molt, err
+	return molts, nil
 }
 
-// FillSea -> Creates shards of the latest molts
-func (m MoltModel) FillSea() error {
-	// retrieve all deals from past day
-	l := m.latest()
-	fmt.Printf("Length of latest is: %d", len(l))
+// FillSea rebuilds the sea's shards from the molts of the past SeaWindow.
+// Each shard orders them a little differently, so readers landing on
+// different shards don't all see the same page, and is cut short to stay
+// under the item size limit.
+func (m MoltModel) FillSea(ctx context.Context) error {
+	now := time.Now()
+	l, err := m.latest(ctx, now)
+	if err != nil {
+		return err
+	}
 	for i := 0; i < ShardSize; i++ {
+		molts, err := seaShard(l, i, now.UnixNano())
+		if err != nil {
+			return err
+		}
 		c := &Cache{
 			PK:    fmt.Sprintf("MS#%d", i),
 			SK:    fmt.Sprintf("MS#%d", i),
-			Molts: l,
+			Molts: molts,
 		}
 		item, err := attributevalue.MarshalMap(c)
 		if err != nil {
-			fmt.Println("ERR: ", err)
-			return err
+			return fmt.Errorf("MarshalMap: %w", err)
 		}
-		_, err = m.SVC.ItemTable.PutItem(context.TODO(), &dynamodb.PutItemInput{
+		_, err = m.SVC.ItemTable.PutItem(ctx, &dynamodb.PutItemInput{
 			TableName: aws.String(TableName),
 			Item:      item,
 		})
 		if err != nil {
-			return err
+			return fmt.Errorf("PutItem: %w", err)
 		}
-
+		log.Printf("Filled sea shard %d with %d of %d molts", i, len(molts), len(l))
 	}
 	return nil
 }
+
+// latest returns the molts posted in the SeaWindow before now, newest
+// first. Molts are bucketed in GSI3 by the local date they were posted on,
+// so the window reads every day it overlaps.
+func (m MoltModel) latest(ctx context.Context, now time.Time) ([]Molt, error) {
+	since := now.Add(-SeaWindow)
+	var items []Molt
+	for _, bucket := range seaBuckets(since, now) {
+		p := dynamodb.NewQueryPaginator(m.SVC.ItemTable, &dynamodb.QueryInput{
+			TableName:              aws.String(TableName),
+			IndexName:              aws.String("GSI3"),
+			KeyConditionExpression: aws.String("GSI3PK = :hashKey"),
+			FilterExpression:       aws.String("deleted <> :deleted"),
+			ExpressionAttributeValues: map[string]types.AttributeValue{
+				":hashKey": &types.AttributeValueMemberS{Value: bucket},
+				":deleted": &types.AttributeValueMemberBOOL{Value: true},
+			},
+		})
+		for p.HasMorePages() {
+			out, err := p.NextPage(ctx)
+			if err != nil {
+				return nil, fmt.Errorf("Query: %w", err)
+			}
+			var pItems []Molt
+			err = attributevalue.UnmarshalListOfMaps(out.Items, &pItems)
+			if err != nil {
+				return nil, fmt.Errorf("UnmarshalListOfMaps: %w", err)
+			}
+			for _, molt := range pItems {
+				t := moltTime(molt)
+				if !t.Before(since) && !t.After(now) {
+					items = append(items, molt)
+				}
+			}
+		}
+	}
+	return MergeMolts(items), nil
+}
+
+// seaBuckets are the GSI3 date partitions, oldest first, that molts posted
+// between since and until can be in.
+func seaBuckets(since, until time.Time) []string {
+	buckets := make([]string, 0, 2)
+	y, mnth, d := since.Date()
+	day := time.Date(y, mnth, d, 0, 0, 0, 0, since.Location())
+	for !day.After(until) {
+		y, mnth, d = day.Date()
+		buckets = append(buckets, "M#"+fmt.Sprintf("%d-%d-%d", y, int(mnth), d))
+		day = day.AddDate(0, 0, 1)
+	}
+	return buckets
+}
+
+// seaShard orders molts, which are newest first, for shard i and keeps as
+// many as fit in one item. Shard 0 keeps the order; the others move each
+// molt by up to seaJitter, drawn from seed and i, so they shuffle the
+// near-simultaneous molts and, on a busy day, keep different ones.
+func seaShard(molts []Molt, i int, seed int64) ([]Molt, error) {
+	shard := make([]Molt, len(molts))
+	copy(shard, molts)
+	if i > 0 {
+		rng := rand.New(rand.NewSource(seed + int64(i)))
+		at := make(map[string]time.Time, len(shard))
+		for _, molt := range shard {
+			at[molt.ID] = moltTime(molt).Add(time.Duration(rng.Int63n(int64(2*seaJitter))) - seaJitter)
+		}
+		sort.SliceStable(shard, func(a, b int) bool {
+			return at[shard[a].ID].After(at[shard[b].ID])
+		})
+	}
+	size := 0
+	for n, molt := range shard {
+		av, err := attributevalue.Marshal(molt)
+		if err != nil {
+			return nil, fmt.Errorf("Marshal: %w", err)
+		}
+		size += itemSize(av)
+		if size > maxShardBytes {
+			return shard[:n], nil
+		}
+	}
+	return shard, nil
+}
+
+// itemSize estimates how much of an item av takes up, erring high: DynamoDB
+// counts the bytes of names and strings, up to 21 for a number and a few
+// for each list or map.
+func itemSize(av types.AttributeValue) int {
+	switch v := av.(type) {
+	case *types.AttributeValueMemberS:
+		return len(v.Value)
+	case *types.AttributeValueMemberN:
+		return 21
+	case *types.AttributeValueMemberB:
+		return len(v.Value)
+	case *types.AttributeValueMemberSS:
+		n := 0
+		for _, s := range v.Value {
+			n += len(s)
+		}
+		return n
+	case *types.AttributeValueMemberNS:
+		return 21 * len(v.Value)
+	case *types.AttributeValueMemberL:
+		n := 3
+		for _, e := range v.Value {
+			n += 1 + itemSize(e)
+		}
+		return n
+	case *types.AttributeValueMemberM:
+		n := 3
+		for k, e := range v.Value {
+			n += 1 + len(k) + itemSize(e)
+		}
+		return n
+	}
+	return 1
+}
@@ -0,0 +1,143 @@
+package sqldb
+
+import (
+	"encoding/json"
+	"fmt"
+
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+	"krabber.net/internal/models/expr"
+)
+
+// value is the JSON form of an attribute value, the same typed layout the
+// DynamoDB API uses on the wire ({"S": "..."}, {"N": "1"}, ...). Pointers
+// keep empty lists, maps and binaries apart from absent ones.
+type value struct {
+	S    *string           `json:"S,omitempty"`
+	N    *string           `json:"N,omitempty"`
+	B    *[]byte           `json:"B,omitempty"`
+	BOOL *bool             `json:"BOOL,omitempty"`
+	NULL *bool             `json:"NULL,omitempty"`
+	SS   []string          `json:"SS,omitempty"`
+	NS   []string          `json:"NS,omitempty"`
+	BS   [][]byte          `json:"BS,omitempty"`
+	L    *[]value          `json:"L,omitempty"`
+	M    *map[string]value `json:"M,omitempty"`
+}
+
+func toValue(av types.AttributeValue) (value, error) {
+	switch t := av.(type) {
+	case *types.AttributeValueMemberS:
+		return value{S: &t.Value}, nil
+	case *types.AttributeValueMemberN:
+		return value{N: &t.Value}, nil
+	case *types.AttributeValueMemberB:
+		return value{B: &t.Value}, nil
+	case *types.AttributeValueMemberBOOL:
+		return value{BOOL: &t.Value}, nil
+	case *types.AttributeValueMemberNULL:
+		return value{NULL: &t.Value}, nil
+	case *types.AttributeValueMemberSS:
+		return value{SS: t.Value}, nil
+	case *types.AttributeValueMemberNS:
+		return value{NS: t.Value}, nil
+	case *types.AttributeValueMemberBS:
+		return value{BS: t.Value}, nil
+	case *types.AttributeValueMemberL:
+		l := make([]value, len(t.Value))
+		for i, e := range t.Value {
+			v, err := toValue(e)
+			if err != nil {
+				return value{}, err
+			}
+			l[i] = v
+		}
+		return value{L: &l}, nil
+	case *types.AttributeValueMemberM:
+		m, err := toValues(t.Value)
+		if err != nil {
+			return value{}, err
+		}
+		return value{M: &m}, nil
+	}
+	return value{}, fmt.Errorf("sqldb: unsupported attribute value %T", av)
+}
+
+func toValues(item expr.Item) (map[string]value, error) {
+	out := make(map[string]value, len(item))
+	for k, av := range item {
+		v, err := toValue(av)
+		if err != nil {
+			return nil, err
+		}
+		out[k] = v
+	}
+	return out, nil
+}
+
+func (v value) attribute() (types.AttributeValue, error) {
+	switch {
+	case v.S != nil:
+		return &types.AttributeValueMemberS{Value: *v.S}, nil
+	case v.N != nil:
+		return &types.AttributeValueMemberN{Value: *v.N}, nil
+	case v.B != nil:
+		return &types.AttributeValueMemberB{Value: *v.B}, nil
+	case v.BOOL != nil:
+		return &types.AttributeValueMemberBOOL{Value: *v.BOOL}, nil
+	case v.NULL != nil:
+		return &types.AttributeValueMemberNULL{Value: *v.NULL}, nil
+	case v.SS != nil:
+		return &types.AttributeValueMemberSS{Value: v.SS}, nil
+	case v.NS != nil:
+		return &types.AttributeValueMemberNS{Value: v.NS}, nil
+	case v.BS != nil:
+		return &types.AttributeValueMemberBS{Value: v.BS}, nil
+	case v.L != nil:
+		l := make([]types.AttributeValue, len(*v.L))
+		for i, e := range *v.L {
+			av, err := e.attribute()
+			if err != nil {
+				return nil, err
+			}
+			l[i] = av
+		}
+		return &types.AttributeValueMemberL{Value: l}, nil
+	case v.M != nil:
+		m, err := fromValues(*v.M)
+		if err != nil {
+			return nil, err
+		}
+		return &types.AttributeValueMemberM{Value: m}, nil
+	}
+	return nil, fmt.Errorf("sqldb: empty attribute value")
+}
+
+func fromValues(values map[string]value) (expr.Item, error) {
+	item := make(expr.Item, len(values))
+	for k, v := range values {
+		av, err := v.attribute()
+		if err != nil {
+			return nil, err
+		}
+		item[k] = av
+	}
+	return item, nil
+}
+
+// encode serializes an item for the items.item column.
+func encode(item expr.Item) ([]byte, error) {
+	values, err := toValues(item)
+	if err != nil {
+		return nil, err
+	}
+	return json.Marshal(values)
+}
+
+// decode is the inverse of encode.
+func decode(data []byte) (expr.Item, error) {
+	var values map[string]value
+	if err := json.Unmarshal(data, &values); err != nil {
+		return nil, err
+	}
+	return fromValues(values)
+}
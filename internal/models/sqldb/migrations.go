@@ -0,0 +1,70 @@
+package sqldb
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+)
+
+// migrations are applied in order and recorded in schema_migrations. Only
+// ever append to this list: a migration that has shipped must not change.
+var migrations = []string{
+	// 1: items keep the whole item as JSON under its primary key, with
+	// when it expires for the sweep, and item_indexes holds one row per GSI
+	// an item is projected into. Index reads are ordered on the item's key
+	// after the index key, so the index covers that too and a page is read
+	// without sorting.
+	`CREATE TABLE items (
+		tbl     TEXT NOT NULL,
+		pk      TEXT NOT NULL,
+		sk      TEXT NOT NULL,
+		item    TEXT NOT NULL,
+		expires INTEGER,
+		PRIMARY KEY (tbl, pk, sk)
+	);
+	CREATE INDEX items_expires ON items (expires) WHERE expires IS NOT NULL;
+	CREATE TABLE item_indexes (
+		tbl        TEXT NOT NULL,
+		index_name TEXT NOT NULL,
+		pk         TEXT NOT NULL,
+		sk         TEXT NOT NULL,
+		item_pk    TEXT NOT NULL,
+		item_sk    TEXT NOT NULL,
+		PRIMARY KEY (tbl, index_name, item_pk, item_sk)
+	);
+	CREATE INDEX item_indexes_key ON item_indexes (tbl, index_name, pk, sk, item_pk, item_sk);`,
+}
+
+// migrate brings the schema up to date.
+func migrate(ctx context.Context, db *sql.DB) error {
+	_, err := db.ExecContext(ctx, `CREATE TABLE IF NOT EXISTS schema_migrations (
+		version    INTEGER PRIMARY KEY,
+		applied_at TEXT NOT NULL DEFAULT CURRENT_TIMESTAMP
+	)`)
+	if err != nil {
+		return err
+	}
+	var current int
+	err = db.QueryRowContext(ctx, `SELECT COALESCE(MAX(version), 0) FROM schema_migrations`).Scan(&current)
+	if err != nil {
+		return err
+	}
+	for i := current; i < len(migrations); i++ {
+		tx, err := db.BeginTx(ctx, nil)
+		if err != nil {
+			return err
+		}
+		if _, err := tx.ExecContext(ctx, migrations[i]); err != nil {
+			tx.Rollback()
+			return fmt.Errorf("sqldb: migration %d: %w", i+1, err)
+		}
+		if _, err := tx.ExecContext(ctx, `INSERT INTO schema_migrations (version) VALUES (?)`, i+1); err != nil {
+			tx.Rollback()
+			return err
+		}
+		if err := tx.Commit(); err != nil {
+			return err
+		}
+	}
+	return nil
+}
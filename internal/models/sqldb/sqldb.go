@@ -0,0 +1,396 @@
+// Package sqldb is a models.ItemStore backed by an embedded SQLite database,
+// for small deployments that don't want to pay for DynamoDB. Items are stored
+// whole under their primary key and every GSI an item belongs to gets a row
+// in item_indexes, so the single-table access patterns work unchanged:
+// queries read the key range, in order and no further than the page, from
+// SQLite and the expr package applies the filter and paging.
+//
+// It is a driver for the single table, not a relational schema: there are no
+// per-model tables, and everything the models know about items stays in the
+// models.
+package sqldb
+
+import (
+	"context"
+	"database/sql"
+	"strings"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+	"krabber.net/internal/models/expr"
+	_ "modernc.org/sqlite"
+)
+
+// Table is an ItemStore over a SQLite database.
+type Table struct {
+	db *sql.DB
+}
+
+// Open opens (creating if needed) the database at dsn, for example
+// "file:krabber.db", and applies any pending migrations.
+func Open(dsn string) (*Table, error) {
+	db, err := sql.Open("sqlite", dsn)
+	if err != nil {
+		return nil, err
+	}
+	// SQLite allows a single writer. One connection serializes every
+	// statement, which is what makes the read-check-write of conditional
+	// writes and transactions atomic.
+	db.SetMaxOpenConns(1)
+	ctx := context.Background()
+	for _, pragma := range []string{"PRAGMA journal_mode = WAL", "PRAGMA busy_timeout = 5000"} {
+		if _, err := db.ExecContext(ctx, pragma); err != nil {
+			db.Close()
+			return nil, err
+		}
+	}
+	if err := migrate(ctx, db); err != nil {
+		db.Close()
+		return nil, err
+	}
+	return &Table{db: db}, nil
+}
+
+// Close closes the database.
+func (t *Table) Close() error {
+	return t.db.Close()
+}
+
+// queryer is satisfied by *sql.DB and *sql.Tx.
+type queryer interface {
+	QueryContext(ctx context.Context, query string, args ...any) (*sql.Rows, error)
+	QueryRowContext(ctx context.Context, query string, args ...any) *sql.Row
+}
+
+func load(ctx context.Context, q queryer, table, pk, sk string) (expr.Item, error) {
+	var data []byte
+	err := q.QueryRowContext(ctx, `SELECT item FROM items WHERE tbl = ? AND pk = ? AND sk = ?`, table, pk, sk).Scan(&data)
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return decode(data)
+}
+
+func loadAll(ctx context.Context, q queryer, query string, args ...any) ([]expr.Item, error) {
+	rows, err := q.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []expr.Item
+	for rows.Next() {
+		var data []byte
+		if err := rows.Scan(&data); err != nil {
+			return nil, err
+		}
+		item, err := decode(data)
+		if err != nil {
+			return nil, err
+		}
+		items = append(items, item)
+	}
+	return items, rows.Err()
+}
+
+// indexes lists the GSIs an item is projected into: every GSInPK/GSInSK pair
+// it carries.
+func indexes(item expr.Item) []string {
+	var out []string
+	for name := range item {
+		if !strings.HasPrefix(name, "GSI") || !strings.HasSuffix(name, "PK") {
+			continue
+		}
+		index := strings.TrimSuffix(name, "PK")
+		if _, _, ok := expr.IndexKey(item, index); ok {
+			out = append(out, index)
+		}
+	}
+	return out
+}
+
+// write plans writes inside a transaction and persists them if plan succeeds.
+func (t *Table) write(ctx context.Context, plan func(expr.Getter) ([]expr.Write, error)) ([]expr.Write, error) {
+	tx, err := t.db.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+	get := func(table, pk, sk string) (expr.Item, error) {
+		return load(ctx, tx, table, pk, sk)
+	}
+	writes, err := plan(get)
+	if err != nil {
+		return nil, err
+	}
+	for _, w := range writes {
+		if _, err := tx.ExecContext(ctx, `DELETE FROM item_indexes WHERE tbl = ? AND item_pk = ? AND item_sk = ?`, w.Table, w.PK, w.SK); err != nil {
+			return nil, err
+		}
+		if w.New == nil {
+			if _, err := tx.ExecContext(ctx, `DELETE FROM items WHERE tbl = ? AND pk = ? AND sk = ?`, w.Table, w.PK, w.SK); err != nil {
+				return nil, err
+			}
+			continue
+		}
+		data, err := encode(w.New)
+		if err != nil {
+			return nil, err
+		}
+		var expires sql.NullInt64
+		expires.Int64, expires.Valid = expr.Expiry(w.New)
+		_, err = tx.ExecContext(ctx, `INSERT INTO items (tbl, pk, sk, item, expires) VALUES (?, ?, ?, ?, ?)
+			ON CONFLICT (tbl, pk, sk) DO UPDATE SET item = excluded.item, expires = excluded.expires`, w.Table, w.PK, w.SK, data, expires)
+		if err != nil {
+			return nil, err
+		}
+		for _, index := range indexes(w.New) {
+			ipk, isk, _ := expr.IndexKey(w.New, index)
+			_, err := tx.ExecContext(ctx, `INSERT INTO item_indexes (tbl, index_name, pk, sk, item_pk, item_sk) VALUES (?, ?, ?, ?, ?, ?)`,
+				w.Table, index, ipk, isk, w.PK, w.SK)
+			if err != nil {
+				return nil, err
+			}
+		}
+	}
+	return writes, tx.Commit()
+}
+
+// Sweep deletes every item whose ttl has passed by now, as DynamoDB's time
+// to live does in the background, and returns how many it deleted.
+func (t *Table) Sweep(ctx context.Context, now time.Time) (int, error) {
+	tx, err := t.db.BeginTx(ctx, nil)
+	if err != nil {
+		return 0, err
+	}
+	defer tx.Rollback()
+	_, err = tx.ExecContext(ctx, `DELETE FROM item_indexes WHERE (tbl, item_pk, item_sk) IN
+		(SELECT tbl, pk, sk FROM items WHERE expires <= ?)`, now.Unix())
+	if err != nil {
+		return 0, err
+	}
+	res, err := tx.ExecContext(ctx, `DELETE FROM items WHERE expires <= ?`, now.Unix())
+	if err != nil {
+		return 0, err
+	}
+	n, err := res.RowsAffected()
+	if err != nil {
+		return 0, err
+	}
+	return int(n), tx.Commit()
+}
+
+func (t *Table) GetItem(ctx context.Context, in *dynamodb.GetItemInput, _ ...func(*dynamodb.Options)) (*dynamodb.GetItemOutput, error) {
+	pk, sk, err := expr.Key(in.Key)
+	if err != nil {
+		return nil, err
+	}
+	item, err := load(ctx, t.db, aws.ToString(in.TableName), pk, sk)
+	if err != nil {
+		return nil, err
+	}
+	item, err = expr.Project(item, in.ProjectionExpression, in.ExpressionAttributeNames)
+	if err != nil {
+		return nil, err
+	}
+	return &dynamodb.GetItemOutput{Item: item}, nil
+}
+
+// BatchGetItem reads every key asked for; nothing is ever left unprocessed.
+func (t *Table) BatchGetItem(ctx context.Context, in *dynamodb.BatchGetItemInput, _ ...func(*dynamodb.Options)) (*dynamodb.BatchGetItemOutput, error) {
+	out := &dynamodb.BatchGetItemOutput{Responses: map[string][]expr.Item{}}
+	for table, ka := range in.RequestItems {
+		items := make([]expr.Item, 0, len(ka.Keys))
+		for _, k := range ka.Keys {
+			pk, sk, err := expr.Key(k)
+			if err != nil {
+				return nil, err
+			}
+			item, err := load(ctx, t.db, table, pk, sk)
+			if err != nil {
+				return nil, err
+			}
+			if item == nil {
+				continue
+			}
+			item, err = expr.Project(item, ka.ProjectionExpression, ka.ExpressionAttributeNames)
+			if err != nil {
+				return nil, err
+			}
+			items = append(items, item)
+		}
+		out.Responses[table] = items
+	}
+	return out, nil
+}
+
+func (t *Table) PutItem(ctx context.Context, in *dynamodb.PutItemInput, _ ...func(*dynamodb.Options)) (*dynamodb.PutItemOutput, error) {
+	writes, err := t.write(ctx, func(get expr.Getter) ([]expr.Write, error) {
+		w, err := expr.PlanPut(get, in)
+		return []expr.Write{w}, err
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &dynamodb.PutItemOutput{Attributes: expr.ReturnValues(writes[0], in.ReturnValues)}, nil
+}
+
+func (t *Table) UpdateItem(ctx context.Context, in *dynamodb.UpdateItemInput, _ ...func(*dynamodb.Options)) (*dynamodb.UpdateItemOutput, error) {
+	writes, err := t.write(ctx, func(get expr.Getter) ([]expr.Write, error) {
+		w, err := expr.PlanUpdate(get, in)
+		return []expr.Write{w}, err
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &dynamodb.UpdateItemOutput{Attributes: expr.ReturnValues(writes[0], in.ReturnValues)}, nil
+}
+
+func (t *Table) DeleteItem(ctx context.Context, in *dynamodb.DeleteItemInput, _ ...func(*dynamodb.Options)) (*dynamodb.DeleteItemOutput, error) {
+	writes, err := t.write(ctx, func(get expr.Getter) ([]expr.Write, error) {
+		w, err := expr.PlanDelete(get, in)
+		return []expr.Write{w}, err
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &dynamodb.DeleteItemOutput{Attributes: expr.ReturnValues(writes[0], in.ReturnValues)}, nil
+}
+
+func (t *Table) TransactWriteItems(ctx context.Context, in *dynamodb.TransactWriteItemsInput, _ ...func(*dynamodb.Options)) (*dynamodb.TransactWriteItemsOutput, error) {
+	_, err := t.write(ctx, func(get expr.Getter) ([]expr.Write, error) {
+		return expr.PlanTransaction(get, in)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &dynamodb.TransactWriteItemsOutput{}, nil
+}
+
+func (t *Table) BatchWriteItem(ctx context.Context, in *dynamodb.BatchWriteItemInput, _ ...func(*dynamodb.Options)) (*dynamodb.BatchWriteItemOutput, error) {
+	_, err := t.write(ctx, func(get expr.Getter) ([]expr.Write, error) {
+		return expr.PlanBatch(get, in)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &dynamodb.BatchWriteItemOutput{}, nil
+}
+
+func (t *Table) Query(ctx context.Context, in *dynamodb.QueryInput, _ ...func(*dynamodb.Options)) (*dynamodb.QueryOutput, error) {
+	partition, err := expr.Partition(in)
+	if err != nil {
+		return nil, err
+	}
+	op, args, err := expr.SortCondition(in)
+	if err != nil {
+		return nil, err
+	}
+	index := aws.ToString(in.IndexName)
+	r := newRange(aws.ToString(in.TableName), index)
+	r.where(r.cols[0]+" = ?", partition)
+	sk := r.cols[1]
+	switch op {
+	case "=", "<", "<=", ">", ">=":
+		r.where(sk+" "+op+" ?", args[0])
+	case "BETWEEN":
+		r.where(sk+" BETWEEN ? AND ?", args[0], args[1])
+	case "begins_with":
+		// 0xff never appears in UTF-8, so every key with the prefix sorts
+		// below the prefix followed by it
+		r.where(sk+" >= ? AND "+sk+" < ?", args[0], args[0]+"\xff")
+	}
+	candidates, err := r.load(ctx, t.db, in.ExclusiveStartKey, in.ScanIndexForward == nil || *in.ScanIndexForward, in.Limit)
+	if err != nil {
+		return nil, err
+	}
+	return expr.QueryPage(candidates, in)
+}
+
+func (t *Table) Scan(ctx context.Context, in *dynamodb.ScanInput, _ ...func(*dynamodb.Options)) (*dynamodb.ScanOutput, error) {
+	r := newRange(aws.ToString(in.TableName), aws.ToString(in.IndexName))
+	candidates, err := r.load(ctx, t.db, in.ExclusiveStartKey, true, in.Limit)
+	if err != nil {
+		return nil, err
+	}
+	return expr.ScanPage(candidates, in)
+}
+
+// itemRange reads a stretch of the table or one of its indexes in the order
+// the index keeps it, so SQLite does the seeking and the expr package only
+// sees the rows a page can use.
+type itemRange struct {
+	index string
+	from  string
+	// cols are the columns items sort on: partition key, sort key and,
+	// in an index, the primary key to break ties.
+	cols  []string
+	conds []string
+	args  []any
+}
+
+func newRange(table, index string) *itemRange {
+	if index == "" {
+		return &itemRange{
+			from:  `items i`,
+			cols:  []string{"i.pk", "i.sk"},
+			conds: []string{"i.tbl = ?"},
+			args:  []any{table},
+		}
+	}
+	return &itemRange{
+		index: index,
+		from:  `item_indexes x JOIN items i ON i.tbl = x.tbl AND i.pk = x.item_pk AND i.sk = x.item_sk`,
+		cols:  []string{"x.pk", "x.sk", "x.item_pk", "x.item_sk"},
+		conds: []string{"x.tbl = ?", "x.index_name = ?"},
+		args:  []any{table, index},
+	}
+}
+
+func (r *itemRange) where(cond string, args ...any) {
+	r.conds = append(r.conds, cond)
+	r.args = append(r.args, args...)
+}
+
+// load reads the items after startKey in the direction asked. With a limit
+// it reads one more than that, so the page knows whether any are left.
+func (r *itemRange) load(ctx context.Context, q queryer, startKey expr.Item, forward bool, limit *int32) ([]expr.Item, error) {
+	dir, after := "ASC", ">"
+	if !forward {
+		dir, after = "DESC", "<"
+	}
+	if start, ok := r.position(startKey); ok {
+		r.where("("+strings.Join(r.cols, ", ")+") "+after+" ("+strings.Repeat("?, ", len(start)-1)+"?)", start...)
+	}
+	order := make([]string, len(r.cols))
+	for i, col := range r.cols {
+		order[i] = col + " " + dir
+	}
+	query := "SELECT i.item FROM " + r.from + " WHERE " + strings.Join(r.conds, " AND ") + " ORDER BY " + strings.Join(order, ", ")
+	args := r.args
+	if limit != nil {
+		query += " LIMIT ?"
+		args = append(args, int64(*limit)+1)
+	}
+	return loadAll(ctx, q, query, args...)
+}
+
+// position is where key sits in the range's ordering, false if it doesn't
+// carry the attributes to place it.
+func (r *itemRange) position(key expr.Item) ([]any, bool) {
+	if key == nil {
+		return nil, false
+	}
+	pk, sk, err := expr.Key(key)
+	if err != nil {
+		return nil, false
+	}
+	if r.index == "" {
+		return []any{pk, sk}, true
+	}
+	ipk, isk, ok := expr.IndexKey(key, r.index)
+	return []any{ipk, isk, pk, sk}, ok
+}
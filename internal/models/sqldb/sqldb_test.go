@@ -0,0 +1,18 @@
+package sqldb
+
+import (
+	"testing"
+
+	"krabber.net/internal/models/storetest"
+)
+
+func TestConformance(t *testing.T) {
+	storetest.Run(t, func(t *testing.T) storetest.Store {
+		db, err := Open("file::memory:")
+		if err != nil {
+			t.Fatal(err)
+		}
+		t.Cleanup(func() { db.Close() })
+		return db
+	})
+}
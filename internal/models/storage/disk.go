@@ -0,0 +1,107 @@
+package storage
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io/fs"
+	"net/http"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+)
+
+// Disk keeps files in a directory, for running without an AWS account. It
+// serves them itself, so it has to be mounted at Prefix.
+type Disk struct {
+	Dir    string
+	Prefix string // e.g. "/media"
+}
+
+// NewDisk stores files under dir, creating it if need be, and serves them
+// under prefix.
+func NewDisk(dir, prefix string) (*Disk, error) {
+	err := os.MkdirAll(dir, 0o755)
+	if err != nil {
+		return nil, fmt.Errorf("MkdirAll: %w", err)
+	}
+	return &Disk{Dir: dir, Prefix: strings.TrimSuffix(prefix, "/")}, nil
+}
+
+// path turns key into a file name inside Dir.
+func (d *Disk) path(key string) (string, error) {
+	clean := path.Clean("/" + key)
+	if clean == "/" || clean != "/"+key {
+		return "", ErrBadKey
+	}
+	return filepath.Join(d.Dir, filepath.FromSlash(clean)), nil
+}
+
+func (d *Disk) Put(ctx context.Context, key, contentType string, body []byte) error {
+	name, err := d.path(key)
+	if err != nil {
+		return err
+	}
+	err = os.MkdirAll(filepath.Dir(name), 0o755)
+	if err != nil {
+		return fmt.Errorf("MkdirAll: %w", err)
+	}
+	// write next to it and rename so nobody is served half a file
+	tmp, err := os.CreateTemp(filepath.Dir(name), ".put-*")
+	if err != nil {
+		return fmt.Errorf("CreateTemp: %w", err)
+	}
+	defer os.Remove(tmp.Name())
+	_, err = tmp.Write(body)
+	if cerr := tmp.Close(); err == nil {
+		err = cerr
+	}
+	if err != nil {
+		return fmt.Errorf("Write: %w", err)
+	}
+	err = os.Chmod(tmp.Name(), 0o644)
+	if err != nil {
+		return fmt.Errorf("Chmod: %w", err)
+	}
+	err = os.Rename(tmp.Name(), name)
+	if err != nil {
+		return fmt.Errorf("Rename: %w", err)
+	}
+	return nil
+}
+
+func (d *Disk) Delete(ctx context.Context, key string) error {
+	name, err := d.path(key)
+	if err != nil {
+		return err
+	}
+	err = os.Remove(name)
+	if err != nil && !errors.Is(err, fs.ErrNotExist) {
+		return fmt.Errorf("Remove: %w", err)
+	}
+	return nil
+}
+
+func (d *Disk) URL(key string) string {
+	return d.Prefix + "/" + key
+}
+
+// ServeHTTP serves the file named by the request path, which is the key
+// once Prefix has been stripped. Directories aren't listed.
+func (d *Disk) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	name, err := d.path(strings.TrimPrefix(r.URL.Path, "/"))
+	if err != nil {
+		http.NotFound(w, r)
+		return
+	}
+	info, err := os.Stat(name)
+	if err != nil || info.IsDir() || strings.HasPrefix(info.Name(), ".") {
+		http.NotFound(w, r)
+		return
+	}
+	w.Header().Set("Cache-Control", "public, max-age=31536000, immutable")
+	// uploads come from crabs, so nothing in them gets to run on our origin
+	w.Header().Set("Content-Security-Policy", "default-src 'none'; sandbox")
+	http.ServeFile(w, r, name)
+}
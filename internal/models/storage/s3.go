@@ -0,0 +1,116 @@
+package storage
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"github.com/aws/aws-sdk-go-v2/aws"
+	v4 "github.com/aws/aws-sdk-go-v2/aws/signer/v4"
+	"github.com/aws/aws-sdk-go-v2/config"
+	"github.com/aws/aws-sdk-go-v2/credentials"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	"github.com/aws/aws-sdk-go-v2/service/s3/types"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// S3 keeps files in an S3 bucket. Either the bucket lets anyone read it, or
+// Expiry is set and browsers get presigned URLs that stop working after it.
+type S3 struct {
+	client    *s3.Client
+	presigner *s3.PresignClient
+	bucket    string
+	// BaseURL is what keys are appended to for their URL. It defaults to
+	// the bucket's own address but can point at a CDN in front of it. It
+	// isn't used for presigned URLs, which go to the bucket.
+	BaseURL string
+	// Expiry is how long presigned URLs last. Zero means the bucket is
+	// public and URLs aren't signed.
+	Expiry time.Duration
+}
+
+// NewS3 connects to bucket with the given credentials.
+func NewS3(region, akid, sac, bucket string) (*S3, error) {
+	cfg, err := config.LoadDefaultConfig(context.TODO(),
+		config.WithRegion(region),
+		config.WithCredentialsProvider(credentials.StaticCredentialsProvider{
+			Value: aws.Credentials{
+				AccessKeyID:     akid,
+				SecretAccessKey: sac,
+			},
+		}),
+	)
+	if err != nil {
+		return nil, fmt.Errorf("LoadDefaultConfig: %w", err)
+	}
+	client := s3.NewFromConfig(cfg)
+	return &S3{
+		client:    client,
+		presigner: s3.NewPresignClient(client),
+		bucket:    bucket,
+		BaseURL:   fmt.Sprintf("https://%s.s3.%s.amazonaws.com", bucket, region),
+	}, nil
+}
+
+func (s *S3) Put(ctx context.Context, key, contentType string, body []byte) error {
+	_, err := s.client.PutObject(ctx, &s3.PutObjectInput{
+		Bucket:               aws.String(s.bucket),
+		Key:                  aws.String(key),
+		Body:                 bytes.NewReader(body),
+		ContentLength:        aws.Int64(int64(len(body))),
+		ContentType:          aws.String(contentType),
+		CacheControl:         aws.String("public, max-age=31536000, immutable"), // keys are never reused
+		ServerSideEncryption: types.ServerSideEncryptionAes256,
+		StorageClass:         types.StorageClassIntelligentTiering,
+	})
+	if err != nil {
+		return fmt.Errorf("PutObject: %w", err)
+	}
+	return nil
+}
+
+func (s *S3) Delete(ctx context.Context, key string) error {
+	_, err := s.client.DeleteObject(ctx, &s3.DeleteObjectInput{
+		Bucket: aws.String(s.bucket),
+		Key:    aws.String(key),
+	})
+	if err != nil {
+		return fmt.Errorf("DeleteObject: %w", err)
+	}
+	return nil
+}
+
+func (s *S3) URL(key string) string {
+	if s.Expiry <= 0 {
+		return strings.TrimSuffix(s.BaseURL, "/") + "/" + key
+	}
+	return s.presign(key, time.Now())
+}
+
+// presign signs a GET of key. The signing time is rounded down to half of
+// Expiry, so a page shows the same URLs, which browsers can cache, for a
+// while, and each still has at least half of Expiry left when handed out.
+func (s *S3) presign(key string, now time.Time) string {
+	req, err := s.presigner.PresignGetObject(context.Background(), &s3.GetObjectInput{
+		Bucket: aws.String(s.bucket),
+		Key:    aws.String(key),
+	}, func(o *s3.PresignOptions) {
+		o.Expires = s.Expiry
+		o.Presigner = signedAt{o.Presigner, now.Truncate(s.Expiry / 2)}
+	})
+	if err != nil {
+		return ""
+	}
+	return req.URL
+}
+
+// signedAt presigns as if it were at, rather than when it is asked to.
+type signedAt struct {
+	s3.HTTPPresignerV4
+	at time.Time
+}
+
+func (p signedAt) PresignHTTP(ctx context.Context, credentials aws.Credentials, r *http.Request, payloadHash, service, region string, _ time.Time, optFns ...func(*v4.SignerOptions)) (string, http.Header, error) {
+	return p.HTTPPresignerV4.PresignHTTP(ctx, credentials, r, payloadHash, service, region, p.at, optFns...)
+}
@@ -0,0 +1,22 @@
+// Package storage keeps the files crabs upload, such as the images attached
+// to molts, somewhere the browser can load them from.
+package storage
+
+import (
+	"context"
+	"errors"
+)
+
+// ErrBadKey is returned for keys that would land outside the store.
+var ErrBadKey = errors.New("storage: bad key")
+
+// Store is somewhere uploaded files live. Keys are slash separated paths
+// like "m/crabID/name.jpg".
+type Store interface {
+	// Put stores body under key, replacing whatever was there.
+	Put(ctx context.Context, key, contentType string, body []byte) error
+	// Delete removes key. Deleting a key that isn't there is not an error.
+	Delete(ctx context.Context, key string) error
+	// URL is where a browser can load key from.
+	URL(key string) string
+}
@@ -0,0 +1,608 @@
+// Package storetest checks that an item store behaves like the parts of
+// DynamoDB the models rely on. Each backend runs the same suite from its own
+// tests, so memdb and sqldb can't drift apart from each other or from the
+// real table.
+package storetest
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+)
+
+// Store is the item store under test, the same methods as models.ItemStore.
+type Store interface {
+	GetItem(ctx context.Context, params *dynamodb.GetItemInput, optFns ...func(*dynamodb.Options)) (*dynamodb.GetItemOutput, error)
+	BatchGetItem(ctx context.Context, params *dynamodb.BatchGetItemInput, optFns ...func(*dynamodb.Options)) (*dynamodb.BatchGetItemOutput, error)
+	PutItem(ctx context.Context, params *dynamodb.PutItemInput, optFns ...func(*dynamodb.Options)) (*dynamodb.PutItemOutput, error)
+	UpdateItem(ctx context.Context, params *dynamodb.UpdateItemInput, optFns ...func(*dynamodb.Options)) (*dynamodb.UpdateItemOutput, error)
+	DeleteItem(ctx context.Context, params *dynamodb.DeleteItemInput, optFns ...func(*dynamodb.Options)) (*dynamodb.DeleteItemOutput, error)
+	Query(ctx context.Context, params *dynamodb.QueryInput, optFns ...func(*dynamodb.Options)) (*dynamodb.QueryOutput, error)
+	Scan(ctx context.Context, params *dynamodb.ScanInput, optFns ...func(*dynamodb.Options)) (*dynamodb.ScanOutput, error)
+	TransactWriteItems(ctx context.Context, params *dynamodb.TransactWriteItemsInput, optFns ...func(*dynamodb.Options)) (*dynamodb.TransactWriteItemsOutput, error)
+	BatchWriteItem(ctx context.Context, params *dynamodb.BatchWriteItemInput, optFns ...func(*dynamodb.Options)) (*dynamodb.BatchWriteItemOutput, error)
+	// Sweep deletes the items whose ttl has passed, which DynamoDB does on
+	// its own.
+	Sweep(ctx context.Context, now time.Time) (int, error)
+}
+
+const table = "krabber_test"
+
+type item = map[string]types.AttributeValue
+
+func s(v string) types.AttributeValue { return &types.AttributeValueMemberS{Value: v} }
+func n(v string) types.AttributeValue { return &types.AttributeValueMemberN{Value: v} }
+
+func key(pk, sk string) item { return item{"PK": s(pk), "SK": s(sk)} }
+
+// Run runs the suite, opening a fresh, empty store for every test.
+func Run(t *testing.T, open func(t *testing.T) Store) {
+	tests := []struct {
+		name string
+		run  func(t *testing.T, store Store)
+	}{
+		{"ConditionalPut", conditionalPut},
+		{"ConditionalUpdate", conditionalUpdate},
+		{"ConditionalDelete", conditionalDelete},
+		{"Query", query},
+		{"QueryIndex", queryIndex},
+		{"QueryPages", queryPages},
+		{"ScanPages", scanPages},
+		{"Transaction", transaction},
+		{"TransactionCancelled", transactionCancelled},
+		{"TransactionInvalid", transactionInvalid},
+		{"BatchGet", batchGet},
+		{"BatchWrite", batchWrite},
+		{"Sweep", sweep},
+	}
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			tt.run(t, open(t))
+		})
+	}
+}
+
+func put(t *testing.T, store Store, it item) {
+	t.Helper()
+	_, err := store.PutItem(context.Background(), &dynamodb.PutItemInput{TableName: aws.String(table), Item: it})
+	if err != nil {
+		t.Fatalf("PutItem: %v", err)
+	}
+}
+
+func get(t *testing.T, store Store, pk, sk string) item {
+	t.Helper()
+	out, err := store.GetItem(context.Background(), &dynamodb.GetItemInput{TableName: aws.String(table), Key: key(pk, sk)})
+	if err != nil {
+		t.Fatalf("GetItem: %v", err)
+	}
+	return out.Item
+}
+
+func number(it item, name string) string {
+	v, _ := it[name].(*types.AttributeValueMemberN)
+	if v == nil {
+		return ""
+	}
+	return v.Value
+}
+
+func sortKeys(items []item) string {
+	out := make([]string, 0, len(items))
+	for _, it := range items {
+		v, _ := it["SK"].(*types.AttributeValueMemberS)
+		if v != nil {
+			out = append(out, v.Value)
+		}
+	}
+	return fmt.Sprint(out)
+}
+
+func wantConditionFailed(t *testing.T, err error) {
+	t.Helper()
+	var ccf *types.ConditionalCheckFailedException
+	if !errors.As(err, &ccf) {
+		t.Fatalf("got %v, want a ConditionalCheckFailedException", err)
+	}
+}
+
+func conditionalPut(t *testing.T, store Store) {
+	ctx := context.Background()
+	in := &dynamodb.PutItemInput{
+		TableName:           aws.String(table),
+		Item:                item{"PK": s("C#crab"), "SK": s("C#crab"), "count": n("1")},
+		ConditionExpression: aws.String("attribute_not_exists(PK)"),
+	}
+	if _, err := store.PutItem(ctx, in); err != nil {
+		t.Fatalf("first put: %v", err)
+	}
+	in.Item = item{"PK": s("C#crab"), "SK": s("C#crab"), "count": n("2")}
+	_, err := store.PutItem(ctx, in)
+	wantConditionFailed(t, err)
+	if got := number(get(t, store, "C#crab", "C#crab"), "count"); got != "1" {
+		t.Errorf("a failed put changed the item, count %q", got)
+	}
+
+	in.ConditionExpression = nil
+	in.ReturnValues = types.ReturnValueAllOld
+	out, err := store.PutItem(ctx, in)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if number(out.Attributes, "count") != "1" {
+		t.Errorf("ALL_OLD returned %v", out.Attributes)
+	}
+	if got := number(get(t, store, "C#crab", "C#crab"), "count"); got != "2" {
+		t.Errorf("an unconditional put didn't replace the item, count %q", got)
+	}
+}
+
+func conditionalUpdate(t *testing.T, store Store) {
+	ctx := context.Background()
+	count := func(cond string) (*dynamodb.UpdateItemOutput, error) {
+		in := &dynamodb.UpdateItemInput{
+			TableName:        aws.String(table),
+			Key:              key("C#crab", "C#crab"),
+			UpdateExpression: aws.String("set #count = if_not_exists(#count, :zero) + :one"),
+			ExpressionAttributeNames: map[string]string{
+				"#count": "count",
+			},
+			ExpressionAttributeValues: map[string]types.AttributeValue{
+				":zero": n("0"),
+				":one":  n("1"),
+			},
+			ReturnValues: types.ReturnValueAllNew,
+		}
+		if cond != "" {
+			in.ConditionExpression = aws.String(cond)
+		}
+		return store.UpdateItem(ctx, in)
+	}
+	_, err := count("attribute_exists(PK)")
+	wantConditionFailed(t, err)
+	if it := get(t, store, "C#crab", "C#crab"); it != nil {
+		t.Fatalf("a failed update created %v", it)
+	}
+	// an update without a condition creates the item
+	out, err := count("")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if number(out.Attributes, "count") != "1" {
+		t.Errorf("ALL_NEW returned %v", out.Attributes)
+	}
+	if _, err := count("attribute_exists(PK)"); err != nil {
+		t.Fatal(err)
+	}
+	if got := number(get(t, store, "C#crab", "C#crab"), "count"); got != "2" {
+		t.Errorf("count %q, want 2", got)
+	}
+}
+
+func conditionalDelete(t *testing.T, store Store) {
+	ctx := context.Background()
+	put(t, store, item{"PK": s("L#crab"), "SK": s("L#molt"), "liked": &types.AttributeValueMemberBOOL{Value: true}})
+	in := &dynamodb.DeleteItemInput{
+		TableName:           aws.String(table),
+		Key:                 key("L#crab", "L#molt"),
+		ConditionExpression: aws.String("attribute_exists(PK)"),
+		ReturnValues:        types.ReturnValueAllOld,
+	}
+	out, err := store.DeleteItem(ctx, in)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if out.Attributes["liked"] == nil {
+		t.Errorf("ALL_OLD returned %v", out.Attributes)
+	}
+	if it := get(t, store, "L#crab", "L#molt"); it != nil {
+		t.Fatalf("deleted item still there: %v", it)
+	}
+	_, err = store.DeleteItem(ctx, in)
+	wantConditionFailed(t, err)
+}
+
+// molts puts five molts of one crab, the odd ones also filed on GSI1, and
+// one molt of another crab.
+func molts(t *testing.T, store Store) {
+	for _, i := range []int{3, 1, 4, 0, 2} {
+		it := item{
+			"PK":      s("M#crab"),
+			"SK":      s(fmt.Sprintf("M#crab#%d", i)),
+			"deleted": &types.AttributeValueMemberBOOL{Value: i == 2},
+		}
+		if i%2 == 1 {
+			it["GSI1PK"] = s("G#crab")
+			it["GSI1SK"] = s(fmt.Sprintf("G#%d", 9-i))
+		}
+		put(t, store, it)
+	}
+	put(t, store, item{"PK": s("M#other"), "SK": s("M#other#0"), "GSI1PK": s("G#crab"), "GSI1SK": s("G#9")})
+}
+
+func query(t *testing.T, store Store) {
+	molts(t, store)
+	values := map[string]types.AttributeValue{
+		":pk":      s("M#crab"),
+		":lo":      s("M#crab#1"),
+		":hi":      s("M#crab#3"),
+		":prefix":  s("M#crab#4"),
+		":deleted": &types.AttributeValueMemberBOOL{Value: true},
+	}
+	tests := []struct {
+		name    string
+		cond    string
+		filter  string
+		forward bool
+		want    string
+	}{
+		{name: "partition", cond: "PK = :pk", forward: true, want: "[M#crab#0 M#crab#1 M#crab#2 M#crab#3 M#crab#4]"},
+		{name: "backwards", cond: "PK = :pk", want: "[M#crab#4 M#crab#3 M#crab#2 M#crab#1 M#crab#0]"},
+		{name: "between", cond: "PK = :pk AND SK BETWEEN :lo AND :hi", forward: true, want: "[M#crab#1 M#crab#2 M#crab#3]"},
+		{name: "below", cond: "PK = :pk AND SK < :lo", forward: true, want: "[M#crab#0]"},
+		{name: "begins_with", cond: "PK = :pk AND begins_with(SK, :prefix)", forward: true, want: "[M#crab#4]"},
+		{name: "filtered", cond: "PK = :pk", filter: "deleted <> :deleted", forward: true, want: "[M#crab#0 M#crab#1 M#crab#3 M#crab#4]"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			in := &dynamodb.QueryInput{
+				TableName:                 aws.String(table),
+				KeyConditionExpression:    aws.String(tt.cond),
+				ExpressionAttributeValues: values,
+				ScanIndexForward:          aws.Bool(tt.forward),
+			}
+			if tt.filter != "" {
+				in.FilterExpression = aws.String(tt.filter)
+			}
+			out, err := store.Query(context.Background(), in)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got := sortKeys(out.Items); got != tt.want {
+				t.Errorf("got %s, want %s", got, tt.want)
+			}
+		})
+	}
+}
+
+func queryIndex(t *testing.T, store Store) {
+	molts(t, store)
+	out, err := store.Query(context.Background(), &dynamodb.QueryInput{
+		TableName:              aws.String(table),
+		IndexName:              aws.String("GSI1"),
+		KeyConditionExpression: aws.String("GSI1PK = :g"),
+		ExpressionAttributeValues: map[string]types.AttributeValue{
+			":g": s("G#crab"),
+		},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	// ordered on the index's sort key, and only items that carry it
+	if got, want := sortKeys(out.Items), "[M#crab#3 M#crab#1 M#other#0]"; got != want {
+		t.Errorf("got %s, want %s", got, want)
+	}
+}
+
+// queryPages reads a partition and an index a page at a time, checking every
+// page but the last leaves a key to go on from and nothing is lost or read
+// twice.
+func queryPages(t *testing.T, store Store) {
+	molts(t, store)
+	tests := []struct {
+		name  string
+		index string
+		cond  string
+		value string
+		want  string
+	}{
+		{name: "table", cond: "PK = :v", value: "M#crab", want: "[M#crab#4 M#crab#3 M#crab#2 M#crab#1 M#crab#0]"},
+		{name: "index", index: "GSI1", cond: "GSI1PK = :v", value: "G#crab", want: "[M#other#0 M#crab#1 M#crab#3]"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			in := &dynamodb.QueryInput{
+				TableName:                 aws.String(table),
+				KeyConditionExpression:    aws.String(tt.cond),
+				ExpressionAttributeValues: map[string]types.AttributeValue{":v": s(tt.value)},
+				ScanIndexForward:          aws.Bool(false),
+				Limit:                     aws.Int32(2),
+			}
+			if tt.index != "" {
+				in.IndexName = aws.String(tt.index)
+			}
+			var got []item
+			for pages := 0; ; pages++ {
+				if pages > 5 {
+					t.Fatal("paging doesn't end")
+				}
+				out, err := store.Query(context.Background(), in)
+				if err != nil {
+					t.Fatal(err)
+				}
+				if len(out.Items) > 2 {
+					t.Fatalf("page of %d items with Limit 2", len(out.Items))
+				}
+				got = append(got, out.Items...)
+				if out.LastEvaluatedKey == nil {
+					break
+				}
+				if tt.index != "" && out.LastEvaluatedKey["GSI1SK"] == nil {
+					t.Fatalf("index LastEvaluatedKey %v lacks the index key", out.LastEvaluatedKey)
+				}
+				in.ExclusiveStartKey = out.LastEvaluatedKey
+			}
+			if s := sortKeys(got); s != tt.want {
+				t.Errorf("got %s, want %s", s, tt.want)
+			}
+		})
+	}
+}
+
+func scanPages(t *testing.T, store Store) {
+	molts(t, store)
+	in := &dynamodb.ScanInput{
+		TableName:        aws.String(table),
+		FilterExpression: aws.String("deleted <> :deleted"),
+		ExpressionAttributeValues: map[string]types.AttributeValue{
+			":deleted": &types.AttributeValueMemberBOOL{Value: true},
+		},
+		Limit: aws.Int32(2),
+	}
+	seen := map[string]bool{}
+	for pages := 0; ; pages++ {
+		if pages > 5 {
+			t.Fatal("paging doesn't end")
+		}
+		out, err := store.Scan(context.Background(), in)
+		if err != nil {
+			t.Fatal(err)
+		}
+		for _, it := range out.Items {
+			sk := it["SK"].(*types.AttributeValueMemberS).Value
+			if seen[sk] {
+				t.Fatalf("%s read twice", sk)
+			}
+			seen[sk] = true
+		}
+		if out.LastEvaluatedKey == nil {
+			break
+		}
+		in.ExclusiveStartKey = out.LastEvaluatedKey
+	}
+	if len(seen) != 5 || seen["M#crab#2"] {
+		t.Errorf("scanned %v, want every item but the deleted one", seen)
+	}
+}
+
+func follow(pk string) []types.TransactWriteItem {
+	return []types.TransactWriteItem{
+		{Put: &types.Put{
+			TableName:           aws.String(table),
+			Item:                key("F#"+pk, "F#other"),
+			ConditionExpression: aws.String("attribute_not_exists(PK)"),
+		}},
+		{Update: &types.Update{
+			TableName:           aws.String(table),
+			Key:                 key("C#"+pk, "C#"+pk),
+			UpdateExpression:    aws.String("set following = following + :one"),
+			ConditionExpression: aws.String("attribute_exists(PK)"),
+			ExpressionAttributeValues: map[string]types.AttributeValue{
+				":one": n("1"),
+			},
+		}},
+		{ConditionCheck: &types.ConditionCheck{
+			TableName:           aws.String(table),
+			Key:                 key("C#other", "C#other"),
+			ConditionExpression: aws.String("attribute_exists(PK)"),
+		}},
+	}
+}
+
+func crabs(t *testing.T, store Store) {
+	put(t, store, item{"PK": s("C#crab"), "SK": s("C#crab"), "following": n("0")})
+	put(t, store, item{"PK": s("C#other"), "SK": s("C#other")})
+}
+
+func transaction(t *testing.T, store Store) {
+	crabs(t, store)
+	_, err := store.TransactWriteItems(context.Background(), &dynamodb.TransactWriteItemsInput{TransactItems: follow("crab")})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if get(t, store, "F#crab", "F#other") == nil {
+		t.Error("put not written")
+	}
+	if got := number(get(t, store, "C#crab", "C#crab"), "following"); got != "1" {
+		t.Errorf("following %q, want 1", got)
+	}
+	// the condition check is never written
+	if it := get(t, store, "C#other", "C#other"); len(it) != 2 {
+		t.Errorf("checked item changed: %v", it)
+	}
+}
+
+func transactionCancelled(t *testing.T, store Store) {
+	crabs(t, store)
+	ctx := context.Background()
+	// the follow exists already, so the whole transaction is cancelled
+	put(t, store, key("F#crab", "F#other"))
+	_, err := store.TransactWriteItems(ctx, &dynamodb.TransactWriteItemsInput{TransactItems: follow("crab")})
+	var tce *types.TransactionCanceledException
+	if !errors.As(err, &tce) {
+		t.Fatalf("got %v, want a TransactionCanceledException", err)
+	}
+	codes := make([]string, 0, len(tce.CancellationReasons))
+	for _, r := range tce.CancellationReasons {
+		codes = append(codes, aws.ToString(r.Code))
+	}
+	if got, want := fmt.Sprint(codes), "[ConditionalCheckFailed None None]"; got != want {
+		t.Errorf("reasons %s, want %s", got, want)
+	}
+	if got := number(get(t, store, "C#crab", "C#crab"), "following"); got != "0" {
+		t.Errorf("a cancelled transaction wrote following %q", got)
+	}
+
+	// a missing crab fails the update's condition
+	_, err = store.TransactWriteItems(ctx, &dynamodb.TransactWriteItemsInput{TransactItems: follow("gone")})
+	if !errors.As(err, &tce) {
+		t.Fatalf("got %v, want a TransactionCanceledException", err)
+	}
+	if get(t, store, "F#gone", "F#other") != nil {
+		t.Error("a cancelled transaction wrote its put")
+	}
+}
+
+func transactionInvalid(t *testing.T, store Store) {
+	crabs(t, store)
+	items := follow("crab")
+	items = append(items, types.TransactWriteItem{Delete: &types.Delete{
+		TableName: aws.String(table),
+		Key:       key("F#crab", "F#other"),
+	}})
+	_, err := store.TransactWriteItems(context.Background(), &dynamodb.TransactWriteItemsInput{TransactItems: items})
+	var tce *types.TransactionCanceledException
+	if err == nil || errors.As(err, &tce) {
+		t.Fatalf("got %v, want a validation error for one item written twice", err)
+	}
+	if get(t, store, "F#crab", "F#other") != nil {
+		t.Error("an invalid transaction wrote its put")
+	}
+}
+
+func batchGet(t *testing.T, store Store) {
+	molts(t, store)
+	out, err := store.BatchGetItem(context.Background(), &dynamodb.BatchGetItemInput{
+		RequestItems: map[string]types.KeysAndAttributes{
+			table: {
+				Keys: []map[string]types.AttributeValue{
+					key("M#crab", "M#crab#1"),
+					key("M#crab", "M#crab#9"),
+					key("M#other", "M#other#0"),
+				},
+				ProjectionExpression: aws.String("PK, SK"),
+			},
+		},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	got := out.Responses[table]
+	if len(got) != 2 {
+		t.Fatalf("got %d items, want the 2 that exist", len(got))
+	}
+	for _, it := range got {
+		if len(it) != 2 {
+			t.Errorf("projection not applied: %v", it)
+		}
+	}
+	for _, keys := range out.UnprocessedKeys {
+		if len(keys.Keys) > 0 {
+			t.Errorf("unprocessed keys %v", keys.Keys)
+		}
+	}
+}
+
+func batchWrite(t *testing.T, store Store) {
+	molts(t, store)
+	ctx := context.Background()
+	requests := []types.WriteRequest{
+		{PutRequest: &types.PutRequest{Item: key("T#crab", "T#1")}},
+		{PutRequest: &types.PutRequest{Item: key("T#crab", "T#2")}},
+		{DeleteRequest: &types.DeleteRequest{Key: key("M#crab", "M#crab#0")}},
+		// deleting what isn't there is fine
+		{DeleteRequest: &types.DeleteRequest{Key: key("M#crab", "M#crab#9")}},
+	}
+	_, err := store.BatchWriteItem(ctx, &dynamodb.BatchWriteItemInput{
+		RequestItems: map[string][]types.WriteRequest{table: requests},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if get(t, store, "T#crab", "T#1") == nil || get(t, store, "T#crab", "T#2") == nil {
+		t.Error("batch puts not written")
+	}
+	if get(t, store, "M#crab", "M#crab#0") != nil {
+		t.Error("batch delete not applied")
+	}
+
+	var tooMany []types.WriteRequest
+	for i := 0; i < 26; i++ {
+		tooMany = append(tooMany, types.WriteRequest{PutRequest: &types.PutRequest{Item: key("T#many", fmt.Sprintf("T#%02d", i))}})
+	}
+	_, err = store.BatchWriteItem(ctx, &dynamodb.BatchWriteItemInput{
+		RequestItems: map[string][]types.WriteRequest{table: tooMany},
+	})
+	if err == nil {
+		t.Error("a batch of 26 requests went through")
+	}
+}
+
+// sweep checks only items with a Number ttl that has passed are deleted,
+// from the table and its indexes.
+func sweep(t *testing.T, store Store) {
+	now := time.Unix(1700000000, 0)
+	past, future := fmt.Sprint(now.Unix()-1), fmt.Sprint(now.Unix()+60)
+	expired := key("N#crab", "N#1")
+	expired["ttl"] = n(past)
+	expired["GSI1PK"], expired["GSI1SK"] = s("G#crab"), s("N#1")
+	put(t, store, expired)
+	due := key("N#crab", "N#2")
+	due["ttl"] = n(fmt.Sprint(now.Unix()))
+	put(t, store, due)
+	later := key("N#crab", "N#3")
+	later["ttl"] = n(future)
+	put(t, store, later)
+	text := key("N#crab", "N#4")
+	text["ttl"] = s(past) // DynamoDB ignores a ttl that isn't a Number
+	put(t, store, text)
+	put(t, store, key("N#crab", "N#5"))
+	// an expired item rewritten with a later ttl is kept
+	renewed := key("N#crab", "N#6")
+	renewed["ttl"] = n(past)
+	put(t, store, renewed)
+	renewed["ttl"] = n(future)
+	put(t, store, renewed)
+
+	swept, err := store.Sweep(context.Background(), now)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if swept != 2 {
+		t.Errorf("swept %d items, want 2", swept)
+	}
+	out, err := store.Query(context.Background(), &dynamodb.QueryInput{
+		TableName:              aws.String(table),
+		KeyConditionExpression: aws.String("PK = :pk"),
+		ExpressionAttributeValues: map[string]types.AttributeValue{
+			":pk": s("N#crab"),
+		},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, want := sortKeys(out.Items), "[N#3 N#4 N#5 N#6]"; got != want {
+		t.Errorf("got %s, want %s", got, want)
+	}
+	out, err = store.Query(context.Background(), &dynamodb.QueryInput{
+		TableName:              aws.String(table),
+		IndexName:              aws.String("GSI1"),
+		KeyConditionExpression: aws.String("GSI1PK = :g"),
+		ExpressionAttributeValues: map[string]types.AttributeValue{
+			":g": s("G#crab"),
+		},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(out.Items) != 0 {
+		t.Errorf("the index still has %s", sortKeys(out.Items))
+	}
+}
@@ -0,0 +1,320 @@
+package models
+
+import (
+	"context"
+	"fmt"
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/feature/dynamodb/attributevalue"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+	"sort"
+	"time"
+)
+
+const (
+	// SuggestionSize is how many crabs are kept suggested for each crab.
+	SuggestionSize = 20
+	// newCrabAge is how recently a crab has to have joined to be suggested
+	// for being new.
+	newCrabAge = 30 * 24 * time.Hour
+)
+
+// How much each way of coming across a crab counts towards suggesting it.
+const (
+	friendScore     = 1   // per crab you follow who follows them
+	sharedLikeScore = 0.5 // per molt you both liked
+	newCrabScore    = 0.5 // once, for being new and followed
+)
+
+type SuggestionModel struct {
+	SVC ItemService
+}
+
+// Suggestion is a crab suggested to follow, with what the side panel shows
+// of them copied in so it can be drawn from one read.
+type Suggestion struct {
+	CrabID   string  `dynamodbav:"crab_id"`
+	UserName string  `dynamodbav:"user_name"`
+	Display  string  `dynamodbav:"display"`
+	Avatar   string  `dynamodbav:"avatar"`
+	Reason   string  `dynamodbav:"reason"`
+	Score    float64 `dynamodbav:"score"`
+}
+
+// Suggestions are the crabs suggested to one crab, best first, as Fill
+// last worked them out.
+type Suggestions struct {
+	PK      string       `dynamodbav:"PK"` // SG#crabID
+	SK      string       `dynamodbav:"SK"` // SG#crabID
+	Updated string       `dynamodbav:"updated"`
+	Crabs   []Suggestion `dynamodbav:"crabs"`
+}
+
+// Fill works out the suggestions for every crab and saves them, returning
+// how many crabs it did. Each crab costs a few dozen queries, so it is run
+// in the background every so often rather than when the panel is drawn.
+func (m SuggestionModel) Fill(ctx context.Context) (int, error) {
+	crabs := make(map[string]*Crab)
+	all := make([]*Crab, 0)
+	cursor := ""
+	for {
+		page, next, err := CrabModel{SVC: m.SVC}.Show(ctx, cursor)
+		if err != nil {
+			return 0, err
+		}
+		for i := range page {
+			crabs[page[i].ID] = &page[i]
+			all = append(all, &page[i])
+		}
+		if next == "" {
+			break
+		}
+		cursor = next
+	}
+	fresh := newCrabs(all, time.Now())
+
+	n := 0
+	for _, c := range all {
+		if !suggestable(c) {
+			continue
+		}
+		suggested, err := m.suggest(ctx, c, crabs, fresh)
+		if err != nil {
+			return n, err
+		}
+		item, err := attributevalue.MarshalMap(&Suggestions{
+			PK:      "SG#" + c.ID,
+			SK:      "SG#" + c.ID,
+			Updated: time.Now().UTC().Format(time.RFC3339),
+			Crabs:   suggested,
+		})
+		if err != nil {
+			return n, fmt.Errorf("MarshalMap: %w", err)
+		}
+		_, err = m.SVC.ItemTable.PutItem(ctx, &dynamodb.PutItemInput{
+			TableName: aws.String(TableName),
+			Item:      item,
+		})
+		if err != nil {
+			return n, fmt.Errorf("PutItem: %w", err)
+		}
+		n++
+	}
+	return n, nil
+}
+
+// suggestable reports whether c can be suggested, or suggested to.
+func suggestable(c *Crab) bool {
+	return c.Activated && !c.Banned && !c.Deleted
+}
+
+// newCrabs are the crabs that joined within newCrabAge of now and already
+// have followers, most followed first.
+func newCrabs(all []*Crab, now time.Time) []*Crab {
+	fresh := make([]*Crab, 0)
+	for _, c := range all {
+		joined, err := time.Parse(time.RFC3339, c.Created)
+		if err != nil || now.Sub(joined) > newCrabAge || c.FollowerCount == 0 || !suggestable(c) {
+			continue
+		}
+		fresh = append(fresh, c)
+	}
+	sort.SliceStable(fresh, func(i, j int) bool {
+		return fresh[i].FollowerCount > fresh[j].FollowerCount
+	})
+	if len(fresh) > SuggestionSize {
+		fresh = fresh[:SuggestionSize]
+	}
+	return fresh
+}
+
+// suggest works out c's suggestions from the crabs followed by those c
+// follows, the crabs who liked the molts c liked, and fresh. Only the first
+// page of each is read, which is plenty to suggest from.
+func (m SuggestionModel) suggest(ctx context.Context, c *Crab, crabs map[string]*Crab, fresh []*Crab) ([]Suggestion, error) {
+	follows := FollowModel{SVC: m.SVC}
+	following := make(map[string]bool)
+	var firstPage []Follow
+	cursor := ""
+	for {
+		page, next, err := follows.Show(ctx, c.ID, cursor)
+		if err != nil {
+			return nil, err
+		}
+		if firstPage == nil {
+			firstPage = page
+		}
+		for _, f := range page {
+			following[f.FolloweeID()] = true
+		}
+		if next == "" {
+			break
+		}
+		cursor = next
+	}
+
+	scores := make(map[string]float64)
+	reasons := make(map[string]string)
+	add := func(id string, score float64, reason string) {
+		if id == c.ID || following[id] {
+			return
+		}
+		scores[id] += score
+		if reasons[id] == "" {
+			reasons[id] = reason
+		}
+	}
+	for _, f := range firstPage {
+		theirs, _, err := follows.Show(ctx, f.FolloweeID(), "")
+		if err != nil {
+			return nil, err
+		}
+		for _, t := range theirs {
+			add(t.FolloweeID(), friendScore, "Followed by crabs you follow")
+		}
+	}
+	liked, err := m.liked(ctx, c.ID)
+	if err != nil {
+		return nil, err
+	}
+	for _, moltID := range liked {
+		likes, _, err := LikesModel{SVC: m.SVC}.On(ctx, moltID, "")
+		if err != nil {
+			return nil, err
+		}
+		for _, l := range likes {
+			add(l.PK[2:], sharedLikeScore, "Likes what you like")
+		}
+	}
+	for _, f := range fresh {
+		add(f.ID, newCrabScore, "New to Krabber")
+	}
+
+	ids := make([]string, 0, len(scores))
+	for id := range scores {
+		if crabs[id] != nil && suggestable(crabs[id]) {
+			ids = append(ids, id)
+		}
+	}
+	sort.Slice(ids, func(i, j int) bool {
+		if scores[ids[i]] != scores[ids[j]] {
+			return scores[ids[i]] > scores[ids[j]]
+		}
+		return crabs[ids[i]].FollowerCount > crabs[ids[j]].FollowerCount
+	})
+
+	suggested := make([]Suggestion, 0, SuggestionSize)
+	for _, id := range ids {
+		if len(suggested) == SuggestionSize {
+			break
+		}
+		blocked, err := BlockModel{SVC: m.SVC}.Between(ctx, c.ID, id)
+		if err != nil {
+			return nil, err
+		}
+		if blocked {
+			continue
+		}
+		s := crabs[id]
+		suggested = append(suggested, Suggestion{
+			CrabID:   s.ID,
+			UserName: s.UserName,
+			Display:  s.Display,
+			Avatar:   s.AvatarAt(ListAvatar),
+			Reason:   reasons[id],
+			Score:    scores[id],
+		})
+	}
+	return suggested, nil
+}
+
+// liked returns the ids of the molts on the first page of crabID's likes.
+func (m SuggestionModel) liked(ctx context.Context, crabID string) ([]string, error) {
+	items, _, err := queryPage(ctx, m.SVC.ItemTable, &dynamodb.QueryInput{
+		TableName:              aws.String(TableName),
+		Limit:                  aws.Int32(PageSize),
+		KeyConditionExpression: aws.String("PK = :hashKey"),
+		ExpressionAttributeValues: map[string]types.AttributeValue{
+			":hashKey": &types.AttributeValueMemberS{Value: "L#" + crabID},
+		},
+	}, "")
+	if err != nil {
+		return nil, err
+	}
+	likes := make([]Like, 0)
+	err = attributevalue.UnmarshalListOfMaps(items, &likes)
+	if err != nil {
+		return nil, err
+	}
+	ids := make([]string, 0, len(likes))
+	for _, l := range likes {
+		ids = append(ids, l.SK[2:])
+	}
+	return ids, nil
+}
+
+// For returns up to n of the crabs suggested to crabID. Crabs followed or
+// blocked since the suggestions were worked out are left out, checked in
+// one batch. It is empty until Fill has run.
+func (m SuggestionModel) For(ctx context.Context, crabID string, n int) ([]Suggestion, error) {
+	out, err := m.SVC.ItemTable.GetItem(ctx, &dynamodb.GetItemInput{
+		TableName: aws.String(TableName),
+		Key: map[string]types.AttributeValue{
+			"PK": &types.AttributeValueMemberS{Value: "SG#" + crabID},
+			"SK": &types.AttributeValueMemberS{Value: "SG#" + crabID},
+		},
+	})
+	if err != nil {
+		return nil, fmt.Errorf("GetItem: %w", err)
+	}
+	s := &Suggestions{}
+	err = attributevalue.UnmarshalMap(out.Item, s)
+	if err != nil {
+		return nil, fmt.Errorf("UnmarshalMap: %w", err)
+	}
+	if len(s.Crabs) == 0 {
+		return []Suggestion{}, nil
+	}
+
+	key := func(pk, sk string) map[string]types.AttributeValue {
+		return map[string]types.AttributeValue{
+			"PK": &types.AttributeValueMemberS{Value: pk},
+			"SK": &types.AttributeValueMemberS{Value: sk},
+		}
+	}
+	keys := make([]map[string]types.AttributeValue, 0, 3*len(s.Crabs))
+	for _, c := range s.Crabs {
+		keys = append(keys,
+			key("F#"+crabID, "F#"+c.CrabID),
+			key("B#"+crabID, "B#"+c.CrabID),
+			key("B#"+c.CrabID, "B#"+crabID))
+	}
+	items, err := batchGet(ctx, m.SVC.ItemTable, keys)
+	if err != nil {
+		return nil, err
+	}
+	gone := make(map[string]bool, len(items))
+	for _, item := range items {
+		pk, _ := item["PK"].(*types.AttributeValueMemberS)
+		sk, _ := item["SK"].(*types.AttributeValueMemberS)
+		if pk == nil || sk == nil {
+			continue
+		}
+		// whichever side of the pair isn't crabID is the suggestion
+		if pk.Value[2:] == crabID {
+			gone[sk.Value[2:]] = true
+		} else {
+			gone[pk.Value[2:]] = true
+		}
+	}
+	suggested := make([]Suggestion, 0, n)
+	for _, c := range s.Crabs {
+		if len(suggested) == n {
+			break
+		}
+		if !gone[c.CrabID] {
+			suggested = append(suggested, c)
+		}
+	}
+	return suggested, nil
+}
@@ -0,0 +1,333 @@
+package models
+
+import (
+	"context"
+	"fmt"
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/feature/dynamodb/attributevalue"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+	"math/rand"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+	"unicode/utf8"
+)
+
+const (
+	// maxTags caps how many crabtags one molt is filed under.
+	maxTags = 10
+	// TrendingWindow is how far back trending looks.
+	TrendingWindow = 24 * time.Hour
+	// TrendingSize is how many crabtags the trending panel shows.
+	TrendingSize = 10
+	// tagHour is the layout of the hour buckets trending reads.
+	tagHour = "2006-01-02T15"
+)
+
+// tagRX finds the #crabtags in a molt.
+var tagRX = regexp.MustCompile(`#([\p{L}\p{N}_]+)`)
+
+type TagModel struct {
+	SVC ItemService
+}
+
+// Tag files a molt under one of its crabtags. Tags are keyed by tag and
+// time so a tag's timeline reads newest first; GSI10 buckets them by the hour
+// they were posted in so trending only reads the window it scores.
+type Tag struct {
+	PK      string `dynamodbav:"PK"`      // T#tag
+	SK      string `dynamodbav:"SK"`      // T#created#moltID
+	GSI10PK string `dynamodbav:"GSI10PK"` // TH#hour
+	GSI10SK string `dynamodbav:"GSI10SK"` // T#tag#moltID
+	Tag     string `dynamodbav:"tag"`
+	MoltID  string `dynamodbav:"molt_id"`
+	Created string `dynamodbav:"created"`
+	// MoltPK and MoltSK are the molt's own key, so a page of tags can be
+	// read in one batch. Tags filed before they were kept don't have them.
+	MoltPK string `dynamodbav:"molt_pk,omitempty"`
+	MoltSK string `dynamodbav:"molt_sk,omitempty"`
+}
+
+// Trend is a crabtag on the trending panel.
+type Trend struct {
+	Tag   string  `dynamodbav:"tag"`
+	Molts int     `dynamodbav:"molts"`
+	Likes int     `dynamodbav:"likes"`
+	Score float64 `dynamodbav:"score"`
+}
+
+type TrendingCache struct {
+	PK      string  `dynamodbav:"PK"`
+	SK      string  `dynamodbav:"SK"`
+	Updated string  `dynamodbav:"updated"`
+	Trends  []Trend `dynamodbav:"trends"`
+}
+
+// Crabtags returns the lower case crabtags in content, without the #, in the
+// order they first appear.
+func Crabtags(content string) []string {
+	seen := map[string]bool{}
+	tags := make([]string, 0)
+	for _, m := range tagRX.FindAllStringSubmatch(content, -1) {
+		tag := strings.ToLower(m[1])
+		if seen[tag] || utf8.RuneCountInString(tag) > maxTermLength {
+			continue
+		}
+		seen[tag] = true
+		tags = append(tags, tag)
+		if len(tags) == maxTags {
+			break
+		}
+	}
+	return tags
+}
+
+// tagPuts returns the puts that file molt under each of tags, for the
+// transaction that inserts or edits it.
+func tagPuts(molt *Molt, tags []string, now time.Time) ([]types.TransactWriteItem, error) {
+	created := now.UTC().Format(time.RFC3339)
+	hour := now.UTC().Format(tagHour)
+	puts := make([]types.TransactWriteItem, 0)
+	for _, tag := range tags {
+		item, err := attributevalue.MarshalMap(&Tag{
+			PK:      fmt.Sprintf("T#%s", tag),
+			SK:      fmt.Sprintf("T#%s#%s", created, molt.ID),
+			GSI10PK: fmt.Sprintf("TH#%s", hour),
+			GSI10SK: fmt.Sprintf("T#%s#%s", tag, molt.ID),
+			Tag:     tag,
+			MoltID:  molt.ID,
+			Created: created,
+			MoltPK:  molt.PK,
+			MoltSK:  molt.SK,
+		})
+		if err != nil {
+			return nil, fmt.Errorf("MarshalMap: %w", err)
+		}
+		puts = append(puts, types.TransactWriteItem{
+			Put: &types.Put{
+				Item:      item,
+				TableName: aws.String(TableName),
+			},
+		})
+	}
+	return puts, nil
+}
+
+// tagsMissing returns the tags in a that aren't in b.
+func tagsMissing(a, b []string) []string {
+	in := map[string]bool{}
+	for _, t := range b {
+		in[t] = true
+	}
+	missing := make([]string, 0)
+	for _, t := range a {
+		if !in[t] {
+			missing = append(missing, t)
+		}
+	}
+	return missing
+}
+
+// tagDeletes returns the deletes that take molt out from under tags, for the
+// transaction that edits it. Tags are keyed by when they were filed, which
+// is looked for in the minute either side of the molt's own time.
+func tagDeletes(ctx context.Context, svc ItemService, molt *Molt, tags []string) ([]types.TransactWriteItem, error) {
+	t := moltTime(*molt).UTC()
+	deletes := make([]types.TransactWriteItem, 0)
+	for _, tag := range tags {
+		items, err := svc.ItemTable.Query(ctx, &dynamodb.QueryInput{
+			TableName:              aws.String(TableName),
+			KeyConditionExpression: aws.String("PK = :pk AND SK BETWEEN :from AND :to"),
+			FilterExpression:       aws.String("molt_id = :id"),
+			ExpressionAttributeValues: map[string]types.AttributeValue{
+				":pk":   &types.AttributeValueMemberS{Value: fmt.Sprintf("T#%s", tag)},
+				":from": &types.AttributeValueMemberS{Value: "T#" + t.Add(-time.Minute).Format(time.RFC3339)},
+				":to":   &types.AttributeValueMemberS{Value: "T#" + t.Add(time.Minute+time.Second).Format(time.RFC3339)},
+				":id":   &types.AttributeValueMemberS{Value: molt.ID},
+			},
+		})
+		if err != nil {
+			return nil, fmt.Errorf("Query: %w", err)
+		}
+		var filed []Tag
+		err = attributevalue.UnmarshalListOfMaps(items.Items, &filed)
+		if err != nil {
+			return nil, fmt.Errorf("UnmarshalListOfMaps: %w", err)
+		}
+		for _, f := range filed {
+			deletes = append(deletes, types.TransactWriteItem{
+				Delete: &types.Delete{
+					Key: map[string]types.AttributeValue{
+						"PK": &types.AttributeValueMemberS{Value: f.PK},
+						"SK": &types.AttributeValueMemberS{Value: f.SK},
+					},
+					TableName: aws.String(TableName),
+				},
+			})
+		}
+	}
+	return deletes, nil
+}
+
+// Timeline returns a page of the tags filing molts under tag, newest first.
+// The molts themselves are loaded with Hydrator.TagMolts.
+func (m TagModel) Timeline(ctx context.Context, tag, cursor string) ([]Tag, string, error) {
+	tag = strings.ToLower(strings.TrimPrefix(tag, "#"))
+	items, next, err := queryPage(ctx, m.SVC.ItemTable, &dynamodb.QueryInput{
+		TableName:              aws.String(TableName),
+		KeyConditionExpression: aws.String("PK = :pk"),
+		ExpressionAttributeValues: map[string]types.AttributeValue{
+			":pk": &types.AttributeValueMemberS{Value: fmt.Sprintf("T#%s", tag)},
+		},
+		ScanIndexForward: aws.Bool(false),
+	}, cursor)
+	if err != nil {
+		return nil, "", fmt.Errorf("Query: %w", err)
+	}
+	var tags []Tag
+	err = attributevalue.UnmarshalListOfMaps(items, &tags)
+	if err != nil {
+		return nil, "", fmt.Errorf("UnmarshalListOfMaps: %w", err)
+	}
+	return tags, next, nil
+}
+
+// recent returns every tag posted in the TrendingWindow before now.
+func (m TagModel) recent(ctx context.Context, now time.Time) ([]Tag, error) {
+	var tags []Tag
+	for h := now.UTC().Truncate(time.Hour); now.Sub(h) < TrendingWindow; h = h.Add(-time.Hour) {
+		p := dynamodb.NewQueryPaginator(m.SVC.ItemTable, &dynamodb.QueryInput{
+			TableName:              aws.String(TableName),
+			IndexName:              aws.String("GSI10"),
+			KeyConditionExpression: aws.String("GSI10PK = :hashKey"),
+			ExpressionAttributeValues: map[string]types.AttributeValue{
+				":hashKey": &types.AttributeValueMemberS{Value: fmt.Sprintf("TH#%s", h.Format(tagHour))},
+			},
+		})
+		for p.HasMorePages() {
+			out, err := p.NextPage(ctx)
+			if err != nil {
+				return nil, fmt.Errorf("Query: %w", err)
+			}
+			var page []Tag
+			err = attributevalue.UnmarshalListOfMaps(out.Items, &page)
+			if err != nil {
+				return nil, fmt.Errorf("UnmarshalListOfMaps: %w", err)
+			}
+			tags = append(tags, page...)
+		}
+	}
+	return tags, nil
+}
+
+// trends scores the crabtags used in the TrendingWindow. Each molt counts
+// for one and each like it got for half, and the older the molt the less it
+// adds, down to nothing at the edge of the window.
+func (m TagModel) trends(ctx context.Context, now time.Time) ([]Trend, error) {
+	tags, err := m.recent(ctx, now)
+	if err != nil {
+		return nil, err
+	}
+	// deleted molts keep their tags but don't count towards trending
+	molts, err := NewHydrator(m.SVC, "").TagMolts(ctx, tags)
+	if err != nil {
+		return nil, err
+	}
+	likes := make(map[string]int, len(molts))
+	for _, molt := range molts {
+		likes[molt.ID] = molt.LikeCount
+	}
+	byTag := map[string]*Trend{}
+	for _, t := range tags {
+		n, ok := likes[t.MoltID]
+		if !ok {
+			continue
+		}
+		created, err := time.Parse(time.RFC3339, t.Created)
+		if err != nil {
+			continue
+		}
+		fresh := 1 - now.Sub(created).Hours()/TrendingWindow.Hours()
+		if fresh <= 0 {
+			continue
+		}
+		trend, ok := byTag[t.Tag]
+		if !ok {
+			trend = &Trend{Tag: t.Tag}
+			byTag[t.Tag] = trend
+		}
+		trend.Molts++
+		trend.Likes += n
+		trend.Score += (1 + float64(n)/2) * fresh
+	}
+	trends := make([]Trend, 0, len(byTag))
+	for _, trend := range byTag {
+		trends = append(trends, *trend)
+	}
+	sort.Slice(trends, func(i, j int) bool {
+		if trends[i].Score != trends[j].Score {
+			return trends[i].Score > trends[j].Score
+		}
+		return trends[i].Tag < trends[j].Tag
+	})
+	if len(trends) > TrendingSize {
+		trends = trends[:TrendingSize]
+	}
+	return trends, nil
+}
+
+// FillTrending works out what is trending and caches it in every shard, the
+// same way FillSea caches the latest molts.
+func (m TagModel) FillTrending(ctx context.Context) ([]Trend, error) {
+	now := time.Now()
+	trends, err := m.trends(ctx, now)
+	if err != nil {
+		return nil, err
+	}
+	for i := 0; i < ShardSize; i++ {
+		item, err := attributevalue.MarshalMap(&TrendingCache{
+			PK:      fmt.Sprintf("TT#%d", i),
+			SK:      fmt.Sprintf("TT#%d", i),
+			Updated: now.UTC().Format(time.RFC3339),
+			Trends:  trends,
+		})
+		if err != nil {
+			return nil, fmt.Errorf("MarshalMap: %w", err)
+		}
+		_, err = m.SVC.ItemTable.PutItem(ctx, &dynamodb.PutItemInput{
+			TableName: aws.String(TableName),
+			Item:      item,
+		})
+		if err != nil {
+			return nil, fmt.Errorf("PutItem: %w", err)
+		}
+	}
+	return trends, nil
+}
+
+// Trending reads the cached trending crabtags from a random shard. It is
+// empty until FillTrending has run.
+func (m TagModel) Trending(ctx context.Context) ([]Trend, error) {
+	shard := rand.Intn(ShardSize)
+	out, err := m.SVC.ItemTable.GetItem(ctx, &dynamodb.GetItemInput{
+		TableName: aws.String(TableName),
+		Key: map[string]types.AttributeValue{
+			"PK": &types.AttributeValueMemberS{Value: fmt.Sprintf("TT#%d", shard)},
+			"SK": &types.AttributeValueMemberS{Value: fmt.Sprintf("TT#%d", shard)},
+		},
+	})
+	if err != nil {
+		return nil, fmt.Errorf("GetItem: %w", err)
+	}
+	c := &TrendingCache{}
+	err = attributevalue.UnmarshalMap(out.Item, c)
+	if err != nil {
+		return nil, fmt.Errorf("UnmarshalMap: %w", err)
+	}
+	if c.Trends == nil {
+		return []Trend{}, nil
+	}
+	return c.Trends, nil
+}
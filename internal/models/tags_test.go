@@ -0,0 +1,110 @@
+package models
+
+import (
+	"context"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/feature/dynamodb/attributevalue"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+	"github.com/google/uuid"
+	"krabber.net/internal/models/ksuid"
+	"krabber.net/internal/models/memdb"
+)
+
+// TestTagMolts files molts under a crabtag, one of them the way tags were
+// filed before they kept the molt's key, and checks the timeline and
+// trending both find the ones that haven't been deleted.
+func TestTagMolts(t *testing.T) {
+	ctx := context.Background()
+	svc := ItemService{ItemTable: memdb.New()}
+	c, err := CrabModel{SVC: svc}.Insert(ctx, &Crab{Email: "tagger@example.com", UserName: "tagger"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	molts := MoltModel{SVC: svc}
+	post := func(content string) *Molt {
+		t.Helper()
+		id := uuid.New().String()
+		molt := &Molt{
+			ID:      id,
+			PK:      "M#" + c.ID,
+			SK:      fmt.Sprintf("M#%s#%s", c.ID, ksuid.GenerateKSUID()),
+			GSI5PK:  "M#" + id,
+			GSI5SK:  "M#" + id,
+			Author:  c.ID,
+			Content: content,
+		}
+		if err := molts.Insert(ctx, molt); err != nil {
+			t.Fatal(err)
+		}
+		return molt
+	}
+	liked := post("#krab one")
+	kept := post("#krab two")
+	gone := post("#krab three")
+	old := post("four")
+	if err := (LikesModel{SVC: svc}).Insert(ctx, c.ID, liked); err != nil {
+		t.Fatal(err)
+	}
+	if err := molts.Delete(ctx, gone); err != nil {
+		t.Fatal(err)
+	}
+	now := time.Now()
+	item, err := attributevalue.MarshalMap(&Tag{
+		PK:      "T#krab",
+		SK:      fmt.Sprintf("T#%s#%s", now.UTC().Format(time.RFC3339), old.ID),
+		GSI10PK: fmt.Sprintf("TH#%s", now.UTC().Format(tagHour)),
+		GSI10SK: fmt.Sprintf("T#krab#%s", old.ID),
+		Tag:     "krab",
+		MoltID:  old.ID,
+		Created: now.UTC().Format(time.RFC3339),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = svc.ItemTable.PutItem(ctx, &dynamodb.PutItemInput{TableName: aws.String(TableName), Item: item})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tags, _, err := TagModel{SVC: svc}.Timeline(ctx, "#Krab", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(tags) != 4 {
+		t.Fatalf("got %d tags, want 4", len(tags))
+	}
+	for _, tag := range tags {
+		if tag.MoltID != old.ID && tag.MoltPK == "" {
+			t.Errorf("tag for %s has no molt key", tag.MoltID)
+		}
+	}
+	page, err := NewHydrator(svc, c.ID).TagMolts(ctx, tags)
+	if err != nil {
+		t.Fatal(err)
+	}
+	got := map[string]bool{}
+	for _, molt := range page {
+		got[molt.ID] = true
+	}
+	want := map[string]bool{liked.ID: true, kept.ID: true, old.ID: true}
+	if len(got) != len(want) || len(page) != len(want) {
+		t.Fatalf("got molts %v, want %v", got, want)
+	}
+	for id := range want {
+		if !got[id] {
+			t.Errorf("molt %s missing from the timeline", id)
+		}
+	}
+
+	trends, err := TagModel{SVC: svc}.trends(ctx, now.Add(time.Minute))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(trends) != 1 || trends[0].Tag != "krab" || trends[0].Molts != 3 || trends[0].Likes != 1 {
+		t.Fatalf("got trends %+v, want krab with 3 molts and 1 like", trends)
+	}
+}
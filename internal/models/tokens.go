@@ -10,6 +10,7 @@ import (
 	"github.com/aws/aws-sdk-go-v2/aws"
 	"github.com/aws/aws-sdk-go-v2/feature/dynamodb/attributevalue"
 	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
 	"krabber.net/internal/models/validator"
 	"time"
 )
@@ -19,6 +20,7 @@ const (
 	ScopeActivation     = "ACTIVATION"
 	ScopeAuthentication = "AUTHENTICATION"
 	ScopePasswordReset  = "PASSWORD-RESET"
+	ScopeEmailChange    = "EMAIL-CHANGE"
 )
 
 // Define a Token struct to hold the data for an individual token. This includes the
@@ -27,14 +29,17 @@ const (
 type Token struct {
 	PK           string `dynamodbav:"PK"`
 	SK           string `dynamodbav:"SK"`
+	GSI8PK       string `dynamodbav:"GSI8PK"` // CT#crabID so a crab's tokens can be found without the plaintext
+	GSI8SK       string `dynamodbav:"GSI8SK"` // CT#scope#createdAt
 	Plaintext    string `dynamodbav:"plaintext"`
 	ByteHash     []byte `dynamodbav:"byte_hash"`
 	CrabID       string `dynamodbav:"crab_id"`
 	CrabEmail    string `dynamodbav:"crab_email"`
 	CrabUserName string `dynamodbav:"crab_username"`
+	NewEmail     string `dynamodbav:"new_email,omitempty"` // the address an EMAIL-CHANGE token confirms
 	CreatedAt    string `dynamodbav:"created_at"`
 	ExpiresAt    string `dynamodbav:"expires_at"`
-	TTL          string `dynamodbav:"ttl"`
+	TTL          Expiry `dynamodbav:"ttl"`
 	Scope        string `dynamodbav:"scope"`
 }
 
@@ -48,14 +53,17 @@ type TokenModel struct {
 	SVC ItemService
 }
 
-func (m TokenModel) Insert(token *Token) error {
+func (m TokenModel) Insert(ctx context.Context, token *Token) error {
 	t := &Token{
 		PK:           fmt.Sprintf("CT#%s", token.ByteHash),
 		SK:           fmt.Sprintf("CT#%sTYPE#%s", token.ByteHash, token.Scope),
+		GSI8PK:       fmt.Sprintf("CT#%s", token.CrabID),
+		GSI8SK:       fmt.Sprintf("CT#%s#%s", token.Scope, token.CreatedAt),
 		Plaintext:    token.Plaintext,
 		CrabID:       token.CrabID,
 		CrabEmail:    token.CrabEmail,
 		CrabUserName: token.CrabUserName,
+		NewEmail:     token.NewEmail,
 		CreatedAt:    token.CreatedAt,
 		ExpiresAt:    token.ExpiresAt,
 		TTL:          token.TTL,
@@ -64,76 +72,130 @@ func (m TokenModel) Insert(token *Token) error {
 
 	item, err := attributevalue.MarshalMap(t)
 	if err != nil {
-		panic(err)
+		return fmt.Errorf("MarshalMap: %w", err)
 	}
 
-	_, err = m.SVC.ItemTable.PutItem(context.TODO(), &dynamodb.PutItemInput{
+	_, err = m.SVC.ItemTable.PutItem(ctx, &dynamodb.PutItemInput{
 		TableName:           aws.String(TableName),
 		Item:                item,
 		ConditionExpression: aws.String("attribute_not_exists(plaintext)"),
 	})
 	if err != nil {
-		fmt.Printf("\n Insert Token ERROR : %v", err)
-		return err
+		return fmt.Errorf("PutItem: %w", conflict(err))
 	}
 	return nil
 }
 
-func (m TokenModel) New(c *Crab, activation string) (*Token, error) {
+func (m TokenModel) New(ctx context.Context, c *Crab, activation string) (*Token, error) {
 	token, err := generateToken(c, activation)
 	if err != nil {
 		return nil, err
 	}
-	err = m.Insert(token)
+	err = m.Insert(ctx, token)
 	return token, err
 }
 
-func (m TokenModel) Get(tokenScope, tokenPlaintext string) (*Token, error) {
+// NewEmailChange creates the token that confirms a crab owns the email they
+// want to change to.
+func (m TokenModel) NewEmailChange(ctx context.Context, c *Crab, email string) (*Token, error) {
+	token, err := generateToken(c, ScopeEmailChange)
+	if err != nil {
+		return nil, err
+	}
+	token.NewEmail = email
+	err = m.Insert(ctx, token)
+	return token, err
+}
+
+func (m TokenModel) Get(ctx context.Context, tokenScope, tokenPlaintext string) (*Token, error) {
 	// Calculate the SHA-256 hash of the plaintext token provided by the client.
 	// Remember that this returns a byte *array* with length 32, not a slice.
 	tokenHash := sha256.Sum256([]byte(tokenPlaintext))
-	t := &Token{}
-	fmt.Printf("CT HASH: %v", tokenHash)
-	selectedKeys := map[string]string{
-		"PK": fmt.Sprintf("CT#%s", tokenHash),
-		"SK": fmt.Sprintf("CT#%sTYPE#%s", tokenHash, tokenScope),
-	}
-	key, err := attributevalue.MarshalMap(selectedKeys)
-	data, err := m.SVC.ItemTable.GetItem(context.TODO(), &dynamodb.GetItemInput{
+	data, err := m.SVC.ItemTable.GetItem(ctx, &dynamodb.GetItemInput{
 		TableName: aws.String(TableName),
-		Key:       key,
+		Key: map[string]types.AttributeValue{
+			"PK": &types.AttributeValueMemberS{Value: fmt.Sprintf("CT#%s", tokenHash)},
+			"SK": &types.AttributeValueMemberS{Value: fmt.Sprintf("CT#%sTYPE#%s", tokenHash, tokenScope)},
+		},
 	})
 	if err != nil {
-		return t, fmt.Errorf("GetItem: %v\n", err)
+		return nil, fmt.Errorf("GetItem: %w", err)
 	}
-
 	if data.Item == nil {
-		return t, fmt.Errorf("GetItem: Data not found.\n")
+		return nil, ErrRecordNotFound
 	}
-	err = attributevalue.UnmarshalMap(data.Item, &t)
+	t := &Token{}
+	err = attributevalue.UnmarshalMap(data.Item, t)
 	if err != nil {
-		return t, fmt.Errorf("UnmarshalMap: %v\n", err)
+		return nil, fmt.Errorf("UnmarshalMap: %w", err)
+	}
+	// the table's TTL can take a while to remove the item, so check the expiry too
+	expiresAt, err := time.Parse(time.RFC3339, t.ExpiresAt)
+	if err != nil || time.Now().After(expiresAt) {
+		return nil, ErrRecordNotFound
 	}
-	//fmt.Println("pretty get token", prettyPrint(t))
-
 	return t, nil
 }
 
+// DeleteAllForCrab deletes every token of the given scope that belongs to a crab,
+// so that once one of them is used the rest can't be.
+func (m TokenModel) DeleteAllForCrab(ctx context.Context, scope, crabID string) error {
+	cursor := ""
+	for {
+		items, next, err := queryPage(ctx, m.SVC.ItemTable, &dynamodb.QueryInput{
+			TableName:              aws.String(TableName),
+			IndexName:              aws.String("GSI8"),
+			KeyConditionExpression: aws.String("GSI8PK = :gsi8pk AND begins_with(GSI8SK, :scope)"),
+			ExpressionAttributeValues: map[string]types.AttributeValue{
+				":gsi8pk": &types.AttributeValueMemberS{Value: fmt.Sprintf("CT#%s", crabID)},
+				":scope":  &types.AttributeValueMemberS{Value: fmt.Sprintf("CT#%s#", scope)},
+			},
+		}, cursor)
+		if err != nil {
+			return err
+		}
+		for _, item := range items {
+			_, err := m.SVC.ItemTable.DeleteItem(ctx, &dynamodb.DeleteItemInput{
+				TableName: aws.String(TableName),
+				Key: map[string]types.AttributeValue{
+					"PK": item["PK"],
+					"SK": item["SK"],
+				},
+			})
+			if err != nil {
+				return fmt.Errorf("DeleteItem: %w", err)
+			}
+		}
+		if next == "" {
+			return nil
+		}
+		cursor = next
+	}
+}
+
 func prettyPrint(i interface{}) string {
 	s, _ := json.MarshalIndent(i, "", "\t")
 	return string(s)
 }
 
+// tokenLifetime is how long a token of the given scope stays valid.
+func tokenLifetime(scope string) time.Duration {
+	if scope == ScopePasswordReset {
+		return 45 * time.Minute
+	}
+	return time.Hour * 24 * 3
+}
+
 func generateToken(c *Crab, scope string) (*Token, error) {
-	expiresAt := time.Now().Add(time.Hour * 24 * 3).Format(time.RFC3339)
-	createdAt := time.Now().Format(time.RFC3339)
+	now := time.Now()
+	expiry := now.Add(tokenLifetime(scope))
 	token := &Token{
 		CrabID:       c.ID,
 		CrabEmail:    c.Email,
 		CrabUserName: c.UserName,
-		CreatedAt:    createdAt,
-		ExpiresAt:    expiresAt,
-		TTL:          fmt.Sprintf("%d", time.Now().Add(time.Hour*24*3).Unix()),
+		CreatedAt:    now.Format(time.RFC3339),
+		ExpiresAt:    expiry.Format(time.RFC3339),
+		TTL:          Expiry(expiry.Unix()),
 		Scope:        scope,
 	}
 
@@ -156,15 +218,3 @@ func ValidateTokenPlaintext(v *validator.Validator, tokenPlaintext string) {
 	v.Check(len(tokenPlaintext) == 26, "token", "must be 26 bytes long")
 }
 
-// DeleteAllForUser() deletes all tokens for a specific user and scope.
-//func (m TokenModel) DeleteAllActivation(scope string, userID int64) error {
-//	query := `
-//       DELETE FROM tokens
-//       WHERE scope = $1 AND user_id = $2`
-//
-//	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
-//	defer cancel()
-//
-//	_, err := m.DB.ExecContext(ctx, query, scope, userID)
-//	return err
-//}
@@ -7,102 +7,187 @@ import (
 	"github.com/aws/aws-sdk-go-v2/feature/dynamodb/attributevalue"
 	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
 	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+	"strconv"
+	"time"
 )
 
 type TrenchModel struct {
 	SVC ItemService
+	// CelebrityFollowers is how many followers make a crab a celebrity,
+	// whose molts are read into trenches instead of written to them. Zero
+	// writes every crab's.
+	CelebrityFollowers int
 }
 
-// For the Id of the crab get the followers -> maybe once crab authenticates call the trench method...?
-// then for each follower POST to their Trench -> each time I molt -> post to my followers
-// type trench struct {
-// PK: T%s, OtherCrabID
-// SK: T%s, MyMoltID
-// Fanned: false
-// }
-// Naive algorithm for a hobby project
-// do POST /v1/trench with my special key
-// returns all of my molts that haven't been fanned out
-// then for each one do fan out -> write to each of my followers trench
-// update the molt to fanned:true when done
+// TrenchTTL is how long a molt stays in trenches after it was posted.
+// Older entries expire so trench partitions don't grow for ever.
+const TrenchTTL = 30 * 24 * time.Hour
+
+// Trench is an entry in a crab's home feed, pointing at a molt by one of
+// the crabs they follow. Entries are written by the fan-out jobs in
+// fanout.go, which mark the molt fanned once every follower has it, and
+// by Backfill when a crab follows someone.
 type Trench struct {
 	PK string `dynamodbav:"PK"` // PK: T%s, OtherCrabID
 	SK string `dynamodbav:"SK"` // //SK: T%s, MyMoltID
+	// MoltPK and MoltSK are the molt's own key, so a page of entries can be
+	// read back in one batch. Entries from before they were kept lack them.
+	MoltPK string `dynamodbav:"molt_pk,omitempty"`
+	MoltSK string `dynamodbav:"molt_sk,omitempty"`
+	// TTL is when the entry expires, in unix seconds. It is a number,
+	// unlike the notifications', because DynamoDB only expires numbers.
+	TTL int64 `dynamodbav:"ttl,omitempty"`
+}
+
+// trenchPut writes molt into crabID's trench, to expire TrenchTTL after
+// the molt was posted.
+func trenchPut(crabID string, molt *Molt) (types.WriteRequest, error) {
+	posted, err := molt.Created()
+	if err != nil {
+		posted = time.Now()
+	}
+	item, err := attributevalue.MarshalMap(
+		&Trench{
+			PK:     fmt.Sprintf("T#%s", crabID), // one crab will have many -> sort by the SK
+			SK:     fmt.Sprintf("T#%s", molt.ID),
+			MoltPK: molt.PK,
+			MoltSK: molt.SK,
+			TTL:    posted.Add(TrenchTTL).Unix(),
+		})
+	if err != nil {
+		return types.WriteRequest{}, fmt.Errorf("MarshalMap: %w", err)
+	}
+	return types.WriteRequest{PutRequest: &types.PutRequest{Item: item}}, nil
 }
 
-// called after a molt is successfully inserted
-func (m TrenchModel) Insert(crabs []Crab, molt *Molt) error {
-	for _, c := range crabs {
-		//fmt.Printf("%+v\n", c)
-		//fmt.Printf("follower %v", c.PK[2:])
-		item, err := attributevalue.MarshalMap(
-			&Trench{
-				PK: fmt.Sprintf("T#%s", c.PK[2:]), // one crab will have many -> sort by the SK
-				SK: fmt.Sprintf("T#%s", molt.ID),
-			})
+func trenchDelete(crabID, moltID string) types.WriteRequest {
+	return types.WriteRequest{
+		DeleteRequest: &types.DeleteRequest{
+			Key: map[string]types.AttributeValue{
+				"PK": &types.AttributeValueMemberS{Value: fmt.Sprintf("T#%s", crabID)},
+				"SK": &types.AttributeValueMemberS{Value: fmt.Sprintf("T#%s", moltID)},
+			},
+		},
+	}
+}
+
+// Insert puts molt in the trench of each follower in followers, 25 at a
+// time. Writing an entry that is already there changes nothing, so a
+// fan-out that is run again part way through does no harm.
+func (m TrenchModel) Insert(ctx context.Context, followers []Follow, molt *Molt) error {
+	requests := make([]types.WriteRequest, 0, len(followers))
+	for _, f := range followers {
+		put, err := trenchPut(f.FollowerID(), molt)
 		if err != nil {
-			fmt.Println("ERR: ", err)
-			panic(err)
+			return err
 		}
-		tItems := make([]types.TransactWriteItem, 0)
-		tw1 := types.TransactWriteItem{
-			Put: &types.Put{
-				Item:      item,
-				TableName: aws.String(TableName),
-			},
+		requests = append(requests, put)
+	}
+	return batchWrite(ctx, m.SVC.ItemTable, requests)
+}
+
+// Backfill puts followee's newest molts, a page of them, in the trench of
+// follower, who has just followed them. Remolts are left out as they are
+// from fan-out, see Before, and so is everything from a celebrity, whose
+// molts are read in anyway. Should follower have unfollowed while it ran,
+// what it wrote is taken back out.
+func (m TrenchModel) Backfill(ctx context.Context, follower, followee *Crab) error {
+	if m.celebrity(followee) {
+		return nil
+	}
+	molts, err := MoltModel{SVC: m.SVC}.Before(ctx, followee.ID, time.Time{}, time.Time{})
+	if err != nil {
+		return err
+	}
+	expired := time.Now().Add(-TrenchTTL)
+	requests := make([]types.WriteRequest, 0, len(molts))
+	for i := range molts {
+		if moltTime(molts[i]).Before(expired) {
+			continue
 		}
-		tItems = append(tItems, tw1)
-		// Worried about this part
-		_, err = m.SVC.ItemTable.TransactWriteItems(context.TODO(), &dynamodb.TransactWriteItemsInput{
-			TransactItems: tItems,
-		})
+		put, err := trenchPut(follower.ID, &molts[i])
 		if err != nil {
-			fmt.Printf("\nErr: %v", err)
 			return err
 		}
+		requests = append(requests, put)
+	}
+	err = batchWrite(ctx, m.SVC.ItemTable, requests)
+	if err != nil {
+		return err
+	}
+	following, err := FollowModel{SVC: m.SVC}.Exists(ctx, follower.ID, followee.ID)
+	if err != nil || following {
+		return err
 	}
-	return nil
+	return m.Purge(ctx, follower.ID, followee.ID)
 }
 
-// Show - Get the crab trench feed for current crab
-func (m TrenchModel) Get(id string) ([]Trench, error) {
-	p := dynamodb.NewQueryPaginator(m.SVC.ItemTable, &dynamodb.QueryInput{
+// Purge takes followee's molts out of the trench of follower, who has
+// unfollowed them. Only molts young enough to still be in trenches are
+// looked at.
+func (m TrenchModel) Purge(ctx context.Context, followerID, followeeID string) error {
+	expired := time.Now().Add(-TrenchTTL)
+	cursor := ""
+	for {
+		molts, next, err := MoltModel{SVC: m.SVC}.Show(ctx, followeeID, cursor)
+		if err != nil {
+			return err
+		}
+		requests := make([]types.WriteRequest, 0, len(molts))
+		old := false
+		for _, molt := range molts {
+			if moltTime(molt).Before(expired) {
+				old = true
+				continue
+			}
+			requests = append(requests, trenchDelete(followerID, molt.ID))
+		}
+		err = batchWrite(ctx, m.SVC.ItemTable, requests)
+		if err != nil {
+			return err
+		}
+		// molts are newest first, so past one that has expired they all have
+		if old || next == "" {
+			return nil
+		}
+		cursor = next
+	}
+}
+
+// Delete takes molt back out of the trenches of followers
+func (m TrenchModel) Delete(ctx context.Context, followers []Follow, molt *Molt) error {
+	requests := make([]types.WriteRequest, 0, len(followers))
+	for _, f := range followers {
+		requests = append(requests, trenchDelete(f.FollowerID(), molt.ID))
+	}
+	return batchWrite(ctx, m.SVC.ItemTable, requests)
+}
+
+// Show - Get a page of the crab trench feed for current crab
+func (m TrenchModel) Get(ctx context.Context, id, cursor string) ([]Trench, string, error) {
+	items, next, err := queryPage(ctx, m.SVC.ItemTable, &dynamodb.QueryInput{
 		TableName:              aws.String(TableName),
 		Limit:                  aws.Int32(PageSize),
 		KeyConditionExpression: aws.String("PK = :hashKey"),
+		// DynamoDB can take days to remove expired items, and the local
+		// backends never do
+		FilterExpression: aws.String("attribute_not_exists(#ttl) OR #ttl > :now"),
+		ExpressionAttributeNames: map[string]string{
+			"#ttl": "ttl",
+		},
 		ExpressionAttributeValues: map[string]types.AttributeValue{
 			":hashKey": &types.AttributeValueMemberS{Value: "T#" + id},
+			":now":     &types.AttributeValueMemberN{Value: strconv.FormatInt(time.Now().Unix(), 10)},
 		},
 		ScanIndexForward: aws.Bool(false),
-	})
-	trenches := make([]Trench, 0)
-	for p.HasMorePages() {
-		out, err := p.NextPage(context.TODO())
-		if err != nil {
-			fmt.Printf("ERR: %s", err)
-			panic(err)
-		}
-		var trench []Trench
-		err = attributevalue.UnmarshalListOfMaps(out.Items, &trench)
-		if err != nil {
-			fmt.Printf("ERR: %s", err)
-			panic(err)
-		}
-		trenches = append(trenches, trench...)
+	}, cursor)
+	if err != nil {
+		return nil, "", err
 	}
-	return trenches, nil
-}
-
-func (m MoltModel) GetTrenchMolts(trench []Trench) []Molt {
-	molts := make([]Molt, 0)
-	for _, t := range trench {
-		molt, err := m.ByID(t.SK[2:]) // delete the time stamp not needed in insert
-		if err != nil {
-			fmt.Printf("Error trench molts %s", err)
-		}
-		if molt != nil {
-			molts = append(molts, *molt)
-		}
+	trenches := make([]Trench, 0)
+	err = attributevalue.UnmarshalListOfMaps(items, &trenches)
+	if err != nil {
+		return nil, "", err
 	}
-	return molts
+	return trenches, next, nil
 }
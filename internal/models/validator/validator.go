@@ -1,6 +1,7 @@
 package validator
 
 import (
+	"net/url"
 	"regexp"
 	"strings"
 	"unicode/utf8"
@@ -25,6 +26,12 @@ func MinChars(value string, n int) bool {
 	return utf8.RuneCountInString(value) >= n
 }
 
+// URL() returns true if a value is an absolute http or https URL.
+func URL(value string) bool {
+	u, err := url.Parse(value)
+	return err == nil && (u.Scheme == "http" || u.Scheme == "https") && u.Host != ""
+}
+
 // Matches() returns true if a value matches a provided compiled regular
 // expression pattern.
 func Matches(value string, rx *regexp.Regexp) bool {
@@ -41,9 +48,7 @@ func (v *Validator) Check(ok bool, key, message string) {
 // AddError adds an error message to the map (so long as no entry already exists for
 // the given key).
 func (v *Validator) AddError(key, message string) {
-	//if _, exists := v.Errors[key]; !exists {
-	//	v.Errors[key] = message
-	//}
+	v.AddFieldError(key, message)
 }
 
 // Valid() returns true if the FieldErrors map doesn't contain any entries.
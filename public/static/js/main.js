@@ -43,51 +43,37 @@ function changeContent(el, newText) {
     $(el).text(newText);
 }
 
-function toggleLike(e) {
-    let empty_heart = $(e).children("svg")[0];
-    let filled_heart = $(e).children("svg")[1];
-    let counter = $(e).children("span").get(0);
-
-    let updateLikeCounter = function(amount) {
-        likesCounter = $(e).parents('.mini-molt').find('[data-target="#molt_likes_modal"]');
-        likesNum = parseInt(likesCounter.children('#likes-number').text());
-        likesNum += amount;
-        likesCounter.children('#likes-number').text(likesNum);
-        likesCounter.children('#likes-text').text((likesNum == 1) ? 'Like' : 'Likes');
-    };
-
-    // was liked, needs to be unliked
-    if (empty_heart.classList.contains("d-none")) {
-        $(empty_heart).removeClass("d-none");
-        $(filled_heart).addClass("d-none");
-        if (counter != undefined) {
-            $(counter).removeClass("text-primary");
-            counter.textContent = parseInt(counter.textContent) - 1;
-        } else {
-            updateLikeCounter(-1)
-        }
+// Send the CSRF token with every htmx request, so buttons swapped in by htmx
+// don't each need a hidden csrf_token field.
+document.addEventListener('htmx:configRequest', function (e) {
+    let token = $("meta[name='csrf-token']").attr("content");
+    if (token) {
+        e.detail.headers['X-CSRF-Token'] = token;
     }
-    // was unliked, needs to be liked
-    else {
-        // Rogen Out of Control
-        let moltId = $(e.parentElement)
-            .find('input[name=molt_id]')
-            .attr('value');
-        let moltContent = $(`meta#molt-content-${moltId}`).data('content');
-        if (moltContent.toLowerCase().match(/seth ?rogen/)) {
-            document.getElementById('rogen-out-of-control').play();
-        }
-
-        $(filled_heart).removeClass("d-none");
-        $(empty_heart).addClass("d-none");
-        if (counter != undefined) {
-            $(counter).addClass("text-primary");
-            counter.textContent = parseInt(counter.textContent) + 1;
-        } else {
-            updateLikeCounter(1)
-        }
+});
+
+// htmx leaves error responses alone. A molt form that didn't pass comes back
+// as a whole page retargeted at the body, so let that one through.
+document.addEventListener('htmx:beforeSwap', function (e) {
+    if (e.detail.xhr.status === 422 && e.detail.xhr.getResponseHeader('HX-Retarget')) {
+        e.detail.shouldSwap = true;
+        e.detail.isError = false;
     }
-}
+});
+
+// Rogen Out of Control: liking a molt about Seth Rogen plays him, on pages
+// that have the clip.
+document.addEventListener('htmx:beforeRequest', function (e) {
+    let form = e.detail.elt;
+    if (!form.matches || !form.matches('form[data-molt-content]')) {
+        return;
+    }
+    let liking = $(form).find('.like-button').attr('aria-pressed') !== 'true';
+    let clip = document.getElementById('rogen-out-of-control');
+    if (liking && clip && String(form.dataset.moltContent).toLowerCase().match(/seth ?rogen/)) {
+        clip.play();
+    }
+});
 
 function toggleFollow(e) {
     if (e.form.user_action.value == "unfollow") {